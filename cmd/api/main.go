@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"log"
+	"log/slog"
 
 	cfg "github.com/dwiw96/GoCommerceAPI/config"
 	factory "github.com/dwiw96/GoCommerceAPI/factory"
@@ -10,6 +11,9 @@ import (
 	rd "github.com/dwiw96/GoCommerceAPI/pkg/driver/redis"
 	server "github.com/dwiw96/GoCommerceAPI/server"
 
+	transactionsRepository "github.com/dwiw96/GoCommerceAPI/internal/features/transactions/repository"
+	transactionsWorker "github.com/dwiw96/GoCommerceAPI/internal/features/transactions/worker"
+
 	password "github.com/dwiw96/GoCommerceAPI/pkg/utils/password"
 )
 
@@ -25,11 +29,23 @@ func main() {
 	ctx := context.Background()
 	defer ctx.Done()
 
-	password.JwtInit(pgPool, ctx)
+	err := password.SetKeyEncryptionKey(env.JWT_KEY_ENCRYPTION_KEY)
+	if err != nil {
+		log.Fatal(err)
+	}
+	password.JwtInit(pgPool, ctx, env.JWT_SIGNING_ALGORITHM)
+
+	router := server.SetupRouter(env.TRUSTED_PROXIES)
 
-	router := server.SetupRouter()
+	factory.InitFactory(router, pgPool, rdClient, ctx, env)
 
-	factory.InitFactory(router, pgPool, rdClient, ctx)
+	reconciler := transactionsWorker.NewReconciler(
+		transactionsRepository.NewTransactionsRepository(pgPool, pgPool, ctx),
+		env.RECONCILER_INTERVAL,
+		env.RECONCILER_PENDING_AGE,
+		slog.Default(),
+	)
+	go reconciler.Start(ctx)
 
 	server.StartServer(env.SERVER_PORT, router)
 }
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	password "github.com/dwiw96/GoCommerceAPI/pkg/utils/password"
+	signer "github.com/dwiw96/GoCommerceAPI/pkg/utils/signer"
 	testUtils "github.com/dwiw96/GoCommerceAPI/testutils"
 )
 
@@ -15,7 +16,8 @@ func TestMain(m *testing.M) {
 	ctx := testUtils.GetContext()
 	defer ctx.Done()
 
-	password.JwtInit(pgPool, ctx)
+	testUtils.SetKeyEncryptionKey()
+	password.JwtInit(pgPool, ctx, signer.RS256)
 
 	os.Exit(m.Run())
 }
@@ -0,0 +1,51 @@
+// Command encryptkeys encrypts the token signing keys and the TOTP secrets
+// that are still stored in plain with the key encryption key from
+// JWT_KEY_ENCRYPTION_KEY, whatever the algorithm of the keys. RS256 keys are
+// stored in PKCS#1, ES256 and EdDSA keys in PKCS#8.
+// With -decrypt it stores them in plain again, which has to be done before
+// the migrations that added the encryption are rolled back.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	cfg "github.com/dwiw96/GoCommerceAPI/config"
+	pg "github.com/dwiw96/GoCommerceAPI/pkg/driver/postgresql"
+	password "github.com/dwiw96/GoCommerceAPI/pkg/utils/password"
+
+	authRepository "github.com/dwiw96/GoCommerceAPI/internal/features/auth/repository"
+)
+
+func main() {
+	decrypt := flag.Bool("decrypt", false, "store the keys in plain instead")
+	flag.Parse()
+
+	env := cfg.GetEnvConfig()
+	if err := password.SetKeyEncryptionKey(env.JWT_KEY_ENCRYPTION_KEY); err != nil {
+		log.Fatal(err)
+	}
+
+	pgPool := pg.ConnectToPg(env)
+	defer pgPool.Close()
+
+	ctx := context.Background()
+	repo := authRepository.NewAuthRepository(pgPool, pgPool)
+
+	count, err := repo.SetSigningKeysEncryption(ctx, !*decrypt)
+	if err != nil {
+		log.Fatalf("failed to convert signing keys, err: %v", err)
+	}
+	totpCount, err := repo.SetTOTPSecretsEncryption(ctx, !*decrypt)
+	if err != nil {
+		log.Fatalf("failed to convert totp secrets, err: %v", err)
+	}
+
+	if *decrypt {
+		fmt.Printf("%d signing keys and %d totp secrets decrypted\n", count, totpCount)
+		return
+	}
+	fmt.Printf("%d signing keys and %d totp secrets encrypted\n", count, totpCount)
+}
@@ -0,0 +1,49 @@
+// Command ledgercheck recomputes every wallet balance from ledger_entries and
+// reports the wallets whose balance drifted from it and the journals whose
+// debits and credits differ. It exits with status 1 when it finds any.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	cfg "github.com/dwiw96/GoCommerceAPI/config"
+	pg "github.com/dwiw96/GoCommerceAPI/pkg/driver/postgresql"
+
+	ledgerRepository "github.com/dwiw96/GoCommerceAPI/internal/features/ledger/repository"
+)
+
+func main() {
+	env := cfg.GetEnvConfig()
+	pgPool := pg.ConnectToPg(env)
+	defer pgPool.Close()
+
+	ctx := context.Background()
+	repo := ledgerRepository.NewLedgerRepository(pgPool, ctx)
+
+	drifts, err := repo.ListWalletDrift()
+	if err != nil {
+		log.Fatalf("failed to list wallet drift, err: %v", err)
+	}
+	unbalanced, err := repo.ListUnbalancedJournals()
+	if err != nil {
+		log.Fatalf("failed to list unbalanced journals, err: %v", err)
+	}
+
+	for _, drift := range drifts {
+		fmt.Printf("wallet %d: balance %d, ledger %d, drift %d\n",
+			drift.WalletID, drift.Balance, drift.LedgerBalance, drift.Balance-drift.LedgerBalance)
+	}
+	for _, journal := range unbalanced {
+		fmt.Printf("journal %d: debit %d, credit %d\n", journal.JournalID, journal.Debit, journal.Credit)
+	}
+
+	if len(drifts) > 0 || len(unbalanced) > 0 {
+		fmt.Printf("ledger check failed: %d wallets drifted, %d journals unbalanced\n", len(drifts), len(unbalanced))
+		os.Exit(1)
+	}
+
+	fmt.Println("ledger check passed")
+}
@@ -0,0 +1,81 @@
+// Command rotatekey adds a new key for signing tokens and retires the keys
+// before it. The new key is published in the JWKS right away and signs from
+// -activate-after on, so every server has read it before the first token it
+// signs. The old keys keep verifying until -retire-after past the activation,
+// which has to be longer than the longest token they may have signed, a
+// shorter one is refused unless -force is given. The new key uses -alg,
+// JWT_SIGNING_ALGORITHM by default, so rotating is also how tokens move to
+// another algorithm.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	cfg "github.com/dwiw96/GoCommerceAPI/config"
+	pg "github.com/dwiw96/GoCommerceAPI/pkg/driver/postgresql"
+	password "github.com/dwiw96/GoCommerceAPI/pkg/utils/password"
+	signer "github.com/dwiw96/GoCommerceAPI/pkg/utils/signer"
+
+	auth "github.com/dwiw96/GoCommerceAPI/internal/features/auth"
+	authRepository "github.com/dwiw96/GoCommerceAPI/internal/features/auth/repository"
+)
+
+func main() {
+	activateAfter := flag.Duration("activate-after", 10*time.Minute, "how long until the new key signs tokens")
+	retireAfter := flag.Duration("retire-after", 24*time.Hour, "how long the old keys verify tokens after the new key activates")
+	algName := flag.String("alg", "", "algorithm of the new key, RS256, ES256 or EdDSA")
+	force := flag.Bool("force", false, "retire the old keys even before the tokens they signed expire")
+	flag.Parse()
+
+	env := cfg.GetEnvConfig()
+	alg := env.JWT_SIGNING_ALGORITHM
+	if *algName != "" {
+		var err error
+		alg, err = signer.ParseAlgorithm(*algName)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if longest := longestTokenTTL(env); *retireAfter < longest && !*force {
+		log.Fatalf("retire-after %s is shorter than the longest token lifetime %s, sessions and verification links would stop working early, use -force to retire anyway", *retireAfter, longest)
+	}
+
+	if err := password.SetKeyEncryptionKey(env.JWT_KEY_ENCRYPTION_KEY); err != nil {
+		log.Fatal(err)
+	}
+
+	pgPool := pg.ConnectToPg(env)
+	defer pgPool.Close()
+
+	ctx := context.Background()
+	repo := authRepository.NewAuthRepository(pgPool, pgPool)
+
+	kid, privateKey, err := password.GenerateSigningKey(alg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	activatesAt := time.Now().UTC().Add(*activateAfter)
+	key, err := repo.RotateSigningKey(ctx, auth.RotateSigningKeyParams{
+		Kid:         kid,
+		Signer:      privateKey,
+		ActivatesAt: activatesAt,
+		RetiresAt:   activatesAt.Add(*retireAfter),
+	})
+	if err != nil {
+		log.Fatalf("failed to rotate signing key, err: %v", err)
+	}
+
+	fmt.Printf("%s key %s signs from %s, the keys before it retire at %s\n",
+		key.Signer.Algorithm(), key.Kid, key.ActivatesAt.Format(time.RFC3339), activatesAt.Add(*retireAfter).Format(time.RFC3339))
+}
+
+// longestTokenTTL is how long a token signed by a key may still be used, the
+// max of the access, refresh and verification token lifetimes.
+func longestTokenTTL(env *cfg.EnvConfig) time.Duration {
+	return max(env.ACCESS_TOKEN_TTL, env.REFRESH_TOKEN_TTL, env.VERIFICATION_TOKEN_TTL)
+}
@@ -1,12 +1,22 @@
 package config
 
 import (
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"log"
+	"net"
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"strconv"
+	"strings"
+	"time"
 
+	oidc "github.com/dwiw96/GoCommerceAPI/pkg/oidc"
 	conv "github.com/dwiw96/GoCommerceAPI/pkg/utils/converter"
+	signer "github.com/dwiw96/GoCommerceAPI/pkg/utils/signer"
 
 	"github.com/joho/godotenv"
 )
@@ -21,6 +31,62 @@ type EnvConfig struct {
 	REDIS_HOST     string
 	REDIS_PASSWORD string
 	REDIS_DB       int
+	// TRUSTED_PROXIES is a comma separated list of the ips and cidrs of the
+	// proxies in front of the API. The client ip is only read from
+	// X-Forwarded-For when the request comes from one of them, with none the
+	// ip the request came from is used.
+	TRUSTED_PROXIES []string
+
+	RECONCILER_INTERVAL    time.Duration
+	RECONCILER_PENDING_AGE time.Duration
+
+	// ADMIN_EMAILS is a comma separated list of the users made admin once
+	// they verified the email.
+	ADMIN_EMAILS []string
+
+	// APP_BASE_URL is where the API is reached from outside, the links in
+	// the emails start with it.
+	APP_BASE_URL string
+	MAIL_FROM    string
+	// MAIL_OUTBOX_DIR is where the emails are written for local development,
+	// they are only logged when it's empty.
+	MAIL_OUTBOX_DIR        string
+	VERIFICATION_TOKEN_TTL time.Duration
+	// REQUIRE_VERIFIED_EMAIL blocks purchases and transfers until the user
+	// verified the email.
+	REQUIRE_VERIFIED_EMAIL bool
+	// PASSWORD_RESET_URL is the page where users choose a new password, the
+	// reset token is added as the token query param.
+	PASSWORD_RESET_URL       string
+	PASSWORD_RESET_TOKEN_TTL time.Duration
+	// JWT_KEY_ENCRYPTION_KEY encrypts the token signing keys in the
+	// database, it's 32 bytes base64 encoded in the env. When it's empty
+	// it's read from the file at JWT_KEY_ENCRYPTION_KEY_FILE.
+	JWT_KEY_ENCRYPTION_KEY []byte
+	// JWT_SIGNING_ALGORITHM is the algorithm of new signing keys, RS256,
+	// ES256 or EdDSA. Tokens of the old algorithm keep verifying until its
+	// keys are retired.
+	JWT_SIGNING_ALGORITHM signer.Algorithm
+	// MFA_STEP_UP_THRESHOLD is the amount above which withdrawals and
+	// transfers of a user with TOTP need a fresh code, 0 turns it off.
+	MFA_STEP_UP_THRESHOLD int32
+	// OIDC_PROVIDERS are the OpenID Connect providers users can log in
+	// with. The env lists their names comma separated, each name has
+	// OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID and OIDC_<NAME>_CLIENT_SECRET.
+	OIDC_PROVIDERS []oidc.Config
+
+	// ACCESS_TOKEN_TTL is how long an access token from log in or refresh
+	// lives and SIGNUP_ACCESS_TOKEN_TTL the one from sign up.
+	ACCESS_TOKEN_TTL        time.Duration
+	SIGNUP_ACCESS_TOKEN_TTL time.Duration
+	// REFRESH_TOKEN_TTL is how long a refresh token lives, every refresh
+	// starts it over. A log in with remember_me gets
+	// REMEMBER_ME_REFRESH_TOKEN_TTL instead.
+	REFRESH_TOKEN_TTL             time.Duration
+	REMEMBER_ME_REFRESH_TOKEN_TTL time.Duration
+	// SESSION_MAX_LIFETIME is how long after the log in a session can still
+	// be refreshed.
+	SESSION_MAX_LIFETIME time.Duration
 }
 
 func GetEnvConfig() *EnvConfig {
@@ -41,10 +107,179 @@ func GetEnvConfig() *EnvConfig {
 	if err != nil {
 		log.Fatal("get env config, err:", err)
 	}
+	resEnvConfig.TRUSTED_PROXIES, err = readTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		log.Fatal("get env config TRUSTED_PROXIES, err:", err)
+	}
+
+	resEnvConfig.RECONCILER_INTERVAL, err = time.ParseDuration(os.Getenv("RECONCILER_INTERVAL"))
+	if err != nil {
+		log.Fatal("get env config RECONCILER_INTERVAL, err:", err)
+	}
+	resEnvConfig.RECONCILER_PENDING_AGE, err = time.ParseDuration(os.Getenv("RECONCILER_PENDING_AGE"))
+	if err != nil {
+		log.Fatal("get env config RECONCILER_PENDING_AGE, err:", err)
+	}
+
+	for _, email := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		email = strings.ToLower(strings.TrimSpace(email))
+		if email != "" {
+			resEnvConfig.ADMIN_EMAILS = append(resEnvConfig.ADMIN_EMAILS, email)
+		}
+	}
+
+	resEnvConfig.APP_BASE_URL = strings.TrimSuffix(os.Getenv("APP_BASE_URL"), "/")
+	resEnvConfig.MAIL_FROM = os.Getenv("MAIL_FROM")
+	resEnvConfig.MAIL_OUTBOX_DIR = os.Getenv("MAIL_OUTBOX_DIR")
+	resEnvConfig.VERIFICATION_TOKEN_TTL, err = time.ParseDuration(os.Getenv("VERIFICATION_TOKEN_TTL"))
+	if err != nil {
+		log.Fatal("get env config VERIFICATION_TOKEN_TTL, err:", err)
+	}
+	resEnvConfig.REQUIRE_VERIFIED_EMAIL, err = strconv.ParseBool(os.Getenv("REQUIRE_VERIFIED_EMAIL"))
+	if err != nil {
+		log.Fatal("get env config REQUIRE_VERIFIED_EMAIL, err:", err)
+	}
+	resEnvConfig.PASSWORD_RESET_URL = os.Getenv("PASSWORD_RESET_URL")
+	resEnvConfig.PASSWORD_RESET_TOKEN_TTL, err = time.ParseDuration(os.Getenv("PASSWORD_RESET_TOKEN_TTL"))
+	if err != nil {
+		log.Fatal("get env config PASSWORD_RESET_TOKEN_TTL, err:", err)
+	}
+	resEnvConfig.JWT_KEY_ENCRYPTION_KEY, err = readKeyEncryptionKey(os.Getenv("JWT_KEY_ENCRYPTION_KEY"), os.Getenv("JWT_KEY_ENCRYPTION_KEY_FILE"))
+	if err != nil {
+		log.Fatal("get env config JWT_KEY_ENCRYPTION_KEY, err:", err)
+	}
+	resEnvConfig.JWT_SIGNING_ALGORITHM, err = signer.ParseAlgorithm(os.Getenv("JWT_SIGNING_ALGORITHM"))
+	if err != nil {
+		log.Fatal("get env config JWT_SIGNING_ALGORITHM, err:", err)
+	}
+	threshold, err := strconv.ParseInt(os.Getenv("MFA_STEP_UP_THRESHOLD"), 10, 32)
+	if err != nil {
+		log.Fatal("get env config MFA_STEP_UP_THRESHOLD, err:", err)
+	}
+	resEnvConfig.MFA_STEP_UP_THRESHOLD = int32(threshold)
+	resEnvConfig.OIDC_PROVIDERS, err = readOIDCProviders(os.Getenv("OIDC_PROVIDERS"), resEnvConfig.APP_BASE_URL)
+	if err != nil {
+		log.Fatal("get env config OIDC_PROVIDERS, err:", err)
+	}
+
+	resEnvConfig.ACCESS_TOKEN_TTL, err = time.ParseDuration(os.Getenv("ACCESS_TOKEN_TTL"))
+	if err != nil {
+		log.Fatal("get env config ACCESS_TOKEN_TTL, err:", err)
+	}
+	resEnvConfig.SIGNUP_ACCESS_TOKEN_TTL, err = time.ParseDuration(os.Getenv("SIGNUP_ACCESS_TOKEN_TTL"))
+	if err != nil {
+		log.Fatal("get env config SIGNUP_ACCESS_TOKEN_TTL, err:", err)
+	}
+	resEnvConfig.REFRESH_TOKEN_TTL, err = time.ParseDuration(os.Getenv("REFRESH_TOKEN_TTL"))
+	if err != nil {
+		log.Fatal("get env config REFRESH_TOKEN_TTL, err:", err)
+	}
+	resEnvConfig.REMEMBER_ME_REFRESH_TOKEN_TTL, err = time.ParseDuration(os.Getenv("REMEMBER_ME_REFRESH_TOKEN_TTL"))
+	if err != nil {
+		log.Fatal("get env config REMEMBER_ME_REFRESH_TOKEN_TTL, err:", err)
+	}
+	resEnvConfig.SESSION_MAX_LIFETIME, err = time.ParseDuration(os.Getenv("SESSION_MAX_LIFETIME"))
+	if err != nil {
+		log.Fatal("get env config SESSION_MAX_LIFETIME, err:", err)
+	}
+	if err := validateTokenLifetimes(&resEnvConfig); err != nil {
+		log.Fatal("get env config token lifetimes, err:", err)
+	}
 
 	return &resEnvConfig
 }
 
+func readTrustedProxies(value string) ([]string, error) {
+	var proxies []string
+	for _, proxy := range strings.Split(value, ",") {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			return nil, fmt.Errorf("%q is not an ip or a cidr", proxy)
+		}
+		proxies = append(proxies, proxy)
+	}
+
+	return proxies, nil
+}
+
+func readKeyEncryptionKey(value, path string) ([]byte, error) {
+	if value == "" && path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s, err: %v", path, err)
+		}
+		value = strings.TrimSpace(string(content))
+	}
+	if value == "" {
+		return nil, errors.New("JWT_KEY_ENCRYPTION_KEY or JWT_KEY_ENCRYPTION_KEY_FILE must be set")
+	}
+
+	kek, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode base64, err: %v", err)
+	}
+	if len(kek) != 32 {
+		return nil, fmt.Errorf("key must be 32 bytes, got %d", len(kek))
+	}
+
+	return kek, nil
+}
+
+// validateTokenLifetimes checks that the lifetimes are set and that a refresh
+// token outlives the access token it refreshes.
+func validateTokenLifetimes(c *EnvConfig) error {
+	if c.ACCESS_TOKEN_TTL <= 0 || c.SIGNUP_ACCESS_TOKEN_TTL <= 0 || c.REFRESH_TOKEN_TTL <= 0 ||
+		c.REMEMBER_ME_REFRESH_TOKEN_TTL <= 0 || c.SESSION_MAX_LIFETIME <= 0 {
+		return errors.New("token lifetimes must be more than 0")
+	}
+	if c.REFRESH_TOKEN_TTL < c.ACCESS_TOKEN_TTL {
+		return fmt.Errorf("REFRESH_TOKEN_TTL %s is shorter than ACCESS_TOKEN_TTL %s", c.REFRESH_TOKEN_TTL, c.ACCESS_TOKEN_TTL)
+	}
+	if c.REMEMBER_ME_REFRESH_TOKEN_TTL < c.REFRESH_TOKEN_TTL {
+		return fmt.Errorf("REMEMBER_ME_REFRESH_TOKEN_TTL %s is shorter than REFRESH_TOKEN_TTL %s", c.REMEMBER_ME_REFRESH_TOKEN_TTL, c.REFRESH_TOKEN_TTL)
+	}
+	if c.SESSION_MAX_LIFETIME < c.REFRESH_TOKEN_TTL {
+		return fmt.Errorf("SESSION_MAX_LIFETIME %s is shorter than REFRESH_TOKEN_TTL %s", c.SESSION_MAX_LIFETIME, c.REFRESH_TOKEN_TTL)
+	}
+
+	return nil
+}
+
+var oidcProviderName = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// readOIDCProviders reads the providers named in names, the callback of each
+// one is under baseURL.
+func readOIDCProviders(names, baseURL string) ([]oidc.Config, error) {
+	var providers []oidc.Config
+	for _, name := range strings.Split(names, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if !oidcProviderName.MatchString(name) {
+			return nil, fmt.Errorf("provider name %q must be letters, digits and _", name)
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		provider := oidc.Config{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  baseURL + "/api/v1/auth/oidc/" + name + "/callback",
+		}
+		if provider.Issuer == "" || provider.ClientID == "" {
+			return nil, fmt.Errorf("%sISSUER and %sCLIENT_ID must be set", prefix, prefix)
+		}
+		providers = append(providers, provider)
+	}
+
+	return providers, nil
+}
+
 func initEnvConfig() {
 	_, b, _, _ := runtime.Caller(0)
 	basePath := filepath.Dir(b)
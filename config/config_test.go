@@ -1,13 +1,23 @@
 package config
 
 import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
+
+	oidc "github.com/dwiw96/GoCommerceAPI/pkg/oidc"
+	signer "github.com/dwiw96/GoCommerceAPI/pkg/utils/signer"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 func TestGetEnvConfig(t *testing.T) {
+	kek := []byte("test-only-key-encryption-key-32b")
+	t.Setenv("JWT_KEY_ENCRYPTION_KEY", base64.StdEncoding.EncodeToString(kek))
+
 	ans := &EnvConfig{
 		SERVER_PORT:    ":8080",
 		DB_USERNAME:    "dwiw",
@@ -18,8 +28,168 @@ func TestGetEnvConfig(t *testing.T) {
 		REDIS_HOST:     "localhost:6379",
 		REDIS_PASSWORD: "",
 		REDIS_DB:       0,
+
+		RECONCILER_INTERVAL:    time.Minute,
+		RECONCILER_PENDING_AGE: 5 * time.Minute,
+
+		ADMIN_EMAILS: []string{"admin@gocommerce.com"},
+
+		APP_BASE_URL:           "http://localhost:8080",
+		MAIL_FROM:              "no-reply@gocommerce.com",
+		MAIL_OUTBOX_DIR:        "",
+		VERIFICATION_TOKEN_TTL: 24 * time.Hour,
+		REQUIRE_VERIFIED_EMAIL: false,
+
+		PASSWORD_RESET_URL:       "http://localhost:3000/reset-password",
+		PASSWORD_RESET_TOKEN_TTL: 30 * time.Minute,
+
+		JWT_KEY_ENCRYPTION_KEY: kek,
+		JWT_SIGNING_ALGORITHM:  signer.RS256,
+
+		MFA_STEP_UP_THRESHOLD: 0,
+
+		ACCESS_TOKEN_TTL:              time.Hour,
+		SIGNUP_ACCESS_TOKEN_TTL:       10 * time.Minute,
+		REFRESH_TOKEN_TTL:             24 * time.Hour,
+		REMEMBER_ME_REFRESH_TOKEN_TTL: 30 * 24 * time.Hour,
+		SESSION_MAX_LIFETIME:          90 * 24 * time.Hour,
 	}
 	res := GetEnvConfig()
 	require.NotNil(t, res)
 	assert.Equal(t, ans, res)
 }
+
+func TestReadKeyEncryptionKey(t *testing.T) {
+	value := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+
+	t.Run("env", func(t *testing.T) {
+		res, err := readKeyEncryptionKey(value, "")
+		require.NoError(t, err)
+		assert.Equal(t, []byte("0123456789abcdef0123456789abcdef"), res)
+	})
+
+	t.Run("file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "kek")
+		err := os.WriteFile(path, []byte(value+"\n"), 0o600)
+		require.NoError(t, err)
+
+		res, err := readKeyEncryptionKey("", path)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("0123456789abcdef0123456789abcdef"), res)
+	})
+
+	t.Run("failed_empty", func(t *testing.T) {
+		_, err := readKeyEncryptionKey("", "")
+		require.Error(t, err)
+	})
+
+	t.Run("failed_short", func(t *testing.T) {
+		_, err := readKeyEncryptionKey(base64.StdEncoding.EncodeToString([]byte("short")), "")
+		require.Error(t, err)
+	})
+}
+
+func TestReadTrustedProxies(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		res, err := readTrustedProxies(" 10.0.0.0/8, 192.168.1.10 ,")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"10.0.0.0/8", "192.168.1.10"}, res)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		res, err := readTrustedProxies("")
+		require.NoError(t, err)
+		assert.Nil(t, res)
+	})
+
+	t.Run("failed_invalid", func(t *testing.T) {
+		_, err := readTrustedProxies("proxy.local")
+		require.Error(t, err)
+	})
+}
+
+func TestReadOIDCProviders(t *testing.T) {
+	t.Setenv("OIDC_GOOGLE_ISSUER", "https://accounts.google.com")
+	t.Setenv("OIDC_GOOGLE_CLIENT_ID", "client")
+	t.Setenv("OIDC_GOOGLE_CLIENT_SECRET", "secret")
+
+	t.Run("success", func(t *testing.T) {
+		res, err := readOIDCProviders(" Google ,", "http://localhost:8080")
+		require.NoError(t, err)
+		assert.Equal(t, []oidc.Config{{
+			Name:         "google",
+			Issuer:       "https://accounts.google.com",
+			ClientID:     "client",
+			ClientSecret: "secret",
+			RedirectURL:  "http://localhost:8080/api/v1/auth/oidc/google/callback",
+		}}, res)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		res, err := readOIDCProviders("", "http://localhost:8080")
+		require.NoError(t, err)
+		assert.Empty(t, res)
+	})
+
+	t.Run("failed_not_configured", func(t *testing.T) {
+		_, err := readOIDCProviders("google,github", "http://localhost:8080")
+		require.Error(t, err)
+	})
+
+	t.Run("failed_invalid_name", func(t *testing.T) {
+		_, err := readOIDCProviders("my/provider", "http://localhost:8080")
+		require.Error(t, err)
+	})
+}
+
+func TestValidateTokenLifetimes(t *testing.T) {
+	valid := func() *EnvConfig {
+		return &EnvConfig{
+			ACCESS_TOKEN_TTL:              time.Hour,
+			SIGNUP_ACCESS_TOKEN_TTL:       10 * time.Minute,
+			REFRESH_TOKEN_TTL:             24 * time.Hour,
+			REMEMBER_ME_REFRESH_TOKEN_TTL: 30 * 24 * time.Hour,
+			SESSION_MAX_LIFETIME:          90 * 24 * time.Hour,
+		}
+	}
+
+	testCases := []struct {
+		desc   string
+		modify func(c *EnvConfig)
+		isErr  bool
+	}{
+		{
+			desc:   "success",
+			modify: func(c *EnvConfig) {},
+			isErr:  false,
+		}, {
+			desc:   "failed_zero",
+			modify: func(c *EnvConfig) { c.SIGNUP_ACCESS_TOKEN_TTL = 0 },
+			isErr:  true,
+		}, {
+			desc:   "failed_refresh_shorter_than_access",
+			modify: func(c *EnvConfig) { c.REFRESH_TOKEN_TTL = 5 * time.Minute },
+			isErr:  true,
+		}, {
+			desc:   "failed_remember_me_shorter_than_refresh",
+			modify: func(c *EnvConfig) { c.REMEMBER_ME_REFRESH_TOKEN_TTL = time.Hour },
+			isErr:  true,
+		}, {
+			desc:   "failed_session_shorter_than_refresh",
+			modify: func(c *EnvConfig) { c.SESSION_MAX_LIFETIME = time.Hour },
+			isErr:  true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			c := valid()
+			tC.modify(c)
+			err := validateTokenLifetimes(c)
+			if tC.isErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
@@ -7,6 +7,10 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/redis/go-redis/v9"
 
+	cfg "github.com/dwiw96/GoCommerceAPI/config"
+	mailer "github.com/dwiw96/GoCommerceAPI/pkg/mailer"
+
+	auth "github.com/dwiw96/GoCommerceAPI/internal/features/auth"
 	authCache "github.com/dwiw96/GoCommerceAPI/internal/features/auth/cache"
 	authHandler "github.com/dwiw96/GoCommerceAPI/internal/features/auth/handler"
 	authRepository "github.com/dwiw96/GoCommerceAPI/internal/features/auth/repository"
@@ -23,23 +27,66 @@ import (
 	transactionsHandler "github.com/dwiw96/GoCommerceAPI/internal/features/transactions/handler"
 	transactionsRepository "github.com/dwiw96/GoCommerceAPI/internal/features/transactions/repository"
 	transactionsService "github.com/dwiw96/GoCommerceAPI/internal/features/transactions/service"
+
+	cartsHandler "github.com/dwiw96/GoCommerceAPI/internal/features/carts/handler"
+	cartsRepository "github.com/dwiw96/GoCommerceAPI/internal/features/carts/repository"
+	cartsService "github.com/dwiw96/GoCommerceAPI/internal/features/carts/service"
+
+	ordersHandler "github.com/dwiw96/GoCommerceAPI/internal/features/orders/handler"
+	ordersRepository "github.com/dwiw96/GoCommerceAPI/internal/features/orders/repository"
+	ordersService "github.com/dwiw96/GoCommerceAPI/internal/features/orders/service"
+
+	ratesHandler "github.com/dwiw96/GoCommerceAPI/internal/features/rates/handler"
+	ratesRepository "github.com/dwiw96/GoCommerceAPI/internal/features/rates/repository"
+	ratesService "github.com/dwiw96/GoCommerceAPI/internal/features/rates/service"
 )
 
-func InitFactory(router *gin.Engine, pool *pgxpool.Pool, rdClient *redis.Client, ctx context.Context) {
+func InitFactory(router *gin.Engine, pool *pgxpool.Pool, rdClient *redis.Client, ctx context.Context, env *cfg.EnvConfig) {
+	authConf := auth.ServiceConfig{
+		AdminEmails:          env.ADMIN_EMAILS,
+		VerifyURL:            env.APP_BASE_URL + "/api/v1/auth/verify",
+		VerificationTokenTTL: env.VERIFICATION_TOKEN_TTL,
+		MailFrom:             env.MAIL_FROM,
+		ResetPasswordURL:     env.PASSWORD_RESET_URL,
+		ResetTokenTTL:        env.PASSWORD_RESET_TOKEN_TTL,
+		StepUpThreshold:      env.MFA_STEP_UP_THRESHOLD,
+		OIDCProviders:        env.OIDC_PROVIDERS,
+
+		AccessTokenTTL:            env.ACCESS_TOKEN_TTL,
+		SignUpTokenTTL:            env.SIGNUP_ACCESS_TOKEN_TTL,
+		RefreshTokenTTL:           env.REFRESH_TOKEN_TTL,
+		RememberMeRefreshTokenTTL: env.REMEMBER_ME_REFRESH_TOKEN_TTL,
+		SessionMaxLifetime:        env.SESSION_MAX_LIFETIME,
+	}
+	iMailer := mailer.NewFileSender(env.MAIL_OUTBOX_DIR)
+
 	iAuthRepo := authRepository.NewAuthRepository(pool, pool)
 	iAuthCache := authCache.NewAuthCache(rdClient, ctx)
-	iAuthService := authService.NewAuthService(iAuthRepo, iAuthCache, ctx)
+	iAuthService := authService.NewAuthService(iAuthRepo, iAuthCache, ctx, iMailer, authConf)
 	authHandler.NewAuthHandler(router, iAuthService, pool, rdClient, ctx)
 
 	iProductRep := productsRepository.NewProductRepository(pool)
 	iProductService := productsService.NewProductService(ctx, iProductRep)
 	productsHandler.NewProductHandler(router, iProductService, pool, rdClient, ctx)
 
+	iTransactionsRep := transactionsRepository.NewTransactionsRepository(pool, pool, ctx)
+
 	iWalletsRep := walletsRepository.NewWalletsRepository(pool, ctx)
-	iWalletsService := walletsService.NewWalletsService(ctx, iWalletsRep)
-	walletsHandler.NewWalletsHandler(router, iWalletsService, pool, rdClient, ctx)
+	iWalletsService := walletsService.NewWalletsService(ctx, iWalletsRep, iTransactionsRep)
+	walletsHandler.NewWalletsHandler(router, iWalletsService, iAuthService, pool, rdClient, ctx)
 
-	iTransactionsRep := transactionsRepository.NewTransactionsRepository(pool, pool, ctx)
 	iTransactionsService := transactionsService.NewTransactionsService(ctx, iTransactionsRep)
-	transactionsHandler.NewTransactionsHandler(router, iTransactionsService, pool, rdClient, ctx)
+	transactionsHandler.NewTransactionsHandler(router, iTransactionsService, iAuthService, pool, rdClient, ctx, env.REQUIRE_VERIFIED_EMAIL)
+
+	iCartsRep := cartsRepository.NewCartsRepository(pool, pool, ctx)
+	iCartsService := cartsService.NewCartsService(ctx, iCartsRep)
+	cartsHandler.NewCartsHandler(router, iCartsService, pool, rdClient, ctx, env.REQUIRE_VERIFIED_EMAIL)
+
+	iOrdersRep := ordersRepository.NewOrdersRepository(pool, ctx)
+	iOrdersService := ordersService.NewOrdersService(ctx, iOrdersRep, iTransactionsRep)
+	ordersHandler.NewOrdersHandler(router, iOrdersService, pool, rdClient, ctx)
+
+	iRatesRep := ratesRepository.NewRatesRepository(pool, ctx)
+	iRatesService := ratesService.NewRatesService(ctx, iRatesRep)
+	ratesHandler.NewRatesHandler(router, iRatesService, pool, rdClient, ctx)
 }
@@ -2,12 +2,34 @@ package chache
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 
 	auth "github.com/dwiw96/GoCommerceAPI/internal/features/auth"
+	errs "github.com/dwiw96/GoCommerceAPI/pkg/utils/responses"
+)
+
+const (
+	mailCooldown = time.Minute
+	mailLimit    = 5
+	mailWindow   = 24 * time.Hour
+
+	// loginWindow is how long failed log ins are counted after the last one.
+	loginWindow = 15 * time.Minute
+	// loginFreeAttempts fail without a delay, each one after doubles the
+	// delay from a second up to loginMaxDelay.
+	loginFreeAttempts = 3
+	loginMaxDelay     = time.Minute
+	// an account or an ip is locked for loginLockout after this many failed
+	// log ins, an ip gets more as users behind one NAT share it
+	accountLockoutAttempts = 10
+	ipLockoutAttempts      = 50
+	loginLockout           = 15 * time.Minute
 )
 
 type authCache struct {
@@ -50,3 +72,186 @@ func (r *authCache) CheckBlockedToken(payload auth.JwtPayload) error {
 
 	return nil
 }
+
+// ReserveVerificationResend allows one verification email per minute and five
+// a day for each user, it returns errs.ErrTooManyRequests past that.
+func (c *authCache) ReserveVerificationResend(userID int32) error {
+	return c.reserveMail("verify resend", userID)
+}
+
+// ReservePasswordResetMail allows one password reset email per minute and
+// five a day for each user, it returns errs.ErrTooManyRequests past that.
+func (c *authCache) ReservePasswordResetMail(userID int32) error {
+	return c.reserveMail("password reset", userID)
+}
+
+func (c *authCache) reserveMail(prefix string, userID int32) error {
+	reserved, err := c.client.SetNX(c.ctx, fmt.Sprint(prefix, " cooldown ", userID), 1, mailCooldown).Result()
+	if err != nil {
+		return fmt.Errorf("failed to reserve %s email, msg: %v", prefix, err)
+	}
+	if !reserved {
+		return errs.ErrTooManyRequests
+	}
+
+	countKey := fmt.Sprint(prefix, " count ", userID)
+	count, err := c.client.Incr(c.ctx, countKey).Result()
+	if err != nil {
+		return fmt.Errorf("failed to count %s email, msg: %v", prefix, err)
+	}
+	if count == 1 {
+		if err := c.client.Expire(c.ctx, countKey, mailWindow).Err(); err != nil {
+			return fmt.Errorf("failed to count %s email, msg: %v", prefix, err)
+		}
+	}
+	if count > mailLimit {
+		return errs.ErrTooManyRequests
+	}
+
+	return nil
+}
+
+// BlockUserTokens blocks every access token of the user issued until now, ttl
+// should be the lifetime of the longest lived access token.
+func (c *authCache) BlockUserTokens(userID int32, ttl time.Duration) error {
+	err := c.client.Set(c.ctx, fmt.Sprint("block user ", userID), time.Now().UTC().Unix(), ttl).Err()
+	if err != nil {
+		return fmt.Errorf("failed to block user tokens, msg: %v", err)
+	}
+
+	return nil
+}
+
+// BlockSession blocks every access token issued for the session, ttl should
+// be the lifetime of an access token.
+func (c *authCache) BlockSession(sessionID int32, ttl time.Duration) error {
+	err := c.client.Set(c.ctx, fmt.Sprint("block session ", sessionID), 1, ttl).Err()
+	if err != nil {
+		return fmt.Errorf("failed to block session, msg: %v", err)
+	}
+
+	return nil
+}
+
+// loginDelay is how long log ins are held back after failures failed ones.
+func loginDelay(failures, lockoutAttempts int64) time.Duration {
+	if failures >= lockoutAttempts {
+		return loginLockout
+	}
+	if failures <= loginFreeAttempts {
+		return 0
+	}
+
+	delay := time.Second
+	for i := failures - loginFreeAttempts - 1; i > 0 && delay < loginMaxDelay; i-- {
+		delay *= 2
+	}
+
+	return min(delay, loginMaxDelay)
+}
+
+func loginKeys(email, ip string) (scopes []string, lockoutAttempts []int64) {
+	scopes = []string{fmt.Sprint("email ", strings.ToLower(email))}
+	lockoutAttempts = []int64{accountLockoutAttempts}
+	if ip != "" {
+		scopes = append(scopes, fmt.Sprint("ip ", ip))
+		lockoutAttempts = append(lockoutAttempts, ipLockoutAttempts)
+	}
+
+	return scopes, lockoutAttempts
+}
+
+// LoginDelay is how long log ins for the email or from the ip are held back
+// by failed ones, 0 when they are allowed.
+func (c *authCache) LoginDelay(email, ip string) (time.Duration, error) {
+	scopes, _ := loginKeys(email, ip)
+
+	var delay time.Duration
+	for _, scope := range scopes {
+		ttl, err := c.client.PTTL(c.ctx, "login lock "+scope).Result()
+		if err != nil {
+			return 0, fmt.Errorf("failed to check login lock, msg: %v", err)
+		}
+		// a missing key is a negative ttl
+		if ttl > delay {
+			delay = ttl
+		}
+	}
+
+	return delay, nil
+}
+
+// RecordFailedLogin counts a failed log in for the email and the ip. Emails
+// without a user are counted too, so a lock says nothing about the email.
+func (c *authCache) RecordFailedLogin(email, ip string) error {
+	scopes, lockoutAttempts := loginKeys(email, ip)
+
+	for i, scope := range scopes {
+		countKey := "login failed " + scope
+		failures, err := c.client.Incr(c.ctx, countKey).Result()
+		if err != nil {
+			return fmt.Errorf("failed to count failed login, msg: %v", err)
+		}
+		if err := c.client.Expire(c.ctx, countKey, loginWindow).Err(); err != nil {
+			return fmt.Errorf("failed to count failed login, msg: %v", err)
+		}
+
+		delay := loginDelay(failures, lockoutAttempts[i])
+		if delay == 0 {
+			continue
+		}
+		if err := c.client.Set(c.ctx, "login lock "+scope, failures, delay).Err(); err != nil {
+			return fmt.Errorf("failed to lock login, msg: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// ClearFailedLogins forgets the failed log ins of the email after it logs in
+// or an admin unlocks it. The ip keeps its count, one good log in from an ip
+// doesn't vouch for the other attempts from it.
+func (c *authCache) ClearFailedLogins(email string) error {
+	scope := fmt.Sprint("email ", strings.ToLower(email))
+	err := c.client.Del(c.ctx, "login failed "+scope, "login lock "+scope).Err()
+	if err != nil {
+		return fmt.Errorf("failed to clear failed logins, msg: %v", err)
+	}
+
+	return nil
+}
+
+// SaveOIDCState keeps what the callback of a log in with a provider needs
+// until ttl.
+func (c *authCache) SaveOIDCState(state string, arg auth.OIDCState, ttl time.Duration) error {
+	value, err := json.Marshal(arg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal oidc state, msg: %v", err)
+	}
+
+	err = c.client.Set(c.ctx, "oidc state "+state, value, ttl).Err()
+	if err != nil {
+		return fmt.Errorf("failed to save oidc state, msg: %v", err)
+	}
+
+	return nil
+}
+
+// TakeOIDCState returns the saved state and deletes it, a state is good for
+// one callback. It returns errs.ErrInvalidOIDCState when there is none.
+func (c *authCache) TakeOIDCState(state string) (*auth.OIDCState, error) {
+	value, err := c.client.GetDel(c.ctx, "oidc state "+state).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, errs.ErrInvalidOIDCState
+		}
+		return nil, fmt.Errorf("failed to get oidc state, msg: %v", err)
+	}
+
+	var res auth.OIDCState
+	if err := json.Unmarshal(value, &res); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal oidc state, msg: %v", err)
+	}
+
+	return &res, nil
+}
@@ -2,10 +2,10 @@ package chache
 
 import (
 	"context"
-	"crypto/rsa"
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -16,6 +16,8 @@ import (
 	conv "github.com/dwiw96/GoCommerceAPI/pkg/utils/converter"
 	generator "github.com/dwiw96/GoCommerceAPI/pkg/utils/generator"
 	password "github.com/dwiw96/GoCommerceAPI/pkg/utils/password"
+	errs "github.com/dwiw96/GoCommerceAPI/pkg/utils/responses"
+	signer "github.com/dwiw96/GoCommerceAPI/pkg/utils/signer"
 	testUtils "github.com/dwiw96/GoCommerceAPI/testutils"
 
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -29,7 +31,7 @@ var (
 	pool      *pgxpool.Pool
 	client    *redis.Client
 	ctx       context.Context
-	key       *rsa.PrivateKey
+	keys      *auth.KeySet
 )
 
 func TestMain(m *testing.M) {
@@ -40,7 +42,8 @@ func TestMain(m *testing.M) {
 
 	schemaCleanup := testUtils.SetupDB("test_cache_auth")
 
-	password.JwtInit(pool, ctx)
+	testUtils.SetKeyEncryptionKey()
+	password.JwtInit(pool, ctx, signer.RS256)
 
 	os.Setenv("REDIS_HOST", "localhost:6379")
 	os.Setenv("REDIS_PASSWORD", "")
@@ -71,20 +74,20 @@ func TestMain(m *testing.M) {
 
 func createToken(t *testing.T) (payload *auth.JwtPayload) {
 	var err error
-	key, err = middleware.LoadKey(ctx, pool)
+	keys, err = middleware.LoadKeys(ctx, pool)
 	require.NoError(t, err)
-	require.NotNil(t, key)
+	require.NotNil(t, keys)
 
 	user := auth.User{
 		ID:       int32(generator.RandomInt(1, 100)),
 		Username: generator.CreateRandomString(5) + " " + generator.CreateRandomString(7),
 		Email:    generator.CreateRandomEmail(generator.CreateRandomString(5)),
 	}
-	token, err := middleware.CreateToken(user, 5, key)
+	token, err := middleware.CreateToken(user, 0, 5*time.Minute, keys.Signing)
 	require.NoError(t, err)
 	require.NotZero(t, len(token))
 
-	payload, err = middleware.ReadToken(token, key)
+	payload, err = middleware.ReadToken(token, keys)
 	require.NoError(t, err)
 
 	return
@@ -171,3 +174,148 @@ func TestCheckBlockedToken(t *testing.T) {
 		})
 	}
 }
+
+func TestReserveVerificationResend(t *testing.T) {
+	userID := int32(generator.RandomInt(1000, 100000))
+	err := client.Del(ctx, fmt.Sprint("verify resend cooldown ", userID), fmt.Sprint("verify resend count ", userID)).Err()
+	require.NoError(t, err)
+
+	err = cacheTest.ReserveVerificationResend(userID)
+	require.NoError(t, err)
+
+	err = cacheTest.ReserveVerificationResend(userID)
+	require.Error(t, err)
+	assert.Equal(t, errs.ErrTooManyRequests, err)
+
+	// past the cooldown only the daily limit is left
+	for i := 1; i < mailLimit; i++ {
+		err = client.Del(ctx, fmt.Sprint("verify resend cooldown ", userID)).Err()
+		require.NoError(t, err)
+		err = cacheTest.ReserveVerificationResend(userID)
+		require.NoError(t, err)
+	}
+
+	err = client.Del(ctx, fmt.Sprint("verify resend cooldown ", userID)).Err()
+	require.NoError(t, err)
+	err = cacheTest.ReserveVerificationResend(userID)
+	require.Error(t, err)
+	assert.Equal(t, errs.ErrTooManyRequests, err)
+
+	ttl, err := client.TTL(ctx, fmt.Sprint("verify resend count ", userID)).Result()
+	require.NoError(t, err)
+	assert.Greater(t, ttl, time.Duration(0))
+}
+
+func TestReservePasswordResetMail(t *testing.T) {
+	userID := int32(generator.RandomInt(1000, 100000))
+	err := client.Del(ctx, fmt.Sprint("password reset cooldown ", userID), fmt.Sprint("password reset count ", userID)).Err()
+	require.NoError(t, err)
+
+	err = cacheTest.ReservePasswordResetMail(userID)
+	require.NoError(t, err)
+
+	err = cacheTest.ReservePasswordResetMail(userID)
+	require.Error(t, err)
+	assert.Equal(t, errs.ErrTooManyRequests, err)
+
+	// the verification emails are counted apart
+	err = client.Del(ctx, fmt.Sprint("verify resend cooldown ", userID), fmt.Sprint("verify resend count ", userID)).Err()
+	require.NoError(t, err)
+	err = cacheTest.ReserveVerificationResend(userID)
+	require.NoError(t, err)
+}
+
+func TestBlockUserTokens(t *testing.T) {
+	userID := int32(generator.RandomInt(1000, 100000))
+
+	err := cacheTest.BlockUserTokens(userID, time.Minute)
+	require.NoError(t, err)
+
+	blockedAt, err := client.Get(ctx, fmt.Sprint("block user ", userID)).Int64()
+	require.NoError(t, err)
+	assert.InDelta(t, time.Now().UTC().Unix(), blockedAt, 2)
+
+	ttl, err := client.TTL(ctx, fmt.Sprint("block user ", userID)).Result()
+	require.NoError(t, err)
+	assert.Greater(t, ttl, time.Duration(0))
+	assert.LessOrEqual(t, ttl, time.Minute)
+}
+
+func TestBlockSession(t *testing.T) {
+	sessionID := int32(generator.RandomInt(1000, 100000))
+
+	err := cacheTest.BlockSession(sessionID, time.Minute)
+	require.NoError(t, err)
+
+	ttl, err := client.TTL(ctx, fmt.Sprint("block session ", sessionID)).Result()
+	require.NoError(t, err)
+	assert.Greater(t, ttl, time.Duration(0))
+	assert.LessOrEqual(t, ttl, time.Minute)
+}
+
+func TestLoginDelay(t *testing.T) {
+	testCases := []struct {
+		failures int64
+		lockout  int64
+		delay    time.Duration
+	}{
+		{failures: 1, lockout: accountLockoutAttempts, delay: 0},
+		{failures: loginFreeAttempts, lockout: accountLockoutAttempts, delay: 0},
+		{failures: loginFreeAttempts + 1, lockout: accountLockoutAttempts, delay: time.Second},
+		{failures: loginFreeAttempts + 2, lockout: accountLockoutAttempts, delay: 2 * time.Second},
+		{failures: loginFreeAttempts + 4, lockout: accountLockoutAttempts, delay: 8 * time.Second},
+		{failures: accountLockoutAttempts, lockout: accountLockoutAttempts, delay: loginLockout},
+		{failures: accountLockoutAttempts, lockout: ipLockoutAttempts, delay: loginMaxDelay},
+		{failures: ipLockoutAttempts - 1, lockout: ipLockoutAttempts, delay: loginMaxDelay},
+		{failures: ipLockoutAttempts, lockout: ipLockoutAttempts, delay: loginLockout},
+	}
+	for _, tC := range testCases {
+		t.Run(fmt.Sprint(tC.failures, "_of_", tC.lockout), func(t *testing.T) {
+			assert.Equal(t, tC.delay, loginDelay(tC.failures, tC.lockout))
+		})
+	}
+}
+
+func TestRecordFailedLogin(t *testing.T) {
+	email := generator.CreateRandomEmail(generator.CreateRandomString(8))
+	ip := fmt.Sprintf("10.%d.%d.2", generator.RandomInt(0, 255), generator.RandomInt(0, 255))
+
+	for i := 0; i < loginFreeAttempts; i++ {
+		err := cacheTest.RecordFailedLogin(email, ip)
+		require.NoError(t, err)
+	}
+	delay, err := cacheTest.LoginDelay(email, ip)
+	require.NoError(t, err)
+	assert.Zero(t, delay)
+
+	err = cacheTest.RecordFailedLogin(email, ip)
+	require.NoError(t, err)
+	delay, err = cacheTest.LoginDelay(email, ip)
+	require.NoError(t, err)
+	assert.Greater(t, delay, time.Duration(0))
+	assert.LessOrEqual(t, delay, time.Second)
+
+	// the email is counted whatever its case
+	delay, err = cacheTest.LoginDelay(strings.ToUpper(email), "")
+	require.NoError(t, err)
+	assert.Greater(t, delay, time.Duration(0))
+
+	for i := loginFreeAttempts + 1; i < accountLockoutAttempts; i++ {
+		err = cacheTest.RecordFailedLogin(email, ip)
+		require.NoError(t, err)
+	}
+	delay, err = cacheTest.LoginDelay(email, "")
+	require.NoError(t, err)
+	assert.Greater(t, delay, loginMaxDelay)
+
+	err = cacheTest.ClearFailedLogins(email)
+	require.NoError(t, err)
+	delay, err = cacheTest.LoginDelay(email, "")
+	require.NoError(t, err)
+	assert.Zero(t, delay)
+
+	// the ip isn't cleared with the email
+	delay, err = cacheTest.LoginDelay(email, ip)
+	require.NoError(t, err)
+	assert.Greater(t, delay, time.Duration(0))
+}
@@ -2,11 +2,28 @@ package auth
 
 import (
 	"context"
-	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
 	"time"
 
+	oidc "github.com/dwiw96/GoCommerceAPI/pkg/oidc"
+	signer "github.com/dwiw96/GoCommerceAPI/pkg/utils/signer"
+
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Role decides which routes a user may call. Every user signs up as a
+// customer, staff manages the products and admin also manages the roles.
+type Role string
+
+const (
+	RoleCustomer Role = "customer"
+	RoleStaff    Role = "staff"
+	RoleAdmin    Role = "admin"
 )
 
 // database model for users table
@@ -16,7 +33,52 @@ type User struct {
 	Email          string
 	HashedPassword string
 	IsVerified     bool
+	Role           Role
 	CreatedAt      time.Time
+	// Address is the default address in one line, it's not a column of
+	// users and is only filled to go in the access token.
+	Address string
+}
+
+// Profile is the account data a user reads and updates.
+type Profile struct {
+	ID         int32
+	Username   string
+	Email      string
+	FullName   pgtype.Text
+	Phone      pgtype.Text
+	IsVerified bool
+	Role       Role
+	CreatedAt  time.Time
+	Addresses  []Address
+}
+
+type Address struct {
+	ID         int32
+	UserID     int32
+	Label      string
+	Recipient  string
+	Phone      string
+	Street     string
+	City       string
+	Province   string
+	PostalCode string
+	Country    string
+	IsDefault  bool
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// String is the address in one line, the parts that are empty are left out.
+func (a Address) String() string {
+	var parts []string
+	for _, part := range []string{a.Street, a.City, a.Province, a.PostalCode, a.Country} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	return strings.Join(parts, ", ")
 }
 
 // params for repository method
@@ -24,6 +86,8 @@ type CreateUserParams struct {
 	Username       string
 	Email          string
 	HashedPassword string
+	// Role is customer when empty
+	Role Role
 }
 
 type UpdateUserParams struct {
@@ -37,6 +101,65 @@ type DeleteUserParams struct {
 	Email string
 }
 
+type UpdateUserRoleParams struct {
+	ID   int32
+	Role Role
+}
+
+type UpdateUserVerificationParams struct {
+	ID    int32
+	Email string
+}
+
+// CreatePasswordResetTokenParams keeps only the hash of the token, the
+// token itself is mailed to the user.
+type CreatePasswordResetTokenParams struct {
+	UserID    int32
+	TokenHash string
+	ExpiresAt time.Time
+}
+
+type ResetPasswordParams struct {
+	TokenHash      string
+	HashedPassword string
+}
+
+type UpdatePasswordParams struct {
+	ID             int32
+	HashedPassword string
+}
+
+// UpdateProfileParams changes the fields that are valid. An empty full name
+// or phone clears it, a new email has to be verified again.
+type UpdateProfileParams struct {
+	ID       int32
+	Username pgtype.Text
+	Email    pgtype.Text
+	FullName pgtype.Text
+	Phone    pgtype.Text
+}
+
+// AddressParams creates an address, or with ID replaces the user's address
+// with that id. The first address of a user is always the default.
+type AddressParams struct {
+	ID         int32
+	UserID     int32
+	Label      string
+	Recipient  string
+	Phone      string
+	Street     string
+	City       string
+	Province   string
+	PostalCode string
+	Country    string
+	IsDefault  bool
+}
+
+type DeleteAddressParams struct {
+	ID     int32
+	UserID int32
+}
+
 // params for service method
 type SignupRequest struct {
 	Username string `json:"username"`
@@ -47,6 +170,24 @@ type SignupRequest struct {
 type LoginRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	// DeviceName, UserAgent and IPAddress describe the session that is
+	// started.
+	DeviceName string `json:"device_name"`
+	UserAgent  string `json:"-"`
+	IPAddress  string `json:"-"`
+	// RememberMe gives the session the longer refresh token lifetime.
+	RememberMe bool `json:"remember_me"`
+}
+
+// MFALoginRequest is the second step of a log in for a user with TOTP, Code
+// is a TOTP code or one of the recovery codes.
+type MFALoginRequest struct {
+	MFAToken   string
+	Code       string
+	DeviceName string
+	UserAgent  string
+	IPAddress  string
+	RememberMe bool
 }
 
 // param for jwt
@@ -57,18 +198,408 @@ type JwtPayload struct {
 	Iss     string    `json:"iss"`
 	Name    string    `json:"name"`
 	Email   string    `json:"email"`
+	Role    Role      `json:"role"`
 	Address string    `json:"address,omitempty"`
 	Iat     int64     `json:"iat"`
 	Exp     int64     `json:"exp"`
+	// SessionID is the session the token was issued for, 0 for the token
+	// from sign up.
+	SessionID int32 `json:"sid,omitempty"`
+	// IsVerified isn't part of the token, AuthMiddleware reads it from the
+	// database on every request.
+	IsVerified bool `json:"-"`
+}
+
+// VerificationAudience tells a verification token apart from an access token.
+const VerificationAudience = "email_verification"
+
+// VerificationClaims is the token mailed to a user to verify the email.
+type VerificationClaims struct {
+	jwt.RegisteredClaims
+	UserID int32  `json:"user_id"`
+	Email  string `json:"email"`
+}
+
+// MFAChallengeAudience tells an MFA challenge token apart from an access
+// token.
+const MFAChallengeAudience = "mfa_challenge"
+
+// MFAChallengeClaims is the token a log in returns instead of the access
+// token when the user has TOTP, it's traded for the access token with a code.
+type MFAChallengeClaims struct {
+	jwt.RegisteredClaims
+	UserID int32 `json:"user_id"`
+}
+
+// TOTPCodeHeader carries a fresh TOTP code for the withdrawals and transfers
+// above the step up threshold.
+const TOTPCodeHeader = "X-TOTP-Code"
+
+// TOTP is the authenticator app of a user, it's only used once ConfirmedAt is
+// set. LastUsedStep is the period of the last code taken, a code of that
+// period or before is refused.
+type TOTP struct {
+	UserID       int32
+	Secret       string
+	ConfirmedAt  pgtype.Timestamp
+	LastUsedStep int64
+	CreatedAt    time.Time
+}
+
+// TOTPEnrollment is what the authenticator app is set up with, URI is the
+// otpauth URI for a QR code.
+type TOTPEnrollment struct {
+	Secret string
+	URI    string
 }
 
-// param for refresh token
+// ConfirmTOTPParams turns TOTP on, the recovery codes replace the old ones.
+type ConfirmTOTPParams struct {
+	UserID             int32
+	Step               int64
+	RecoveryCodeHashes []string
+}
+
+// ServiceConfig is how the auth service is set up.
+type ServiceConfig struct {
+	// AdminEmails are made admin when they sign up or log in.
+	AdminEmails []string
+	// VerifyURL is the link mailed to verify an email, the token is added
+	// as the token query param.
+	VerifyURL            string
+	VerificationTokenTTL time.Duration
+	MailFrom             string
+	// ResetPasswordURL is the link mailed to reset a password, the token is
+	// added as the token query param.
+	ResetPasswordURL string
+	ResetTokenTTL    time.Duration
+	// StepUpThreshold is the amount above which withdrawals and transfers
+	// of a user with TOTP need a fresh code, 0 turns it off.
+	StepUpThreshold int32
+	// OIDCProviders are the providers users can log in with, by name.
+	OIDCProviders []oidc.Config
+	// AccessTokenTTL is how long an access token from log in or refresh
+	// lives, blocking a session has to last as long.
+	AccessTokenTTL time.Duration
+	// SignUpTokenTTL is how long the access token from sign up lives, it has
+	// no session to refresh it with. Blocking a user's tokens lasts as long
+	// as the longer of the two.
+	SignUpTokenTTL time.Duration
+	// RefreshTokenTTL is how long a refresh token lives, every refresh
+	// starts it over. RememberMeRefreshTokenTTL is used instead for a log in
+	// with remember me.
+	RefreshTokenTTL           time.Duration
+	RememberMeRefreshTokenTTL time.Duration
+	// SessionMaxLifetime is how long a session can be refreshed after the
+	// log in, the user has to log in again after it.
+	SessionMaxLifetime time.Duration
+}
+
+// SigningKey is one of the keys tokens are signed with, a token names its key
+// in the kid header. A key signs from ActivatesAt and is trusted until
+// RetiresAt, a key that activates later is already published so it is known
+// before the first token signed with it. Keys of any algorithm are trusted
+// together, so tokens of the old algorithm keep working after a rotation to a
+// new one.
+type SigningKey struct {
+	ID          int32
+	Kid         string
+	Signer      signer.Signer
+	ActivatesAt time.Time
+	RetiresAt   pgtype.Timestamp
+	CreatedAt   time.Time
+}
+
+// KeySet is the keys that aren't retired, Signing is the newest of them that
+// is active.
+type KeySet struct {
+	Signing *SigningKey
+	Keys    []SigningKey
+}
+
+// NewKeySet picks the signing key at now out of keys, keys that are retired
+// at now are left out.
+func NewKeySet(keys []SigningKey, now time.Time) (*KeySet, error) {
+	set := KeySet{}
+	for _, key := range keys {
+		if key.RetiresAt.Valid && !now.Before(key.RetiresAt.Time) {
+			continue
+		}
+		set.Keys = append(set.Keys, key)
+	}
+
+	for i, key := range set.Keys {
+		if now.Before(key.ActivatesAt) {
+			continue
+		}
+		if set.Signing == nil || key.ActivatesAt.After(set.Signing.ActivatesAt) ||
+			(key.ActivatesAt.Equal(set.Signing.ActivatesAt) && key.ID > set.Signing.ID) {
+			set.Signing = &set.Keys[i]
+		}
+	}
+	if set.Signing == nil {
+		return nil, errors.New("no active signing key found")
+	}
+
+	return &set, nil
+}
+
+// NewVerifyingKeySet is NewKeySet keeping the retired keys as well, it reads
+// tokens signed before a rotation. Its keys must never be published.
+func NewVerifyingKeySet(keys []SigningKey, now time.Time) (*KeySet, error) {
+	set, err := NewKeySet(keys, now)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if key.RetiresAt.Valid && !now.Before(key.RetiresAt.Time) {
+			set.Keys = append(set.Keys, key)
+		}
+	}
+
+	return set, nil
+}
+
+// Find returns the key with the kid. Tokens signed before keys had ids have
+// no kid, they are checked with the signing key.
+func (k *KeySet) Find(kid string) (*SigningKey, bool) {
+	if kid == "" {
+		return k.Signing, true
+	}
+	for i := range k.Keys {
+		if k.Keys[i].Kid == kid {
+			return &k.Keys[i], true
+		}
+	}
+
+	return nil, false
+}
+
+type JWKS struct {
+	Keys []signer.JWK `json:"keys"`
+}
+
+// JWKS publishes the public keys of the set.
+func (k *KeySet) JWKS() JWKS {
+	jwks := JWKS{Keys: []signer.JWK{}}
+	for _, key := range k.Keys {
+		jwks.Keys = append(jwks.Keys, key.Signer.JWK(key.Kid))
+	}
+
+	return jwks
+}
+
+// RotateSigningKeyParams adds a key that signs from ActivatesAt, the keys
+// before it are retired at RetiresAt.
+type RotateSigningKeyParams struct {
+	Kid         string
+	Signer      signer.Signer
+	ActivatesAt time.Time
+	RetiresAt   time.Time
+}
+
+// RefreshTokenWhitelist is one session, each device the user logs in on has
+// its own refresh token.
 type RefreshTokenWhitelist struct {
 	ID           int32
 	UserID       int32
 	RefreshToken uuid.UUID
+	DeviceName   string
+	UserAgent    string
+	IPAddress    string
+	// RememberMe sessions get the longer refresh token lifetime.
+	RememberMe bool
+	LastUsedAt time.Time
+	ExpiresAt  time.Time
+	CreatedAt  time.Time
+}
+
+type CreateSessionParams struct {
+	UserID       int32
+	RefreshToken uuid.UUID
+	DeviceName   string
+	UserAgent    string
+	IPAddress    string
+	RememberMe   bool
 	ExpiresAt    time.Time
-	CreatedAt    time.Time
+}
+
+// UpdateRefreshTokenParams rotates the session's refresh token, it only
+// happens while OldRefreshToken is still the session's token. ExpiresAt is
+// when the new token expires.
+type UpdateRefreshTokenParams struct {
+	ID              int32
+	UserID          int32
+	RefreshToken    uuid.UUID
+	OldRefreshToken uuid.UUID
+	ExpiresAt       time.Time
+}
+
+// RefreshTokenRotation is one rotation in a session, ParentToken is the
+// token that was replaced by RefreshToken and can't be used again.
+type RefreshTokenRotation struct {
+	ID           int32
+	SessionID    int32
+	UserID       int32
+	RefreshToken uuid.UUID
+	ParentToken  uuid.UUID
+	RotatedAt    time.Time
+}
+
+// AuditEvent is what happened in an audit log entry.
+type AuditEvent string
+
+const (
+	// AuditRefreshTokenReused is a rotated refresh token used again, the
+	// whole session is revoked.
+	AuditRefreshTokenReused AuditEvent = "refresh_token_reused"
+)
+
+type AuditLog struct {
+	ID        int32
+	UserID    int32
+	SessionID pgtype.Int4
+	Event     AuditEvent
+	Detail    string
+	CreatedAt time.Time
+}
+
+type CreateAuditLogParams struct {
+	UserID    int32
+	SessionID pgtype.Int4
+	Event     AuditEvent
+	Detail    string
+}
+
+// APIKeyHeader carries an API key, AuthMiddleware takes it instead of the
+// bearer access token.
+const APIKeyHeader = "X-API-Key"
+
+// APIKeyPrefix starts every API key so a leaked one is easy to recognize.
+const APIKeyPrefix = "gca_"
+
+// APIKeyResources are what an API key can be scoped to, the first segment of
+// the path after /api/v1. A scope is "<resource>:read" for GET requests or
+// "<resource>:write" for the others. The auth and users routes can't be
+// called with a key at all, they hand out access tokens that would outlive
+// the key's scopes.
+var APIKeyResources = []string{"admin", "carts", "orders", "product", "rates", "transactions", "wallets"}
+
+// ValidAPIKeyScope tells if scope names a resource and read or write.
+func ValidAPIKeyScope(scope string) bool {
+	resource, access, found := strings.Cut(scope, ":")
+	if !found || (access != "read" && access != "write") {
+		return false
+	}
+	for _, r := range APIKeyResources {
+		if r == resource {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HashAPIKey is what is saved of a key, the key itself is only shown once.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKey lets a server call the API as the user without logging in. Prefix is
+// the start of the key, enough to tell the keys apart in a list.
+type APIKey struct {
+	ID         int32
+	UserID     int32
+	Name       string
+	Prefix     string
+	Scopes     []string
+	ExpiresAt  pgtype.Timestamp
+	LastUsedAt pgtype.Timestamp
+	CreatedAt  time.Time
+}
+
+// HasScope tells if the key may be used for scope.
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CreateAPIKeyRequest is a new key of the user, it never expires when
+// ExpiresAt isn't set.
+type CreateAPIKeyRequest struct {
+	UserID    int32
+	Name      string
+	Scopes    []string
+	ExpiresAt pgtype.Timestamp
+}
+
+type CreateAPIKeyParams struct {
+	UserID    int32
+	Name      string
+	Prefix    string
+	KeyHash   string
+	Scopes    []string
+	ExpiresAt pgtype.Timestamp
+}
+
+type DeleteAPIKeyParams struct {
+	ID     int32
+	UserID int32
+}
+
+type DeleteSessionParams struct {
+	ID     int32
+	UserID int32
+}
+
+// Identity links a user to an account at an OpenID Connect provider, Subject
+// is the provider's id of the account.
+type Identity struct {
+	ID        int32
+	UserID    int32
+	Provider  string
+	Subject   string
+	Email     string
+	CreatedAt time.Time
+}
+
+type CreateIdentityParams struct {
+	UserID   int32
+	Provider string
+	Subject  string
+	Email    string
+}
+
+// CreateIdentityUserParams is a user who signs up by logging in with a
+// provider, the provider already verified the email.
+type CreateIdentityUserParams struct {
+	User     CreateUserParams
+	Provider string
+	Subject  string
+}
+
+// OIDCState is what is kept of a log in with a provider until the callback,
+// it's found by the state param.
+type OIDCState struct {
+	Provider     string `json:"provider"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+}
+
+// OIDCCallbackRequest is the redirect back from the provider.
+type OIDCCallbackRequest struct {
+	Provider   string
+	Code       string
+	State      string
+	DeviceName string
+	UserAgent  string
+	IPAddress  string
 }
 
 type IRepository interface {
@@ -76,24 +607,106 @@ type IRepository interface {
 	GetUserByEmail(ctx context.Context, email string) (*User, error)
 	UpdateUser(ctx context.Context, arg UpdateUserParams) (*User, error)
 	DeleteUser(ctx context.Context, arg DeleteUserParams) error
+	UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) (*User, error)
+	UpdateUserVerification(ctx context.Context, arg UpdateUserVerificationParams) error
+	CreatePasswordResetToken(ctx context.Context, arg CreatePasswordResetTokenParams) error
+	ResetPassword(ctx context.Context, arg ResetPasswordParams) (*User, error)
+	ChangePassword(ctx context.Context, arg UpdatePasswordParams) (*User, error)
+	GetUserByID(ctx context.Context, id int32) (*User, error)
+	GetProfile(ctx context.Context, userID int32) (*Profile, error)
+	UpdateProfile(ctx context.Context, arg UpdateProfileParams) (*Profile, error)
+	ListAddresses(ctx context.Context, userID int32) ([]Address, error)
+	GetDefaultAddress(ctx context.Context, userID int32) (*Address, error)
+	CreateAddress(ctx context.Context, arg AddressParams) (*Address, error)
+	UpdateAddress(ctx context.Context, arg AddressParams) (*Address, error)
+	DeleteAddress(ctx context.Context, arg DeleteAddressParams) error
 
-	LoadKey(ctx context.Context) (key *rsa.PrivateKey, err error)
+	LoadKeys(ctx context.Context) (keys *KeySet, err error)
+	LoadKeysWithRetired(ctx context.Context) (keys *KeySet, err error)
+	RotateSigningKey(ctx context.Context, arg RotateSigningKeyParams) (*SigningKey, error)
+	SetSigningKeysEncryption(ctx context.Context, encrypted bool) (count int, err error)
+	SetTOTPSecretsEncryption(ctx context.Context, encrypted bool) (count int, err error)
 	ReadRefreshToken(ctx context.Context, userID int32, refreshToken uuid.UUID) (res *RefreshTokenWhitelist, err error)
-	InsertRefreshToken(ctx context.Context, userID int32, refreshToken uuid.UUID) (err error)
+	InsertRefreshToken(ctx context.Context, userID int32, refreshToken uuid.UUID, expiresAt time.Time) (err error)
+	CreateSession(ctx context.Context, arg CreateSessionParams) (*RefreshTokenWhitelist, error)
+	ListSessions(ctx context.Context, userID int32) ([]RefreshTokenWhitelist, error)
+	DeleteSession(ctx context.Context, arg DeleteSessionParams) error
+	// DeleteRefreshToken deletes every session of the user.
 	DeleteRefreshToken(ctx context.Context, userID int32) (err error)
 	DeleteAllUserInformation(ctx context.Context, arg DeleteUserParams) (err error)
-	UpdateRefreshToken(ctx context.Context, userID int32, refreshToken uuid.UUID) (err error)
+	UpdateRefreshToken(ctx context.Context, arg UpdateRefreshTokenParams) (err error)
+	GetRefreshTokenRotation(ctx context.Context, userID int32, parentToken uuid.UUID) (*RefreshTokenRotation, error)
+	CreateAuditLog(ctx context.Context, arg CreateAuditLogParams) (*AuditLog, error)
+	ListAuditLogs(ctx context.Context, userID int32) ([]AuditLog, error)
+
+	GetTOTP(ctx context.Context, userID int32) (*TOTP, error)
+	UpsertTOTP(ctx context.Context, userID int32, secret string) (*TOTP, error)
+	ConfirmTOTP(ctx context.Context, arg ConfirmTOTPParams) error
+	UseTOTPStep(ctx context.Context, userID int32, step int64) error
+	UseRecoveryCode(ctx context.Context, userID int32, codeHash string) error
+	DeleteTOTP(ctx context.Context, userID int32) error
+
+	CreateAPIKey(ctx context.Context, arg CreateAPIKeyParams) (*APIKey, error)
+	ListAPIKeys(ctx context.Context, userID int32) ([]APIKey, error)
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (*APIKey, error)
+	TouchAPIKey(ctx context.Context, id int32) error
+	DeleteAPIKey(ctx context.Context, arg DeleteAPIKeyParams) error
+
+	GetIdentity(ctx context.Context, provider, subject string) (*Identity, error)
+	CreateIdentity(ctx context.Context, arg CreateIdentityParams) (*Identity, error)
+	CreateIdentityUser(ctx context.Context, arg CreateIdentityUserParams) (*User, error)
 }
 
 type IService interface {
 	SignUp(input SignupRequest) (user *User, token string, code int, err error)
-	LogIn(input LoginRequest) (user *User, accessToken, refreshToken string, code int, err error)
+	LogIn(input LoginRequest) (user *User, accessToken, refreshToken, mfaToken string, code int, err error)
+	LogInMFA(input MFALoginRequest) (user *User, accessToken, refreshToken string, code int, err error)
 	LogOut(payload JwtPayload) error
 	DeleteUser(arg DeleteUserParams) (code int, err error)
 	RefreshToken(refreshToken, accessToken string) (newRefreshToken, newAccessToken string, code int, err error)
+	GrantRole(arg UpdateUserRoleParams) (user *User, code int, err error)
+	RevokeRole(userID int32) (user *User, code int, err error)
+	UnlockUser(userID int32) (code int, err error)
+	VerifyEmail(token string) (code int, err error)
+	ResendVerification(payload JwtPayload) (code int, err error)
+	ForgotPassword(email string) (code int, err error)
+	ResetPassword(token, newPassword string) (code int, err error)
+	ChangePassword(payload JwtPayload, oldPassword, newPassword string) (code int, err error)
+	GetProfile(userID int32) (profile *Profile, code int, err error)
+	UpdateProfile(payload JwtPayload, arg UpdateProfileParams) (profile *Profile, accessToken string, code int, err error)
+	AddAddress(arg AddressParams) (address *Address, code int, err error)
+	UpdateAddress(arg AddressParams) (address *Address, code int, err error)
+	DeleteAddress(arg DeleteAddressParams) (code int, err error)
+	ListSessions(userID int32) (sessions []RefreshTokenWhitelist, code int, err error)
+	RevokeSession(arg DeleteSessionParams) (code int, err error)
+	GetJWKS() (jwks JWKS, code int, err error)
+	EnrollTOTP(payload JwtPayload) (enrollment *TOTPEnrollment, code int, err error)
+	ConfirmTOTP(payload JwtPayload, totpCode string) (recoveryCodes []string, code int, err error)
+	DisableTOTP(payload JwtPayload, totpCode string) (code int, err error)
+	CheckStepUp(payload JwtPayload, amount int32, totpCode string) (code int, err error)
+	CreateAPIKey(arg CreateAPIKeyRequest) (apiKey *APIKey, key string, code int, err error)
+	ListAPIKeys(userID int32) (apiKeys []APIKey, code int, err error)
+	RevokeAPIKey(arg DeleteAPIKeyParams) (code int, err error)
+	OIDCAuthURL(provider string) (authURL string, code int, err error)
+	OIDCCallback(input OIDCCallbackRequest) (user *User, accessToken, refreshToken, mfaToken string, code int, err error)
+}
+
+// IStepUp is what the wallet and transaction handlers need from the auth
+// service, it asks for a fresh TOTP code before moving a large amount.
+type IStepUp interface {
+	CheckStepUp(payload JwtPayload, amount int32, totpCode string) (code int, err error)
 }
 
 type ICache interface {
 	CachingBlockedToken(payload JwtPayload) error
 	CheckBlockedToken(payload JwtPayload) error
+	ReserveVerificationResend(userID int32) error
+	ReservePasswordResetMail(userID int32) error
+	BlockUserTokens(userID int32, ttl time.Duration) error
+	BlockSession(sessionID int32, ttl time.Duration) error
+	LoginDelay(email, ip string) (time.Duration, error)
+	RecordFailedLogin(email, ip string) error
+	ClearFailedLogins(email string) error
+	SaveOIDCState(state string, arg OIDCState, ttl time.Duration) error
+	TakeOIDCState(state string) (*OIDCState, error)
 }
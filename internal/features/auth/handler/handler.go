@@ -42,9 +42,36 @@ func NewAuthHandler(router *gin.Engine, service auth.IService, pool *pgxpool.Poo
 
 	router.POST("/api/v1/auth/signup", handler.signUp)
 	router.POST("/api/v1/auth/login", handler.logIn)
+	router.POST("/api/v1/auth/login/mfa", handler.logInMFA)
+	router.GET("/api/v1/auth/oidc/:provider/login", handler.oidcLogIn)
+	router.GET("/api/v1/auth/oidc/:provider/callback", handler.oidcCallback)
 	router.POST("/api/v1/auth/logout", handler.logOut)
 	router.DELETE("/api/v1/auth/delete_user", handler.deleteUser)
 	router.POST("/api/v1/auth/refresh_token", handler.refreshToken)
+	router.GET("/api/v1/auth/verify", handler.verifyEmail)
+	router.POST("/api/v1/auth/verify/resend", handler.resendVerification)
+	router.POST("/api/v1/auth/password/forgot", handler.forgotPassword)
+	router.POST("/api/v1/auth/password/reset", handler.resetPassword)
+	router.POST("/api/v1/auth/password/change", handler.changePassword)
+	router.GET("/api/v1/auth/sessions", handler.listSessions)
+	router.DELETE("/api/v1/auth/sessions/:id", handler.revokeSession)
+	router.POST("/api/v1/auth/mfa/totp/enroll", handler.enrollTOTP)
+	router.POST("/api/v1/auth/mfa/totp/confirm", handler.confirmTOTP)
+	router.DELETE("/api/v1/auth/mfa/totp", handler.disableTOTP)
+	router.POST("/api/v1/auth/api_keys", handler.createAPIKey)
+	router.GET("/api/v1/auth/api_keys", handler.listAPIKeys)
+	router.DELETE("/api/v1/auth/api_keys/:id", handler.revokeAPIKey)
+	router.GET("/.well-known/jwks.json", handler.getJWKS)
+
+	router.GET("/api/v1/users/me", handler.getProfile)
+	router.PATCH("/api/v1/users/me", handler.updateProfile)
+	router.POST("/api/v1/users/me/addresses", handler.addAddress)
+	router.PUT("/api/v1/users/me/addresses/:id", handler.updateAddress)
+	router.DELETE("/api/v1/users/me/addresses/:id", handler.deleteAddress)
+
+	router.PUT("/api/v1/admin/users/:id/role", mid.RoleMiddleware(auth.RoleAdmin), handler.grantRole)
+	router.DELETE("/api/v1/admin/users/:id/role", mid.RoleMiddleware(auth.RoleAdmin), handler.revokeRole)
+	router.DELETE("/api/v1/admin/users/:id/lockout", mid.RoleMiddleware(auth.RoleAdmin), handler.unlockUser)
 }
 
 func translateError(trans ut.Translator, err error) (errTrans []string) {
@@ -104,12 +131,105 @@ func (d *authHandler) logIn(c *gin.Context) {
 		return
 	}
 
-	user, accessToken, refreshToken, code, err := d.service.LogIn(auth.LoginRequest(request))
+	user, accessToken, refreshToken, mfaToken, code, err := d.service.LogIn(toLoginRequest(request, c.Request.UserAgent(), c.ClientIP()))
 	if err != nil {
 		responses.ErrorJSON(c, code, []string{err.Error()}, c.Request.RemoteAddr)
 		return
 	}
 
+	if mfaToken != "" {
+		respBody := mfaChallengeResponse{
+			MFARequired: true,
+			MFAToken:    mfaToken,
+		}
+
+		response := responses.SuccessWithDataResponse(respBody, 200, "enter the code from the authenticator app")
+		c.IndentedJSON(200, response)
+		return
+	}
+
+	respBody := toLoginResponse(user, accessToken, refreshToken)
+
+	response := responses.SuccessWithDataResponse(respBody, 200, "Login success")
+	c.IndentedJSON(200, response)
+}
+
+func (d *authHandler) logInMFA(c *gin.Context) {
+	var request mfaLoginRequest
+
+	err := c.BindJSON(&request)
+	if err != nil {
+		responses.ErrorJSON(c, 422, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	err = d.validate.Struct(request)
+	if err != nil {
+		errTranslated := translateError(d.trans, err)
+		responses.ErrorJSON(c, 422, errTranslated, c.Request.RemoteAddr)
+		return
+	}
+
+	user, accessToken, refreshToken, code, err := d.service.LogInMFA(toMFALoginRequest(request, c.Request.UserAgent(), c.ClientIP()))
+	if err != nil {
+		responses.ErrorJSON(c, code, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	respBody := toLoginResponse(user, accessToken, refreshToken)
+
+	response := responses.SuccessWithDataResponse(respBody, 200, "Login success")
+	c.IndentedJSON(200, response)
+}
+
+func (d *authHandler) oidcLogIn(c *gin.Context) {
+	authURL, code, err := d.service.OIDCAuthURL(c.Param("provider"))
+	if err != nil {
+		responses.ErrorJSON(c, code, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	c.Redirect(http.StatusFound, authURL)
+}
+
+func (d *authHandler) oidcCallback(c *gin.Context) {
+	var request oidcCallbackRequest
+	err := c.ShouldBindQuery(&request)
+	if err != nil {
+		responses.ErrorJSON(c, 422, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	err = d.validate.Struct(request)
+	if err != nil {
+		errTranslated := translateError(d.trans, err)
+		responses.ErrorJSON(c, 422, errTranslated, c.Request.RemoteAddr)
+		return
+	}
+
+	// the user cancelled or the provider refused
+	if request.Error != "" {
+		responses.ErrorJSON(c, responses.CodeFailedUnauthorized, []string{responses.ErrOIDCLogin.Error(), request.Error}, c.Request.RemoteAddr)
+		return
+	}
+
+	user, accessToken, refreshToken, mfaToken, code, err := d.service.OIDCCallback(toOIDCCallbackRequest(c.Param("provider"), request, c.Request.UserAgent(), c.ClientIP()))
+	if err != nil {
+		responses.ErrorJSON(c, code, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	if mfaToken != "" {
+		respBody := mfaChallengeResponse{
+			MFARequired: true,
+			MFAToken:    mfaToken,
+		}
+
+		response := responses.SuccessWithDataResponse(respBody, 200, "enter the code from the authenticator app")
+		c.IndentedJSON(200, response)
+		return
+	}
+
 	respBody := toLoginResponse(user, accessToken, refreshToken)
 
 	response := responses.SuccessWithDataResponse(respBody, 200, "Login success")
@@ -184,3 +304,558 @@ func (d *authHandler) deleteUser(c *gin.Context) {
 	response := responses.SuccessResponse("user deleted")
 	c.IndentedJSON(code, response)
 }
+
+func (d *authHandler) grantRole(c *gin.Context) {
+	var param userIDUrlParam
+	err := c.ShouldBindUri(&param)
+	if err != nil {
+		responses.ErrorJSON(c, 422, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	var request grantRoleRequest
+	err = c.BindJSON(&request)
+	if err != nil {
+		responses.ErrorJSON(c, 422, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	err = d.validate.Struct(request)
+	if err != nil {
+		errTranslated := translateError(d.trans, err)
+		responses.ErrorJSON(c, 422, errTranslated, c.Request.RemoteAddr)
+		return
+	}
+
+	user, code, err := d.service.GrantRole(auth.UpdateUserRoleParams{ID: param.ID, Role: auth.Role(request.Role)})
+	if err != nil {
+		responses.ErrorJSON(c, code, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	response := responses.SuccessWithDataResponse(toUserRoleResponse(user), code, "role granted")
+	c.IndentedJSON(code, response)
+}
+
+func (d *authHandler) revokeRole(c *gin.Context) {
+	var param userIDUrlParam
+	err := c.ShouldBindUri(&param)
+	if err != nil {
+		responses.ErrorJSON(c, 422, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	user, code, err := d.service.RevokeRole(param.ID)
+	if err != nil {
+		responses.ErrorJSON(c, code, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	response := responses.SuccessWithDataResponse(toUserRoleResponse(user), code, "role revoked")
+	c.IndentedJSON(code, response)
+}
+
+func (d *authHandler) unlockUser(c *gin.Context) {
+	var param userIDUrlParam
+	err := c.ShouldBindUri(&param)
+	if err != nil {
+		responses.ErrorJSON(c, 422, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	code, err := d.service.UnlockUser(param.ID)
+	if err != nil {
+		responses.ErrorJSON(c, code, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	response := responses.SuccessResponse("user unlocked")
+	c.IndentedJSON(code, response)
+}
+
+func (d *authHandler) verifyEmail(c *gin.Context) {
+	var request verifyEmailRequest
+	err := c.ShouldBindQuery(&request)
+	if err != nil {
+		responses.ErrorJSON(c, 422, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	err = d.validate.Struct(request)
+	if err != nil {
+		errTranslated := translateError(d.trans, err)
+		responses.ErrorJSON(c, 422, errTranslated, c.Request.RemoteAddr)
+		return
+	}
+
+	code, err := d.service.VerifyEmail(request.Token)
+	if err != nil {
+		responses.ErrorJSON(c, code, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	response := responses.SuccessResponse("email verified")
+	c.IndentedJSON(code, response)
+}
+
+func (d *authHandler) resendVerification(c *gin.Context) {
+	authPayload, isExists := c.Keys["payloadKey"].(*auth.JwtPayload)
+	if !isExists {
+		responses.ErrorJSON(c, 401, []string{"token is wrong"}, c.Request.RemoteAddr)
+		return
+	}
+
+	code, err := d.service.ResendVerification(*authPayload)
+	if err != nil {
+		responses.ErrorJSON(c, code, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	response := responses.SuccessResponse("verification email sent")
+	c.IndentedJSON(code, response)
+}
+
+func (d *authHandler) forgotPassword(c *gin.Context) {
+	var request forgotPasswordRequest
+	err := c.BindJSON(&request)
+	if err != nil {
+		responses.ErrorJSON(c, 422, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	err = d.validate.Struct(request)
+	if err != nil {
+		errTranslated := translateError(d.trans, err)
+		responses.ErrorJSON(c, 422, errTranslated, c.Request.RemoteAddr)
+		return
+	}
+
+	code, err := d.service.ForgotPassword(request.Email)
+	if err != nil {
+		responses.ErrorJSON(c, code, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	response := responses.SuccessResponse("if the email is registered, a password reset link has been sent")
+	c.IndentedJSON(code, response)
+}
+
+func (d *authHandler) resetPassword(c *gin.Context) {
+	var request resetPasswordRequest
+	err := c.BindJSON(&request)
+	if err != nil {
+		responses.ErrorJSON(c, 422, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	err = d.validate.Struct(request)
+	if err != nil {
+		errTranslated := translateError(d.trans, err)
+		responses.ErrorJSON(c, 422, errTranslated, c.Request.RemoteAddr)
+		return
+	}
+
+	code, err := d.service.ResetPassword(request.Token, request.NewPassword)
+	if err != nil {
+		responses.ErrorJSON(c, code, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	response := responses.SuccessResponse("password reset, log in with the new password")
+	c.IndentedJSON(code, response)
+}
+
+func (d *authHandler) changePassword(c *gin.Context) {
+	authPayload, isExists := c.Keys["payloadKey"].(*auth.JwtPayload)
+	if !isExists {
+		responses.ErrorJSON(c, 401, []string{"token is wrong"}, c.Request.RemoteAddr)
+		return
+	}
+
+	var request changePasswordRequest
+	err := c.BindJSON(&request)
+	if err != nil {
+		responses.ErrorJSON(c, 422, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	err = d.validate.Struct(request)
+	if err != nil {
+		errTranslated := translateError(d.trans, err)
+		responses.ErrorJSON(c, 422, errTranslated, c.Request.RemoteAddr)
+		return
+	}
+
+	code, err := d.service.ChangePassword(*authPayload, request.OldPassword, request.NewPassword)
+	if err != nil {
+		responses.ErrorJSON(c, code, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	response := responses.SuccessResponse("password changed, log in with the new password")
+	c.IndentedJSON(code, response)
+}
+
+func (d *authHandler) getProfile(c *gin.Context) {
+	authPayload, isExists := c.Keys["payloadKey"].(*auth.JwtPayload)
+	if !isExists {
+		responses.ErrorJSON(c, 401, []string{"token is wrong"}, c.Request.RemoteAddr)
+		return
+	}
+
+	profile, code, err := d.service.GetProfile(authPayload.UserID)
+	if err != nil {
+		responses.ErrorJSON(c, code, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	response := responses.SuccessWithDataResponse(toProfileResponse(profile), code, "profile")
+	c.IndentedJSON(code, response)
+}
+
+func (d *authHandler) updateProfile(c *gin.Context) {
+	authPayload, isExists := c.Keys["payloadKey"].(*auth.JwtPayload)
+	if !isExists {
+		responses.ErrorJSON(c, 401, []string{"token is wrong"}, c.Request.RemoteAddr)
+		return
+	}
+
+	var request updateProfileRequest
+	err := c.BindJSON(&request)
+	if err != nil {
+		responses.ErrorJSON(c, 422, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	err = d.validate.Struct(request)
+	if err != nil {
+		errTranslated := translateError(d.trans, err)
+		responses.ErrorJSON(c, 422, errTranslated, c.Request.RemoteAddr)
+		return
+	}
+
+	profile, accessToken, code, err := d.service.UpdateProfile(*authPayload, toUpdateProfileArg(authPayload.UserID, request))
+	if err != nil {
+		responses.ErrorJSON(c, code, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	res := updateProfileResponse{
+		Profile:     toProfileResponse(profile),
+		AccessToken: accessToken,
+	}
+	response := responses.SuccessWithDataResponse(res, code, "profile updated")
+	c.IndentedJSON(code, response)
+}
+
+func (d *authHandler) addAddress(c *gin.Context) {
+	authPayload, isExists := c.Keys["payloadKey"].(*auth.JwtPayload)
+	if !isExists {
+		responses.ErrorJSON(c, 401, []string{"token is wrong"}, c.Request.RemoteAddr)
+		return
+	}
+
+	var request addressRequest
+	err := c.BindJSON(&request)
+	if err != nil {
+		responses.ErrorJSON(c, 422, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	err = d.validate.Struct(request)
+	if err != nil {
+		errTranslated := translateError(d.trans, err)
+		responses.ErrorJSON(c, 422, errTranslated, c.Request.RemoteAddr)
+		return
+	}
+
+	address, code, err := d.service.AddAddress(toAddressArg(authPayload.UserID, 0, request))
+	if err != nil {
+		responses.ErrorJSON(c, code, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	response := responses.SuccessWithDataResponse(toAddressResponse(address), code, "address added")
+	c.IndentedJSON(code, response)
+}
+
+func (d *authHandler) updateAddress(c *gin.Context) {
+	authPayload, isExists := c.Keys["payloadKey"].(*auth.JwtPayload)
+	if !isExists {
+		responses.ErrorJSON(c, 401, []string{"token is wrong"}, c.Request.RemoteAddr)
+		return
+	}
+
+	var param addressIDUrlParam
+	err := c.ShouldBindUri(&param)
+	if err != nil {
+		responses.ErrorJSON(c, 422, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	var request addressRequest
+	err = c.BindJSON(&request)
+	if err != nil {
+		responses.ErrorJSON(c, 422, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	err = d.validate.Struct(request)
+	if err != nil {
+		errTranslated := translateError(d.trans, err)
+		responses.ErrorJSON(c, 422, errTranslated, c.Request.RemoteAddr)
+		return
+	}
+
+	address, code, err := d.service.UpdateAddress(toAddressArg(authPayload.UserID, param.ID, request))
+	if err != nil {
+		responses.ErrorJSON(c, code, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	response := responses.SuccessWithDataResponse(toAddressResponse(address), code, "address updated")
+	c.IndentedJSON(code, response)
+}
+
+func (d *authHandler) deleteAddress(c *gin.Context) {
+	authPayload, isExists := c.Keys["payloadKey"].(*auth.JwtPayload)
+	if !isExists {
+		responses.ErrorJSON(c, 401, []string{"token is wrong"}, c.Request.RemoteAddr)
+		return
+	}
+
+	var param addressIDUrlParam
+	err := c.ShouldBindUri(&param)
+	if err != nil {
+		responses.ErrorJSON(c, 422, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	code, err := d.service.DeleteAddress(auth.DeleteAddressParams{ID: param.ID, UserID: authPayload.UserID})
+	if err != nil {
+		responses.ErrorJSON(c, code, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	response := responses.SuccessResponse("address deleted")
+	c.IndentedJSON(code, response)
+}
+
+func (d *authHandler) listSessions(c *gin.Context) {
+	authPayload, isExists := c.Keys["payloadKey"].(*auth.JwtPayload)
+	if !isExists {
+		responses.ErrorJSON(c, 401, []string{"token is wrong"}, c.Request.RemoteAddr)
+		return
+	}
+
+	sessions, code, err := d.service.ListSessions(authPayload.UserID)
+	if err != nil {
+		responses.ErrorJSON(c, code, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	response := responses.SuccessWithDataResponse(toSessionsResponse(sessions, authPayload.SessionID), code, "sessions")
+	c.IndentedJSON(code, response)
+}
+
+func (d *authHandler) revokeSession(c *gin.Context) {
+	authPayload, isExists := c.Keys["payloadKey"].(*auth.JwtPayload)
+	if !isExists {
+		responses.ErrorJSON(c, 401, []string{"token is wrong"}, c.Request.RemoteAddr)
+		return
+	}
+
+	var param sessionIDUrlParam
+	err := c.ShouldBindUri(&param)
+	if err != nil {
+		responses.ErrorJSON(c, 422, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	code, err := d.service.RevokeSession(auth.DeleteSessionParams{ID: param.ID, UserID: authPayload.UserID})
+	if err != nil {
+		responses.ErrorJSON(c, code, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	response := responses.SuccessResponse("session revoked")
+	c.IndentedJSON(code, response)
+}
+
+func (d *authHandler) enrollTOTP(c *gin.Context) {
+	authPayload, isExists := c.Keys["payloadKey"].(*auth.JwtPayload)
+	if !isExists {
+		responses.ErrorJSON(c, 401, []string{"token is wrong"}, c.Request.RemoteAddr)
+		return
+	}
+
+	enrollment, code, err := d.service.EnrollTOTP(*authPayload)
+	if err != nil {
+		responses.ErrorJSON(c, code, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	respBody := totpEnrollmentResponse{
+		Secret: enrollment.Secret,
+		URI:    enrollment.URI,
+	}
+
+	response := responses.SuccessWithDataResponse(respBody, code, "add the secret to the authenticator app and confirm it with a code")
+	c.IndentedJSON(code, response)
+}
+
+func (d *authHandler) confirmTOTP(c *gin.Context) {
+	authPayload, isExists := c.Keys["payloadKey"].(*auth.JwtPayload)
+	if !isExists {
+		responses.ErrorJSON(c, 401, []string{"token is wrong"}, c.Request.RemoteAddr)
+		return
+	}
+
+	var request totpCodeRequest
+	err := c.BindJSON(&request)
+	if err != nil {
+		responses.ErrorJSON(c, 422, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	err = d.validate.Struct(request)
+	if err != nil {
+		errTranslated := translateError(d.trans, err)
+		responses.ErrorJSON(c, 422, errTranslated, c.Request.RemoteAddr)
+		return
+	}
+
+	recoveryCodes, code, err := d.service.ConfirmTOTP(*authPayload, request.Code)
+	if err != nil {
+		responses.ErrorJSON(c, code, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	respBody := recoveryCodesResponse{
+		RecoveryCodes: recoveryCodes,
+	}
+
+	response := responses.SuccessWithDataResponse(respBody, code, "totp is enabled, keep the recovery codes somewhere safe")
+	c.IndentedJSON(code, response)
+}
+
+func (d *authHandler) disableTOTP(c *gin.Context) {
+	authPayload, isExists := c.Keys["payloadKey"].(*auth.JwtPayload)
+	if !isExists {
+		responses.ErrorJSON(c, 401, []string{"token is wrong"}, c.Request.RemoteAddr)
+		return
+	}
+
+	var request totpCodeRequest
+	err := c.BindJSON(&request)
+	if err != nil {
+		responses.ErrorJSON(c, 422, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	err = d.validate.Struct(request)
+	if err != nil {
+		errTranslated := translateError(d.trans, err)
+		responses.ErrorJSON(c, 422, errTranslated, c.Request.RemoteAddr)
+		return
+	}
+
+	code, err := d.service.DisableTOTP(*authPayload, request.Code)
+	if err != nil {
+		responses.ErrorJSON(c, code, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	response := responses.SuccessResponse("totp is disabled")
+	c.IndentedJSON(code, response)
+}
+
+func (d *authHandler) createAPIKey(c *gin.Context) {
+	authPayload, isExists := c.Keys["payloadKey"].(*auth.JwtPayload)
+	if !isExists {
+		responses.ErrorJSON(c, 401, []string{"token is wrong"}, c.Request.RemoteAddr)
+		return
+	}
+
+	var request createAPIKeyRequest
+	err := c.BindJSON(&request)
+	if err != nil {
+		responses.ErrorJSON(c, 422, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	err = d.validate.Struct(request)
+	if err != nil {
+		errTranslated := translateError(d.trans, err)
+		responses.ErrorJSON(c, 422, errTranslated, c.Request.RemoteAddr)
+		return
+	}
+
+	apiKey, key, code, err := d.service.CreateAPIKey(toCreateAPIKeyArg(authPayload.UserID, request))
+	if err != nil {
+		responses.ErrorJSON(c, code, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	respBody := createAPIKeyResponse{
+		apiKeyResponse: toAPIKeyResponse(apiKey),
+		Key:            key,
+	}
+
+	response := responses.SuccessWithDataResponse(respBody, code, "api key created, it's only shown once")
+	c.IndentedJSON(code, response)
+}
+
+func (d *authHandler) listAPIKeys(c *gin.Context) {
+	authPayload, isExists := c.Keys["payloadKey"].(*auth.JwtPayload)
+	if !isExists {
+		responses.ErrorJSON(c, 401, []string{"token is wrong"}, c.Request.RemoteAddr)
+		return
+	}
+
+	apiKeys, code, err := d.service.ListAPIKeys(authPayload.UserID)
+	if err != nil {
+		responses.ErrorJSON(c, code, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	response := responses.SuccessWithDataResponse(toAPIKeysResponse(apiKeys), code, "api keys")
+	c.IndentedJSON(code, response)
+}
+
+func (d *authHandler) revokeAPIKey(c *gin.Context) {
+	authPayload, isExists := c.Keys["payloadKey"].(*auth.JwtPayload)
+	if !isExists {
+		responses.ErrorJSON(c, 401, []string{"token is wrong"}, c.Request.RemoteAddr)
+		return
+	}
+
+	var param apiKeyIDUrlParam
+	err := c.ShouldBindUri(&param)
+	if err != nil {
+		responses.ErrorJSON(c, 422, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	code, err := d.service.RevokeAPIKey(auth.DeleteAPIKeyParams{ID: param.ID, UserID: authPayload.UserID})
+	if err != nil {
+		responses.ErrorJSON(c, code, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	response := responses.SuccessResponse("api key revoked")
+	c.IndentedJSON(code, response)
+}
+
+// getJWKS publishes the public keys as a plain JWK set, clients that verify
+// tokens read it as it is so it isn't wrapped in the usual response.
+func (d *authHandler) getJWKS(c *gin.Context) {
+	jwks, code, err := d.service.GetJWKS()
+	if err != nil {
+		responses.ErrorJSON(c, code, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(code, jwks)
+}
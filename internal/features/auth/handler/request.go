@@ -1,7 +1,11 @@
 package delivery
 
 import (
+	"time"
+
 	auth "github.com/dwiw96/GoCommerceAPI/internal/features/auth"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 type signupRequest struct {
@@ -21,9 +25,176 @@ func toSignUpRequest(input signupRequest) auth.SignupRequest {
 type signinRequest struct {
 	Email    string `json:"email" validate:"required,email,max=255"`
 	Password string `json:"password" validate:"required,min=7"`
+	// DeviceName names the session in the session list
+	DeviceName string `json:"device_name" validate:"max=255"`
+	RememberMe bool   `json:"remember_me"`
+}
+
+func toLoginRequest(input signinRequest, userAgent, ip string) auth.LoginRequest {
+	return auth.LoginRequest{
+		Email:      input.Email,
+		Password:   input.Password,
+		DeviceName: input.DeviceName,
+		UserAgent:  userAgent,
+		IPAddress:  ip,
+		RememberMe: input.RememberMe,
+	}
+}
+
+type mfaLoginRequest struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+	// Code is a TOTP code or one of the recovery codes
+	Code       string `json:"code" validate:"required,max=32"`
+	DeviceName string `json:"device_name" validate:"max=255"`
+	RememberMe bool   `json:"remember_me"`
+}
+
+func toMFALoginRequest(input mfaLoginRequest, userAgent, ip string) auth.MFALoginRequest {
+	return auth.MFALoginRequest{
+		MFAToken:   input.MFAToken,
+		Code:       input.Code,
+		DeviceName: input.DeviceName,
+		UserAgent:  userAgent,
+		IPAddress:  ip,
+		RememberMe: input.RememberMe,
+	}
+}
+
+// oidcCallbackRequest is the redirect back from the provider, Error is set
+// instead of Code when the user didn't log in.
+type oidcCallbackRequest struct {
+	Code  string `form:"code" validate:"required_without=Error"`
+	State string `form:"state" validate:"required"`
+	Error string `form:"error"`
+}
+
+func toOIDCCallbackRequest(provider string, input oidcCallbackRequest, userAgent, ip string) auth.OIDCCallbackRequest {
+	return auth.OIDCCallbackRequest{
+		Provider:  provider,
+		Code:      input.Code,
+		State:     input.State,
+		UserAgent: userAgent,
+		IPAddress: ip,
+	}
+}
+
+type totpCodeRequest struct {
+	Code string `json:"code" validate:"required,max=32"`
 }
 
 type refreshTokenRequest struct {
 	RefreshToken string `json:"refresh_token"`
 	AccessToken  string `json:"access_token"`
 }
+
+type userIDUrlParam struct {
+	ID int32 `uri:"id" validate:"required,number"`
+}
+
+type grantRoleRequest struct {
+	Role string `json:"role" validate:"required,oneof=customer staff admin"`
+}
+
+type verifyEmailRequest struct {
+	Token string `form:"token" validate:"required"`
+}
+
+type forgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+type resetPasswordRequest struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required,min=7"`
+}
+
+type changePasswordRequest struct {
+	OldPassword string `json:"old_password" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required,min=7,nefield=OldPassword"`
+}
+
+// updateProfileRequest leaves out the fields that aren't sent, an empty
+// full_name or phone clears it.
+type updateProfileRequest struct {
+	Username *string `json:"username" validate:"omitnil,min=2"`
+	Email    *string `json:"email" validate:"omitnil,email,max=255"`
+	FullName *string `json:"full_name" validate:"omitnil,max=255"`
+	Phone    *string `json:"phone" validate:"omitempty,e164"`
+}
+
+func toUpdateProfileArg(userID int32, input updateProfileRequest) auth.UpdateProfileParams {
+	return auth.UpdateProfileParams{
+		ID:       userID,
+		Username: toText(input.Username),
+		Email:    toText(input.Email),
+		FullName: toText(input.FullName),
+		Phone:    toText(input.Phone),
+	}
+}
+
+func toText(input *string) pgtype.Text {
+	if input == nil {
+		return pgtype.Text{}
+	}
+	return pgtype.Text{String: *input, Valid: true}
+}
+
+type addressIDUrlParam struct {
+	ID int32 `uri:"id" validate:"required,number"`
+}
+
+type addressRequest struct {
+	Label      string `json:"label" validate:"max=50"`
+	Recipient  string `json:"recipient" validate:"required,max=255"`
+	Phone      string `json:"phone" validate:"omitempty,e164"`
+	Street     string `json:"street" validate:"required,max=255"`
+	City       string `json:"city" validate:"required,max=100"`
+	Province   string `json:"province" validate:"max=100"`
+	PostalCode string `json:"postal_code" validate:"max=20"`
+	Country    string `json:"country" validate:"required,max=100"`
+	IsDefault  bool   `json:"is_default"`
+}
+
+func toAddressArg(userID, addressID int32, input addressRequest) auth.AddressParams {
+	return auth.AddressParams{
+		ID:         addressID,
+		UserID:     userID,
+		Label:      input.Label,
+		Recipient:  input.Recipient,
+		Phone:      input.Phone,
+		Street:     input.Street,
+		City:       input.City,
+		Province:   input.Province,
+		PostalCode: input.PostalCode,
+		Country:    input.Country,
+		IsDefault:  input.IsDefault,
+	}
+}
+
+type sessionIDUrlParam struct {
+	ID int32 `uri:"id" validate:"required,number"`
+}
+
+// createAPIKeyRequest leaves expires_at out for a key that never expires.
+type createAPIKeyRequest struct {
+	Name      string     `json:"name" validate:"required,max=255"`
+	Scopes    []string   `json:"scopes" validate:"required,min=1,dive,required"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func toCreateAPIKeyArg(userID int32, input createAPIKeyRequest) auth.CreateAPIKeyRequest {
+	arg := auth.CreateAPIKeyRequest{
+		UserID: userID,
+		Name:   input.Name,
+		Scopes: input.Scopes,
+	}
+	if input.ExpiresAt != nil {
+		arg.ExpiresAt = pgtype.Timestamp{Time: input.ExpiresAt.UTC(), Valid: true}
+	}
+
+	return arg
+}
+
+type apiKeyIDUrlParam struct {
+	ID int32 `uri:"id" validate:"required,number"`
+}
@@ -1,6 +1,10 @@
 package delivery
 
-import auth "github.com/dwiw96/GoCommerceAPI/internal/features/auth"
+import (
+	"time"
+
+	auth "github.com/dwiw96/GoCommerceAPI/internal/features/auth"
+)
 
 type signupResponse struct {
 	Username string `json:"username"`
@@ -18,6 +22,7 @@ type loginResponse struct {
 	ID           int32  `json:"id"`
 	Username     string `json:"Username"`
 	Email        string `json:"email"`
+	Role         string `json:"role"`
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
 }
@@ -26,12 +31,192 @@ func toLoginResponse(input *auth.User, accessToken, refreshToken string) loginRe
 	return loginResponse{
 		Username:     input.Username,
 		Email:        input.Email,
+		Role:         string(input.Role),
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
 	}
 }
 
+// mfaChallengeResponse is the log in of a user with TOTP, the token is sent
+// to /api/v1/auth/login/mfa with a code.
+type mfaChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+
+type totpEnrollmentResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
 type refreshTokenResponse struct {
 	RefreshToken string `json:"refresh_token"`
 	AccessToken  string `json:"access_token"`
 }
+
+type userRoleResponse struct {
+	ID       int32  `json:"id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Role     string `json:"role"`
+}
+
+func toUserRoleResponse(input *auth.User) userRoleResponse {
+	return userRoleResponse{
+		ID:       input.ID,
+		Username: input.Username,
+		Email:    input.Email,
+		Role:     string(input.Role),
+	}
+}
+
+type addressResponse struct {
+	ID         int32     `json:"id"`
+	Label      string    `json:"label"`
+	Recipient  string    `json:"recipient"`
+	Phone      string    `json:"phone"`
+	Street     string    `json:"street"`
+	City       string    `json:"city"`
+	Province   string    `json:"province"`
+	PostalCode string    `json:"postal_code"`
+	Country    string    `json:"country"`
+	IsDefault  bool      `json:"is_default"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func toAddressResponse(input *auth.Address) addressResponse {
+	return addressResponse{
+		ID:         input.ID,
+		Label:      input.Label,
+		Recipient:  input.Recipient,
+		Phone:      input.Phone,
+		Street:     input.Street,
+		City:       input.City,
+		Province:   input.Province,
+		PostalCode: input.PostalCode,
+		Country:    input.Country,
+		IsDefault:  input.IsDefault,
+		CreatedAt:  input.CreatedAt,
+		UpdatedAt:  input.UpdatedAt,
+	}
+}
+
+type profileResponse struct {
+	ID         int32             `json:"id"`
+	Username   string            `json:"username"`
+	Email      string            `json:"email"`
+	FullName   *string           `json:"full_name"`
+	Phone      *string           `json:"phone"`
+	IsVerified bool              `json:"is_verified"`
+	Role       string            `json:"role"`
+	CreatedAt  time.Time         `json:"created_at"`
+	Addresses  []addressResponse `json:"addresses"`
+}
+
+func toProfileResponse(input *auth.Profile) profileResponse {
+	res := profileResponse{
+		ID:         input.ID,
+		Username:   input.Username,
+		Email:      input.Email,
+		IsVerified: input.IsVerified,
+		Role:       string(input.Role),
+		CreatedAt:  input.CreatedAt,
+		Addresses:  []addressResponse{},
+	}
+	if input.FullName.Valid {
+		res.FullName = &input.FullName.String
+	}
+	if input.Phone.Valid {
+		res.Phone = &input.Phone.String
+	}
+	for i := range input.Addresses {
+		res.Addresses = append(res.Addresses, toAddressResponse(&input.Addresses[i]))
+	}
+
+	return res
+}
+
+type updateProfileResponse struct {
+	Profile     profileResponse `json:"profile"`
+	AccessToken string          `json:"access_token"`
+}
+
+type sessionResponse struct {
+	ID         int32     `json:"id"`
+	DeviceName string    `json:"device_name"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	Current    bool      `json:"current"`
+	RememberMe bool      `json:"remember_me"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// toSessionsResponse marks the session with currentID as the current one.
+func toSessionsResponse(input []auth.RefreshTokenWhitelist, currentID int32) []sessionResponse {
+	res := []sessionResponse{}
+	for _, session := range input {
+		res = append(res, sessionResponse{
+			ID:         session.ID,
+			DeviceName: session.DeviceName,
+			UserAgent:  session.UserAgent,
+			IPAddress:  session.IPAddress,
+			Current:    session.ID == currentID,
+			RememberMe: session.RememberMe,
+			LastUsedAt: session.LastUsedAt,
+			ExpiresAt:  session.ExpiresAt,
+			CreatedAt:  session.CreatedAt,
+		})
+	}
+
+	return res
+}
+
+type apiKeyResponse struct {
+	ID         int32      `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func toAPIKeyResponse(input *auth.APIKey) apiKeyResponse {
+	res := apiKeyResponse{
+		ID:        input.ID,
+		Name:      input.Name,
+		Prefix:    input.Prefix,
+		Scopes:    input.Scopes,
+		CreatedAt: input.CreatedAt,
+	}
+	if input.ExpiresAt.Valid {
+		res.ExpiresAt = &input.ExpiresAt.Time
+	}
+	if input.LastUsedAt.Valid {
+		res.LastUsedAt = &input.LastUsedAt.Time
+	}
+
+	return res
+}
+
+func toAPIKeysResponse(input []auth.APIKey) []apiKeyResponse {
+	res := []apiKeyResponse{}
+	for i := range input {
+		res = append(res, toAPIKeyResponse(&input[i]))
+	}
+
+	return res
+}
+
+// createAPIKeyResponse is the only time the key is shown.
+type createAPIKeyResponse struct {
+	apiKeyResponse
+	Key string `json:"key"`
+}
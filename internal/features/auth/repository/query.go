@@ -2,15 +2,16 @@ package repository
 
 import (
 	"context"
-	"crypto/rsa"
-	"crypto/x509"
-	"errors"
 	"fmt"
+	"time"
 
 	db "github.com/dwiw96/GoCommerceAPI/internal/db"
 	auth "github.com/dwiw96/GoCommerceAPI/internal/features/auth"
+	password "github.com/dwiw96/GoCommerceAPI/pkg/utils/password"
+	signer "github.com/dwiw96/GoCommerceAPI/pkg/utils/signer"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -49,14 +50,15 @@ const createUser = `-- name: CreateUser :one
 INSERT INTO users(
     username,
     email,
-    hashed_password
+    hashed_password,
+    role
 ) VALUES (
-    $1, $2, $3
-) RETURNING id, username, email, hashed_password, is_verified, created_at
+    $1, $2, $3, COALESCE(NULLIF($4::VARCHAR, ''), 'customer')::user_roles
+) RETURNING id, username, email, hashed_password, is_verified, role, created_at
 `
 
 func (r *authRepository) CreateUser(ctx context.Context, arg auth.CreateUserParams) (*auth.User, error) {
-	row := r.db.QueryRow(ctx, createUser, arg.Username, arg.Email, arg.HashedPassword)
+	row := r.db.QueryRow(ctx, createUser, arg.Username, arg.Email, arg.HashedPassword, arg.Role)
 	var i auth.User
 	err := row.Scan(
 		&i.ID,
@@ -64,13 +66,14 @@ func (r *authRepository) CreateUser(ctx context.Context, arg auth.CreateUserPara
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsVerified,
+		&i.Role,
 		&i.CreatedAt,
 	)
 	return &i, err
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, username, email, hashed_password, is_verified, created_at FROM users WHERE email = $1
+SELECT id, username, email, hashed_password, is_verified, role, created_at FROM users WHERE email = $1
 `
 
 func (r *authRepository) GetUserByEmail(ctx context.Context, email string) (*auth.User, error) {
@@ -82,6 +85,7 @@ func (r *authRepository) GetUserByEmail(ctx context.Context, email string) (*aut
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsVerified,
+		&i.Role,
 		&i.CreatedAt,
 	)
 	return &i, err
@@ -98,7 +102,7 @@ WHERE
 AND (
     $1::VARCHAR IS NOT NULL AND $1 IS DISTINCT FROM username OR
     $2::VARCHAR IS NOT NULL AND $2 IS DISTINCT FROM hashed_password
-) RETURNING id, username, email, hashed_password, is_verified, created_at
+) RETURNING id, username, email, hashed_password, is_verified, role, created_at
 `
 
 func (r *authRepository) UpdateUser(ctx context.Context, arg auth.UpdateUserParams) (*auth.User, error) {
@@ -110,6 +114,7 @@ func (r *authRepository) UpdateUser(ctx context.Context, arg auth.UpdateUserPara
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsVerified,
+		&i.Role,
 		&i.CreatedAt,
 	)
 	return &i, err
@@ -132,108 +137,1419 @@ func (r *authRepository) DeleteUser(ctx context.Context, arg auth.DeleteUserPara
 	return err
 }
 
-func (r *authRepository) LoadKey(ctx context.Context) (key *rsa.PrivateKey, err error) {
-	query := "select private_key from sec_m"
-	var keyBytes []byte
-	rows, err := r.db.Query(ctx, query)
+const updateUserRole = `-- name: UpdateUserRole :one
+UPDATE
+    users
+SET
+    role = $2
+WHERE
+    id = $1
+RETURNING id, username, email, hashed_password, is_verified, role, created_at
+`
+
+func (r *authRepository) UpdateUserRole(ctx context.Context, arg auth.UpdateUserRoleParams) (*auth.User, error) {
+	row := r.db.QueryRow(ctx, updateUserRole, arg.ID, arg.Role)
+	var i auth.User
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsVerified,
+		&i.Role,
+		&i.CreatedAt,
+	)
+	return &i, err
+}
+
+const updateUserVerification = `-- name: UpdateUserVerification :exec
+UPDATE users SET is_verified = TRUE WHERE id = $1 AND email = $2
+`
+
+func (r *authRepository) UpdateUserVerification(ctx context.Context, arg auth.UpdateUserVerificationParams) error {
+	res, err := r.db.Exec(ctx, updateUserVerification, arg.ID, arg.Email)
 	if err != nil {
-		errMsg := fmt.Errorf("failed to load private key, err: %v", err)
-		return nil, errMsg
+		return err
 	}
-	defer rows.Close()
 
-	if rows.Next() {
-		err = rows.Scan(&keyBytes)
-		if err != nil {
-			errMsg := fmt.Errorf("failed to scan private key, err: %v", err)
-			return nil, errMsg
-		}
+	if res.RowsAffected() == 0 {
+		return fmt.Errorf("failed to verify user, err: %w", pgx.ErrNoRows)
+	}
+	return nil
+}
+
+const createPasswordResetToken = `-- name: CreatePasswordResetToken :exec
+INSERT INTO password_reset_tokens(
+    user_id,
+    token_hash,
+    expires_at
+) VALUES (
+    $1, $2, $3
+)
+`
+
+func (r *authRepository) CreatePasswordResetToken(ctx context.Context, arg auth.CreatePasswordResetTokenParams) error {
+	_, err := r.db.Exec(ctx, createPasswordResetToken, arg.UserID, arg.TokenHash, arg.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to create password reset token, err: %v", err)
+	}
+
+	return nil
+}
+
+// usePasswordResetToken marks the token as used, it returns no rows when the
+// token doesn't exist, is used or is expired.
+const usePasswordResetToken = `-- name: UsePasswordResetToken :one
+UPDATE
+    password_reset_tokens
+SET
+    used_at = NOW()
+WHERE
+    token_hash = $1
+AND used_at IS NULL
+AND expires_at > NOW()
+RETURNING user_id
+`
+
+const updatePassword = `-- name: UpdatePassword :one
+UPDATE
+    users
+SET
+    hashed_password = $2
+WHERE
+    id = $1
+RETURNING id, username, email, hashed_password, is_verified, role, created_at
+`
+
+const deleteUserRefreshTokens = `-- name: DeleteUserRefreshTokens :exec
+DELETE FROM refresh_token_whitelist WHERE user_id = $1
+`
+
+const deleteUnusedPasswordResetTokens = `-- name: DeleteUnusedPasswordResetTokens :exec
+DELETE FROM password_reset_tokens WHERE user_id = $1 AND used_at IS NULL
+`
 
-		privateKey, err := x509.ParsePKCS1PrivateKey(keyBytes)
+// ResetPassword uses the reset token and sets the password of its user. It
+// wraps pgx.ErrNoRows when the token can't be used.
+func (r *authRepository) ResetPassword(ctx context.Context, arg auth.ResetPasswordParams) (*auth.User, error) {
+	var i auth.User
+	err := r.ExecDbTx(ctx, func(ar *authRepository) error {
+		var userID int32
+		err := ar.db.QueryRow(ctx, usePasswordResetToken, arg.TokenHash).Scan(&userID)
 		if err != nil {
-			errMsg := fmt.Errorf("failed to parse private key, err: %v", err)
-			return nil, errMsg
+			return fmt.Errorf("failed to use password reset token, err: %w", err)
 		}
 
-		return privateKey, nil
+		return ar.setPassword(ctx, auth.UpdatePasswordParams{ID: userID, HashedPassword: arg.HashedPassword}, &i)
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return nil, errors.New("no private key found in database")
+	return &i, nil
 }
 
-func (r *authRepository) ReadRefreshToken(ctx context.Context, userID int32, refreshToken uuid.UUID) (res *auth.RefreshTokenWhitelist, err error) {
-	query := "SELECT * FROM refresh_token_whitelist WHERE user_id = $1 AND refresh_token = $2;"
-
-	var result auth.RefreshTokenWhitelist
-	err = r.db.QueryRow(ctx, query, userID, refreshToken).Scan(&result.ID, &result.UserID, &result.RefreshToken, &result.ExpiresAt, &result.CreatedAt)
+// ChangePassword sets the password of the user, it wraps pgx.ErrNoRows when
+// there is no user with arg.ID.
+func (r *authRepository) ChangePassword(ctx context.Context, arg auth.UpdatePasswordParams) (*auth.User, error) {
+	var i auth.User
+	err := r.ExecDbTx(ctx, func(ar *authRepository) error {
+		return ar.setPassword(ctx, arg, &i)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to read refresh token, err: %v", err)
+		return nil, err
 	}
 
-	return &result, nil
+	return &i, nil
 }
 
-func (r *authRepository) InsertRefreshToken(ctx context.Context, userID int32, refreshToken uuid.UUID) (err error) {
-	query := "INSERT INTO refresh_token_whitelist(user_id, refresh_token, expires_at) VALUES($1, $2, NOW() + INTERVAL '5 minute')"
+// setPassword updates the password and signs the user out everywhere, the
+// refresh tokens and the unused reset tokens are deleted. It must run in a db
+// transaction.
+func (r *authRepository) setPassword(ctx context.Context, arg auth.UpdatePasswordParams, i *auth.User) error {
+	err := r.db.QueryRow(ctx, updatePassword, arg.ID, arg.HashedPassword).Scan(
+		&i.ID,
+		&i.Username,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsVerified,
+		&i.Role,
+		&i.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update password, err: %w", err)
+	}
 
-	res, err := r.db.Exec(ctx, query, userID, refreshToken)
+	_, err = r.db.Exec(ctx, deleteUserRefreshTokens, arg.ID)
 	if err != nil {
-		return fmt.Errorf("failed to insert refresh token, err: %v", err)
+		return fmt.Errorf("failed to delete refresh tokens, err: %v", err)
 	}
 
-	if res.RowsAffected() == 0 {
-		return fmt.Errorf("there are no rows affrected when insert refresh token")
+	_, err = r.db.Exec(ctx, deleteUnusedPasswordResetTokens, arg.ID)
+	if err != nil {
+		return fmt.Errorf("failed to delete password reset tokens, err: %v", err)
 	}
 
 	return nil
 }
 
-func (r *authRepository) DeleteRefreshToken(ctx context.Context, userID int32) (err error) {
-	query := "DELETE FROM refresh_token_whitelist WHERE user_id = $1;"
+const getUserByID = `-- name: GetUserByID :one
+SELECT id, username, email, hashed_password, is_verified, role, created_at FROM users WHERE id = $1
+`
 
-	res, err := r.db.Exec(ctx, query, userID)
+func (r *authRepository) GetUserByID(ctx context.Context, id int32) (*auth.User, error) {
+	row := r.db.QueryRow(ctx, getUserByID, id)
+	var i auth.User
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsVerified,
+		&i.Role,
+		&i.CreatedAt,
+	)
+	return &i, err
+}
+
+const getProfile = `-- name: GetProfile :one
+SELECT id, username, email, full_name, phone, is_verified, role, created_at FROM users WHERE id = $1
+`
+
+// GetProfile returns the user with the addresses, the default one first.
+func (r *authRepository) GetProfile(ctx context.Context, userID int32) (*auth.Profile, error) {
+	row := r.db.QueryRow(ctx, getProfile, userID)
+	var i auth.Profile
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.Email,
+		&i.FullName,
+		&i.Phone,
+		&i.IsVerified,
+		&i.Role,
+		&i.CreatedAt,
+	)
 	if err != nil {
-		return fmt.Errorf("failed to insert refresh token, err: %v", err)
+		return nil, fmt.Errorf("failed to get profile, err: %w", err)
 	}
 
-	if res.RowsAffected() == 0 {
-		return fmt.Errorf("there are no rows affected when delete refresh token")
+	i.Addresses, err = r.ListAddresses(ctx, userID)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	return &i, nil
 }
 
-func (r *authRepository) DeleteAllUserInformation(ctx context.Context, arg auth.DeleteUserParams) (err error) {
-	err = r.ExecDbTx(ctx, func(ar *authRepository) error {
-		err = ar.DeleteRefreshToken(ctx, arg.ID)
+// updateProfile leaves the fields that are NULL as they are, an empty full
+// name or phone is saved as NULL and a new email isn't verified.
+const updateProfile = `-- name: UpdateProfile :one
+UPDATE
+    users
+SET
+    username = COALESCE($2::VARCHAR, username),
+    email = COALESCE($3::VARCHAR, email),
+    is_verified = CASE WHEN $3::VARCHAR IS NOT NULL AND $3::VARCHAR <> email THEN FALSE ELSE is_verified END,
+    full_name = CASE WHEN $4::VARCHAR IS NULL THEN full_name ELSE NULLIF($4::VARCHAR, '') END,
+    phone = CASE WHEN $5::VARCHAR IS NULL THEN phone ELSE NULLIF($5::VARCHAR, '') END
+WHERE
+    id = $1
+RETURNING id, username, email, full_name, phone, is_verified, role, created_at
+`
+
+func (r *authRepository) UpdateProfile(ctx context.Context, arg auth.UpdateProfileParams) (*auth.Profile, error) {
+	row := r.db.QueryRow(ctx, updateProfile, arg.ID, arg.Username, arg.Email, arg.FullName, arg.Phone)
+	var i auth.Profile
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.Email,
+		&i.FullName,
+		&i.Phone,
+		&i.IsVerified,
+		&i.Role,
+		&i.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update profile, err: %w", err)
+	}
+
+	i.Addresses, err = r.ListAddresses(ctx, arg.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &i, nil
+}
+
+const listAddresses = `-- name: ListAddresses :many
+SELECT id, user_id, label, recipient, phone, street, city, province, postal_code, country, is_default, created_at, updated_at FROM user_addresses
+WHERE user_id = $1
+ORDER BY is_default DESC, id ASC
+`
+
+func (r *authRepository) ListAddresses(ctx context.Context, userID int32) ([]auth.Address, error) {
+	rows, err := r.db.Query(ctx, listAddresses, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list addresses, err: %v", err)
+	}
+	defer rows.Close()
+	items := []auth.Address{}
+	for rows.Next() {
+		var i auth.Address
+		if err := scanAddress(rows, &i); err != nil {
+			return nil, fmt.Errorf("failed to scan address, err: %v", err)
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getDefaultAddress = `-- name: GetDefaultAddress :one
+SELECT id, user_id, label, recipient, phone, street, city, province, postal_code, country, is_default, created_at, updated_at FROM user_addresses
+WHERE user_id = $1 AND is_default
+`
+
+func (r *authRepository) GetDefaultAddress(ctx context.Context, userID int32) (*auth.Address, error) {
+	row := r.db.QueryRow(ctx, getDefaultAddress, userID)
+	var i auth.Address
+	err := scanAddress(row, &i)
+	return &i, err
+}
+
+const countAddresses = `-- name: CountAddresses :one
+SELECT COUNT(*) FROM user_addresses WHERE user_id = $1
+`
+
+const unsetDefaultAddress = `-- name: UnsetDefaultAddress :exec
+UPDATE user_addresses SET is_default = FALSE WHERE user_id = $1 AND id <> $2 AND is_default
+`
+
+const createAddress = `-- name: CreateAddress :one
+INSERT INTO user_addresses(
+    user_id,
+    label,
+    recipient,
+    phone,
+    street,
+    city,
+    province,
+    postal_code,
+    country,
+    is_default
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10
+) RETURNING id, user_id, label, recipient, phone, street, city, province, postal_code, country, is_default, created_at, updated_at
+`
+
+func (r *authRepository) CreateAddress(ctx context.Context, arg auth.AddressParams) (*auth.Address, error) {
+	var i auth.Address
+	err := r.ExecDbTx(ctx, func(ar *authRepository) error {
+		var count int64
+		err := ar.db.QueryRow(ctx, countAddresses, arg.UserID).Scan(&count)
 		if err != nil {
-			return err
+			return fmt.Errorf("failed to count addresses, err: %v", err)
 		}
+		isDefault := arg.IsDefault || count == 0
 
-		err = ar.DeleteUser(ctx, arg)
+		if isDefault {
+			_, err = ar.db.Exec(ctx, unsetDefaultAddress, arg.UserID, 0)
+			if err != nil {
+				return fmt.Errorf("failed to unset default address, err: %v", err)
+			}
+		}
+
+		row := ar.db.QueryRow(ctx, createAddress,
+			arg.UserID,
+			arg.Label,
+			arg.Recipient,
+			arg.Phone,
+			arg.Street,
+			arg.City,
+			arg.Province,
+			arg.PostalCode,
+			arg.Country,
+			isDefault,
+		)
+		err = scanAddress(row, &i)
 		if err != nil {
-			return err
+			return fmt.Errorf("failed to create address, err: %w", err)
 		}
 
 		return nil
 	})
-	return err
+	if err != nil {
+		return nil, err
+	}
+
+	return &i, nil
 }
 
-func (r *authRepository) UpdateRefreshToken(ctx context.Context, userID int32, refreshToken uuid.UUID) (err error) {
-	r.ExecDbTx(ctx, func(ar *authRepository) error {
-		err = ar.DeleteRefreshToken(ctx, userID)
+// updateAddress keeps a default address default, another address has to be
+// made default instead.
+const updateAddress = `-- name: UpdateAddress :one
+UPDATE
+    user_addresses
+SET
+    label = $3,
+    recipient = $4,
+    phone = $5,
+    street = $6,
+    city = $7,
+    province = $8,
+    postal_code = $9,
+    country = $10,
+    is_default = is_default OR $11,
+    updated_at = NOW()
+WHERE
+    id = $1
+AND user_id = $2
+RETURNING id, user_id, label, recipient, phone, street, city, province, postal_code, country, is_default, created_at, updated_at
+`
+
+// UpdateAddress wraps pgx.ErrNoRows when the user has no address with arg.ID.
+func (r *authRepository) UpdateAddress(ctx context.Context, arg auth.AddressParams) (*auth.Address, error) {
+	var i auth.Address
+	err := r.ExecDbTx(ctx, func(ar *authRepository) error {
+		if arg.IsDefault {
+			_, err := ar.db.Exec(ctx, unsetDefaultAddress, arg.UserID, arg.ID)
+			if err != nil {
+				return fmt.Errorf("failed to unset default address, err: %v", err)
+			}
+		}
+
+		row := ar.db.QueryRow(ctx, updateAddress,
+			arg.ID,
+			arg.UserID,
+			arg.Label,
+			arg.Recipient,
+			arg.Phone,
+			arg.Street,
+			arg.City,
+			arg.Province,
+			arg.PostalCode,
+			arg.Country,
+			arg.IsDefault,
+		)
+		err := scanAddress(row, &i)
 		if err != nil {
-			return err
+			return fmt.Errorf("failed to update address, err: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &i, nil
+}
+
+const deleteAddress = `-- name: DeleteAddress :one
+DELETE FROM user_addresses WHERE id = $1 AND user_id = $2 RETURNING is_default
+`
+
+// setNewestAddressDefault makes the last added address the default one.
+const setNewestAddressDefault = `-- name: SetNewestAddressDefault :exec
+UPDATE user_addresses SET is_default = TRUE
+WHERE id = (
+    SELECT id FROM user_addresses WHERE user_id = $1 ORDER BY id DESC LIMIT 1
+)
+`
+
+// DeleteAddress wraps pgx.ErrNoRows when the user has no address with
+// arg.ID. When the default address is deleted the newest one left becomes
+// the default.
+func (r *authRepository) DeleteAddress(ctx context.Context, arg auth.DeleteAddressParams) error {
+	return r.ExecDbTx(ctx, func(ar *authRepository) error {
+		var wasDefault bool
+		err := ar.db.QueryRow(ctx, deleteAddress, arg.ID, arg.UserID).Scan(&wasDefault)
+		if err != nil {
+			return fmt.Errorf("failed to delete address, err: %w", err)
+		}
+
+		if wasDefault {
+			_, err = ar.db.Exec(ctx, setNewestAddressDefault, arg.UserID)
+			if err != nil {
+				return fmt.Errorf("failed to set default address, err: %v", err)
+			}
+		}
+
+		return nil
+	})
+}
+
+func scanAddress(row pgx.Row, i *auth.Address) error {
+	return row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Label,
+		&i.Recipient,
+		&i.Phone,
+		&i.Street,
+		&i.City,
+		&i.Province,
+		&i.PostalCode,
+		&i.Country,
+		&i.IsDefault,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+}
+
+const listSigningKeys = `-- name: ListSigningKeys :many
+SELECT id, kid, algorithm, private_key, encrypted, activates_at, retires_at, created_at FROM jwt_signing_keys
+WHERE retires_at IS NULL OR retires_at > NOW()
+ORDER BY activates_at DESC, id DESC
+`
+
+// LoadKeys returns the keys that aren't retired, tokens are signed with the
+// newest active one.
+func (r *authRepository) LoadKeys(ctx context.Context) (keys *auth.KeySet, err error) {
+	items, err := r.listSigningKeys(ctx, listSigningKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	return auth.NewKeySet(items, time.Now())
+}
+
+const listAllSigningKeys = `-- name: ListAllSigningKeys :many
+SELECT id, kid, algorithm, private_key, encrypted, activates_at, retires_at, created_at FROM jwt_signing_keys
+ORDER BY activates_at DESC, id DESC
+`
+
+// LoadKeysWithRetired is LoadKeys with the retired keys as well, only to
+// verify tokens signed before a rotation.
+func (r *authRepository) LoadKeysWithRetired(ctx context.Context) (keys *auth.KeySet, err error) {
+	items, err := r.listSigningKeys(ctx, listAllSigningKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	return auth.NewVerifyingKeySet(items, time.Now())
+}
+
+func (r *authRepository) listSigningKeys(ctx context.Context, query string) ([]auth.SigningKey, error) {
+	rows, err := r.db.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load signing keys, err: %v", err)
+	}
+	defer rows.Close()
+	var items []auth.SigningKey
+	for rows.Next() {
+		var i auth.SigningKey
+		if err := scanSigningKey(rows, &i); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+const retireSigningKeys = `-- name: RetireSigningKeys :exec
+UPDATE jwt_signing_keys SET retires_at = $1
+WHERE retires_at IS NULL OR retires_at > $1
+`
+
+const createSigningKey = `-- name: CreateSigningKey :one
+INSERT INTO jwt_signing_keys(
+    kid,
+    algorithm,
+    private_key,
+    encrypted,
+    activates_at
+) VALUES (
+    $1, $2, $3, TRUE, $4
+) RETURNING id, kid, algorithm, private_key, encrypted, activates_at, retires_at, created_at
+`
+
+// RotateSigningKey adds arg.Signer and retires the keys before it at
+// arg.RetiresAt. The old keys keep verifying until then, so RetiresAt has to
+// leave time for the tokens they signed to expire. The new key doesn't have to
+// use the algorithm of the old ones.
+func (r *authRepository) RotateSigningKey(ctx context.Context, arg auth.RotateSigningKeyParams) (*auth.SigningKey, error) {
+	der, err := arg.Signer.MarshalPrivateKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal private key, err: %v", err)
+	}
+	encryptedKey, err := password.EncryptPrivateKey(der, arg.Kid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt private key, err: %v", err)
+	}
+
+	var i auth.SigningKey
+	err = r.ExecDbTx(ctx, func(ar *authRepository) error {
+		_, err := ar.db.Exec(ctx, retireSigningKeys, arg.RetiresAt)
+		if err != nil {
+			return fmt.Errorf("failed to retire signing keys, err: %v", err)
 		}
 
-		err = ar.InsertRefreshToken(ctx, userID, refreshToken)
+		row := ar.db.QueryRow(ctx, createSigningKey,
+			arg.Kid,
+			arg.Signer.Algorithm(),
+			encryptedKey,
+			arg.ActivatesAt,
+		)
+		return scanSigningKey(row, &i)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &i, nil
+}
+
+const listSigningKeysToConvert = `-- name: ListSigningKeysToConvert :many
+SELECT id, kid, private_key, encrypted FROM jwt_signing_keys
+WHERE encrypted <> $1
+ORDER BY id ASC
+FOR UPDATE
+`
+
+const updateSigningKeyEncryption = `-- name: UpdateSigningKeyEncryption :exec
+UPDATE jwt_signing_keys SET private_key = $2, encrypted = $3
+WHERE id = $1
+`
+
+// SetSigningKeysEncryption stores every key encrypted with the key encryption
+// key, or back in plain when encrypted is false, and returns how many
+// keys it changed. Retired keys are changed too.
+func (r *authRepository) SetSigningKeysEncryption(ctx context.Context, encrypted bool) (count int, err error) {
+	type storedKey struct {
+		id        int32
+		kid       string
+		data      []byte
+		encrypted bool
+	}
+
+	err = r.ExecDbTx(ctx, func(ar *authRepository) error {
+		rows, err := ar.db.Query(ctx, listSigningKeysToConvert, encrypted)
 		if err != nil {
+			return fmt.Errorf("failed to list signing keys, err: %v", err)
+		}
+		var keys []storedKey
+		for rows.Next() {
+			var i storedKey
+			if err := rows.Scan(&i.id, &i.kid, &i.data, &i.encrypted); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan signing key, err: %v", err)
+			}
+			keys = append(keys, i)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
 			return err
 		}
 
+		for _, key := range keys {
+			var data []byte
+			if encrypted {
+				data, err = password.EncryptPrivateKey(key.data, key.kid)
+				if err != nil {
+					return fmt.Errorf("failed to encrypt private key %s, err: %v", key.kid, err)
+				}
+			} else {
+				data, err = password.DecryptPrivateKey(key.data, key.kid)
+				if err != nil {
+					return fmt.Errorf("failed to decrypt private key %s, err: %v", key.kid, err)
+				}
+			}
+
+			_, err = ar.db.Exec(ctx, updateSigningKeyEncryption, key.id, data, encrypted)
+			if err != nil {
+				return fmt.Errorf("failed to update signing key %s, err: %v", key.kid, err)
+			}
+		}
+
+		count = len(keys)
 		return nil
 	})
 
-	return nil
+	return count, err
+}
+
+func scanSigningKey(row pgx.Row, i *auth.SigningKey) error {
+	var alg signer.Algorithm
+	var keyBytes []byte
+	var encrypted bool
+	err := row.Scan(
+		&i.ID,
+		&i.Kid,
+		&alg,
+		&keyBytes,
+		&encrypted,
+		&i.ActivatesAt,
+		&i.RetiresAt,
+		&i.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to scan signing key, err: %v", err)
+	}
+
+	if encrypted {
+		keyBytes, err = password.DecryptPrivateKey(keyBytes, i.Kid)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt private key %s, err: %v", i.Kid, err)
+		}
+	}
+
+	i.Signer, err = signer.Parse(alg, keyBytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse private key %s, err: %v", i.Kid, err)
+	}
+
+	return nil
+}
+
+const readRefreshToken = `-- name: ReadRefreshToken :one
+SELECT id, user_id, refresh_token, device_name, user_agent, ip_address, remember_me, last_used_at, expires_at, created_at FROM refresh_token_whitelist
+WHERE user_id = $1 AND refresh_token = $2
+`
+
+func (r *authRepository) ReadRefreshToken(ctx context.Context, userID int32, refreshToken uuid.UUID) (res *auth.RefreshTokenWhitelist, err error) {
+	var result auth.RefreshTokenWhitelist
+	err = scanRefreshToken(r.db.QueryRow(ctx, readRefreshToken, userID, refreshToken), &result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read refresh token, err: %w", err)
+	}
+
+	return &result, nil
+}
+
+// InsertRefreshToken starts a session without device details.
+func (r *authRepository) InsertRefreshToken(ctx context.Context, userID int32, refreshToken uuid.UUID, expiresAt time.Time) (err error) {
+	_, err = r.CreateSession(ctx, auth.CreateSessionParams{UserID: userID, RefreshToken: refreshToken, ExpiresAt: expiresAt})
+	return err
+}
+
+const createSession = `-- name: CreateSession :one
+INSERT INTO refresh_token_whitelist(
+    user_id,
+    refresh_token,
+    device_name,
+    user_agent,
+    ip_address,
+    remember_me,
+    expires_at
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7
+) RETURNING id, user_id, refresh_token, device_name, user_agent, ip_address, remember_me, last_used_at, expires_at, created_at
+`
+
+func (r *authRepository) CreateSession(ctx context.Context, arg auth.CreateSessionParams) (*auth.RefreshTokenWhitelist, error) {
+	row := r.db.QueryRow(ctx, createSession,
+		arg.UserID,
+		arg.RefreshToken,
+		arg.DeviceName,
+		arg.UserAgent,
+		arg.IPAddress,
+		arg.RememberMe,
+		arg.ExpiresAt,
+	)
+	var i auth.RefreshTokenWhitelist
+	err := scanRefreshToken(row, &i)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert refresh token, err: %v", err)
+	}
+
+	return &i, nil
+}
+
+const listSessions = `-- name: ListSessions :many
+SELECT id, user_id, refresh_token, device_name, user_agent, ip_address, remember_me, last_used_at, expires_at, created_at FROM refresh_token_whitelist
+WHERE user_id = $1 AND expires_at > NOW()
+ORDER BY last_used_at DESC, id DESC
+`
+
+// ListSessions returns the sessions of the user whose refresh token can
+// still be used, the last used first.
+func (r *authRepository) ListSessions(ctx context.Context, userID int32) ([]auth.RefreshTokenWhitelist, error) {
+	rows, err := r.db.Query(ctx, listSessions, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions, err: %v", err)
+	}
+	defer rows.Close()
+	items := []auth.RefreshTokenWhitelist{}
+	for rows.Next() {
+		var i auth.RefreshTokenWhitelist
+		if err := scanRefreshToken(rows, &i); err != nil {
+			return nil, fmt.Errorf("failed to scan session, err: %v", err)
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const deleteSession = `-- name: DeleteSession :exec
+DELETE FROM refresh_token_whitelist WHERE id = $1 AND user_id = $2
+`
+
+// DeleteSession wraps pgx.ErrNoRows when the user has no session with arg.ID.
+func (r *authRepository) DeleteSession(ctx context.Context, arg auth.DeleteSessionParams) error {
+	res, err := r.db.Exec(ctx, deleteSession, arg.ID, arg.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to delete session, err: %v", err)
+	}
+
+	if res.RowsAffected() == 0 {
+		return fmt.Errorf("failed to delete session, err: %w", pgx.ErrNoRows)
+	}
+
+	return nil
+}
+
+func scanRefreshToken(row pgx.Row, i *auth.RefreshTokenWhitelist) error {
+	return row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.RefreshToken,
+		&i.DeviceName,
+		&i.UserAgent,
+		&i.IPAddress,
+		&i.RememberMe,
+		&i.LastUsedAt,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+	)
+}
+
+func (r *authRepository) DeleteRefreshToken(ctx context.Context, userID int32) (err error) {
+	query := "DELETE FROM refresh_token_whitelist WHERE user_id = $1;"
+
+	res, err := r.db.Exec(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to insert refresh token, err: %v", err)
+	}
+
+	if res.RowsAffected() == 0 {
+		return fmt.Errorf("there are no rows affected when delete refresh token")
+	}
+
+	return nil
+}
+
+func (r *authRepository) DeleteAllUserInformation(ctx context.Context, arg auth.DeleteUserParams) (err error) {
+	err = r.ExecDbTx(ctx, func(ar *authRepository) error {
+		err = ar.DeleteRefreshToken(ctx, arg.ID)
+		if err != nil {
+			return err
+		}
+
+		err = ar.DeleteUser(ctx, arg)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+	return err
+}
+
+const updateRefreshToken = `-- name: UpdateRefreshToken :exec
+WITH rotated AS (
+    UPDATE
+        refresh_token_whitelist
+    SET
+        refresh_token = $3,
+        expires_at = $5,
+        last_used_at = NOW()
+    WHERE
+        id = $1
+    AND user_id = $2
+    AND refresh_token = $4
+    RETURNING id, user_id
+)
+INSERT INTO refresh_token_rotations(
+    session_id,
+    user_id,
+    refresh_token,
+    parent_token
+) SELECT id, user_id, $3, $4 FROM rotated
+`
+
+// UpdateRefreshToken gives the session a new refresh token and records the
+// old one as its parent, the session keeps its id. It wraps pgx.ErrNoRows when
+// the session is gone or arg.OldRefreshToken was already rotated.
+func (r *authRepository) UpdateRefreshToken(ctx context.Context, arg auth.UpdateRefreshTokenParams) (err error) {
+	res, err := r.db.Exec(ctx, updateRefreshToken, arg.ID, arg.UserID, arg.RefreshToken, arg.OldRefreshToken, arg.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to update refresh token, err: %v", err)
+	}
+
+	if res.RowsAffected() == 0 {
+		return fmt.Errorf("failed to update refresh token, err: %w", pgx.ErrNoRows)
+	}
+
+	return nil
+}
+
+const getRefreshTokenRotation = `-- name: GetRefreshTokenRotation :one
+SELECT id, session_id, user_id, refresh_token, parent_token, rotated_at FROM refresh_token_rotations
+WHERE user_id = $1 AND parent_token = $2
+`
+
+// GetRefreshTokenRotation returns the rotation that replaced parentToken, it
+// wraps pgx.ErrNoRows when the token was never rotated in a live session.
+func (r *authRepository) GetRefreshTokenRotation(ctx context.Context, userID int32, parentToken uuid.UUID) (*auth.RefreshTokenRotation, error) {
+	row := r.db.QueryRow(ctx, getRefreshTokenRotation, userID, parentToken)
+	var i auth.RefreshTokenRotation
+	err := row.Scan(
+		&i.ID,
+		&i.SessionID,
+		&i.UserID,
+		&i.RefreshToken,
+		&i.ParentToken,
+		&i.RotatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get refresh token rotation, err: %w", err)
+	}
+
+	return &i, nil
+}
+
+const createAuditLog = `-- name: CreateAuditLog :one
+INSERT INTO auth_audit_logs(
+    user_id,
+    session_id,
+    event,
+    detail
+) VALUES (
+    $1, $2, $3, $4
+) RETURNING id, user_id, session_id, event, detail, created_at
+`
+
+func (r *authRepository) CreateAuditLog(ctx context.Context, arg auth.CreateAuditLogParams) (*auth.AuditLog, error) {
+	row := r.db.QueryRow(ctx, createAuditLog,
+		arg.UserID,
+		arg.SessionID,
+		arg.Event,
+		arg.Detail,
+	)
+	var i auth.AuditLog
+	err := scanAuditLog(row, &i)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create audit log, err: %v", err)
+	}
+
+	return &i, nil
+}
+
+const listAuditLogs = `-- name: ListAuditLogs :many
+SELECT id, user_id, session_id, event, detail, created_at FROM auth_audit_logs
+WHERE user_id = $1
+ORDER BY id DESC
+`
+
+// ListAuditLogs returns the audit log of the user, the newest first.
+func (r *authRepository) ListAuditLogs(ctx context.Context, userID int32) ([]auth.AuditLog, error) {
+	rows, err := r.db.Query(ctx, listAuditLogs, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit logs, err: %v", err)
+	}
+	defer rows.Close()
+	items := []auth.AuditLog{}
+	for rows.Next() {
+		var i auth.AuditLog
+		if err := scanAuditLog(rows, &i); err != nil {
+			return nil, fmt.Errorf("failed to scan audit log, err: %v", err)
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func scanAuditLog(row pgx.Row, i *auth.AuditLog) error {
+	return row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.SessionID,
+		&i.Event,
+		&i.Detail,
+		&i.CreatedAt,
+	)
+}
+
+const getTOTP = `-- name: GetTOTP :one
+SELECT user_id, secret, encrypted, confirmed_at, last_used_step, created_at FROM user_totp
+WHERE user_id = $1
+`
+
+// GetTOTP returns the TOTP of the user, it wraps pgx.ErrNoRows when the user
+// never enrolled.
+func (r *authRepository) GetTOTP(ctx context.Context, userID int32) (*auth.TOTP, error) {
+	row := r.db.QueryRow(ctx, getTOTP, userID)
+	var i auth.TOTP
+	err := scanTOTP(row, &i)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get totp, err: %w", err)
+	}
+
+	return &i, nil
+}
+
+const upsertTOTP = `-- name: UpsertTOTP :one
+INSERT INTO user_totp(
+    user_id,
+    secret,
+    encrypted
+) VALUES (
+    $1, $2, TRUE
+)
+ON CONFLICT (user_id) DO UPDATE SET
+    secret = EXCLUDED.secret,
+    encrypted = EXCLUDED.encrypted,
+    last_used_step = 0,
+    created_at = NOW()
+WHERE user_totp.confirmed_at IS NULL
+RETURNING user_id, secret, encrypted, confirmed_at, last_used_step, created_at
+`
+
+// UpsertTOTP starts an enrollment with secret, an enrollment that wasn't
+// confirmed is started over. It wraps pgx.ErrNoRows when the user already has
+// TOTP. The secret is stored encrypted with the key encryption key.
+func (r *authRepository) UpsertTOTP(ctx context.Context, userID int32, secret string) (*auth.TOTP, error) {
+	encryptedSecret, err := password.EncryptPrivateKey([]byte(secret), totpSecretAAD(userID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt totp secret, err: %v", err)
+	}
+
+	row := r.db.QueryRow(ctx, upsertTOTP, userID, encryptedSecret)
+	var i auth.TOTP
+	err = scanTOTP(row, &i)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upsert totp, err: %w", err)
+	}
+
+	return &i, nil
+}
+
+const confirmTOTP = `-- name: ConfirmTOTP :exec
+UPDATE user_totp SET confirmed_at = NOW(), last_used_step = $2
+WHERE user_id = $1
+AND confirmed_at IS NULL
+AND last_used_step < $2
+`
+
+const deleteRecoveryCodes = `-- name: DeleteRecoveryCodes :exec
+DELETE FROM mfa_recovery_codes WHERE user_id = $1
+`
+
+const createRecoveryCode = `-- name: CreateRecoveryCode :exec
+INSERT INTO mfa_recovery_codes(
+    user_id,
+    code_hash
+) VALUES (
+    $1, $2
+)
+`
+
+// ConfirmTOTP turns TOTP on with the code of arg.Step and replaces the
+// recovery codes. It wraps pgx.ErrNoRows when there is no enrollment waiting.
+func (r *authRepository) ConfirmTOTP(ctx context.Context, arg auth.ConfirmTOTPParams) error {
+	return r.ExecDbTx(ctx, func(ar *authRepository) error {
+		res, err := ar.db.Exec(ctx, confirmTOTP, arg.UserID, arg.Step)
+		if err != nil {
+			return fmt.Errorf("failed to confirm totp, err: %v", err)
+		}
+		if res.RowsAffected() == 0 {
+			return fmt.Errorf("failed to confirm totp, err: %w", pgx.ErrNoRows)
+		}
+
+		_, err = ar.db.Exec(ctx, deleteRecoveryCodes, arg.UserID)
+		if err != nil {
+			return fmt.Errorf("failed to delete recovery codes, err: %v", err)
+		}
+		for _, codeHash := range arg.RecoveryCodeHashes {
+			_, err = ar.db.Exec(ctx, createRecoveryCode, arg.UserID, codeHash)
+			if err != nil {
+				return fmt.Errorf("failed to create recovery code, err: %v", err)
+			}
+		}
+
+		return nil
+	})
+}
+
+const useTOTPStep = `-- name: UseTOTPStep :exec
+UPDATE user_totp SET last_used_step = $2
+WHERE user_id = $1
+AND confirmed_at IS NOT NULL
+AND last_used_step < $2
+`
+
+// UseTOTPStep takes the code of step, it wraps pgx.ErrNoRows when a code of
+// that step or a later one was already taken.
+func (r *authRepository) UseTOTPStep(ctx context.Context, userID int32, step int64) error {
+	res, err := r.db.Exec(ctx, useTOTPStep, userID, step)
+	if err != nil {
+		return fmt.Errorf("failed to use totp code, err: %v", err)
+	}
+	if res.RowsAffected() == 0 {
+		return fmt.Errorf("failed to use totp code, err: %w", pgx.ErrNoRows)
+	}
+
+	return nil
+}
+
+const useRecoveryCode = `-- name: UseRecoveryCode :exec
+UPDATE mfa_recovery_codes SET used_at = NOW()
+WHERE user_id = $1
+AND code_hash = $2
+AND used_at IS NULL
+`
+
+// UseRecoveryCode takes one recovery code, it wraps pgx.ErrNoRows when the
+// code is wrong or already used.
+func (r *authRepository) UseRecoveryCode(ctx context.Context, userID int32, codeHash string) error {
+	res, err := r.db.Exec(ctx, useRecoveryCode, userID, codeHash)
+	if err != nil {
+		return fmt.Errorf("failed to use recovery code, err: %v", err)
+	}
+	if res.RowsAffected() == 0 {
+		return fmt.Errorf("failed to use recovery code, err: %w", pgx.ErrNoRows)
+	}
+
+	return nil
+}
+
+const deleteTOTP = `-- name: DeleteTOTP :exec
+DELETE FROM user_totp WHERE user_id = $1
+`
+
+// DeleteTOTP turns TOTP off and deletes the recovery codes.
+func (r *authRepository) DeleteTOTP(ctx context.Context, userID int32) error {
+	return r.ExecDbTx(ctx, func(ar *authRepository) error {
+		_, err := ar.db.Exec(ctx, deleteTOTP, userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete totp, err: %v", err)
+		}
+
+		_, err = ar.db.Exec(ctx, deleteRecoveryCodes, userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete recovery codes, err: %v", err)
+		}
+
+		return nil
+	})
+}
+
+const listTOTPSecretsToConvert = `-- name: ListTOTPSecretsToConvert :many
+SELECT user_id, secret, encrypted FROM user_totp
+WHERE encrypted <> $1
+ORDER BY user_id ASC
+FOR UPDATE
+`
+
+const updateTOTPSecretEncryption = `-- name: UpdateTOTPSecretEncryption :exec
+UPDATE user_totp SET secret = $2, encrypted = $3
+WHERE user_id = $1
+`
+
+// SetTOTPSecretsEncryption stores every TOTP secret encrypted with the key
+// encryption key, or back in plain when encrypted is false, and returns how
+// many secrets it changed.
+func (r *authRepository) SetTOTPSecretsEncryption(ctx context.Context, encrypted bool) (count int, err error) {
+	type storedSecret struct {
+		userID    int32
+		data      []byte
+		encrypted bool
+	}
+
+	err = r.ExecDbTx(ctx, func(ar *authRepository) error {
+		rows, err := ar.db.Query(ctx, listTOTPSecretsToConvert, encrypted)
+		if err != nil {
+			return fmt.Errorf("failed to list totp secrets, err: %v", err)
+		}
+		var secrets []storedSecret
+		for rows.Next() {
+			var i storedSecret
+			if err := rows.Scan(&i.userID, &i.data, &i.encrypted); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan totp secret, err: %v", err)
+			}
+			secrets = append(secrets, i)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, secret := range secrets {
+			var data []byte
+			if encrypted {
+				data, err = password.EncryptPrivateKey(secret.data, totpSecretAAD(secret.userID))
+				if err != nil {
+					return fmt.Errorf("failed to encrypt totp secret of user %d, err: %v", secret.userID, err)
+				}
+			} else {
+				data, err = password.DecryptPrivateKey(secret.data, totpSecretAAD(secret.userID))
+				if err != nil {
+					return fmt.Errorf("failed to decrypt totp secret of user %d, err: %v", secret.userID, err)
+				}
+			}
+
+			_, err = ar.db.Exec(ctx, updateTOTPSecretEncryption, secret.userID, data, encrypted)
+			if err != nil {
+				return fmt.Errorf("failed to update totp secret of user %d, err: %v", secret.userID, err)
+			}
+		}
+
+		count = len(secrets)
+		return nil
+	})
+
+	return count, err
+}
+
+// totpSecretAAD is authenticated with an encrypted secret, so it can't be
+// copied to the row of another user.
+func totpSecretAAD(userID int32) string {
+	return fmt.Sprint("totp ", userID)
+}
+
+func scanTOTP(row pgx.Row, i *auth.TOTP) error {
+	var secret []byte
+	var encrypted bool
+	err := row.Scan(
+		&i.UserID,
+		&secret,
+		&encrypted,
+		&i.ConfirmedAt,
+		&i.LastUsedStep,
+		&i.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	if encrypted {
+		secret, err = password.DecryptPrivateKey(secret, totpSecretAAD(i.UserID))
+		if err != nil {
+			return fmt.Errorf("failed to decrypt totp secret, err: %v", err)
+		}
+	}
+	i.Secret = string(secret)
+
+	return nil
+}
+
+const createAPIKey = `-- name: CreateAPIKey :one
+INSERT INTO api_keys(
+    user_id,
+    name,
+    prefix,
+    key_hash,
+    scopes,
+    expires_at
+) VALUES (
+    $1, $2, $3, $4, $5, $6
+) RETURNING id, user_id, name, prefix, scopes, expires_at, last_used_at, created_at
+`
+
+func (r *authRepository) CreateAPIKey(ctx context.Context, arg auth.CreateAPIKeyParams) (*auth.APIKey, error) {
+	row := r.db.QueryRow(ctx, createAPIKey,
+		arg.UserID,
+		arg.Name,
+		arg.Prefix,
+		arg.KeyHash,
+		arg.Scopes,
+		arg.ExpiresAt,
+	)
+	var i auth.APIKey
+	err := scanAPIKey(row, &i)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create api key, err: %w", err)
+	}
+
+	return &i, nil
+}
+
+const listAPIKeys = `-- name: ListAPIKeys :many
+SELECT id, user_id, name, prefix, scopes, expires_at, last_used_at, created_at FROM api_keys
+WHERE user_id = $1
+ORDER BY id ASC
+`
+
+// ListAPIKeys returns the keys of the user, the expired ones too.
+func (r *authRepository) ListAPIKeys(ctx context.Context, userID int32) ([]auth.APIKey, error) {
+	rows, err := r.db.Query(ctx, listAPIKeys, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api keys, err: %v", err)
+	}
+	defer rows.Close()
+	items := []auth.APIKey{}
+	for rows.Next() {
+		var i auth.APIKey
+		if err := scanAPIKey(rows, &i); err != nil {
+			return nil, fmt.Errorf("failed to scan api key, err: %v", err)
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getAPIKeyByHash = `-- name: GetAPIKeyByHash :one
+SELECT id, user_id, name, prefix, scopes, expires_at, last_used_at, created_at FROM api_keys
+WHERE key_hash = $1
+AND (expires_at IS NULL OR expires_at > NOW())
+`
+
+// GetAPIKeyByHash returns the key with keyHash, it wraps pgx.ErrNoRows when
+// there is none or it expired.
+func (r *authRepository) GetAPIKeyByHash(ctx context.Context, keyHash string) (*auth.APIKey, error) {
+	row := r.db.QueryRow(ctx, getAPIKeyByHash, keyHash)
+	var i auth.APIKey
+	err := scanAPIKey(row, &i)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get api key, err: %w", err)
+	}
+
+	return &i, nil
+}
+
+// touchAPIKey only writes once a minute, a busy key would otherwise write
+// on every request.
+const touchAPIKey = `-- name: TouchAPIKey :exec
+UPDATE api_keys SET last_used_at = NOW()
+WHERE id = $1
+AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+`
+
+// TouchAPIKey marks the key as used now.
+func (r *authRepository) TouchAPIKey(ctx context.Context, id int32) error {
+	_, err := r.db.Exec(ctx, touchAPIKey, id)
+	if err != nil {
+		return fmt.Errorf("failed to update api key last used, err: %v", err)
+	}
+
+	return nil
+}
+
+const deleteAPIKey = `-- name: DeleteAPIKey :exec
+DELETE FROM api_keys WHERE id = $1 AND user_id = $2
+`
+
+// DeleteAPIKey wraps pgx.ErrNoRows when the user has no key with arg.ID.
+func (r *authRepository) DeleteAPIKey(ctx context.Context, arg auth.DeleteAPIKeyParams) error {
+	res, err := r.db.Exec(ctx, deleteAPIKey, arg.ID, arg.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to delete api key, err: %v", err)
+	}
+
+	if res.RowsAffected() == 0 {
+		return fmt.Errorf("failed to delete api key, err: %w", pgx.ErrNoRows)
+	}
+
+	return nil
+}
+
+func scanAPIKey(row pgx.Row, i *auth.APIKey) error {
+	return row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Name,
+		&i.Prefix,
+		&i.Scopes,
+		&i.ExpiresAt,
+		&i.LastUsedAt,
+		&i.CreatedAt,
+	)
+}
+
+const getIdentity = `-- name: GetIdentity :one
+SELECT id, user_id, provider, subject, email, created_at FROM identities
+WHERE provider = $1 AND subject = $2
+`
+
+func (r *authRepository) GetIdentity(ctx context.Context, provider, subject string) (*auth.Identity, error) {
+	row := r.db.QueryRow(ctx, getIdentity, provider, subject)
+	var i auth.Identity
+	err := scanIdentity(row, &i)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get identity, err: %w", err)
+	}
+
+	return &i, nil
+}
+
+const createIdentity = `-- name: CreateIdentity :one
+INSERT INTO identities(
+    user_id,
+    provider,
+    subject,
+    email
+) VALUES (
+    $1, $2, $3, $4
+) RETURNING id, user_id, provider, subject, email, created_at
+`
+
+func (r *authRepository) CreateIdentity(ctx context.Context, arg auth.CreateIdentityParams) (*auth.Identity, error) {
+	row := r.db.QueryRow(ctx, createIdentity, arg.UserID, arg.Provider, arg.Subject, arg.Email)
+	var i auth.Identity
+	err := scanIdentity(row, &i)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create identity, err: %w", err)
+	}
+
+	return &i, nil
+}
+
+// CreateIdentityUser creates a verified user linked to the identity in one
+// db transaction.
+func (r *authRepository) CreateIdentityUser(ctx context.Context, arg auth.CreateIdentityUserParams) (user *auth.User, err error) {
+	err = r.ExecDbTx(ctx, func(ar *authRepository) error {
+		user, err = ar.CreateUser(ctx, arg.User)
+		if err != nil {
+			return fmt.Errorf("failed to create user, err: %w", err)
+		}
+
+		err = ar.UpdateUserVerification(ctx, auth.UpdateUserVerificationParams{ID: user.ID, Email: user.Email})
+		if err != nil {
+			return err
+		}
+		user.IsVerified = true
+
+		_, err = ar.CreateIdentity(ctx, auth.CreateIdentityParams{
+			UserID:   user.ID,
+			Provider: arg.Provider,
+			Subject:  arg.Subject,
+			Email:    user.Email,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func scanIdentity(row pgx.Row, i *auth.Identity) error {
+	return row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Provider,
+		&i.Subject,
+		&i.Email,
+		&i.CreatedAt,
+	)
 }
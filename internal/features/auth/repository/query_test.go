@@ -3,15 +3,19 @@ package repository
 import (
 	"context"
 	"os"
+	"time"
 
 	"testing"
 
 	auth "github.com/dwiw96/GoCommerceAPI/internal/features/auth"
 	generator "github.com/dwiw96/GoCommerceAPI/pkg/utils/generator"
 	password "github.com/dwiw96/GoCommerceAPI/pkg/utils/password"
+	signer "github.com/dwiw96/GoCommerceAPI/pkg/utils/signer"
 	testUtils "github.com/dwiw96/GoCommerceAPI/testutils"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -31,7 +35,8 @@ func TestMain(m *testing.M) {
 
 	schemaCleanup := testUtils.SetupDB("test_repo_auth")
 
-	password.JwtInit(pool, ctx)
+	testUtils.SetKeyEncryptionKey()
+	password.JwtInit(pool, ctx, signer.RS256)
 
 	repoTest = NewAuthRepository(pool, pool)
 
@@ -122,6 +127,7 @@ func TestCreateUser(t *testing.T) {
 				assert.Equal(t, tC.arg.Username, res.Username)
 				assert.Equal(t, tC.arg.Email, res.Email)
 				assert.Equal(t, tC.arg.HashedPassword, res.HashedPassword)
+				assert.Equal(t, auth.RoleCustomer, res.Role)
 			} else {
 				require.Error(t, err)
 			}
@@ -205,6 +211,7 @@ func TestUpdateUser(t *testing.T) {
 				Email:          user.Email,
 				HashedPassword: hashedPasswordSuccess,
 				IsVerified:     user.IsVerified,
+				Role:           user.Role,
 				CreatedAt:      user.CreatedAt,
 			},
 			err: false,
@@ -266,6 +273,334 @@ func TestUpdateUser(t *testing.T) {
 	}
 }
 
+func TestUpdateUserRole(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user := createRandomUser(t)
+	assert.Equal(t, auth.RoleCustomer, user.Role)
+
+	testCases := []struct {
+		desc string
+		arg  auth.UpdateUserRoleParams
+		err  bool
+	}{
+		{
+			desc: "success_staff",
+			arg:  auth.UpdateUserRoleParams{ID: user.ID, Role: auth.RoleStaff},
+			err:  false,
+		}, {
+			desc: "success_admin",
+			arg:  auth.UpdateUserRoleParams{ID: user.ID, Role: auth.RoleAdmin},
+			err:  false,
+		}, {
+			desc: "failed_invalid_role",
+			arg:  auth.UpdateUserRoleParams{ID: user.ID, Role: "owner"},
+			err:  true,
+		}, {
+			desc: "failed_wrong_id",
+			arg:  auth.UpdateUserRoleParams{ID: user.ID + 5, Role: auth.RoleStaff},
+			err:  true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			res, err := repoTest.UpdateUserRole(ctx, tC.arg)
+			if !tC.err {
+				require.NoError(t, err)
+				assert.Equal(t, user.ID, res.ID)
+				assert.Equal(t, tC.arg.Role, res.Role)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+
+	res, err := repoTest.GetUserByEmail(ctx, user.Email)
+	require.NoError(t, err)
+	assert.Equal(t, auth.RoleAdmin, res.Role)
+}
+
+func TestUpdateUserVerification(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user := createRandomUser(t)
+	assert.False(t, user.IsVerified)
+
+	testCases := []struct {
+		desc string
+		arg  auth.UpdateUserVerificationParams
+		err  bool
+	}{
+		{
+			desc: "success",
+			arg:  auth.UpdateUserVerificationParams{ID: user.ID, Email: user.Email},
+			err:  false,
+		}, {
+			desc: "failed_wrong_email",
+			arg:  auth.UpdateUserVerificationParams{ID: user.ID, Email: "a" + user.Email},
+			err:  true,
+		}, {
+			desc: "failed_wrong_id",
+			arg:  auth.UpdateUserVerificationParams{ID: user.ID + 5, Email: user.Email},
+			err:  true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			err := repoTest.UpdateUserVerification(ctx, tC.arg)
+			if !tC.err {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+
+	res, err := repoTest.GetUserByEmail(ctx, user.Email)
+	require.NoError(t, err)
+	assert.True(t, res.IsVerified)
+}
+
+func TestResetPassword(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user := createRandomUser(t)
+	refreshToken, err := uuid.NewRandom()
+	require.NoError(t, err)
+	err = repoTest.InsertRefreshToken(ctx, user.ID, refreshToken, time.Now().UTC().Add(time.Hour))
+	require.NoError(t, err)
+
+	tokens := map[string]time.Time{
+		"valid":   time.Now().UTC().Add(time.Hour),
+		"expired": time.Now().UTC().Add(-time.Hour),
+		"other":   time.Now().UTC().Add(time.Hour),
+	}
+	for hash, expiresAt := range tokens {
+		err = repoTest.CreatePasswordResetToken(ctx, auth.CreatePasswordResetTokenParams{UserID: user.ID, TokenHash: hash, ExpiresAt: expiresAt})
+		require.NoError(t, err)
+	}
+
+	testCases := []struct {
+		desc string
+		hash string
+		err  bool
+	}{
+		{
+			desc: "failed_expired",
+			hash: "expired",
+			err:  true,
+		}, {
+			desc: "failed_unknown",
+			hash: "unknown",
+			err:  true,
+		}, {
+			desc: "success",
+			hash: "valid",
+			err:  false,
+		}, {
+			desc: "failed_used",
+			hash: "valid",
+			err:  true,
+		}, {
+			// the other tokens of the user are deleted with the reset
+			desc: "failed_other_deleted",
+			hash: "other",
+			err:  true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			arg := auth.ResetPasswordParams{TokenHash: tC.hash, HashedPassword: "hashed " + tC.desc}
+			res, err := repoTest.ResetPassword(ctx, arg)
+			if !tC.err {
+				require.NoError(t, err)
+				assert.Equal(t, user.ID, res.ID)
+				assert.Equal(t, arg.HashedPassword, res.HashedPassword)
+			} else {
+				require.Error(t, err)
+				assert.ErrorIs(t, err, pgx.ErrNoRows)
+			}
+		})
+	}
+
+	res, err := repoTest.GetUserByEmail(ctx, user.Email)
+	require.NoError(t, err)
+	assert.Equal(t, "hashed success", res.HashedPassword)
+
+	_, err = repoTest.ReadRefreshToken(ctx, user.ID, refreshToken)
+	require.Error(t, err)
+}
+
+func TestChangePassword(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user := createRandomUser(t)
+	refreshToken, err := uuid.NewRandom()
+	require.NoError(t, err)
+	err = repoTest.InsertRefreshToken(ctx, user.ID, refreshToken, time.Now().UTC().Add(time.Hour))
+	require.NoError(t, err)
+
+	res, err := repoTest.ChangePassword(ctx, auth.UpdatePasswordParams{ID: user.ID, HashedPassword: "new hashed password"})
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, res.ID)
+	assert.Equal(t, "new hashed password", res.HashedPassword)
+
+	_, err = repoTest.ReadRefreshToken(ctx, user.ID, refreshToken)
+	require.Error(t, err)
+
+	// a user without refresh tokens can change the password too
+	_, err = repoTest.ChangePassword(ctx, auth.UpdatePasswordParams{ID: user.ID, HashedPassword: "newer hashed password"})
+	require.NoError(t, err)
+
+	_, err = repoTest.ChangePassword(ctx, auth.UpdatePasswordParams{ID: user.ID + 5, HashedPassword: "new hashed password"})
+	require.Error(t, err)
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+}
+
+func TestUpdateProfile(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user := createRandomUser(t)
+	err = repoTest.UpdateUserVerification(ctx, auth.UpdateUserVerificationParams{ID: user.ID, Email: user.Email})
+	require.NoError(t, err)
+
+	res, err := repoTest.GetProfile(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, user.Username, res.Username)
+	assert.False(t, res.FullName.Valid)
+	assert.False(t, res.Phone.Valid)
+	assert.True(t, res.IsVerified)
+	assert.Empty(t, res.Addresses)
+
+	t.Run("full_name_and_phone", func(t *testing.T) {
+		arg := auth.UpdateProfileParams{
+			ID:       user.ID,
+			FullName: pgtype.Text{String: "Grace Doe", Valid: true},
+			Phone:    pgtype.Text{String: "+6281234567890", Valid: true},
+		}
+		res, err := repoTest.UpdateProfile(ctx, arg)
+		require.NoError(t, err)
+		assert.Equal(t, user.Username, res.Username)
+		assert.Equal(t, user.Email, res.Email)
+		assert.Equal(t, arg.FullName, res.FullName)
+		assert.Equal(t, arg.Phone, res.Phone)
+		assert.True(t, res.IsVerified)
+	})
+
+	t.Run("clear_phone", func(t *testing.T) {
+		res, err := repoTest.UpdateProfile(ctx, auth.UpdateProfileParams{ID: user.ID, Phone: pgtype.Text{String: "", Valid: true}})
+		require.NoError(t, err)
+		assert.Equal(t, "Grace Doe", res.FullName.String)
+		assert.False(t, res.Phone.Valid)
+	})
+
+	t.Run("same_email_stays_verified", func(t *testing.T) {
+		res, err := repoTest.UpdateProfile(ctx, auth.UpdateProfileParams{ID: user.ID, Email: pgtype.Text{String: user.Email, Valid: true}})
+		require.NoError(t, err)
+		assert.True(t, res.IsVerified)
+	})
+
+	t.Run("new_email_unverified", func(t *testing.T) {
+		arg := auth.UpdateProfileParams{
+			ID:       user.ID,
+			Username: pgtype.Text{String: "new" + user.Username, Valid: true},
+			Email:    pgtype.Text{String: "new" + user.Email, Valid: true},
+		}
+		res, err := repoTest.UpdateProfile(ctx, arg)
+		require.NoError(t, err)
+		assert.Equal(t, arg.Username.String, res.Username)
+		assert.Equal(t, arg.Email.String, res.Email)
+		assert.False(t, res.IsVerified)
+	})
+
+	t.Run("failed_wrong_id", func(t *testing.T) {
+		_, err := repoTest.UpdateProfile(ctx, auth.UpdateProfileParams{ID: user.ID + 5})
+		require.Error(t, err)
+		assert.ErrorIs(t, err, pgx.ErrNoRows)
+	})
+}
+
+func TestAddresses(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user := createRandomUser(t)
+	other := createRandomUser(t)
+
+	arg := auth.AddressParams{
+		UserID:    user.ID,
+		Label:     "home",
+		Recipient: user.Username,
+		Street:    "Circle Street, No.1",
+		City:      "Bandung",
+		Province:  "West Java",
+		Country:   "Indonesia",
+	}
+
+	_, err = repoTest.GetDefaultAddress(ctx, user.ID)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+
+	// the first address is the default even when it isn't asked
+	home, err := repoTest.CreateAddress(ctx, arg)
+	require.NoError(t, err)
+	assert.NotZero(t, home.ID)
+	assert.True(t, home.IsDefault)
+	assert.Equal(t, "Circle Street, No.1, Bandung, West Java, Indonesia", home.String())
+
+	arg.Label = "office"
+	arg.Street = "Square Street, No.2"
+	office, err := repoTest.CreateAddress(ctx, arg)
+	require.NoError(t, err)
+	assert.False(t, office.IsDefault)
+
+	arg.ID = office.ID
+	arg.IsDefault = true
+	office, err = repoTest.UpdateAddress(ctx, arg)
+	require.NoError(t, err)
+	assert.True(t, office.IsDefault)
+
+	res, err := repoTest.GetDefaultAddress(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, office.ID, res.ID)
+
+	addresses, err := repoTest.ListAddresses(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, addresses, 2)
+	assert.Equal(t, office.ID, addresses[0].ID)
+	assert.False(t, addresses[1].IsDefault)
+
+	t.Run("failed_other_user", func(t *testing.T) {
+		arg := arg
+		arg.UserID = other.ID
+		_, err := repoTest.UpdateAddress(ctx, arg)
+		require.Error(t, err)
+		assert.ErrorIs(t, err, pgx.ErrNoRows)
+
+		err = repoTest.DeleteAddress(ctx, auth.DeleteAddressParams{ID: office.ID, UserID: other.ID})
+		require.Error(t, err)
+		assert.ErrorIs(t, err, pgx.ErrNoRows)
+	})
+
+	// deleting the default makes the one left the default
+	err = repoTest.DeleteAddress(ctx, auth.DeleteAddressParams{ID: office.ID, UserID: user.ID})
+	require.NoError(t, err)
+
+	res, err = repoTest.GetDefaultAddress(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, home.ID, res.ID)
+
+	profile, err := repoTest.GetProfile(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, profile.Addresses, 1)
+	assert.Equal(t, home.ID, profile.Addresses[0].ID)
+}
+
 func TestDeleteUser(t *testing.T) {
 	err := testUtils.DeleteSchemaTestData(pool)
 	require.NoError(t, err)
@@ -331,13 +666,73 @@ func TestDeleteUser(t *testing.T) {
 	}
 }
 
-func TestLoadKey(t *testing.T) {
+func TestLoadKeys(t *testing.T) {
 	err := testUtils.DeleteSchemaTestData(pool)
 	require.NoError(t, err)
 
-	res, err := repoTest.LoadKey(ctx)
+	res, err := repoTest.LoadKeys(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, res.Signing)
+	assert.NotEmpty(t, res.Signing.Kid)
+
+	key, ok := res.Find(res.Signing.Kid)
+	require.True(t, ok)
+	assert.Equal(t, res.Signing.ID, key.ID)
+}
+
+func TestNewKeySet(t *testing.T) {
+	now := time.Now()
+	rsaSigner, err := signer.Generate(signer.RS256)
+	require.NoError(t, err)
+	// the next key moves tokens to EdDSA
+	ed25519Signer, err := signer.Generate(signer.EdDSA)
+	require.NoError(t, err)
+
+	retired := auth.SigningKey{ID: 1, Kid: "retired", Signer: rsaSigner, ActivatesAt: now.Add(-48 * time.Hour), RetiresAt: pgtype.Timestamp{Time: now.Add(-time.Hour), Valid: true}}
+	retiring := auth.SigningKey{ID: 2, Kid: "retiring", Signer: rsaSigner, ActivatesAt: now.Add(-24 * time.Hour), RetiresAt: pgtype.Timestamp{Time: now.Add(time.Hour), Valid: true}}
+	active := auth.SigningKey{ID: 3, Kid: "active", Signer: rsaSigner, ActivatesAt: now.Add(-time.Minute)}
+	next := auth.SigningKey{ID: 4, Kid: "next", Signer: ed25519Signer, ActivatesAt: now.Add(10 * time.Minute)}
+
+	keys, err := auth.NewKeySet([]auth.SigningKey{next, active, retiring, retired}, now)
 	require.NoError(t, err)
-	require.NotNil(t, res)
+	assert.Equal(t, "active", keys.Signing.Kid)
+	require.Len(t, keys.Keys, 3)
+
+	_, ok := keys.Find("retiring")
+	assert.True(t, ok)
+	_, ok = keys.Find("retired")
+	assert.False(t, ok)
+	// tokens without a kid are checked with the signing key
+	key, ok := keys.Find("")
+	require.True(t, ok)
+	assert.Equal(t, "active", key.Kid)
+
+	// the next key is published before it signs
+	jwks := keys.JWKS()
+	require.Len(t, jwks.Keys, 3)
+	assert.Equal(t, "next", jwks.Keys[0].Kid)
+	assert.Equal(t, "OKP", jwks.Keys[0].Kty)
+	assert.Equal(t, "EdDSA", jwks.Keys[0].Alg)
+	assert.Equal(t, "Ed25519", jwks.Keys[0].Crv)
+	assert.Equal(t, "active", jwks.Keys[1].Kid)
+	assert.Equal(t, "RSA", jwks.Keys[1].Kty)
+	assert.Equal(t, "RS256", jwks.Keys[1].Alg)
+	assert.Equal(t, "AQAB", jwks.Keys[1].E)
+
+	keys, err = auth.NewKeySet([]auth.SigningKey{next, active, retiring, retired}, now.Add(11*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, "next", keys.Signing.Kid)
+
+	_, err = auth.NewKeySet([]auth.SigningKey{next, retired}, now)
+	require.Error(t, err)
+
+	// the verifying set finds the retired key but still signs with the active
+	keys, err = auth.NewVerifyingKeySet([]auth.SigningKey{next, active, retiring, retired}, now)
+	require.NoError(t, err)
+	assert.Equal(t, "active", keys.Signing.Kid)
+	require.Len(t, keys.Keys, 4)
+	_, ok = keys.Find("retired")
+	assert.True(t, ok)
 }
 
 func TestInsertRefreshToken(t *testing.T) {
@@ -381,17 +776,17 @@ func TestInsertRefreshToken(t *testing.T) {
 	for _, tC := range testCases {
 		t.Run(tC.name, func(t *testing.T) {
 			if !tC.err {
-				err := repoTest.InsertRefreshToken(ctx, tC.user.ID, tC.token)
+				err := repoTest.InsertRefreshToken(ctx, tC.user.ID, tC.token, time.Now().UTC().Add(time.Hour))
 				require.NoError(t, err)
 			}
 			if tC.name == "error_wrong_id" {
-				err := repoTest.InsertRefreshToken(ctx, 0, tC.token)
+				err := repoTest.InsertRefreshToken(ctx, 0, tC.token, time.Now().UTC().Add(time.Hour))
 				require.Error(t, err)
 			}
 			if tC.name == "error_duplicate_uuid" {
-				err := repoTest.InsertRefreshToken(ctx, tC.user.ID, tC.token)
+				err := repoTest.InsertRefreshToken(ctx, tC.user.ID, tC.token, time.Now().UTC().Add(time.Hour))
 				require.NoError(t, err)
-				err = repoTest.InsertRefreshToken(ctx, tC.user.ID, tC.token)
+				err = repoTest.InsertRefreshToken(ctx, tC.user.ID, tC.token, time.Now().UTC().Add(time.Hour))
 				require.Error(t, err)
 			}
 		})
@@ -438,7 +833,7 @@ func TestReadRefreshToken(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			err := repoTest.InsertRefreshToken(ctx, test.user.ID, test.token)
+			err := repoTest.InsertRefreshToken(ctx, test.user.ID, test.token, time.Now().UTC().Add(time.Hour))
 			require.NoError(t, err)
 			if !test.err {
 				res, err := repoTest.ReadRefreshToken(ctx, test.user.ID, test.token)
@@ -501,7 +896,7 @@ func TestDeleteRefreshToken(t *testing.T) {
 
 	for _, tC := range testCases {
 		t.Run(tC.name, func(t *testing.T) {
-			err := repoTest.InsertRefreshToken(ctx, tC.user.ID, tC.token)
+			err := repoTest.InsertRefreshToken(ctx, tC.user.ID, tC.token, time.Now().UTC().Add(time.Hour))
 			require.NoError(t, err)
 			if !tC.err {
 				err := repoTest.DeleteRefreshToken(ctx, tC.user.ID)
@@ -520,3 +915,385 @@ func TestDeleteRefreshToken(t *testing.T) {
 		})
 	}
 }
+
+func TestSessions(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user := createRandomUser(t)
+	other := createRandomUser(t)
+
+	laptop, err := repoTest.CreateSession(ctx, auth.CreateSessionParams{
+		UserID:       user.ID,
+		RefreshToken: uuid.New(),
+		DeviceName:   "laptop",
+		UserAgent:    "Mozilla/5.0",
+		IPAddress:    "127.0.0.1",
+		RememberMe:   true,
+		ExpiresAt:    time.Now().UTC().Add(time.Hour),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "laptop", laptop.DeviceName)
+	assert.Equal(t, "Mozilla/5.0", laptop.UserAgent)
+	assert.Equal(t, "127.0.0.1", laptop.IPAddress)
+	assert.True(t, laptop.RememberMe)
+	assert.NotZero(t, laptop.LastUsedAt)
+
+	// logging in on a second device keeps the first session
+	phone, err := repoTest.CreateSession(ctx, auth.CreateSessionParams{UserID: user.ID, RefreshToken: uuid.New(), DeviceName: "phone", ExpiresAt: time.Now().UTC().Add(time.Hour)})
+	require.NoError(t, err)
+
+	sessions, err := repoTest.ListSessions(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+
+	newToken := uuid.New()
+	err = repoTest.UpdateRefreshToken(ctx, auth.UpdateRefreshTokenParams{ID: laptop.ID, UserID: user.ID, RefreshToken: newToken, OldRefreshToken: laptop.RefreshToken, ExpiresAt: time.Now().UTC().Add(time.Hour)})
+	require.NoError(t, err)
+
+	res, err := repoTest.ReadRefreshToken(ctx, user.ID, newToken)
+	require.NoError(t, err)
+	assert.Equal(t, laptop.ID, res.ID)
+	_, err = repoTest.ReadRefreshToken(ctx, user.ID, laptop.RefreshToken)
+	require.Error(t, err)
+
+	t.Run("failed_other_user", func(t *testing.T) {
+		err := repoTest.UpdateRefreshToken(ctx, auth.UpdateRefreshTokenParams{ID: phone.ID, UserID: other.ID, RefreshToken: uuid.New(), OldRefreshToken: phone.RefreshToken, ExpiresAt: time.Now().UTC().Add(time.Hour)})
+		require.Error(t, err)
+		assert.ErrorIs(t, err, pgx.ErrNoRows)
+
+		err = repoTest.DeleteSession(ctx, auth.DeleteSessionParams{ID: phone.ID, UserID: other.ID})
+		require.Error(t, err)
+		assert.ErrorIs(t, err, pgx.ErrNoRows)
+	})
+
+	err = repoTest.DeleteSession(ctx, auth.DeleteSessionParams{ID: phone.ID, UserID: user.ID})
+	require.NoError(t, err)
+
+	sessions, err = repoTest.ListSessions(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, laptop.ID, sessions[0].ID)
+
+	sessions, err = repoTest.ListSessions(ctx, other.ID)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user := createRandomUser(t)
+
+	session, err := repoTest.CreateSession(ctx, auth.CreateSessionParams{UserID: user.ID, RefreshToken: uuid.New(), ExpiresAt: time.Now().UTC().Add(time.Hour)})
+	require.NoError(t, err)
+
+	first := uuid.New()
+	err = repoTest.UpdateRefreshToken(ctx, auth.UpdateRefreshTokenParams{ID: session.ID, UserID: user.ID, RefreshToken: first, OldRefreshToken: session.RefreshToken, ExpiresAt: time.Now().UTC().Add(time.Hour)})
+	require.NoError(t, err)
+	second := uuid.New()
+	err = repoTest.UpdateRefreshToken(ctx, auth.UpdateRefreshTokenParams{ID: session.ID, UserID: user.ID, RefreshToken: second, OldRefreshToken: first, ExpiresAt: time.Now().UTC().Add(time.Hour)})
+	require.NoError(t, err)
+
+	rotation, err := repoTest.GetRefreshTokenRotation(ctx, user.ID, session.RefreshToken)
+	require.NoError(t, err)
+	assert.Equal(t, session.ID, rotation.SessionID)
+	assert.Equal(t, first, rotation.RefreshToken)
+
+	rotation, err = repoTest.GetRefreshTokenRotation(ctx, user.ID, first)
+	require.NoError(t, err)
+	assert.Equal(t, second, rotation.RefreshToken)
+
+	_, err = repoTest.GetRefreshTokenRotation(ctx, user.ID, second)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+
+	t.Run("failed_rotated_token", func(t *testing.T) {
+		err := repoTest.UpdateRefreshToken(ctx, auth.UpdateRefreshTokenParams{ID: session.ID, UserID: user.ID, RefreshToken: uuid.New(), OldRefreshToken: first, ExpiresAt: time.Now().UTC().Add(time.Hour)})
+		require.Error(t, err)
+		assert.ErrorIs(t, err, pgx.ErrNoRows)
+
+		res, err := repoTest.ReadRefreshToken(ctx, user.ID, second)
+		require.NoError(t, err)
+		assert.Equal(t, session.ID, res.ID)
+	})
+
+	// the rotations go with the session
+	err = repoTest.DeleteSession(ctx, auth.DeleteSessionParams{ID: session.ID, UserID: user.ID})
+	require.NoError(t, err)
+	_, err = repoTest.GetRefreshTokenRotation(ctx, user.ID, first)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+}
+
+func TestAuditLogs(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user := createRandomUser(t)
+
+	res, err := repoTest.CreateAuditLog(ctx, auth.CreateAuditLogParams{
+		UserID:    user.ID,
+		SessionID: pgtype.Int4{Int32: 7, Valid: true},
+		Event:     auth.AuditRefreshTokenReused,
+		Detail:    "session 7 is revoked",
+	})
+	require.NoError(t, err)
+	assert.NotZero(t, res.ID)
+	assert.Equal(t, auth.AuditRefreshTokenReused, res.Event)
+
+	logs, err := repoTest.ListAuditLogs(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+	assert.Equal(t, *res, logs[0])
+
+	// the log is kept after the user is deleted
+	err = repoTest.DeleteUser(ctx, auth.DeleteUserParams{ID: user.ID, Email: user.Email})
+	require.NoError(t, err)
+	logs, err = repoTest.ListAuditLogs(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Len(t, logs, 1)
+}
+
+func TestTOTP(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user := createRandomUser(t)
+
+	_, err = repoTest.GetTOTP(ctx, user.ID)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+
+	res, err := repoTest.UpsertTOTP(ctx, user.ID, "FIRSTSECRET")
+	require.NoError(t, err)
+	assert.Equal(t, "FIRSTSECRET", res.Secret)
+	assert.False(t, res.ConfirmedAt.Valid)
+
+	// an enrollment that wasn't confirmed starts over
+	res, err = repoTest.UpsertTOTP(ctx, user.ID, "SECONDSECRET")
+	require.NoError(t, err)
+	assert.Equal(t, "SECONDSECRET", res.Secret)
+
+	// the secret is only stored encrypted
+	var stored []byte
+	var encrypted bool
+	err = pool.QueryRow(ctx, "SELECT secret, encrypted FROM user_totp WHERE user_id = $1", user.ID).Scan(&stored, &encrypted)
+	require.NoError(t, err)
+	assert.True(t, encrypted)
+	assert.NotContains(t, string(stored), "SECONDSECRET")
+
+	err = repoTest.UseTOTPStep(ctx, user.ID, 10)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+
+	err = repoTest.ConfirmTOTP(ctx, auth.ConfirmTOTPParams{UserID: user.ID, Step: 10, RecoveryCodeHashes: []string{"hash1", "hash2"}})
+	require.NoError(t, err)
+
+	res, err = repoTest.GetTOTP(ctx, user.ID)
+	require.NoError(t, err)
+	assert.True(t, res.ConfirmedAt.Valid)
+	assert.Equal(t, int64(10), res.LastUsedStep)
+
+	_, err = repoTest.UpsertTOTP(ctx, user.ID, "THIRDSECRET")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+
+	t.Run("secrets_are_converted", func(t *testing.T) {
+		count, err := repoTest.SetTOTPSecretsEncryption(ctx, false)
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+
+		err = pool.QueryRow(ctx, "SELECT secret, encrypted FROM user_totp WHERE user_id = $1", user.ID).Scan(&stored, &encrypted)
+		require.NoError(t, err)
+		assert.False(t, encrypted)
+		assert.Equal(t, "SECONDSECRET", string(stored))
+
+		// a plain secret from before is still read
+		res, err := repoTest.GetTOTP(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "SECONDSECRET", res.Secret)
+
+		count, err = repoTest.SetTOTPSecretsEncryption(ctx, true)
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+
+		res, err = repoTest.GetTOTP(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "SECONDSECRET", res.Secret)
+	})
+
+	t.Run("steps_are_used_once", func(t *testing.T) {
+		err := repoTest.UseTOTPStep(ctx, user.ID, 10)
+		require.Error(t, err)
+		assert.ErrorIs(t, err, pgx.ErrNoRows)
+
+		err = repoTest.UseTOTPStep(ctx, user.ID, 11)
+		require.NoError(t, err)
+	})
+
+	t.Run("recovery_codes_are_used_once", func(t *testing.T) {
+		err := repoTest.UseRecoveryCode(ctx, user.ID, "hash1")
+		require.NoError(t, err)
+
+		err = repoTest.UseRecoveryCode(ctx, user.ID, "hash1")
+		require.Error(t, err)
+		assert.ErrorIs(t, err, pgx.ErrNoRows)
+
+		err = repoTest.UseRecoveryCode(ctx, user.ID, "hash3")
+		require.Error(t, err)
+		assert.ErrorIs(t, err, pgx.ErrNoRows)
+	})
+
+	err = repoTest.DeleteTOTP(ctx, user.ID)
+	require.NoError(t, err)
+
+	_, err = repoTest.GetTOTP(ctx, user.ID)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+	err = repoTest.UseRecoveryCode(ctx, user.ID, "hash2")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+}
+
+func TestAPIKeys(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user := createRandomUser(t)
+
+	arg := auth.CreateAPIKeyParams{
+		UserID:  user.ID,
+		Name:    "reports job",
+		Prefix:  "gca_0123abcd",
+		KeyHash: auth.HashAPIKey("gca_0123abcd-key"),
+		Scopes:  []string{"wallets:read", "transactions:read"},
+	}
+	res, err := repoTest.CreateAPIKey(ctx, arg)
+	require.NoError(t, err)
+	assert.NotZero(t, res.ID)
+	assert.Equal(t, arg.Name, res.Name)
+	assert.Equal(t, arg.Prefix, res.Prefix)
+	assert.Equal(t, arg.Scopes, res.Scopes)
+	assert.False(t, res.ExpiresAt.Valid)
+	assert.False(t, res.LastUsedAt.Valid)
+
+	expired, err := repoTest.CreateAPIKey(ctx, auth.CreateAPIKeyParams{
+		UserID:    user.ID,
+		Name:      "old job",
+		Prefix:    "gca_4567efab",
+		KeyHash:   auth.HashAPIKey("gca_4567efab-key"),
+		Scopes:    []string{"wallets:read"},
+		ExpiresAt: pgtype.Timestamp{Time: time.Now().UTC().Add(-time.Hour), Valid: true},
+	})
+	require.NoError(t, err)
+
+	keys, err := repoTest.ListAPIKeys(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	assert.Equal(t, *res, keys[0])
+
+	got, err := repoTest.GetAPIKeyByHash(ctx, arg.KeyHash)
+	require.NoError(t, err)
+	assert.Equal(t, res.ID, got.ID)
+
+	t.Run("failed_expired", func(t *testing.T) {
+		_, err := repoTest.GetAPIKeyByHash(ctx, auth.HashAPIKey("gca_4567efab-key"))
+		require.Error(t, err)
+		assert.ErrorIs(t, err, pgx.ErrNoRows)
+	})
+
+	err = repoTest.TouchAPIKey(ctx, res.ID)
+	require.NoError(t, err)
+	got, err = repoTest.GetAPIKeyByHash(ctx, arg.KeyHash)
+	require.NoError(t, err)
+	assert.True(t, got.LastUsedAt.Valid)
+
+	t.Run("failed_other_user", func(t *testing.T) {
+		err := repoTest.DeleteAPIKey(ctx, auth.DeleteAPIKeyParams{ID: res.ID, UserID: user.ID + 1})
+		require.Error(t, err)
+		assert.ErrorIs(t, err, pgx.ErrNoRows)
+	})
+
+	err = repoTest.DeleteAPIKey(ctx, auth.DeleteAPIKeyParams{ID: res.ID, UserID: user.ID})
+	require.NoError(t, err)
+	_, err = repoTest.GetAPIKeyByHash(ctx, arg.KeyHash)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+
+	keys, err = repoTest.ListAPIKeys(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, expired.ID, keys[0].ID)
+}
+
+func TestIdentities(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user := createRandomUser(t)
+
+	arg := auth.CreateIdentityParams{
+		UserID:   user.ID,
+		Provider: "google",
+		Subject:  "1234",
+		Email:    user.Email,
+	}
+	res, err := repoTest.CreateIdentity(ctx, arg)
+	require.NoError(t, err)
+	assert.NotZero(t, res.ID)
+	assert.Equal(t, arg.UserID, res.UserID)
+	assert.Equal(t, arg.Provider, res.Provider)
+	assert.Equal(t, arg.Subject, res.Subject)
+
+	got, err := repoTest.GetIdentity(ctx, "google", "1234")
+	require.NoError(t, err)
+	assert.Equal(t, *res, *got)
+
+	t.Run("failed_other_provider", func(t *testing.T) {
+		_, err := repoTest.GetIdentity(ctx, "github", "1234")
+		require.Error(t, err)
+		assert.ErrorIs(t, err, pgx.ErrNoRows)
+	})
+
+	t.Run("failed_duplicate", func(t *testing.T) {
+		_, err := repoTest.CreateIdentity(ctx, arg)
+		require.Error(t, err)
+	})
+
+	t.Run("create_identity_user", func(t *testing.T) {
+		username := generator.CreateRandomString(5)
+		newUser, err := repoTest.CreateIdentityUser(ctx, auth.CreateIdentityUserParams{
+			User: auth.CreateUserParams{
+				Username:       username,
+				Email:          generator.CreateRandomEmail(username),
+				HashedPassword: generator.CreateRandomString(20),
+			},
+			Provider: "google",
+			Subject:  "5678",
+		})
+		require.NoError(t, err)
+		assert.True(t, newUser.IsVerified)
+
+		got, err := repoTest.GetIdentity(ctx, "google", "5678")
+		require.NoError(t, err)
+		assert.Equal(t, newUser.ID, got.UserID)
+		assert.Equal(t, newUser.Email, got.Email)
+
+		// the user isn't created when the identity is taken
+		email := generator.CreateRandomEmail(username + "x")
+		_, err = repoTest.CreateIdentityUser(ctx, auth.CreateIdentityUserParams{
+			User: auth.CreateUserParams{
+				Username:       username,
+				Email:          email,
+				HashedPassword: generator.CreateRandomString(20),
+			},
+			Provider: "google",
+			Subject:  "5678",
+		})
+		require.Error(t, err)
+		_, err = repoTest.GetUserByEmail(ctx, email)
+		assert.ErrorIs(t, err, pgx.ErrNoRows)
+	})
+}
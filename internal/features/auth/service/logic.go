@@ -2,32 +2,82 @@ package service
 
 import (
 	"context"
-	"crypto/rsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"log"
+	"net/url"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 
 	auth "github.com/dwiw96/GoCommerceAPI/internal/features/auth"
+	mailer "github.com/dwiw96/GoCommerceAPI/pkg/mailer"
 	middleware "github.com/dwiw96/GoCommerceAPI/pkg/middleware"
+	oidc "github.com/dwiw96/GoCommerceAPI/pkg/oidc"
 	password "github.com/dwiw96/GoCommerceAPI/pkg/utils/password"
 	errorHandler "github.com/dwiw96/GoCommerceAPI/pkg/utils/responses"
+	signer "github.com/dwiw96/GoCommerceAPI/pkg/utils/signer"
+	totp "github.com/dwiw96/GoCommerceAPI/pkg/utils/totp"
+)
+
+const (
+	// mfaChallengeTTL is how long a user with TOTP has to send the code after
+	// the password.
+	mfaChallengeTTL = 5 * time.Minute
+	// totpIssuer names the account in the authenticator app.
+	totpIssuer = "GoCommerceAPI"
+
+	recoveryCodeCount    = 10
+	recoveryCodeAlphabet = "abcdefghijklmnopqrstuvwxyz234567"
+
+	// apiKeyPrefixLength is how much of an API key is kept to show, the
+	// "gca_" and 8 hex digits.
+	apiKeyPrefixLength = 12
+
+	// oidcStateTTL is how long a user has to log in at the provider.
+	oidcStateTTL = 10 * time.Minute
 )
 
 type authService struct {
-	repo  auth.IRepository
-	cache auth.ICache
-	ctx   context.Context
+	repo        auth.IRepository
+	cache       auth.ICache
+	ctx         context.Context
+	sender      mailer.Sender
+	conf        auth.ServiceConfig
+	adminEmails map[string]bool
+	oidcClients map[string]*oidc.Client
 }
 
-func NewAuthService(repo auth.IRepository, cache auth.ICache, ctx context.Context) auth.IService {
+// NewAuthService returns the auth service. The users whose email is in
+// conf.AdminEmails are made admin once they verified it, when they verify or
+// log in, that is how the first admin gets in before anyone can grant roles.
+func NewAuthService(repo auth.IRepository, cache auth.ICache, ctx context.Context, sender mailer.Sender, conf auth.ServiceConfig) auth.IService {
+	admins := make(map[string]bool, len(conf.AdminEmails))
+	for _, email := range conf.AdminEmails {
+		admins[strings.ToLower(email)] = true
+	}
+	oidcClients := make(map[string]*oidc.Client, len(conf.OIDCProviders))
+	for _, provider := range conf.OIDCProviders {
+		oidcClients[provider.Name] = oidc.NewClient(provider, nil)
+	}
+
 	return &authService{
-		repo:  repo,
-		cache: cache,
-		ctx:   ctx,
+		repo:        repo,
+		cache:       cache,
+		ctx:         ctx,
+		sender:      sender,
+		conf:        conf,
+		adminEmails: admins,
+		oidcClients: oidcClients,
 	}
 }
 
@@ -47,7 +97,6 @@ func (s *authService) SignUp(input auth.SignupRequest) (user *auth.User, token s
 		Email:          input.Email,
 		HashedPassword: input.Password,
 	}
-
 	arg.HashedPassword, err = password.HashingPassword(input.Password)
 	if err != nil {
 		return nil, "", errorHandler.CodeFailedServer, err
@@ -58,71 +107,203 @@ func (s *authService) SignUp(input auth.SignupRequest) (user *auth.User, token s
 		return nil, "", errorHandler.CodeFailedUser, err
 	}
 
-	// load private key
-	key, err := s.repo.LoadKey(s.ctx)
+	// load signing keys
+	keys, err := s.repo.LoadKeys(s.ctx)
 	if err != nil {
 		return nil, "", errorHandler.CodeFailedServer, fmt.Errorf("load key error: %w", err)
 	}
 
-	token, err = middleware.CreateToken(*user, 10, key)
+	token, err = middleware.CreateToken(*user, 0, s.conf.SignUpTokenTTL, keys.Signing)
 	if err != nil {
 		return nil, "", errorHandler.CodeFailedServer, err
 	}
 
+	// the user is already saved, a mail that can't be sent is only logged
+	// and the user can ask for it again
+	if err := s.sendVerification(user, keys.Signing); err != nil {
+		log.Printf("failed to send verification email to user %d, err: %v", user.ID, err)
+	}
+
 	return user, token, errorHandler.CodeSuccess, nil
 }
 
-func (s *authService) LogIn(input auth.LoginRequest) (user *auth.User, accessToken, refreshToken string, code int, err error) {
+// dummyHash is compared with the password when the email has no user, so the
+// log in takes as long as a wrong password does.
+var dummyHash = sync.OnceValue(func() string {
+	hash, err := password.HashingPassword("dummy password")
+	if err != nil {
+		log.Printf("failed to hash dummy password, err: %v", err)
+	}
+	return hash
+})
+
+// LogIn checks the email and password. A wrong email and a wrong password
+// get the same error, and the failed log ins of an email or an ip hold back
+// the next ones from it for a growing delay until a lockout. A user with TOTP
+// gets an MFA challenge token instead of the tokens, LogInMFA trades it for
+// them with a code.
+func (s *authService) LogIn(input auth.LoginRequest) (user *auth.User, accessToken, refreshToken, mfaToken string, code int, err error) {
+	delay, err := s.cache.LoginDelay(input.Email, input.IPAddress)
+	if err != nil {
+		return nil, "", "", "", errorHandler.CodeFailedServer, err
+	}
+	if delay > 0 {
+		return nil, "", "", "", errorHandler.CodeFailedTooManyRequests, errorHandler.ErrTooManyLoginAttempts
+	}
+
 	user, err = s.repo.GetUserByEmail(s.ctx, input.Email)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, "", "", "", errorHandler.CodeFailedServer, err
+	}
+
+	found := err == nil
+	hashedPassword := dummyHash()
+	if found {
+		hashedPassword = user.HashedPassword
+	}
+	if err := password.VerifyHashPassword(input.Password, hashedPassword); err != nil || !found {
+		if err := s.cache.RecordFailedLogin(input.Email, input.IPAddress); err != nil {
+			return nil, "", "", "", errorHandler.CodeFailedServer, err
+		}
+		return nil, "", "", "", errorHandler.CodeFailedUnauthorized, errorHandler.ErrInvalidCredentials
+	}
+
+	if err := s.cache.ClearFailedLogins(input.Email); err != nil {
+		return nil, "", "", "", errorHandler.CodeFailedServer, err
+	}
+
+	totpEnabled, err := s.totpEnabled(user.ID)
 	if err != nil {
-		if strings.Contains(err.Error(), pgx.ErrNoRows.Error()) {
-			errMsg := fmt.Errorf("no user found with this email %s", input.Email)
-			return nil, "", "", errorHandler.CodeFailedUnauthorized, errMsg
+		return nil, "", "", "", errorHandler.CodeFailedServer, err
+	}
+	if totpEnabled {
+		mfaToken, err = s.createMFAChallengeToken(user.ID)
+		if err != nil {
+			return nil, "", "", "", errorHandler.CodeFailedServer, err
 		}
-		return nil, "", "", errorHandler.CodeFailedServer, err
+		return nil, "", "", mfaToken, errorHandler.CodeSuccess, nil
 	}
 
-	err = password.VerifyHashPassword(input.Password, user.HashedPassword)
+	user, accessToken, refreshToken, err = s.startSession(user, input.DeviceName, input.UserAgent, input.IPAddress, input.RememberMe)
 	if err != nil {
-		errMsg := errors.New("password is wrong")
-		return nil, "", "", errorHandler.CodeFailedUnauthorized, errMsg
+		return nil, "", "", "", errorHandler.CodeFailedServer, err
 	}
 
-	key, err := s.repo.LoadKey(s.ctx)
+	return user, accessToken, refreshToken, "", errorHandler.CodeSuccess, nil
+}
+
+// LogInMFA is the second step of a log in for a user with TOTP. The MFA
+// challenge token from LogIn is traded for the tokens with a TOTP code or a
+// recovery code, wrong codes are throttled like wrong passwords.
+func (s *authService) LogInMFA(input auth.MFALoginRequest) (user *auth.User, accessToken, refreshToken string, code int, err error) {
+	keys, err := s.repo.LoadKeys(s.ctx)
 	if err != nil {
 		return nil, "", "", errorHandler.CodeFailedServer, fmt.Errorf("load key error: %w", err)
 	}
 
-	accessToken, err = middleware.CreateToken(*user, 60, key)
+	claims, err := readMFAChallengeToken(input.MFAToken, keys)
 	if err != nil {
-		errMsg := errors.New("failed generate access token")
-		return nil, "", "", errorHandler.CodeFailedServer, errMsg
+		return nil, "", "", errorHandler.CodeFailedUnauthorized, errorHandler.ErrInvalidMFAToken
 	}
-	refreshTokenUUID, err := uuid.NewRandom()
+
+	user, err = s.repo.GetUserByID(s.ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, "", "", errorHandler.CodeFailedUnauthorized, errorHandler.ErrInvalidMFAToken
+		}
+		return nil, "", "", errorHandler.CodeFailedServer, err
+	}
+
+	delay, err := s.cache.LoginDelay(user.Email, input.IPAddress)
 	if err != nil {
-		errMsg := errors.New("failed generate refresh token")
-		return nil, "", "", errorHandler.CodeFailedServer, errMsg
+		return nil, "", "", errorHandler.CodeFailedServer, err
+	}
+	if delay > 0 {
+		return nil, "", "", errorHandler.CodeFailedTooManyRequests, errorHandler.ErrTooManyLoginAttempts
 	}
 
-	err = s.repo.InsertRefreshToken(s.ctx, user.ID, refreshTokenUUID)
+	ok, err := s.useMFACode(user.ID, input.Code, true)
 	if err != nil {
+		if errors.Is(err, errorHandler.ErrTOTPNotEnrolled) {
+			return nil, "", "", errorHandler.CodeFailedUnauthorized, errorHandler.ErrInvalidMFAToken
+		}
+		return nil, "", "", errorHandler.CodeFailedServer, err
+	}
+	if !ok {
+		if err := s.cache.RecordFailedLogin(user.Email, input.IPAddress); err != nil {
+			return nil, "", "", errorHandler.CodeFailedServer, err
+		}
+		return nil, "", "", errorHandler.CodeFailedUnauthorized, errorHandler.ErrInvalidTOTPCode
+	}
+
+	if err := s.cache.ClearFailedLogins(user.Email); err != nil {
 		return nil, "", "", errorHandler.CodeFailedServer, err
 	}
 
-	refreshToken = refreshTokenUUID.String()
+	user, accessToken, refreshToken, err = s.startSession(user, input.DeviceName, input.UserAgent, input.IPAddress, input.RememberMe)
+	if err != nil {
+		return nil, "", "", errorHandler.CodeFailedServer, err
+	}
 
 	return user, accessToken, refreshToken, errorHandler.CodeSuccess, nil
 }
 
-func (s *authService) LogOut(payload auth.JwtPayload) error {
-	err := s.repo.DeleteRefreshToken(s.ctx, payload.UserID)
+// startSession starts a session for the user who logged in and returns the
+// tokens of it, rememberMe gives it the longer refresh token lifetime.
+func (s *authService) startSession(user *auth.User, deviceName, userAgent, ipAddress string, rememberMe bool) (res *auth.User, accessToken, refreshToken string, err error) {
+	user, err = s.grantAdminEmail(user)
 	if err != nil {
-		return err
+		return nil, "", "", err
 	}
 
-	err = s.cache.CachingBlockedToken(payload)
+	keys, err := s.repo.LoadKeys(s.ctx)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("load key error: %w", err)
+	}
 
-	return err
+	user.Address, err = s.defaultAddress(user.ID)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	refreshTokenUUID, err := uuid.NewRandom()
+	if err != nil {
+		return nil, "", "", errors.New("failed generate refresh token")
+	}
+
+	// every log in is a session of its own, the other devices stay logged in
+	session, err := s.repo.CreateSession(s.ctx, auth.CreateSessionParams{
+		UserID:       user.ID,
+		RefreshToken: refreshTokenUUID,
+		DeviceName:   deviceName,
+		UserAgent:    userAgent,
+		IPAddress:    ipAddress,
+		RememberMe:   rememberMe,
+		ExpiresAt:    time.Now().UTC().Add(min(s.refreshTokenTTL(rememberMe), s.conf.SessionMaxLifetime)),
+	})
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	accessToken, err = middleware.CreateToken(*user, session.ID, s.conf.AccessTokenTTL, keys.Signing)
+	if err != nil {
+		return nil, "", "", errors.New("failed generate access token")
+	}
+
+	return user, accessToken, refreshTokenUUID.String(), nil
+}
+
+// LogOut ends the session of the token, the other sessions of the user stay.
+func (s *authService) LogOut(payload auth.JwtPayload) error {
+	if payload.SessionID != 0 {
+		err := s.repo.DeleteSession(s.ctx, auth.DeleteSessionParams{ID: payload.SessionID, UserID: payload.UserID})
+		// a session that is already revoked only needs the token blocked
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+	}
+
+	return s.cache.CachingBlockedToken(payload)
 }
 
 func (s *authService) DeleteUser(arg auth.DeleteUserParams) (code int, err error) {
@@ -134,22 +315,21 @@ func (s *authService) DeleteUser(arg auth.DeleteUserParams) (code int, err error
 	return errorHandler.CodeSuccess, nil
 }
 
+// RefreshToken rotates the refresh token of a session and issues a new access
+// token for it. The refresh token is what proves the session, the old access
+// token only has to be of that session so it can be blocked. Its signature is
+// checked against the retired keys too, a remember me session outlives the
+// key that signed it.
 func (s *authService) RefreshToken(refreshToken, accessToken string) (newRefreshToken, newAccessToken string, code int, err error) {
 	code = errorHandler.CodeSuccess
-	key, err := s.repo.LoadKey(s.ctx)
-	if err != nil {
-		return "", "", errorHandler.CodeFailedServer, err
-	}
-
-	authHeader := "Bearer " + accessToken
-	payload, err := middleware.ReadToken(authHeader, key)
+	keys, err := s.repo.LoadKeysWithRetired(s.ctx)
 	if err != nil {
 		return "", "", errorHandler.CodeFailedServer, err
 	}
 
-	err = s.cache.CachingBlockedToken(*payload)
+	payload, err := readRefreshedToken(accessToken, keys)
 	if err != nil {
-		return "", "", errorHandler.CodeFailedServer, fmt.Errorf("failed to caching access token, msg: %v", err)
+		return "", "", errorHandler.CodeFailedUnauthorized, err
 	}
 
 	refreshTokenUUID, err := uuid.Parse(refreshToken)
@@ -159,57 +339,1166 @@ func (s *authService) RefreshToken(refreshToken, accessToken string) (newRefresh
 
 	// Read and validate refresh token from database
 	res, errReadRefreshToken := s.repo.ReadRefreshToken(s.ctx, payload.UserID, refreshTokenUUID)
+	if errors.Is(errReadRefreshToken, pgx.ErrNoRows) {
+		code, err = s.revokeReusedRefreshToken(*payload, refreshTokenUUID)
+		if err != nil {
+			return "", "", code, err
+		}
+	}
 	err = s.validateRefreshToken(res, errReadRefreshToken)
 	if err != nil {
 		return "", "", errorHandler.CodeFailedUnauthorized, err
 	}
+	if payload.SessionID != res.ID {
+		return "", "", errorHandler.CodeFailedUnauthorized, fmt.Errorf("access token isn't of the refresh token's session")
+	}
+
+	err = s.cache.CachingBlockedToken(*payload)
+	if err != nil {
+		return "", "", errorHandler.CodeFailedServer, fmt.Errorf("failed to caching access token, msg: %v", err)
+	}
 
-	newAccessToken, newRefreshToken, err = s.createNewToken(key, payload)
+	newAccessToken, newRefreshToken, err = s.createNewToken(keys, res)
 	if err != nil {
+		// another refresh with the same token rotated it first
+		if errors.Is(err, pgx.ErrNoRows) {
+			code, err = s.revokeReusedRefreshToken(*payload, refreshTokenUUID)
+			if err != nil {
+				return "", "", code, err
+			}
+			return "", "", errorHandler.CodeFailedUnauthorized, fmt.Errorf("invalid refresh token")
+		}
 		return "", "", errorHandler.CodeFailedServer, err
 	}
 
 	return
 }
 
-// ValidateRefreshToken return error.
-//
-// ValidateRefreshToken check the refresh token from database, what to check:
-//   - check error when read from database.
-//   - check if the refresh token is nil
-//   - check if refresh token is expired
-//
-// When the refresh token is expired:
-//
-//	delete refresh token from database
-func (s *authService) validateRefreshToken(arg *auth.RefreshTokenWhitelist, errIn error) (err error) {
-	if errIn != nil {
-		return fmt.Errorf("invalid refresh token, msg: %v", errIn)
+// GrantRole gives the user arg.Role. A user whose email is in the admin
+// emails gets admin back on the next log in whatever is granted here.
+func (s *authService) GrantRole(arg auth.UpdateUserRoleParams) (user *auth.User, code int, err error) {
+	switch arg.Role {
+	case auth.RoleCustomer, auth.RoleStaff, auth.RoleAdmin:
+	default:
+		return nil, errorHandler.CodeFailedUser, errorHandler.ErrInvalidInput
 	}
-	if arg.RefreshToken == uuid.Nil {
-		return fmt.Errorf("invalid refresh token")
+
+	user, err = s.repo.UpdateUserRole(s.ctx, arg)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errorHandler.CodeFailedUser, errorHandler.ErrNoData
+		}
+		return nil, errorHandler.CodeFailedServer, err
 	}
 
-	if time.Now().UTC().After(arg.ExpiresAt) {
-		err = s.repo.DeleteRefreshToken(s.ctx, arg.UserID)
-		if err != nil {
-			return fmt.Errorf("failed to process expired refresh token, msg: %v", err)
+	return user, errorHandler.CodeSuccess, nil
+}
+
+// RevokeRole puts the user back to customer.
+func (s *authService) RevokeRole(userID int32) (user *auth.User, code int, err error) {
+	return s.GrantRole(auth.UpdateUserRoleParams{ID: userID, Role: auth.RoleCustomer})
+}
+
+// UnlockUser lifts the lockout of the user's email and forgets its failed log
+// ins, the lockouts of the ips they came from stay.
+func (s *authService) UnlockUser(userID int32) (code int, err error) {
+	user, err := s.repo.GetUserByID(s.ctx, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errorHandler.CodeFailedUser, errorHandler.ErrNoData
 		}
-		return fmt.Errorf("refresh token is expire")
+		return errorHandler.CodeFailedServer, err
+	}
+
+	err = s.cache.ClearFailedLogins(user.Email)
+	if err != nil {
+		return errorHandler.CodeFailedServer, err
 	}
 
-	return nil
+	return errorHandler.CodeSuccess, nil
 }
 
-// createNewToken return new access token, new refresh token and error
-func (s *authService) createNewToken(key *rsa.PrivateKey, payload *auth.JwtPayload) (newAccessToken, newRefreshToken string, err error) {
-	user := auth.User{
-		ID:       payload.UserID,
-		Username: payload.Name,
-		Email:    payload.Email,
+// VerifyEmail marks the user in the verification token as verified. Verifying
+// twice is not an error.
+func (s *authService) VerifyEmail(token string) (code int, err error) {
+	keys, err := s.repo.LoadKeys(s.ctx)
+	if err != nil {
+		return errorHandler.CodeFailedServer, fmt.Errorf("load key error: %w", err)
+	}
+
+	claims, err := readVerificationToken(token, keys)
+	if err != nil {
+		return errorHandler.CodeFailedUser, errorHandler.ErrInvalidVerificationToken
+	}
+
+	err = s.repo.UpdateUserVerification(s.ctx, auth.UpdateUserVerificationParams{ID: claims.UserID, Email: claims.Email})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errorHandler.CodeFailedUser, errorHandler.ErrInvalidVerificationToken
+		}
+		return errorHandler.CodeFailedServer, err
+	}
+
+	user, err := s.repo.GetUserByID(s.ctx, claims.UserID)
+	if err != nil {
+		return errorHandler.CodeFailedServer, err
+	}
+	_, err = s.grantAdminEmail(user)
+	if err != nil {
+		return errorHandler.CodeFailedServer, err
+	}
+
+	return errorHandler.CodeSuccess, nil
+}
+
+// grantAdminEmail makes user admin when the email is in the admin emails.
+// Only a verified email counts, or anyone signing up with it first would get
+// admin.
+func (s *authService) grantAdminEmail(user *auth.User) (*auth.User, error) {
+	if !user.IsVerified || !s.adminEmails[strings.ToLower(user.Email)] || user.Role == auth.RoleAdmin {
+		return user, nil
+	}
+
+	user, err := s.repo.UpdateUserRole(s.ctx, auth.UpdateUserRoleParams{ID: user.ID, Role: auth.RoleAdmin})
+	if err != nil {
+		return nil, fmt.Errorf("failed to grant admin role, err: %v", err)
+	}
+
+	return user, nil
+}
+
+// ResendVerification mails a new verification token to the user in payload.
+func (s *authService) ResendVerification(payload auth.JwtPayload) (code int, err error) {
+	user, err := s.repo.GetUserByEmail(s.ctx, payload.Email)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errorHandler.CodeFailedUser, errorHandler.ErrNoData
+		}
+		return errorHandler.CodeFailedServer, err
+	}
+	if user.IsVerified {
+		return errorHandler.CodeFailedUser, errorHandler.ErrAlreadyVerified
+	}
+
+	err = s.cache.ReserveVerificationResend(user.ID)
+	if err != nil {
+		if errors.Is(err, errorHandler.ErrTooManyRequests) {
+			return errorHandler.CodeFailedTooManyRequests, err
+		}
+		return errorHandler.CodeFailedServer, err
+	}
+
+	keys, err := s.repo.LoadKeys(s.ctx)
+	if err != nil {
+		return errorHandler.CodeFailedServer, fmt.Errorf("load key error: %w", err)
+	}
+
+	err = s.sendVerification(user, keys.Signing)
+	if err != nil {
+		return errorHandler.CodeFailedServer, fmt.Errorf("failed to send verification email, err: %v", err)
+	}
+
+	return errorHandler.CodeSuccess, nil
+}
+
+// ForgotPassword mails a password reset link when a user has the email. It
+// succeeds whether or not the email is registered, so it can't be used to
+// find out which emails are.
+func (s *authService) ForgotPassword(email string) (code int, err error) {
+	user, err := s.repo.GetUserByEmail(s.ctx, email)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errorHandler.CodeSuccess, nil
+		}
+		return errorHandler.CodeFailedServer, err
+	}
+
+	err = s.cache.ReservePasswordResetMail(user.ID)
+	if err != nil {
+		if errors.Is(err, errorHandler.ErrTooManyRequests) {
+			return errorHandler.CodeSuccess, nil
+		}
+		return errorHandler.CodeFailedServer, err
+	}
+
+	token, err := createResetToken()
+	if err != nil {
+		return errorHandler.CodeFailedServer, err
+	}
+
+	arg := auth.CreatePasswordResetTokenParams{
+		UserID:    user.ID,
+		TokenHash: hashResetToken(token),
+		ExpiresAt: time.Now().UTC().Add(s.conf.ResetTokenTTL),
+	}
+	err = s.repo.CreatePasswordResetToken(s.ctx, arg)
+	if err != nil {
+		return errorHandler.CodeFailedServer, err
+	}
+
+	link := s.conf.ResetPasswordURL + "?token=" + url.QueryEscape(token)
+	msg := mailer.Message{
+		From:    s.conf.MailFrom,
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body:    fmt.Sprintf("Hi %s,\r\n\r\nopen this link to choose a new password:\r\n%s\r\n\r\nThe link expires in %s and works once. If you didn't ask for it, ignore this email.\r\n", user.Username, link, s.conf.ResetTokenTTL),
+	}
+	err = s.sender.Send(s.ctx, msg)
+	if err != nil {
+		return errorHandler.CodeFailedServer, fmt.Errorf("failed to send password reset email, err: %v", err)
+	}
+
+	return errorHandler.CodeSuccess, nil
+}
+
+// ResetPassword sets a new password with a token from ForgotPassword. The
+// token works once, and the user is signed out everywhere.
+func (s *authService) ResetPassword(token, newPassword string) (code int, err error) {
+	hashedPassword, err := password.HashingPassword(newPassword)
+	if err != nil {
+		return errorHandler.CodeFailedServer, err
+	}
+
+	arg := auth.ResetPasswordParams{
+		TokenHash:      hashResetToken(token),
+		HashedPassword: hashedPassword,
+	}
+	user, err := s.repo.ResetPassword(s.ctx, arg)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errorHandler.CodeFailedUser, errorHandler.ErrInvalidResetToken
+		}
+		return errorHandler.CodeFailedServer, err
+	}
+
+	err = s.cache.BlockUserTokens(user.ID, s.userBlockTTL())
+	if err != nil {
+		return errorHandler.CodeFailedServer, err
+	}
+
+	return errorHandler.CodeSuccess, nil
+}
+
+// userBlockTTL is how long blocking a user's tokens has to last, until the
+// longest lived access token, from log in or from sign up, has expired.
+func (s *authService) userBlockTTL() time.Duration {
+	if s.conf.SignUpTokenTTL > s.conf.AccessTokenTTL {
+		return s.conf.SignUpTokenTTL
+	}
+
+	return s.conf.AccessTokenTTL
+}
+
+// ChangePassword sets a new password for the user in payload once the old
+// one is verified, and signs the user out everywhere.
+func (s *authService) ChangePassword(payload auth.JwtPayload, oldPassword, newPassword string) (code int, err error) {
+	user, err := s.repo.GetUserByEmail(s.ctx, payload.Email)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errorHandler.CodeFailedUser, errorHandler.ErrNoData
+		}
+		return errorHandler.CodeFailedServer, err
+	}
+
+	err = password.VerifyHashPassword(oldPassword, user.HashedPassword)
+	if err != nil {
+		return errorHandler.CodeFailedUnauthorized, errors.New("password is wrong")
+	}
+
+	hashedPassword, err := password.HashingPassword(newPassword)
+	if err != nil {
+		return errorHandler.CodeFailedServer, err
+	}
+
+	_, err = s.repo.ChangePassword(s.ctx, auth.UpdatePasswordParams{ID: user.ID, HashedPassword: hashedPassword})
+	if err != nil {
+		return errorHandler.CodeFailedServer, err
+	}
+
+	err = s.cache.BlockUserTokens(user.ID, s.userBlockTTL())
+	if err != nil {
+		return errorHandler.CodeFailedServer, err
+	}
+
+	return errorHandler.CodeSuccess, nil
+}
+
+// GetProfile returns the account data of the user with the addresses.
+func (s *authService) GetProfile(userID int32) (profile *auth.Profile, code int, err error) {
+	profile, err = s.repo.GetProfile(s.ctx, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errorHandler.CodeFailedUser, errorHandler.ErrNoData
+		}
+		return nil, errorHandler.CodeFailedServer, err
+	}
+
+	return profile, errorHandler.CodeSuccess, nil
+}
+
+// UpdateProfile changes the account data and returns a new access token, the
+// old one stops working once the username or email changed. A new email is
+// mailed a verification link.
+func (s *authService) UpdateProfile(payload auth.JwtPayload, arg auth.UpdateProfileParams) (profile *auth.Profile, accessToken string, code int, err error) {
+	user, err := s.repo.GetUserByID(s.ctx, arg.ID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, "", errorHandler.CodeFailedUser, errorHandler.ErrNoData
+		}
+		return nil, "", errorHandler.CodeFailedServer, err
+	}
+
+	emailChanged := arg.Email.Valid && arg.Email.String != user.Email
+	if emailChanged {
+		resGetUser, err := s.repo.GetUserByEmail(s.ctx, arg.Email.String)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return nil, "", errorHandler.CodeFailedServer, err
+		}
+		if err == nil && resGetUser.ID != user.ID {
+			return nil, "", errorHandler.CodeFailedDuplicated, fmt.Errorf("this email address is already in use")
+		}
+	}
+
+	profile, err = s.repo.UpdateProfile(s.ctx, arg)
+	if err != nil {
+		return nil, "", errorHandler.CodeFailedServer, err
+	}
+
+	keys, err := s.repo.LoadKeys(s.ctx)
+	if err != nil {
+		return nil, "", errorHandler.CodeFailedServer, fmt.Errorf("load key error: %w", err)
+	}
+
+	user.Username = profile.Username
+	user.Email = profile.Email
+	user.IsVerified = profile.IsVerified
+	if len(profile.Addresses) > 0 && profile.Addresses[0].IsDefault {
+		user.Address = profile.Addresses[0].String()
+	}
+
+	if emailChanged {
+		// the email is already saved, a mail that can't be sent is only
+		// logged and the user can ask for it again
+		if err := s.sendVerification(user, keys.Signing); err != nil {
+			log.Printf("failed to send verification email to user %d, err: %v", user.ID, err)
+		}
+	}
+
+	accessToken, err = middleware.CreateToken(*user, payload.SessionID, s.conf.AccessTokenTTL, keys.Signing)
+	if err != nil {
+		return nil, "", errorHandler.CodeFailedServer, errors.New("failed generate access token")
+	}
+
+	return profile, accessToken, errorHandler.CodeSuccess, nil
+}
+
+// AddAddress adds an address for arg.UserID, the first one is the default.
+func (s *authService) AddAddress(arg auth.AddressParams) (address *auth.Address, code int, err error) {
+	address, err = s.repo.CreateAddress(s.ctx, arg)
+	if err != nil {
+		return nil, errorHandler.CodeFailedServer, err
+	}
+
+	return address, errorHandler.CodeSuccessCreate, nil
+}
+
+// UpdateAddress replaces one of the user's addresses.
+func (s *authService) UpdateAddress(arg auth.AddressParams) (address *auth.Address, code int, err error) {
+	address, err = s.repo.UpdateAddress(s.ctx, arg)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errorHandler.CodeFailedUser, errorHandler.ErrNoData
+		}
+		return nil, errorHandler.CodeFailedServer, err
+	}
+
+	return address, errorHandler.CodeSuccess, nil
+}
+
+func (s *authService) DeleteAddress(arg auth.DeleteAddressParams) (code int, err error) {
+	err = s.repo.DeleteAddress(s.ctx, arg)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errorHandler.CodeFailedUser, errorHandler.ErrNoData
+		}
+		return errorHandler.CodeFailedServer, err
+	}
+
+	return errorHandler.CodeSuccess, nil
+}
+
+// ListSessions returns the sessions the user is still logged in with.
+func (s *authService) ListSessions(userID int32) (sessions []auth.RefreshTokenWhitelist, code int, err error) {
+	sessions, err = s.repo.ListSessions(s.ctx, userID)
+	if err != nil {
+		return nil, errorHandler.CodeFailedServer, err
+	}
+
+	return sessions, errorHandler.CodeSuccess, nil
+}
+
+// RevokeSession logs the user out of one session, its refresh token is
+// deleted and its access tokens are blocked.
+func (s *authService) RevokeSession(arg auth.DeleteSessionParams) (code int, err error) {
+	err = s.repo.DeleteSession(s.ctx, arg)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errorHandler.CodeFailedUser, errorHandler.ErrNoData
+		}
+		return errorHandler.CodeFailedServer, err
+	}
+
+	err = s.cache.BlockSession(arg.ID, s.conf.AccessTokenTTL)
+	if err != nil {
+		return errorHandler.CodeFailedServer, err
+	}
+
+	return errorHandler.CodeSuccess, nil
+}
+
+// CreateAPIKey creates a key for the user's server to call the API with. The
+// key is returned only here, what is saved is its hash and its prefix.
+func (s *authService) CreateAPIKey(arg auth.CreateAPIKeyRequest) (apiKey *auth.APIKey, key string, code int, err error) {
+	if len(arg.Scopes) == 0 {
+		return nil, "", errorHandler.CodeFailedUser, errorHandler.ErrInvalidAPIKeyScope
+	}
+	for _, scope := range arg.Scopes {
+		if !auth.ValidAPIKeyScope(scope) {
+			return nil, "", errorHandler.CodeFailedUser, errorHandler.ErrInvalidAPIKeyScope
+		}
+	}
+	if arg.ExpiresAt.Valid && !arg.ExpiresAt.Time.After(time.Now().UTC()) {
+		return nil, "", errorHandler.CodeFailedUser, errorHandler.ErrInvalidAPIKeyExpiry
+	}
+
+	key, err = createAPIKey()
+	if err != nil {
+		return nil, "", errorHandler.CodeFailedServer, err
+	}
+
+	apiKey, err = s.repo.CreateAPIKey(s.ctx, auth.CreateAPIKeyParams{
+		UserID:    arg.UserID,
+		Name:      arg.Name,
+		Prefix:    key[:apiKeyPrefixLength],
+		KeyHash:   auth.HashAPIKey(key),
+		Scopes:    arg.Scopes,
+		ExpiresAt: arg.ExpiresAt,
+	})
+	if err != nil {
+		return nil, "", errorHandler.CodeFailedServer, err
+	}
+
+	return apiKey, key, errorHandler.CodeSuccessCreate, nil
+}
+
+func (s *authService) ListAPIKeys(userID int32) (apiKeys []auth.APIKey, code int, err error) {
+	apiKeys, err = s.repo.ListAPIKeys(s.ctx, userID)
+	if err != nil {
+		return nil, errorHandler.CodeFailedServer, err
+	}
+
+	return apiKeys, errorHandler.CodeSuccess, nil
+}
+
+// RevokeAPIKey deletes the key, the next request with it is refused.
+func (s *authService) RevokeAPIKey(arg auth.DeleteAPIKeyParams) (code int, err error) {
+	err = s.repo.DeleteAPIKey(s.ctx, arg)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errorHandler.CodeFailedUser, errorHandler.ErrNoData
+		}
+		return errorHandler.CodeFailedServer, err
+	}
+
+	return errorHandler.CodeSuccess, nil
+}
+
+// OIDCAuthURL starts a log in with the provider, the user is sent to the
+// returned url. The state, nonce and PKCE verifier are kept until the
+// callback for oidcStateTTL.
+func (s *authService) OIDCAuthURL(provider string) (authURL string, code int, err error) {
+	client, ok := s.oidcClients[provider]
+	if !ok {
+		return "", errorHandler.CodeFailedUser, errorHandler.ErrUnknownOIDCProvider
+	}
+
+	arg := auth.OIDCState{Provider: provider}
+	state, err := oidc.RandomString()
+	if err != nil {
+		return "", errorHandler.CodeFailedServer, err
+	}
+	arg.Nonce, err = oidc.RandomString()
+	if err != nil {
+		return "", errorHandler.CodeFailedServer, err
+	}
+	arg.CodeVerifier, err = oidc.RandomString()
+	if err != nil {
+		return "", errorHandler.CodeFailedServer, err
+	}
+
+	authURL, err = client.AuthCodeURL(s.ctx, state, arg.Nonce, oidc.S256Challenge(arg.CodeVerifier))
+	if err != nil {
+		return "", errorHandler.CodeFailedServer, err
+	}
+
+	if err := s.cache.SaveOIDCState(state, arg, oidcStateTTL); err != nil {
+		return "", errorHandler.CodeFailedServer, err
+	}
+
+	return authURL, errorHandler.CodeSuccess, nil
+}
+
+// OIDCCallback finishes a log in with the provider. The identity logs in the
+// user it's linked to, an identity that isn't linked yet is linked to the
+// user with its email or signs a new user up, only when the provider
+// verified the email. Like LogIn a user with TOTP gets an MFA challenge
+// token instead of the tokens.
+func (s *authService) OIDCCallback(input auth.OIDCCallbackRequest) (user *auth.User, accessToken, refreshToken, mfaToken string, code int, err error) {
+	client, ok := s.oidcClients[input.Provider]
+	if !ok {
+		return nil, "", "", "", errorHandler.CodeFailedUser, errorHandler.ErrUnknownOIDCProvider
+	}
+
+	state, err := s.cache.TakeOIDCState(input.State)
+	if err != nil {
+		if errors.Is(err, errorHandler.ErrInvalidOIDCState) {
+			return nil, "", "", "", errorHandler.CodeFailedUnauthorized, err
+		}
+		return nil, "", "", "", errorHandler.CodeFailedServer, err
+	}
+	if state.Provider != input.Provider {
+		return nil, "", "", "", errorHandler.CodeFailedUnauthorized, errorHandler.ErrInvalidOIDCState
+	}
+
+	idToken, err := client.Exchange(s.ctx, input.Code, state.CodeVerifier)
+	if err != nil {
+		log.Printf("failed to log in with %s, err: %v", input.Provider, err)
+		return nil, "", "", "", errorHandler.CodeFailedUnauthorized, errorHandler.ErrOIDCLogin
+	}
+	claims, err := client.VerifyIDToken(s.ctx, idToken, state.Nonce)
+	if err != nil {
+		log.Printf("failed to log in with %s, err: %v", input.Provider, err)
+		return nil, "", "", "", errorHandler.CodeFailedUnauthorized, errorHandler.ErrOIDCLogin
+	}
+
+	user, code, err = s.identityUser(input.Provider, claims)
+	if err != nil {
+		return nil, "", "", "", code, err
+	}
+
+	totpEnabled, err := s.totpEnabled(user.ID)
+	if err != nil {
+		return nil, "", "", "", errorHandler.CodeFailedServer, err
+	}
+	if totpEnabled {
+		mfaToken, err = s.createMFAChallengeToken(user.ID)
+		if err != nil {
+			return nil, "", "", "", errorHandler.CodeFailedServer, err
+		}
+		return nil, "", "", mfaToken, errorHandler.CodeSuccess, nil
+	}
+
+	user, accessToken, refreshToken, err = s.startSession(user, input.DeviceName, input.UserAgent, input.IPAddress, false)
+	if err != nil {
+		return nil, "", "", "", errorHandler.CodeFailedServer, err
+	}
+
+	return user, accessToken, refreshToken, "", errorHandler.CodeSuccess, nil
+}
+
+// identityUser returns the user of the provider's identity, linking or
+// signing it up when it's new. An email is only trusted when the provider
+// verified it, and an unverified user isn't linked to, whoever signed it up
+// may not own the email and would keep the password.
+func (s *authService) identityUser(provider string, claims *oidc.Claims) (*auth.User, int, error) {
+	identity, err := s.repo.GetIdentity(s.ctx, provider, claims.Subject)
+	if err == nil {
+		user, err := s.repo.GetUserByID(s.ctx, identity.UserID)
+		if err != nil {
+			return nil, errorHandler.CodeFailedServer, err
+		}
+		return user, errorHandler.CodeSuccess, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, errorHandler.CodeFailedServer, err
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, errorHandler.CodeFailedForbidden, errorHandler.ErrOIDCEmailNotVerified
+	}
+
+	user, err := s.repo.GetUserByEmail(s.ctx, claims.Email)
+	if err == nil {
+		if !user.IsVerified {
+			return nil, errorHandler.CodeFailedDuplicated, errorHandler.ErrOIDCEmailInUse
+		}
+
+		_, err = s.repo.CreateIdentity(s.ctx, auth.CreateIdentityParams{
+			UserID:   user.ID,
+			Provider: provider,
+			Subject:  claims.Subject,
+			Email:    claims.Email,
+		})
+		if err != nil {
+			return nil, errorHandler.CodeFailedServer, err
+		}
+		return user, errorHandler.CodeSuccess, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, errorHandler.CodeFailedServer, err
+	}
+
+	// the user has no password to log in with, ForgotPassword sets one
+	secret, err := oidc.RandomString()
+	if err != nil {
+		return nil, errorHandler.CodeFailedServer, err
+	}
+	arg := auth.CreateIdentityUserParams{
+		User: auth.CreateUserParams{
+			Username: identityUsername(claims),
+			Email:    claims.Email,
+		},
+		Provider: provider,
+		Subject:  claims.Subject,
+	}
+	if s.adminEmails[strings.ToLower(claims.Email)] {
+		arg.User.Role = auth.RoleAdmin
+	}
+	arg.User.HashedPassword, err = password.HashingPassword(secret)
+	if err != nil {
+		return nil, errorHandler.CodeFailedServer, err
+	}
+
+	user, err = s.repo.CreateIdentityUser(s.ctx, arg)
+	if err != nil {
+		return nil, errorHandler.CodeFailedServer, err
+	}
+
+	return user, errorHandler.CodeSuccess, nil
+}
+
+// identityUsername is the username of a user who signs up with a provider,
+// the start of the email when the provider has no name.
+func identityUsername(claims *oidc.Claims) string {
+	for _, name := range []string{claims.Name, claims.PreferredUsername} {
+		if name = strings.TrimSpace(name); name != "" {
+			return name
+		}
+	}
+	name, _, _ := strings.Cut(claims.Email, "@")
+
+	return name
+}
+
+// GetJWKS returns the public keys tokens can be verified with, a key that
+// activates later is in it too.
+func (s *authService) GetJWKS() (jwks auth.JWKS, code int, err error) {
+	keys, err := s.repo.LoadKeys(s.ctx)
+	if err != nil {
+		return auth.JWKS{}, errorHandler.CodeFailedServer, fmt.Errorf("load key error: %w", err)
+	}
+
+	return keys.JWKS(), errorHandler.CodeSuccess, nil
+}
+
+// EnrollTOTP starts setting up TOTP for the user, the secret and the URI go
+// into the authenticator app and TOTP is on once ConfirmTOTP gets a code of
+// it. Enrolling again before confirming starts over with a new secret.
+func (s *authService) EnrollTOTP(payload auth.JwtPayload) (enrollment *auth.TOTPEnrollment, code int, err error) {
+	enabled, err := s.totpEnabled(payload.UserID)
+	if err != nil {
+		return nil, errorHandler.CodeFailedServer, err
+	}
+	if enabled {
+		return nil, errorHandler.CodeFailedDuplicated, errorHandler.ErrTOTPAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, errorHandler.CodeFailedServer, err
+	}
+
+	_, err = s.repo.UpsertTOTP(s.ctx, payload.UserID, secret)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errorHandler.CodeFailedDuplicated, errorHandler.ErrTOTPAlreadyEnabled
+		}
+		return nil, errorHandler.CodeFailedServer, err
+	}
+
+	enrollment = &auth.TOTPEnrollment{
+		Secret: secret,
+		URI:    totp.URI(totpIssuer, payload.Email, secret),
+	}
+
+	return enrollment, errorHandler.CodeSuccess, nil
+}
+
+// ConfirmTOTP turns TOTP on with a code from the authenticator app and
+// returns the recovery codes. They are only shown here, a recovery code logs
+// in once when the app is lost.
+func (s *authService) ConfirmTOTP(payload auth.JwtPayload, totpCode string) (recoveryCodes []string, code int, err error) {
+	res, err := s.repo.GetTOTP(s.ctx, payload.UserID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errorHandler.CodeFailedUser, errorHandler.ErrTOTPNotEnrolled
+		}
+		return nil, errorHandler.CodeFailedServer, err
+	}
+	if res.ConfirmedAt.Valid {
+		return nil, errorHandler.CodeFailedDuplicated, errorHandler.ErrTOTPAlreadyEnabled
+	}
+
+	step, ok := totp.Validate(res.Secret, totpCode, time.Now())
+	if !ok {
+		return nil, errorHandler.CodeFailedUser, errorHandler.ErrInvalidTOTPCode
+	}
+
+	recoveryCodes, hashes, err := createRecoveryCodes()
+	if err != nil {
+		return nil, errorHandler.CodeFailedServer, err
+	}
+
+	err = s.repo.ConfirmTOTP(s.ctx, auth.ConfirmTOTPParams{
+		UserID:             payload.UserID,
+		Step:               step,
+		RecoveryCodeHashes: hashes,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errorHandler.CodeFailedUser, errorHandler.ErrInvalidTOTPCode
+		}
+		return nil, errorHandler.CodeFailedServer, err
+	}
+
+	return recoveryCodes, errorHandler.CodeSuccess, nil
+}
+
+// DisableTOTP turns TOTP off with a TOTP code or a recovery code, wrong codes
+// are throttled like wrong passwords.
+func (s *authService) DisableTOTP(payload auth.JwtPayload, totpCode string) (code int, err error) {
+	delay, err := s.cache.LoginDelay(payload.Email, "")
+	if err != nil {
+		return errorHandler.CodeFailedServer, err
+	}
+	if delay > 0 {
+		return errorHandler.CodeFailedTooManyRequests, errorHandler.ErrTooManyLoginAttempts
+	}
+
+	ok, err := s.useMFACode(payload.UserID, totpCode, true)
+	if err != nil {
+		if errors.Is(err, errorHandler.ErrTOTPNotEnrolled) {
+			return errorHandler.CodeFailedUser, err
+		}
+		return errorHandler.CodeFailedServer, err
+	}
+	if !ok {
+		if err := s.cache.RecordFailedLogin(payload.Email, ""); err != nil {
+			return errorHandler.CodeFailedServer, err
+		}
+		return errorHandler.CodeFailedForbidden, errorHandler.ErrInvalidTOTPCode
+	}
+
+	err = s.repo.DeleteTOTP(s.ctx, payload.UserID)
+	if err != nil {
+		return errorHandler.CodeFailedServer, err
+	}
+
+	return errorHandler.CodeSuccess, nil
+}
+
+// CheckStepUp asks a user with TOTP for a fresh code before a withdrawal or
+// a transfer above the step up threshold. A recovery code isn't taken here,
+// and wrong codes are throttled like wrong passwords.
+func (s *authService) CheckStepUp(payload auth.JwtPayload, amount int32, totpCode string) (code int, err error) {
+	if s.conf.StepUpThreshold <= 0 || amount <= s.conf.StepUpThreshold {
+		return errorHandler.CodeSuccess, nil
+	}
+
+	enabled, err := s.totpEnabled(payload.UserID)
+	if err != nil {
+		return errorHandler.CodeFailedServer, err
+	}
+	if !enabled {
+		return errorHandler.CodeSuccess, nil
+	}
+
+	delay, err := s.cache.LoginDelay(payload.Email, "")
+	if err != nil {
+		return errorHandler.CodeFailedServer, err
+	}
+	if delay > 0 {
+		return errorHandler.CodeFailedTooManyRequests, errorHandler.ErrTooManyLoginAttempts
+	}
+
+	if totpCode == "" {
+		return errorHandler.CodeFailedForbidden, errorHandler.ErrTOTPRequired
+	}
+
+	ok, err := s.useMFACode(payload.UserID, totpCode, false)
+	if err != nil {
+		return errorHandler.CodeFailedServer, err
+	}
+	if !ok {
+		if err := s.cache.RecordFailedLogin(payload.Email, ""); err != nil {
+			return errorHandler.CodeFailedServer, err
+		}
+		return errorHandler.CodeFailedForbidden, errorHandler.ErrInvalidTOTPCode
+	}
+
+	return errorHandler.CodeSuccess, nil
+}
+
+// totpEnabled tells if the user confirmed TOTP.
+func (s *authService) totpEnabled(userID int32) (bool, error) {
+	res, err := s.repo.GetTOTP(s.ctx, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return res.ConfirmedAt.Valid, nil
+}
+
+// useMFACode takes a TOTP code of the user, or one of the recovery codes when
+// allowRecovery is set. A code is taken once, it returns false when the code
+// is wrong or already used and ErrTOTPNotEnrolled when TOTP is off.
+func (s *authService) useMFACode(userID int32, code string, allowRecovery bool) (bool, error) {
+	res, err := s.repo.GetTOTP(s.ctx, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, errorHandler.ErrTOTPNotEnrolled
+		}
+		return false, err
+	}
+	if !res.ConfirmedAt.Valid {
+		return false, errorHandler.ErrTOTPNotEnrolled
+	}
+
+	if step, ok := totp.Validate(res.Secret, code, time.Now()); ok {
+		err = s.repo.UseTOTPStep(s.ctx, userID, step)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return false, nil
+			}
+			return false, err
+		}
+		return true, nil
+	}
+
+	if !allowRecovery {
+		return false, nil
+	}
+
+	err = s.repo.UseRecoveryCode(s.ctx, userID, hashRecoveryCode(code))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// defaultAddress is the user's default address in one line, empty when the
+// user has none.
+func (s *authService) defaultAddress(userID int32) (string, error) {
+	address, err := s.repo.GetDefaultAddress(s.ctx, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get default address, err: %v", err)
+	}
+
+	return address.String(), nil
+}
+
+// createResetToken returns a random token for the reset link, only its hash
+// is saved.
+func createResetToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate reset token, err: %v", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// createAPIKey returns a new API key, the prefix and random hex.
+func createAPIKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate api key, err: %v", err)
+	}
+
+	return auth.APIKeyPrefix + hex.EncodeToString(b), nil
+}
+
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// createRecoveryCodes returns new recovery codes and their hashes, only the
+// hashes are saved.
+func createRecoveryCodes() (codes, hashes []string, err error) {
+	for range recoveryCodeCount {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, fmt.Errorf("failed to generate recovery code, err: %v", err)
+		}
+		for i := range b {
+			b[i] = recoveryCodeAlphabet[int(b[i])%len(recoveryCodeAlphabet)]
+		}
+
+		code := string(b[:5]) + "-" + string(b[5:])
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode hashes a recovery code the way it was typed, the case, the
+// dash and spaces don't matter.
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *authService) createMFAChallengeToken(userID int32) (string, error) {
+	keys, err := s.repo.LoadKeys(s.ctx)
+	if err != nil {
+		return "", fmt.Errorf("load key error: %w", err)
+	}
+
+	now := time.Now().UTC()
+	claims := auth.MFAChallengeClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{auth.MFAChallengeAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(mfaChallengeTTL)),
+		},
+		UserID: userID,
+	}
+
+	token, err := keys.Signing.Signer.Sign(claims, keys.Signing.Kid)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign mfa challenge token, err: %v", err)
+	}
+
+	return token, nil
+}
+
+func readMFAChallengeToken(token string, keys *auth.KeySet) (*auth.MFAChallengeClaims, error) {
+	var claims auth.MFAChallengeClaims
+	_, err := jwt.ParseWithClaims(token, &claims, middleware.KeyFunc(keys),
+		jwt.WithValidMethods(signer.Algorithms),
+		jwt.WithAudience(auth.MFAChallengeAudience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse mfa challenge token, err: %v", err)
+	}
+
+	return &claims, nil
+}
+
+func (s *authService) sendVerification(user *auth.User, key *auth.SigningKey) error {
+	token, err := createVerificationToken(user, s.conf.VerificationTokenTTL, key)
+	if err != nil {
+		return err
+	}
+
+	link := s.conf.VerifyURL + "?token=" + url.QueryEscape(token)
+	msg := mailer.Message{
+		From:    s.conf.MailFrom,
+		To:      user.Email,
+		Subject: "Verify your email",
+		Body:    fmt.Sprintf("Hi %s,\r\n\r\nopen this link to verify your email:\r\n%s\r\n\r\nThe link expires in %s.\r\n", user.Username, link, s.conf.VerificationTokenTTL),
+	}
+
+	return s.sender.Send(s.ctx, msg)
+}
+
+func createVerificationToken(user *auth.User, ttl time.Duration, key *auth.SigningKey) (string, error) {
+	now := time.Now().UTC()
+	claims := auth.VerificationClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{auth.VerificationAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+		UserID: user.ID,
+		Email:  user.Email,
+	}
+
+	token, err := key.Signer.Sign(claims, key.Kid)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign verification token, err: %v", err)
+	}
+
+	return token, nil
+}
+
+func readVerificationToken(token string, keys *auth.KeySet) (*auth.VerificationClaims, error) {
+	var claims auth.VerificationClaims
+	_, err := jwt.ParseWithClaims(token, &claims, middleware.KeyFunc(keys),
+		jwt.WithValidMethods(signer.Algorithms),
+		jwt.WithAudience(auth.VerificationAudience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse verification token, err: %v", err)
+	}
+
+	return &claims, nil
+}
+
+// readRefreshedToken reads the access token sent with a refresh, keys has to
+// hold the retired keys. Only the expiry isn't checked, the token may be
+// expired by now.
+func readRefreshedToken(accessToken string, keys *auth.KeySet) (*auth.JwtPayload, error) {
+	var payload auth.JwtPayload
+	_, err := jwt.ParseWithClaims(accessToken, &payload, middleware.KeyFunc(keys),
+		jwt.WithValidMethods(signer.Algorithms),
+		jwt.WithoutClaimsValidation(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token, msg: %v", err)
+	}
+
+	return &payload, nil
+}
+
+// ValidateRefreshToken return error.
+//
+// ValidateRefreshToken check the refresh token from database, what to check:
+//   - check error when read from database.
+//   - check if the refresh token is nil
+//   - check if refresh token is expired
+//
+// When the refresh token is expired:
+//
+//	delete the session from database
+func (s *authService) validateRefreshToken(arg *auth.RefreshTokenWhitelist, errIn error) (err error) {
+	if errIn != nil {
+		return fmt.Errorf("invalid refresh token, msg: %v", errIn)
+	}
+	if arg.RefreshToken == uuid.Nil {
+		return fmt.Errorf("invalid refresh token")
+	}
+
+	// the max lifetime is checked first, refresh tokens never outlive it so
+	// the user is told to log in again rather than that the token expired
+	now := time.Now().UTC()
+	switch {
+	case now.After(arg.CreatedAt.Add(s.conf.SessionMaxLifetime)):
+		err = errorHandler.ErrSessionExpired
+	case now.After(arg.ExpiresAt):
+		err = fmt.Errorf("refresh token is expire")
+	default:
+		return nil
+	}
+
+	errDelete := s.repo.DeleteSession(s.ctx, auth.DeleteSessionParams{ID: arg.ID, UserID: arg.UserID})
+	if errDelete != nil {
+		return fmt.Errorf("failed to process expired refresh token, msg: %v", errDelete)
+	}
+
+	return err
+}
+
+func (s *authService) refreshTokenTTL(rememberMe bool) time.Duration {
+	if rememberMe {
+		return s.conf.RememberMeRefreshTokenTTL
+	}
+
+	return s.conf.RefreshTokenTTL
+}
+
+// sessionExpiresAt is when a refresh token of session issued now expires,
+// never after the session's max lifetime.
+func (s *authService) sessionExpiresAt(session *auth.RefreshTokenWhitelist) time.Time {
+	expiresAt := time.Now().UTC().Add(s.refreshTokenTTL(session.RememberMe))
+	maxExpiresAt := session.CreatedAt.Add(s.conf.SessionMaxLifetime)
+	if expiresAt.After(maxExpiresAt) {
+		return maxExpiresAt
+	}
+
+	return expiresAt
+}
+
+// revokeReusedRefreshToken checks if refreshToken was already rotated. An old
+// token coming back means someone else holds a copy of it, so the session it
+// belongs to is revoked: the session is deleted, the access tokens issued for
+// it are blocked and the incident goes to the audit log. payload is the access
+// token sent with the refresh, it's blocked too when it's of that session.
+//
+// It returns nil when the token was never rotated, then the token is simply
+// wrong.
+func (s *authService) revokeReusedRefreshToken(payload auth.JwtPayload, refreshToken uuid.UUID) (code int, err error) {
+	userID := payload.UserID
+	rotation, err := s.repo.GetRefreshTokenRotation(s.ctx, userID, refreshToken)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errorHandler.CodeSuccess, nil
+		}
+		return errorHandler.CodeFailedServer, err
+	}
+
+	err = s.repo.DeleteSession(s.ctx, auth.DeleteSessionParams{ID: rotation.SessionID, UserID: userID})
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return errorHandler.CodeFailedServer, err
+	}
+
+	err = s.cache.BlockSession(rotation.SessionID, s.conf.AccessTokenTTL)
+	if err != nil {
+		return errorHandler.CodeFailedServer, fmt.Errorf("failed to block session, msg: %v", err)
+	}
+	if payload.SessionID == rotation.SessionID {
+		err = s.cache.CachingBlockedToken(payload)
+		if err != nil {
+			return errorHandler.CodeFailedServer, fmt.Errorf("failed to caching access token, msg: %v", err)
+		}
+	}
+
+	detail := fmt.Sprintf("refresh token %s was rotated at %s and used again, session %d is revoked",
+		refreshToken, rotation.RotatedAt.Format(time.RFC3339), rotation.SessionID)
+	_, err = s.repo.CreateAuditLog(s.ctx, auth.CreateAuditLogParams{
+		UserID:    userID,
+		SessionID: pgtype.Int4{Int32: rotation.SessionID, Valid: true},
+		Event:     auth.AuditRefreshTokenReused,
+		Detail:    detail,
+	})
+	if err != nil {
+		return errorHandler.CodeFailedServer, err
+	}
+	log.Printf("%s: user %d, %s", auth.AuditRefreshTokenReused, userID, detail)
+
+	return errorHandler.CodeFailedUnauthorized, errorHandler.ErrRefreshTokenReused
+}
+
+// createNewToken return new access token, new refresh token and error
+func (s *authService) createNewToken(keys *auth.KeySet, session *auth.RefreshTokenWhitelist) (newAccessToken, newRefreshToken string, err error) {
+	// the user is read again, the profile or the role can have changed since
+	// the old token
+	user, err := s.repo.GetUserByID(s.ctx, session.UserID)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get user, err: %v", err)
+	}
+	user.Address, err = s.defaultAddress(user.ID)
+	if err != nil {
+		return
 	}
 
-	newAccessToken, err = middleware.CreateToken(user, 60, key)
+	newAccessToken, err = middleware.CreateToken(*user, session.ID, s.conf.AccessTokenTTL, keys.Signing)
 	if err != nil {
 		return
 	}
@@ -217,7 +1506,13 @@ func (s *authService) createNewToken(key *rsa.PrivateKey, payload *auth.JwtPaylo
 	if err != nil {
 		return
 	}
-	err = s.repo.UpdateRefreshToken(s.ctx, payload.UserID, newRefreshTokenUUID)
+	err = s.repo.UpdateRefreshToken(s.ctx, auth.UpdateRefreshTokenParams{
+		ID:              session.ID,
+		UserID:          session.UserID,
+		RefreshToken:    newRefreshTokenUUID,
+		OldRefreshToken: session.RefreshToken,
+		ExpiresAt:       s.sessionExpiresAt(session),
+	})
 	if err != nil {
 		return
 	}
@@ -2,27 +2,37 @@ package service
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"log"
+	"net/url"
 	"os"
+	"regexp"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	cfg "github.com/dwiw96/GoCommerceAPI/config"
 	auth "github.com/dwiw96/GoCommerceAPI/internal/features/auth"
 	cache "github.com/dwiw96/GoCommerceAPI/internal/features/auth/cache"
 	repo "github.com/dwiw96/GoCommerceAPI/internal/features/auth/repository"
 	rd "github.com/dwiw96/GoCommerceAPI/pkg/driver/redis"
+	mailer "github.com/dwiw96/GoCommerceAPI/pkg/mailer"
 	middleware "github.com/dwiw96/GoCommerceAPI/pkg/middleware"
+	oidc "github.com/dwiw96/GoCommerceAPI/pkg/oidc"
+	oidctest "github.com/dwiw96/GoCommerceAPI/pkg/oidc/oidctest"
 	conv "github.com/dwiw96/GoCommerceAPI/pkg/utils/converter"
 	generator "github.com/dwiw96/GoCommerceAPI/pkg/utils/generator"
 	password "github.com/dwiw96/GoCommerceAPI/pkg/utils/password"
 	errs "github.com/dwiw96/GoCommerceAPI/pkg/utils/responses"
+	signer "github.com/dwiw96/GoCommerceAPI/pkg/utils/signer"
+	totp "github.com/dwiw96/GoCommerceAPI/pkg/utils/totp"
 	testUtils "github.com/dwiw96/GoCommerceAPI/testutils"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -32,8 +42,49 @@ var (
 	pool        *pgxpool.Pool
 	ctx         context.Context
 	repoTest    auth.IRepository
+	client      *redis.Client
+	// oidcProvider is the provider users log in with as "stub"
+	oidcProvider *oidctest.Provider
 )
 
+const adminEmail = "admin@gocommerce.com"
+
+// outbox keeps the mails instead of sending them
+type outbox struct {
+	mutex sync.Mutex
+	mails []mailer.Message
+}
+
+func (o *outbox) Send(ctx context.Context, msg mailer.Message) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.mails = append(o.mails, msg)
+	return nil
+}
+
+var mailTokenRegexp = regexp.MustCompile(`token=(\S+)`)
+
+// lastMailToken is the token in the last mail sent to email, verification
+// and reset mails both carry one.
+func (o *outbox) lastMailToken(t *testing.T, email string) string {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	for i := len(o.mails) - 1; i >= 0; i-- {
+		if o.mails[i].To != email {
+			continue
+		}
+		match := mailTokenRegexp.FindStringSubmatch(o.mails[i].Body)
+		require.Len(t, match, 2)
+		token, err := url.QueryUnescape(match[1])
+		require.NoError(t, err)
+		return token
+	}
+	t.Fatalf("no mail sent to %s", email)
+	return ""
+}
+
+var mailerTest = &outbox{}
+
 func TestMain(m *testing.M) {
 	pool = testUtils.GetPool()
 	defer pool.Close()
@@ -42,7 +93,8 @@ func TestMain(m *testing.M) {
 
 	schemaCleanup := testUtils.SetupDB("test_service_auth")
 
-	password.JwtInit(pool, ctx)
+	testUtils.SetKeyEncryptionKey()
+	password.JwtInit(pool, ctx, signer.RS256)
 
 	os.Setenv("REDIS_HOST", "localhost:6379")
 	os.Setenv("REDIS_PASSWORD", "")
@@ -59,15 +111,38 @@ func TestMain(m *testing.M) {
 		REDIS_DB:       redis_db,
 	}
 
-	client := rd.ConnectToRedis(env)
+	client = rd.ConnectToRedis(env)
 	defer client.Close()
 
+	oidcProvider, err = oidctest.NewProvider("gocommerce", "secret")
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	repoTest = repo.NewAuthRepository(pool, pool)
 	cacheTest := cache.NewAuthCache(client, ctx)
-	serviceTest = NewAuthService(repoTest, cacheTest, ctx)
+	conf := auth.ServiceConfig{
+		AdminEmails:               []string{adminEmail},
+		VerifyURL:                 "http://localhost:8080/api/v1/auth/verify",
+		VerificationTokenTTL:      time.Hour,
+		MailFrom:                  "no-reply@gocommerce.com",
+		ResetPasswordURL:          "http://localhost:3000/reset-password",
+		ResetTokenTTL:             time.Hour,
+		StepUpThreshold:           1000,
+		AccessTokenTTL:            time.Hour,
+		SignUpTokenTTL:            10 * time.Minute,
+		RefreshTokenTTL:           24 * time.Hour,
+		RememberMeRefreshTokenTTL: 720 * time.Hour,
+		SessionMaxLifetime:        2160 * time.Hour,
+		OIDCProviders: []oidc.Config{
+			oidcProvider.Config("stub", "http://localhost:8080/api/v1/auth/oidc/stub/callback"),
+		},
+	}
+	serviceTest = NewAuthService(repoTest, cacheTest, ctx, mailerTest, conf)
 
 	exitTest := m.Run()
 
+	oidcProvider.Close()
 	schemaCleanup()
 
 	os.Exit(exitTest)
@@ -98,7 +173,7 @@ func createUser(t *testing.T) (user *auth.User, token string, signupReq auth.Sig
 func insertRefreshTokenTest(t *testing.T, userID int32) uuid.UUID {
 	refreshToken, err := uuid.NewRandom()
 	require.NoError(t, err)
-	err = repoTest.InsertRefreshToken(ctx, userID, refreshToken)
+	err = repoTest.InsertRefreshToken(ctx, userID, refreshToken, time.Now().UTC().Add(time.Hour))
 	require.NoError(t, err)
 
 	return refreshToken
@@ -215,7 +290,7 @@ func TestLogIn(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			res, accessToken, refreshToken, code, err := serviceTest.LogIn(test.input)
+			res, accessToken, refreshToken, _, code, err := serviceTest.LogIn(test.input)
 			if !test.err {
 				require.NoError(t, err)
 				assert.NotEmpty(t, accessToken)
@@ -236,15 +311,76 @@ func TestLogIn(t *testing.T) {
 				assert.Nil(t, res)
 			}
 
-			if test.code == 2 {
-				assert.Equal(t, err, fmt.Errorf("no user found with this email %s", test.input.Email))
-			} else if test.code == 3 {
-				assert.Equal(t, err, errors.New("password is wrong"))
+			// a wrong email and a wrong password can't be told apart
+			if test.code == 2 || test.code == 3 {
+				assert.Equal(t, errs.ErrInvalidCredentials, err)
 			}
 		})
 	}
 }
 
+func TestLogInLockout(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user, _, signUpReq := createUser(t)
+	ip := fmt.Sprintf("10.%d.%d.1", generator.RandomInt(0, 255), generator.RandomInt(0, 255))
+
+	// the first failed log ins are not held back
+	for i := 0; i < 3; i++ {
+		_, _, _, _, code, err := serviceTest.LogIn(auth.LoginRequest{Email: user.Email, Password: "wrong" + signUpReq.Password, IPAddress: ip})
+		require.Error(t, err)
+		assert.Equal(t, errs.CodeFailedUnauthorized, code)
+		assert.Equal(t, errs.ErrInvalidCredentials, err)
+	}
+
+	_, _, _, _, code, err := serviceTest.LogIn(auth.LoginRequest{Email: user.Email, Password: "wrong" + signUpReq.Password, IPAddress: ip})
+	require.Error(t, err)
+	assert.Equal(t, errs.CodeFailedUnauthorized, code)
+
+	// the right password waits out the delay too
+	_, _, _, _, code, err = serviceTest.LogIn(auth.LoginRequest{Email: user.Email, Password: signUpReq.Password})
+	require.Error(t, err)
+	assert.Equal(t, errs.CodeFailedTooManyRequests, code)
+	assert.Equal(t, errs.ErrTooManyLoginAttempts, err)
+
+	t.Run("ip_is_held_back_for_other_emails", func(t *testing.T) {
+		_, _, _, _, code, err := serviceTest.LogIn(auth.LoginRequest{Email: "other" + user.Email, Password: signUpReq.Password, IPAddress: ip})
+		require.Error(t, err)
+		assert.Equal(t, errs.CodeFailedTooManyRequests, code)
+	})
+
+	t.Run("email_without_user_is_held_back_the_same", func(t *testing.T) {
+		email := "missing" + user.Email
+		for i := 0; i < 4; i++ {
+			_, _, _, _, code, err := serviceTest.LogIn(auth.LoginRequest{Email: email, Password: signUpReq.Password})
+			require.Error(t, err)
+			assert.Equal(t, errs.CodeFailedUnauthorized, code)
+			assert.Equal(t, errs.ErrInvalidCredentials, err)
+		}
+
+		_, _, _, _, code, err := serviceTest.LogIn(auth.LoginRequest{Email: email, Password: signUpReq.Password})
+		require.Error(t, err)
+		assert.Equal(t, errs.CodeFailedTooManyRequests, code)
+	})
+
+	t.Run("unlock", func(t *testing.T) {
+		code, err := serviceTest.UnlockUser(user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, errs.CodeSuccess, code)
+
+		_, accessToken, _, _, code, err := serviceTest.LogIn(auth.LoginRequest{Email: user.Email, Password: signUpReq.Password})
+		require.NoError(t, err)
+		assert.Equal(t, errs.CodeSuccess, code)
+		assert.NotEmpty(t, accessToken)
+
+		code, err = serviceTest.UnlockUser(user.ID + 1000)
+		require.Error(t, err)
+		assert.Equal(t, errs.CodeFailedUser, code)
+		assert.Equal(t, errs.ErrNoData, err)
+	})
+}
+
 func TestLogOut(t *testing.T) {
 	err := testUtils.DeleteSchemaTestData(pool)
 	require.NoError(t, err)
@@ -256,17 +392,17 @@ func TestLogOut(t *testing.T) {
 		Password: signUpReq.Password,
 	}
 
-	_, accessToken, refreshToken, code, err := serviceTest.LogIn(argLogin)
+	_, accessToken, refreshToken, _, code, err := serviceTest.LogIn(argLogin)
 	require.NoError(t, err)
 	assert.NotEmpty(t, accessToken)
 	assert.NotEmpty(t, refreshToken)
 	assert.Equal(t, 200, code)
 
-	key, err := repoTest.LoadKey(ctx)
+	keys, err := repoTest.LoadKeys(ctx)
 	require.NoError(t, err)
-	require.NotNil(t, key)
+	require.NotNil(t, keys)
 
-	payload, err := middleware.ReadToken(accessToken, key)
+	payload, err := middleware.ReadToken(accessToken, keys)
 	require.NoError(t, err)
 
 	err = serviceTest.LogOut(*payload)
@@ -358,13 +494,22 @@ func TestRefreshToken(t *testing.T) {
 		Password: signUpReq.Password,
 	}
 
-	_, accessToken, refreshToken, code, err := serviceTest.LogIn(argLogin)
+	_, accessToken, refreshToken, _, code, err := serviceTest.LogIn(argLogin)
 	require.NoError(t, err)
 	assert.NotEmpty(t, accessToken)
 	assert.NotEmpty(t, refreshToken)
 	assert.Equal(t, 200, code)
 	accessTokenNoBearer := strings.Split(accessToken, " ")
 
+	_, otherAccessToken, _, _, code, err := serviceTest.LogIn(argLogin)
+	require.NoError(t, err)
+	assert.Equal(t, 200, code)
+
+	// the claims of the session with the signature of the other token
+	parts := strings.Split(accessTokenNoBearer[1], ".")
+	otherParts := strings.Split(otherAccessToken, ".")
+	tamperedAccessToken := parts[0] + "." + parts[1] + "." + otherParts[2]
+
 	testCases := []struct {
 		desc         string
 		refreshToken string
@@ -372,15 +517,25 @@ func TestRefreshToken(t *testing.T) {
 		err          bool
 	}{
 		{
-			desc:         "success",
+			desc:         "failed_invalid_access_token",
 			refreshToken: refreshToken,
-			accessToken:  accessTokenNoBearer[1],
-			err:          false,
+			accessToken:  "a",
+			err:          true,
 		}, {
-			desc:         "failed_invalid_access_token",
+			desc:         "failed_tampered_signature",
 			refreshToken: refreshToken,
-			accessToken:  accessTokenNoBearer[1] + "a",
+			accessToken:  tamperedAccessToken,
 			err:          true,
+		}, {
+			desc:         "failed_access_token_of_other_session",
+			refreshToken: refreshToken,
+			accessToken:  strings.TrimPrefix(otherAccessToken, "Bearer "),
+			err:          true,
+		}, {
+			desc:         "success",
+			refreshToken: refreshToken,
+			accessToken:  accessTokenNoBearer[1],
+			err:          false,
 		}, {
 			desc:         "failed_invalid_refresh_token",
 			refreshToken: refreshToken + "a",
@@ -403,3 +558,964 @@ func TestRefreshToken(t *testing.T) {
 		})
 	}
 }
+
+func TestRefreshTokenAfterKeyRetired(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	_, _, signUpReq := createUser(t)
+
+	_, accessToken, refreshToken, _, code, err := serviceTest.LogIn(auth.LoginRequest{Email: signUpReq.Email, Password: signUpReq.Password, RememberMe: true})
+	require.NoError(t, err)
+	assert.Equal(t, errs.CodeSuccess, code)
+
+	// the key that signed the access token is rotated and retired right away
+	kid, privateKey, err := password.GenerateSigningKey(signer.RS256)
+	require.NoError(t, err)
+	now := time.Now().UTC()
+	_, err = repoTest.RotateSigningKey(ctx, auth.RotateSigningKeyParams{
+		Kid:         kid,
+		Signer:      privateKey,
+		ActivatesAt: now.Add(-time.Second),
+		RetiresAt:   now.Add(-time.Second),
+	})
+	require.NoError(t, err)
+
+	keys, err := repoTest.LoadKeys(ctx)
+	require.NoError(t, err)
+	require.Equal(t, kid, keys.Signing.Kid)
+	_, err = middleware.ReadToken(accessToken, keys)
+	require.Error(t, err)
+
+	newRefreshToken, newAccessToken, code, err := serviceTest.RefreshToken(refreshToken, strings.TrimPrefix(accessToken, "Bearer "))
+	require.NoError(t, err)
+	assert.Equal(t, errs.CodeSuccess, code)
+	assert.NotEmpty(t, newRefreshToken)
+
+	payload, err := middleware.ReadToken(newAccessToken, keys)
+	require.NoError(t, err)
+	assert.NotZero(t, payload.SessionID)
+}
+
+func TestSignUpAdminEmail(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	input := auth.SignupRequest{
+		Username: generator.CreateRandomString(5),
+		Email:    adminEmail,
+		Password: generator.CreateRandomString(10),
+	}
+	res, _, code, err := serviceTest.SignUp(input)
+	require.NoError(t, err)
+	require.Equal(t, 200, code)
+	assert.Equal(t, auth.RoleCustomer, res.Role)
+
+	// logging in before the email is verified doesn't make the user admin
+	loggedIn, _, _, _, code, err := serviceTest.LogIn(auth.LoginRequest{Email: input.Email, Password: input.Password})
+	require.NoError(t, err)
+	require.Equal(t, 200, code)
+	assert.Equal(t, auth.RoleCustomer, loggedIn.Role)
+
+	code, err = serviceTest.VerifyEmail(mailerTest.lastMailToken(t, input.Email))
+	require.NoError(t, err)
+	require.Equal(t, 200, code)
+
+	verified, err := repoTest.GetUserByID(ctx, res.ID)
+	require.NoError(t, err)
+	assert.Equal(t, auth.RoleAdmin, verified.Role)
+
+	user, _, _ := createUser(t)
+	assert.Equal(t, auth.RoleCustomer, user.Role)
+}
+
+func TestGrantAndRevokeRole(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user, _, _ := createUser(t)
+
+	testCases := []struct {
+		desc string
+		arg  auth.UpdateUserRoleParams
+		code int
+		err  error
+	}{
+		{
+			desc: "success_staff",
+			arg:  auth.UpdateUserRoleParams{ID: user.ID, Role: auth.RoleStaff},
+			code: errs.CodeSuccess,
+		}, {
+			desc: "success_admin",
+			arg:  auth.UpdateUserRoleParams{ID: user.ID, Role: auth.RoleAdmin},
+			code: errs.CodeSuccess,
+		}, {
+			desc: "failed_invalid_role",
+			arg:  auth.UpdateUserRoleParams{ID: user.ID, Role: "owner"},
+			code: errs.CodeFailedUser,
+			err:  errs.ErrInvalidInput,
+		}, {
+			desc: "failed_wrong_id",
+			arg:  auth.UpdateUserRoleParams{ID: user.ID + 5, Role: auth.RoleStaff},
+			code: errs.CodeFailedUser,
+			err:  errs.ErrNoData,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			res, code, err := serviceTest.GrantRole(tC.arg)
+			assert.Equal(t, tC.code, code)
+			if tC.err != nil {
+				require.Error(t, err)
+				assert.Equal(t, tC.err, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, user.ID, res.ID)
+			assert.Equal(t, tC.arg.Role, res.Role)
+		})
+	}
+
+	res, code, err := serviceTest.RevokeRole(user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, errs.CodeSuccess, code)
+	assert.Equal(t, auth.RoleCustomer, res.Role)
+}
+
+func TestVerifyEmail(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user, _, _ := createUser(t)
+	token := mailerTest.lastMailToken(t, user.Email)
+
+	testCases := []struct {
+		desc  string
+		token string
+		code  int
+		err   error
+	}{
+		{
+			desc:  "success",
+			token: token,
+			code:  errs.CodeSuccess,
+		}, {
+			desc:  "success_twice",
+			token: token,
+			code:  errs.CodeSuccess,
+		}, {
+			desc:  "failed_invalid_token",
+			token: token + "a",
+			code:  errs.CodeFailedUser,
+			err:   errs.ErrInvalidVerificationToken,
+		}, {
+			desc:  "failed_empty_token",
+			token: "",
+			code:  errs.CodeFailedUser,
+			err:   errs.ErrInvalidVerificationToken,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			code, err := serviceTest.VerifyEmail(tC.token)
+			assert.Equal(t, tC.code, code)
+			if tC.err != nil {
+				require.Error(t, err)
+				assert.Equal(t, tC.err, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+
+	res, err := repoTest.GetUserByEmail(ctx, user.Email)
+	require.NoError(t, err)
+	assert.True(t, res.IsVerified)
+
+	t.Run("failed_access_token", func(t *testing.T) {
+		other, signUpToken, _ := createUser(t)
+		code, err := serviceTest.VerifyEmail(strings.TrimPrefix(signUpToken, "Bearer "))
+		assert.Equal(t, errs.CodeFailedUser, code)
+		assert.Equal(t, errs.ErrInvalidVerificationToken, err)
+
+		res, err := repoTest.GetUserByEmail(ctx, other.Email)
+		require.NoError(t, err)
+		assert.False(t, res.IsVerified)
+	})
+}
+
+func TestResendVerification(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user, _, _ := createUser(t)
+	payload := auth.JwtPayload{UserID: user.ID, Name: user.Username, Email: user.Email}
+	// ids restart after the tables are cleaned, so do the limits
+	err = client.Del(ctx, fmt.Sprint("verify resend cooldown ", user.ID), fmt.Sprint("verify resend count ", user.ID)).Err()
+	require.NoError(t, err)
+
+	code, err := serviceTest.ResendVerification(payload)
+	require.NoError(t, err)
+	assert.Equal(t, errs.CodeSuccess, code)
+
+	code, err = serviceTest.ResendVerification(payload)
+	require.Error(t, err)
+	assert.Equal(t, errs.CodeFailedTooManyRequests, code)
+	assert.Equal(t, errs.ErrTooManyRequests, err)
+
+	code, err = serviceTest.VerifyEmail(mailerTest.lastMailToken(t, user.Email))
+	require.NoError(t, err)
+	assert.Equal(t, errs.CodeSuccess, code)
+
+	code, err = serviceTest.ResendVerification(payload)
+	require.Error(t, err)
+	assert.Equal(t, errs.CodeFailedUser, code)
+	assert.Equal(t, errs.ErrAlreadyVerified, err)
+}
+
+func TestForgotAndResetPassword(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user, _, signupReq := createUser(t)
+	insertRefreshTokenTest(t, user.ID)
+	err = client.Del(ctx, fmt.Sprint("password reset cooldown ", user.ID), fmt.Sprint("password reset count ", user.ID), fmt.Sprint("block user ", user.ID)).Err()
+	require.NoError(t, err)
+
+	t.Run("unknown_email", func(t *testing.T) {
+		mails := len(mailerTest.mails)
+		code, err := serviceTest.ForgotPassword("a" + user.Email)
+		require.NoError(t, err)
+		assert.Equal(t, errs.CodeSuccess, code)
+		assert.Len(t, mailerTest.mails, mails)
+	})
+
+	code, err := serviceTest.ForgotPassword(user.Email)
+	require.NoError(t, err)
+	assert.Equal(t, errs.CodeSuccess, code)
+	token := mailerTest.lastMailToken(t, user.Email)
+
+	newPassword := generator.CreateRandomString(10)
+	testCases := []struct {
+		desc  string
+		token string
+		code  int
+		err   error
+	}{
+		{
+			desc:  "failed_invalid_token",
+			token: token + "a",
+			code:  errs.CodeFailedUser,
+			err:   errs.ErrInvalidResetToken,
+		}, {
+			desc:  "success",
+			token: token,
+			code:  errs.CodeSuccess,
+		}, {
+			desc:  "failed_used_token",
+			token: token,
+			code:  errs.CodeFailedUser,
+			err:   errs.ErrInvalidResetToken,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			code, err := serviceTest.ResetPassword(tC.token, newPassword)
+			assert.Equal(t, tC.code, code)
+			if tC.err != nil {
+				require.Error(t, err)
+				assert.Equal(t, tC.err, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+
+	_, _, _, _, _, err = serviceTest.LogIn(auth.LoginRequest{Email: user.Email, Password: signupReq.Password})
+	require.Error(t, err)
+
+	// the refresh token from before the reset is gone, the one from this log
+	// in is the only one left
+	loggedIn, _, refreshToken, _, code, err := serviceTest.LogIn(auth.LoginRequest{Email: user.Email, Password: newPassword})
+	require.NoError(t, err)
+	assert.Equal(t, errs.CodeSuccess, code)
+	refreshTokenUUID, err := uuid.Parse(refreshToken)
+	require.NoError(t, err)
+	_, err = repoTest.ReadRefreshToken(ctx, loggedIn.ID, refreshTokenUUID)
+	require.NoError(t, err)
+
+	blockedAt, err := client.Get(ctx, fmt.Sprint("block user ", user.ID)).Int64()
+	require.NoError(t, err)
+	assert.NotZero(t, blockedAt)
+
+	t.Run("too_many_requests_is_silent", func(t *testing.T) {
+		mails := len(mailerTest.mails)
+		code, err := serviceTest.ForgotPassword(user.Email)
+		require.NoError(t, err)
+		assert.Equal(t, errs.CodeSuccess, code)
+		assert.Len(t, mailerTest.mails, mails)
+	})
+}
+
+func TestChangePassword(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user, _, signupReq := createUser(t)
+	refreshToken := insertRefreshTokenTest(t, user.ID)
+	err = client.Del(ctx, fmt.Sprint("block user ", user.ID)).Err()
+	require.NoError(t, err)
+	payload := auth.JwtPayload{UserID: user.ID, Name: user.Username, Email: user.Email}
+
+	newPassword := generator.CreateRandomString(10)
+
+	code, err := serviceTest.ChangePassword(payload, signupReq.Password+"a", newPassword)
+	require.Error(t, err)
+	assert.Equal(t, errs.CodeFailedUnauthorized, code)
+
+	code, err = serviceTest.ChangePassword(payload, signupReq.Password, newPassword)
+	require.NoError(t, err)
+	assert.Equal(t, errs.CodeSuccess, code)
+
+	_, err = repoTest.ReadRefreshToken(ctx, user.ID, refreshToken)
+	require.Error(t, err)
+
+	blockedAt, err := client.Get(ctx, fmt.Sprint("block user ", user.ID)).Int64()
+	require.NoError(t, err)
+	assert.NotZero(t, blockedAt)
+
+	_, _, _, _, code, err = serviceTest.LogIn(auth.LoginRequest{Email: user.Email, Password: newPassword})
+	require.NoError(t, err)
+	assert.Equal(t, errs.CodeSuccess, code)
+}
+
+func TestUserBlockTTL(t *testing.T) {
+	testCases := []struct {
+		desc   string
+		access time.Duration
+		signUp time.Duration
+		ans    time.Duration
+	}{
+		{desc: "access_token_longer", access: time.Hour, signUp: 10 * time.Minute, ans: time.Hour},
+		{desc: "signup_token_longer", access: 15 * time.Minute, signUp: 24 * time.Hour, ans: 24 * time.Hour},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			s := &authService{conf: auth.ServiceConfig{AccessTokenTTL: tC.access, SignUpTokenTTL: tC.signUp}}
+			assert.Equal(t, tC.ans, s.userBlockTTL())
+		})
+	}
+}
+
+func TestUpdateProfile(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user, _, _ := createUser(t)
+	other, _, _ := createUser(t)
+	code, err := serviceTest.VerifyEmail(mailerTest.lastMailToken(t, user.Email))
+	require.NoError(t, err)
+	assert.Equal(t, errs.CodeSuccess, code)
+
+	keys, err := repoTest.LoadKeys(ctx)
+	require.NoError(t, err)
+	payload := auth.JwtPayload{UserID: user.ID, Name: user.Username, Email: user.Email}
+
+	t.Run("failed_email_in_use", func(t *testing.T) {
+		arg := auth.UpdateProfileParams{ID: user.ID, Email: pgtype.Text{String: other.Email, Valid: true}}
+		_, _, code, err := serviceTest.UpdateProfile(payload, arg)
+		require.Error(t, err)
+		assert.Equal(t, errs.CodeFailedDuplicated, code)
+	})
+
+	t.Run("failed_unknown_user", func(t *testing.T) {
+		_, _, code, err := serviceTest.UpdateProfile(payload, auth.UpdateProfileParams{ID: other.ID + 5})
+		require.Error(t, err)
+		assert.Equal(t, errs.CodeFailedUser, code)
+		assert.Equal(t, errs.ErrNoData, err)
+	})
+
+	t.Run("success_new_email", func(t *testing.T) {
+		arg := auth.UpdateProfileParams{
+			ID:       user.ID,
+			Email:    pgtype.Text{String: "new" + user.Email, Valid: true},
+			FullName: pgtype.Text{String: "Grace Doe", Valid: true},
+		}
+		profile, accessToken, code, err := serviceTest.UpdateProfile(payload, arg)
+		require.NoError(t, err)
+		assert.Equal(t, errs.CodeSuccess, code)
+		assert.Equal(t, arg.Email.String, profile.Email)
+		assert.Equal(t, arg.FullName, profile.FullName)
+		assert.False(t, profile.IsVerified)
+
+		// the new token carries the new email, the verification goes there
+		payload, err := middleware.ReadToken(accessToken, keys)
+		require.NoError(t, err)
+		assert.Equal(t, arg.Email.String, payload.Email)
+
+		code, err = serviceTest.VerifyEmail(mailerTest.lastMailToken(t, arg.Email.String))
+		require.NoError(t, err)
+		assert.Equal(t, errs.CodeSuccess, code)
+
+		res, err := repoTest.GetUserByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.True(t, res.IsVerified)
+	})
+}
+
+func TestAddressInAccessToken(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user, _, signupReq := createUser(t)
+	keys, err := repoTest.LoadKeys(ctx)
+	require.NoError(t, err)
+
+	address, code, err := serviceTest.AddAddress(auth.AddressParams{
+		UserID:    user.ID,
+		Recipient: user.Username,
+		Street:    "Circle Street, No.1",
+		City:      "Bandung",
+		Country:   "Indonesia",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, errs.CodeSuccessCreate, code)
+	assert.True(t, address.IsDefault)
+
+	_, accessToken, _, _, code, err := serviceTest.LogIn(auth.LoginRequest{Email: user.Email, Password: signupReq.Password})
+	require.NoError(t, err)
+	assert.Equal(t, errs.CodeSuccess, code)
+
+	payload, err := middleware.ReadToken(accessToken, keys)
+	require.NoError(t, err)
+	assert.Equal(t, "Circle Street, No.1, Bandung, Indonesia", payload.Address)
+
+	code, err = serviceTest.DeleteAddress(auth.DeleteAddressParams{ID: address.ID, UserID: user.ID})
+	require.NoError(t, err)
+	assert.Equal(t, errs.CodeSuccess, code)
+
+	code, err = serviceTest.DeleteAddress(auth.DeleteAddressParams{ID: address.ID, UserID: user.ID})
+	require.Error(t, err)
+	assert.Equal(t, errs.CodeFailedUser, code)
+	assert.Equal(t, errs.ErrNoData, err)
+}
+
+func TestSessions(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	_, _, signUpReq := createUser(t)
+	keys, err := repoTest.LoadKeys(ctx)
+	require.NoError(t, err)
+
+	login := func(device string) (*auth.JwtPayload, string) {
+		_, accessToken, refreshToken, _, code, err := serviceTest.LogIn(auth.LoginRequest{
+			Email:      signUpReq.Email,
+			Password:   signUpReq.Password,
+			DeviceName: device,
+			UserAgent:  "test agent",
+			IPAddress:  "127.0.0.1",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, errs.CodeSuccess, code)
+
+		payload, err := middleware.ReadToken(accessToken, keys)
+		require.NoError(t, err)
+		assert.NotZero(t, payload.SessionID)
+
+		return payload, refreshToken
+	}
+
+	laptop, _ := login("laptop")
+	phone, phoneRefreshToken := login("phone")
+	assert.NotEqual(t, laptop.SessionID, phone.SessionID)
+
+	sessions, code, err := serviceTest.ListSessions(laptop.UserID)
+	require.NoError(t, err)
+	assert.Equal(t, errs.CodeSuccess, code)
+	require.Len(t, sessions, 2)
+
+	// logging out on the laptop leaves the phone logged in
+	err = serviceTest.LogOut(*laptop)
+	require.NoError(t, err)
+
+	sessions, _, err = serviceTest.ListSessions(laptop.UserID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, phone.SessionID, sessions[0].ID)
+	assert.Equal(t, "phone", sessions[0].DeviceName)
+
+	accessToken, err := middleware.CreateToken(auth.User{ID: phone.UserID, Username: phone.Name, Email: phone.Email}, phone.SessionID, 5*time.Minute, keys.Signing)
+	require.NoError(t, err)
+	_, newAccessToken, code, err := serviceTest.RefreshToken(phoneRefreshToken, strings.TrimPrefix(accessToken, "Bearer "))
+	require.NoError(t, err)
+	assert.Equal(t, errs.CodeSuccess, code)
+
+	// the session keeps its id across a refresh
+	payload, err := middleware.ReadToken(newAccessToken, keys)
+	require.NoError(t, err)
+	assert.Equal(t, phone.SessionID, payload.SessionID)
+
+	err = client.Del(ctx, fmt.Sprint("block session ", phone.SessionID)).Err()
+	require.NoError(t, err)
+
+	code, err = serviceTest.RevokeSession(auth.DeleteSessionParams{ID: phone.SessionID, UserID: phone.UserID})
+	require.NoError(t, err)
+	assert.Equal(t, errs.CodeSuccess, code)
+
+	blocked, err := client.Exists(ctx, fmt.Sprint("block session ", phone.SessionID)).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), blocked)
+
+	code, err = serviceTest.RevokeSession(auth.DeleteSessionParams{ID: phone.SessionID, UserID: phone.UserID})
+	require.Error(t, err)
+	assert.Equal(t, errs.CodeFailedUser, code)
+	assert.Equal(t, errs.ErrNoData, err)
+}
+
+func TestRefreshTokenReuse(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	_, _, signUpReq := createUser(t)
+	keys, err := repoTest.LoadKeys(ctx)
+	require.NoError(t, err)
+
+	_, accessToken, oldRefreshToken, _, code, err := serviceTest.LogIn(auth.LoginRequest{Email: signUpReq.Email, Password: signUpReq.Password, DeviceName: "laptop"})
+	require.NoError(t, err)
+	assert.Equal(t, errs.CodeSuccess, code)
+	payload, err := middleware.ReadToken(accessToken, keys)
+	require.NoError(t, err)
+
+	newRefreshToken, newAccessToken, code, err := serviceTest.RefreshToken(oldRefreshToken, strings.TrimPrefix(accessToken, "Bearer "))
+	require.NoError(t, err)
+	assert.Equal(t, errs.CodeSuccess, code)
+
+	// the old token is replayed, the session is revoked
+	stolenAccessToken, err := middleware.CreateToken(auth.User{ID: payload.UserID, Username: payload.Name, Email: payload.Email}, payload.SessionID, 5*time.Minute, keys.Signing)
+	require.NoError(t, err)
+	_, _, code, err = serviceTest.RefreshToken(oldRefreshToken, strings.TrimPrefix(stolenAccessToken, "Bearer "))
+	require.Error(t, err)
+	assert.Equal(t, errs.CodeFailedUnauthorized, code)
+	assert.Equal(t, errs.ErrRefreshTokenReused, err)
+
+	sessions, _, err := serviceTest.ListSessions(payload.UserID)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+
+	blocked, err := client.Exists(ctx, fmt.Sprint("block session ", payload.SessionID)).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), blocked)
+
+	stolenPayload, err := middleware.ReadToken(stolenAccessToken, keys)
+	require.NoError(t, err)
+	blocked, err = client.Exists(ctx, fmt.Sprint("block ", stolenPayload.ID)).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), blocked)
+
+	logs, err := repoTest.ListAuditLogs(ctx, payload.UserID)
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+	assert.Equal(t, auth.AuditRefreshTokenReused, logs[0].Event)
+	assert.Equal(t, payload.SessionID, logs[0].SessionID.Int32)
+
+	// the token from the rotation went with the session
+	_, _, code, err = serviceTest.RefreshToken(newRefreshToken, strings.TrimPrefix(newAccessToken, "Bearer "))
+	require.Error(t, err)
+	assert.Equal(t, errs.CodeFailedUnauthorized, code)
+	assert.NotEqual(t, errs.ErrRefreshTokenReused, err)
+
+	err = client.Del(ctx, fmt.Sprint("block session ", payload.SessionID)).Err()
+	require.NoError(t, err)
+}
+
+func TestRememberMe(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	_, _, signUpReq := createUser(t)
+	keys, err := repoTest.LoadKeys(ctx)
+	require.NoError(t, err)
+
+	_, _, _, _, code, err := serviceTest.LogIn(auth.LoginRequest{Email: signUpReq.Email, Password: signUpReq.Password, DeviceName: "phone"})
+	require.NoError(t, err)
+	assert.Equal(t, errs.CodeSuccess, code)
+	_, accessToken, refreshToken, _, code, err := serviceTest.LogIn(auth.LoginRequest{Email: signUpReq.Email, Password: signUpReq.Password, DeviceName: "laptop", RememberMe: true})
+	require.NoError(t, err)
+	assert.Equal(t, errs.CodeSuccess, code)
+	payload, err := middleware.ReadToken(accessToken, keys)
+	require.NoError(t, err)
+
+	sessions, _, err := serviceTest.ListSessions(payload.UserID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	for _, session := range sessions {
+		expiresIn := 24 * time.Hour
+		if session.DeviceName == "laptop" {
+			expiresIn = 720 * time.Hour
+		}
+		assert.Equal(t, session.DeviceName == "laptop", session.RememberMe)
+		assert.WithinDuration(t, time.Now().Add(expiresIn), session.ExpiresAt, time.Minute)
+	}
+
+	// the rotated token keeps the longer lifetime
+	refreshToken, accessToken, code, err = serviceTest.RefreshToken(refreshToken, strings.TrimPrefix(accessToken, "Bearer "))
+	require.NoError(t, err)
+	assert.Equal(t, errs.CodeSuccess, code)
+	session, err := repoTest.ReadRefreshToken(ctx, payload.UserID, uuid.MustParse(refreshToken))
+	require.NoError(t, err)
+	assert.True(t, session.RememberMe)
+	assert.WithinDuration(t, time.Now().Add(720*time.Hour), session.ExpiresAt, time.Minute)
+
+	// the max lifetime was lowered below the session's age
+	shortLived := NewAuthService(repoTest, cache.NewAuthCache(client, ctx), ctx, mailerTest, auth.ServiceConfig{
+		AccessTokenTTL:            time.Hour,
+		RefreshTokenTTL:           24 * time.Hour,
+		RememberMeRefreshTokenTTL: 720 * time.Hour,
+		SessionMaxLifetime:        time.Nanosecond,
+	})
+	_, _, code, err = shortLived.RefreshToken(refreshToken, strings.TrimPrefix(accessToken, "Bearer "))
+	require.Error(t, err)
+	assert.Equal(t, errs.CodeFailedUnauthorized, code)
+	assert.Equal(t, errs.ErrSessionExpired, err)
+
+	sessions, _, err = serviceTest.ListSessions(payload.UserID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, "phone", sessions[0].DeviceName)
+}
+
+func TestTOTP(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user, _, signUpReq := createUser(t)
+	payload := auth.JwtPayload{UserID: user.ID, Name: user.Username, Email: user.Email}
+	loginReq := auth.LoginRequest{Email: user.Email, Password: signUpReq.Password}
+
+	// a user without totp isn't asked for a code
+	code, err := serviceTest.CheckStepUp(payload, 5000, "")
+	require.NoError(t, err)
+	assert.Equal(t, errs.CodeSuccess, code)
+
+	_, code, err = serviceTest.ConfirmTOTP(payload, "123456")
+	require.Error(t, err)
+	assert.Equal(t, errs.CodeFailedUser, code)
+	assert.Equal(t, errs.ErrTOTPNotEnrolled, err)
+
+	_, _, err = serviceTest.EnrollTOTP(payload)
+	require.NoError(t, err)
+	// enrolling again starts over with a new secret
+	enrollment, code, err := serviceTest.EnrollTOTP(payload)
+	require.NoError(t, err)
+	assert.Equal(t, errs.CodeSuccess, code)
+	assert.Contains(t, enrollment.URI, "otpauth://totp/")
+	assert.Contains(t, enrollment.URI, "secret="+enrollment.Secret)
+
+	// totp is off until it's confirmed
+	_, accessToken, _, mfaToken, code, err := serviceTest.LogIn(loginReq)
+	require.NoError(t, err)
+	assert.Equal(t, errs.CodeSuccess, code)
+	assert.NotEmpty(t, accessToken)
+	assert.Empty(t, mfaToken)
+
+	step := totp.Step(time.Now())
+	totpCode := func(step int64) string {
+		res, err := totp.Code(enrollment.Secret, step)
+		require.NoError(t, err)
+		return res
+	}
+
+	recoveryCodes, code, err := serviceTest.ConfirmTOTP(payload, totpCode(step))
+	require.NoError(t, err)
+	assert.Equal(t, errs.CodeSuccess, code)
+	assert.Len(t, recoveryCodes, 10)
+
+	_, code, err = serviceTest.EnrollTOTP(payload)
+	require.Error(t, err)
+	assert.Equal(t, errs.CodeFailedDuplicated, code)
+	assert.Equal(t, errs.ErrTOTPAlreadyEnabled, err)
+
+	t.Run("log_in", func(t *testing.T) {
+		_, accessToken, _, mfaToken, code, err := serviceTest.LogIn(loginReq)
+		require.NoError(t, err)
+		assert.Equal(t, errs.CodeSuccess, code)
+		assert.Empty(t, accessToken)
+		require.NotEmpty(t, mfaToken)
+
+		// the code that confirmed totp is already used
+		_, _, _, code, err = serviceTest.LogInMFA(auth.MFALoginRequest{MFAToken: mfaToken, Code: totpCode(step)})
+		require.Error(t, err)
+		assert.Equal(t, errs.CodeFailedUnauthorized, code)
+		assert.Equal(t, errs.ErrInvalidTOTPCode, err)
+
+		res, accessToken, refreshToken, code, err := serviceTest.LogInMFA(auth.MFALoginRequest{MFAToken: mfaToken, Code: totpCode(step + 1)})
+		require.NoError(t, err)
+		assert.Equal(t, errs.CodeSuccess, code)
+		assert.Equal(t, user.ID, res.ID)
+		assert.NotEmpty(t, accessToken)
+		assert.NotEmpty(t, refreshToken)
+
+		_, _, _, code, err = serviceTest.LogInMFA(auth.MFALoginRequest{MFAToken: accessToken, Code: totpCode(step + 1)})
+		require.Error(t, err)
+		assert.Equal(t, errs.CodeFailedUnauthorized, code)
+		assert.Equal(t, errs.ErrInvalidMFAToken, err)
+	})
+
+	t.Run("recovery_code", func(t *testing.T) {
+		_, _, _, mfaToken, _, err := serviceTest.LogIn(loginReq)
+		require.NoError(t, err)
+
+		// the case and the dash don't matter
+		typed := strings.ToUpper(strings.ReplaceAll(recoveryCodes[0], "-", ""))
+		_, accessToken, _, code, err := serviceTest.LogInMFA(auth.MFALoginRequest{MFAToken: mfaToken, Code: typed})
+		require.NoError(t, err)
+		assert.Equal(t, errs.CodeSuccess, code)
+		assert.NotEmpty(t, accessToken)
+
+		_, _, _, code, err = serviceTest.LogInMFA(auth.MFALoginRequest{MFAToken: mfaToken, Code: recoveryCodes[0]})
+		require.Error(t, err)
+		assert.Equal(t, errs.CodeFailedUnauthorized, code)
+		assert.Equal(t, errs.ErrInvalidTOTPCode, err)
+	})
+
+	t.Run("step_up", func(t *testing.T) {
+		code, err := serviceTest.CheckStepUp(payload, 1000, "")
+		require.NoError(t, err)
+		assert.Equal(t, errs.CodeSuccess, code)
+
+		code, err = serviceTest.CheckStepUp(payload, 1001, "")
+		require.Error(t, err)
+		assert.Equal(t, errs.CodeFailedForbidden, code)
+		assert.Equal(t, errs.ErrTOTPRequired, err)
+
+		// a recovery code doesn't step up
+		code, err = serviceTest.CheckStepUp(payload, 1001, recoveryCodes[1])
+		require.Error(t, err)
+		assert.Equal(t, errs.CodeFailedForbidden, code)
+		assert.Equal(t, errs.ErrInvalidTOTPCode, err)
+
+		code, err = serviceTest.CheckStepUp(payload, 1001, totpCode(step+1))
+		require.Error(t, err)
+		assert.Equal(t, errs.CodeFailedForbidden, code)
+		assert.Equal(t, errs.ErrInvalidTOTPCode, err)
+	})
+
+	code, err = serviceTest.DisableTOTP(payload, recoveryCodes[1])
+	require.NoError(t, err)
+	assert.Equal(t, errs.CodeSuccess, code)
+
+	_, accessToken, _, mfaToken, code, err = serviceTest.LogIn(loginReq)
+	require.NoError(t, err)
+	assert.Equal(t, errs.CodeSuccess, code)
+	assert.NotEmpty(t, accessToken)
+	assert.Empty(t, mfaToken)
+
+	code, err = serviceTest.DisableTOTP(payload, recoveryCodes[2])
+	require.Error(t, err)
+	assert.Equal(t, errs.CodeFailedUser, code)
+	assert.Equal(t, errs.ErrTOTPNotEnrolled, err)
+}
+
+func TestAPIKeys(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user, _, _ := createUser(t)
+
+	testCases := []struct {
+		desc string
+		arg  auth.CreateAPIKeyRequest
+		code int
+		err  error
+	}{
+		{
+			desc: "success",
+			arg:  auth.CreateAPIKeyRequest{UserID: user.ID, Name: "reports job", Scopes: []string{"wallets:read", "transactions:write"}},
+			code: errs.CodeSuccessCreate,
+		}, {
+			desc: "success_expiring",
+			arg: auth.CreateAPIKeyRequest{
+				UserID:    user.ID,
+				Name:      "one off",
+				Scopes:    []string{"orders:read"},
+				ExpiresAt: pgtype.Timestamp{Time: time.Now().UTC().Add(time.Hour), Valid: true},
+			},
+			code: errs.CodeSuccessCreate,
+		}, {
+			desc: "failed_no_scope",
+			arg:  auth.CreateAPIKeyRequest{UserID: user.ID, Name: "job"},
+			code: errs.CodeFailedUser,
+			err:  errs.ErrInvalidAPIKeyScope,
+		}, {
+			desc: "failed_auth_scope",
+			arg:  auth.CreateAPIKeyRequest{UserID: user.ID, Name: "job", Scopes: []string{"auth:write"}},
+			code: errs.CodeFailedUser,
+			err:  errs.ErrInvalidAPIKeyScope,
+		}, {
+			desc: "failed_expired",
+			arg: auth.CreateAPIKeyRequest{
+				UserID:    user.ID,
+				Name:      "job",
+				Scopes:    []string{"orders:read"},
+				ExpiresAt: pgtype.Timestamp{Time: time.Now().UTC().Add(-time.Minute), Valid: true},
+			},
+			code: errs.CodeFailedUser,
+			err:  errs.ErrInvalidAPIKeyExpiry,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			res, key, code, err := serviceTest.CreateAPIKey(tC.arg)
+			assert.Equal(t, tC.code, code)
+			if tC.err != nil {
+				require.Error(t, err)
+				assert.Equal(t, tC.err, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.True(t, strings.HasPrefix(key, auth.APIKeyPrefix))
+			assert.True(t, strings.HasPrefix(key, res.Prefix))
+			assert.Equal(t, tC.arg.Scopes, res.Scopes)
+
+			// only the hash is saved
+			saved, err := repoTest.GetAPIKeyByHash(ctx, auth.HashAPIKey(key))
+			require.NoError(t, err)
+			assert.Equal(t, res.ID, saved.ID)
+		})
+	}
+
+	keys, code, err := serviceTest.ListAPIKeys(user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, errs.CodeSuccess, code)
+	require.Len(t, keys, 2)
+
+	code, err = serviceTest.RevokeAPIKey(auth.DeleteAPIKeyParams{ID: keys[0].ID, UserID: user.ID})
+	require.NoError(t, err)
+	assert.Equal(t, errs.CodeSuccess, code)
+
+	code, err = serviceTest.RevokeAPIKey(auth.DeleteAPIKeyParams{ID: keys[0].ID, UserID: user.ID})
+	require.Error(t, err)
+	assert.Equal(t, errs.CodeFailedUser, code)
+	assert.Equal(t, errs.ErrNoData, err)
+
+	keys, _, err = serviceTest.ListAPIKeys(user.ID)
+	require.NoError(t, err)
+	assert.Len(t, keys, 1)
+}
+
+// oidcCallbackTest logs identity in at the stub provider and returns the
+// callback it redirects back with.
+func oidcCallbackTest(t *testing.T, identity oidctest.Identity) auth.OIDCCallbackRequest {
+	authURL, code, err := serviceTest.OIDCAuthURL("stub")
+	require.NoError(t, err)
+	require.Equal(t, errs.CodeSuccess, code)
+
+	oidcCode, state, err := oidcProvider.Authorize(authURL, identity)
+	require.NoError(t, err)
+
+	return auth.OIDCCallbackRequest{Provider: "stub", Code: oidcCode, State: state}
+}
+
+func TestOIDCLogin(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	t.Run("success_new_user", func(t *testing.T) {
+		identity := oidctest.Identity{
+			Subject:       generator.CreateRandomString(10),
+			Email:         generator.CreateRandomEmail(generator.CreateRandomString(5)),
+			EmailVerified: true,
+			Name:          "Stub User",
+		}
+
+		user, accessToken, refreshToken, mfaToken, code, err := serviceTest.OIDCCallback(oidcCallbackTest(t, identity))
+		require.NoError(t, err)
+		assert.Equal(t, errs.CodeSuccess, code)
+		assert.Equal(t, identity.Email, user.Email)
+		assert.Equal(t, identity.Name, user.Username)
+		assert.True(t, user.IsVerified)
+		assert.NotEmpty(t, accessToken)
+		assert.NotEmpty(t, refreshToken)
+		assert.Empty(t, mfaToken)
+
+		// the identity logs the same user in again
+		again, _, _, _, code, err := serviceTest.OIDCCallback(oidcCallbackTest(t, identity))
+		require.NoError(t, err)
+		assert.Equal(t, errs.CodeSuccess, code)
+		assert.Equal(t, user.ID, again.ID)
+	})
+
+	t.Run("success_link_verified_user", func(t *testing.T) {
+		user, _, _ := createUser(t)
+		err := repoTest.UpdateUserVerification(ctx, auth.UpdateUserVerificationParams{ID: user.ID, Email: user.Email})
+		require.NoError(t, err)
+
+		identity := oidctest.Identity{Subject: generator.CreateRandomString(10), Email: user.Email, EmailVerified: true}
+		res, _, _, _, code, err := serviceTest.OIDCCallback(oidcCallbackTest(t, identity))
+		require.NoError(t, err)
+		assert.Equal(t, errs.CodeSuccess, code)
+		assert.Equal(t, user.ID, res.ID)
+
+		identityRes, err := repoTest.GetIdentity(ctx, "stub", identity.Subject)
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, identityRes.UserID)
+	})
+
+	t.Run("failed_unverified_user", func(t *testing.T) {
+		user, _, _ := createUser(t)
+
+		identity := oidctest.Identity{Subject: generator.CreateRandomString(10), Email: user.Email, EmailVerified: true}
+		_, _, _, _, code, err := serviceTest.OIDCCallback(oidcCallbackTest(t, identity))
+		require.Error(t, err)
+		assert.Equal(t, errs.CodeFailedDuplicated, code)
+		assert.Equal(t, errs.ErrOIDCEmailInUse, err)
+	})
+
+	t.Run("failed_email_not_verified", func(t *testing.T) {
+		identity := oidctest.Identity{
+			Subject: generator.CreateRandomString(10),
+			Email:   generator.CreateRandomEmail(generator.CreateRandomString(5)),
+		}
+		_, _, _, _, code, err := serviceTest.OIDCCallback(oidcCallbackTest(t, identity))
+		require.Error(t, err)
+		assert.Equal(t, errs.CodeFailedForbidden, code)
+		assert.Equal(t, errs.ErrOIDCEmailNotVerified, err)
+	})
+
+	t.Run("failed_state_reused", func(t *testing.T) {
+		identity := oidctest.Identity{
+			Subject:       generator.CreateRandomString(10),
+			Email:         generator.CreateRandomEmail(generator.CreateRandomString(5)),
+			EmailVerified: true,
+		}
+		input := oidcCallbackTest(t, identity)
+		_, _, _, _, _, err := serviceTest.OIDCCallback(input)
+		require.NoError(t, err)
+
+		_, _, _, _, code, err := serviceTest.OIDCCallback(input)
+		require.Error(t, err)
+		assert.Equal(t, errs.CodeFailedUnauthorized, code)
+		assert.Equal(t, errs.ErrInvalidOIDCState, err)
+	})
+
+	t.Run("failed_wrong_code", func(t *testing.T) {
+		identity := oidctest.Identity{Subject: generator.CreateRandomString(10), EmailVerified: true}
+		input := oidcCallbackTest(t, identity)
+		input.Code = "wrong"
+
+		_, _, _, _, code, err := serviceTest.OIDCCallback(input)
+		require.Error(t, err)
+		assert.Equal(t, errs.CodeFailedUnauthorized, code)
+		assert.Equal(t, errs.ErrOIDCLogin, err)
+	})
+
+	t.Run("failed_unknown_provider", func(t *testing.T) {
+		_, code, err := serviceTest.OIDCAuthURL("other")
+		require.Error(t, err)
+		assert.Equal(t, errs.CodeFailedUser, code)
+		assert.Equal(t, errs.ErrUnknownOIDCProvider, err)
+	})
+}
@@ -0,0 +1,97 @@
+package carts
+
+import (
+	"time"
+
+	orders "github.com/dwiw96/GoCommerceAPI/internal/features/orders"
+	transactions "github.com/dwiw96/GoCommerceAPI/internal/features/transactions"
+	wallets "github.com/dwiw96/GoCommerceAPI/internal/features/wallets"
+)
+
+type Cart struct {
+	ID        int32
+	UserID    int32
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type CartItem struct {
+	ID        int32
+	CartID    int32
+	ProductID int32
+	Quantity  int32
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// CartItemDetail is a cart line joined with the product it refers to.
+type CartItemDetail struct {
+	CartItem
+	ProductName  string
+	Price        int32
+	Availability int32
+	Subtotal     int32
+}
+
+type CartDetail struct {
+	Cart
+	Items       []CartItemDetail
+	TotalAmount int32
+}
+
+type CartItemParams struct {
+	CartID    int32
+	ProductID int32
+	Quantity  int32
+}
+
+// params for service method
+type AddItemParams struct {
+	UserID    int32
+	ProductID int32
+	Quantity  int32
+}
+
+type UpdateItemParams struct {
+	UserID    int32
+	ProductID int32
+	Quantity  int32
+}
+
+type RemoveItemParams struct {
+	UserID    int32
+	ProductID int32
+}
+
+// CheckoutParams pays the cart of UserID with the wallet in Currency, or the
+// one in the currency of the products when it's empty.
+type CheckoutParams struct {
+	UserID   int32
+	Currency string
+}
+
+type CheckoutResult struct {
+	Order        *orders.Order
+	Items        []orders.OrderItem
+	Transactions []transactions.TransactionHistory
+	TotalAmount  int32
+	Wallet       *wallets.Wallet
+}
+
+type IRepository interface {
+	GetOrCreateCart(userID int32) (*Cart, error)
+	AddCartItem(arg CartItemParams) (*CartItem, error)
+	UpdateCartItem(arg CartItemParams) (*CartItem, error)
+	DeleteCartItem(cartID, productID int32) error
+	ListCartItems(cartID int32) ([]CartItemDetail, error)
+	ClearCart(cartID int32) error
+	Checkout(arg CheckoutParams) (*CheckoutResult, error)
+}
+
+type IService interface {
+	GetCart(userID int32) (res *CartDetail, code int, err error)
+	AddItem(arg AddItemParams) (res *CartItem, code int, err error)
+	UpdateItem(arg UpdateItemParams) (res *CartItem, code int, err error)
+	RemoveItem(arg RemoveItemParams) (code int, err error)
+	Checkout(arg CheckoutParams) (res *CheckoutResult, code int, err error)
+}
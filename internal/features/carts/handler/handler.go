@@ -0,0 +1,212 @@
+package handler
+
+import (
+	"context"
+
+	auth "github.com/dwiw96/GoCommerceAPI/internal/features/auth"
+	carts "github.com/dwiw96/GoCommerceAPI/internal/features/carts"
+	mid "github.com/dwiw96/GoCommerceAPI/pkg/middleware"
+	responses "github.com/dwiw96/GoCommerceAPI/pkg/utils/responses"
+
+	"github.com/go-playground/locales/en"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	en_translations "github.com/go-playground/validator/v10/translations/en"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/gin-gonic/gin"
+)
+
+type cartsHandler struct {
+	router   *gin.Engine
+	service  carts.IService
+	validate *validator.Validate
+	trans    ut.Translator
+}
+
+// NewCartsHandler registers the cart routes. With requireVerified a user must
+// verify the email before checking out.
+func NewCartsHandler(router *gin.Engine, service carts.IService, pool *pgxpool.Pool, client *redis.Client, ctx context.Context, requireVerified bool) {
+	handler := &cartsHandler{
+		router:   router,
+		service:  service,
+		validate: validator.New(),
+	}
+
+	en := en.New()
+	uni := ut.New(en, en)
+	trans, _ := uni.GetTranslator("en")
+	en_translations.RegisterDefaultTranslations(handler.validate, trans)
+	handler.trans = trans
+
+	router.Use(mid.AuthMiddleware(ctx, pool, client))
+
+	router.GET("/api/v1/carts", handler.getCart)
+	router.POST("/api/v1/carts/items", handler.addItem)
+	router.PUT("/api/v1/carts/items/:product_id", handler.updateItem)
+	router.DELETE("/api/v1/carts/items/:product_id", handler.removeItem)
+	router.POST("/api/v1/carts/checkout", mid.VerifiedMiddleware(requireVerified), handler.checkout)
+}
+
+func translateError(trans ut.Translator, err error) (errTrans []string) {
+	errs := err.(validator.ValidationErrors)
+	a := (errs.Translate(trans))
+	for _, val := range a {
+		errTrans = append(errTrans, val)
+	}
+
+	return
+}
+
+func (h *cartsHandler) getCart(c *gin.Context) {
+	authPayload, isExists := c.Keys["payloadKey"].(*auth.JwtPayload)
+	if !isExists {
+		responses.ErrorJSON(c, 401, []string{"token is wrong"}, c.Request.RemoteAddr)
+		return
+	}
+
+	res, code, err := h.service.GetCart(authPayload.UserID)
+	if err != nil {
+		responses.ErrorJSON(c, code, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	response := responses.SuccessWithDataResponse(toCartResp(res), code, "get cart success")
+	c.IndentedJSON(code, response)
+}
+
+func (h *cartsHandler) addItem(c *gin.Context) {
+	authPayload, isExists := c.Keys["payloadKey"].(*auth.JwtPayload)
+	if !isExists {
+		responses.ErrorJSON(c, 401, []string{"token is wrong"}, c.Request.RemoteAddr)
+		return
+	}
+
+	var reqBody addItemReq
+	err := c.BindJSON(&reqBody)
+	if err != nil {
+		responses.ErrorJSON(c, 422, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+	err = h.validate.Struct(&reqBody)
+	if err != nil {
+		errTranslated := translateError(h.trans, err)
+		responses.ErrorJSON(c, 422, errTranslated, c.Request.RemoteAddr)
+		return
+	}
+
+	arg := carts.AddItemParams{
+		UserID:    authPayload.UserID,
+		ProductID: reqBody.ProductID,
+		Quantity:  reqBody.Quantity,
+	}
+	res, code, err := h.service.AddItem(arg)
+	if err != nil {
+		responses.ErrorJSON(c, code, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	response := responses.SuccessWithDataResponse(toCartItemResp(res), code, "add item to cart success")
+	c.IndentedJSON(code, response)
+}
+
+func (h *cartsHandler) updateItem(c *gin.Context) {
+	authPayload, isExists := c.Keys["payloadKey"].(*auth.JwtPayload)
+	if !isExists {
+		responses.ErrorJSON(c, 401, []string{"token is wrong"}, c.Request.RemoteAddr)
+		return
+	}
+
+	var urlParam cartItemUrlParam
+	if err := c.ShouldBindUri(&urlParam); err != nil {
+		responses.ErrorJSON(c, 422, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	var reqBody updateItemReq
+	err := c.BindJSON(&reqBody)
+	if err != nil {
+		responses.ErrorJSON(c, 422, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+	err = h.validate.Struct(&reqBody)
+	if err != nil {
+		errTranslated := translateError(h.trans, err)
+		responses.ErrorJSON(c, 422, errTranslated, c.Request.RemoteAddr)
+		return
+	}
+
+	arg := carts.UpdateItemParams{
+		UserID:    authPayload.UserID,
+		ProductID: urlParam.ProductID,
+		Quantity:  reqBody.Quantity,
+	}
+	res, code, err := h.service.UpdateItem(arg)
+	if err != nil {
+		responses.ErrorJSON(c, code, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	response := responses.SuccessWithDataResponse(toCartItemResp(res), code, "update cart item success")
+	c.IndentedJSON(code, response)
+}
+
+func (h *cartsHandler) removeItem(c *gin.Context) {
+	authPayload, isExists := c.Keys["payloadKey"].(*auth.JwtPayload)
+	if !isExists {
+		responses.ErrorJSON(c, 401, []string{"token is wrong"}, c.Request.RemoteAddr)
+		return
+	}
+
+	var urlParam cartItemUrlParam
+	if err := c.ShouldBindUri(&urlParam); err != nil {
+		responses.ErrorJSON(c, 422, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	arg := carts.RemoveItemParams{
+		UserID:    authPayload.UserID,
+		ProductID: urlParam.ProductID,
+	}
+	code, err := h.service.RemoveItem(arg)
+	if err != nil {
+		responses.ErrorJSON(c, code, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	response := responses.SuccessResponse("remove cart item success")
+	c.IndentedJSON(code, response)
+}
+
+func (h *cartsHandler) checkout(c *gin.Context) {
+	authPayload, isExists := c.Keys["payloadKey"].(*auth.JwtPayload)
+	if !isExists {
+		responses.ErrorJSON(c, 401, []string{"token is wrong"}, c.Request.RemoteAddr)
+		return
+	}
+
+	var reqQuery checkoutQuery
+	if err := c.ShouldBindQuery(&reqQuery); err != nil {
+		responses.ErrorJSON(c, 422, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+	if err := h.validate.Struct(&reqQuery); err != nil {
+		errTranslated := translateError(h.trans, err)
+		responses.ErrorJSON(c, 422, errTranslated, c.Request.RemoteAddr)
+		return
+	}
+
+	arg := carts.CheckoutParams{
+		UserID:   authPayload.UserID,
+		Currency: reqQuery.Currency,
+	}
+	res, code, err := h.service.Checkout(arg)
+	if err != nil {
+		responses.ErrorJSON(c, code, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	response := responses.SuccessWithDataResponse(toCheckoutResp(res), code, "checkout success")
+	c.IndentedJSON(code, response)
+}
@@ -0,0 +1,20 @@
+package handler
+
+type addItemReq struct {
+	ProductID int32 `json:"product_id" validate:"required,min=1"`
+	Quantity  int32 `json:"quantity" validate:"required,min=1"`
+}
+
+type updateItemReq struct {
+	Quantity int32 `json:"quantity" validate:"required,min=1"`
+}
+
+type cartItemUrlParam struct {
+	ProductID int32 `uri:"product_id" validate:"required,number"`
+}
+
+// checkoutQuery picks the wallet that pays, the one in the currency of the
+// products when Currency is empty.
+type checkoutQuery struct {
+	Currency string `form:"currency" validate:"omitempty,iso4217"`
+}
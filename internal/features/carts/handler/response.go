@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"time"
+
+	carts "github.com/dwiw96/GoCommerceAPI/internal/features/carts"
+	orders "github.com/dwiw96/GoCommerceAPI/internal/features/orders"
+	transactions "github.com/dwiw96/GoCommerceAPI/internal/features/transactions"
+)
+
+type cartItemResp struct {
+	ProductID   int32     `json:"product_id"`
+	ProductName string    `json:"product_name,omitempty"`
+	Price       int32     `json:"price,omitempty"`
+	Quantity    int32     `json:"quantity"`
+	Subtotal    int32     `json:"subtotal,omitempty"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func toCartItemResp(input *carts.CartItem) cartItemResp {
+	return cartItemResp{
+		ProductID: input.ProductID,
+		Quantity:  input.Quantity,
+		UpdatedAt: input.UpdatedAt,
+	}
+}
+
+type cartResp struct {
+	ID          int32          `json:"id"`
+	Items       []cartItemResp `json:"items"`
+	TotalAmount int32          `json:"total_amount"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+}
+
+func toCartResp(input *carts.CartDetail) cartResp {
+	res := cartResp{
+		ID:          input.ID,
+		Items:       []cartItemResp{},
+		TotalAmount: input.TotalAmount,
+		UpdatedAt:   input.UpdatedAt,
+	}
+	for _, item := range input.Items {
+		res.Items = append(res.Items, cartItemResp{
+			ProductID:   item.ProductID,
+			ProductName: item.ProductName,
+			Price:       item.Price,
+			Quantity:    item.Quantity,
+			Subtotal:    item.Subtotal,
+			UpdatedAt:   item.UpdatedAt,
+		})
+	}
+
+	return res
+}
+
+type checkoutTransactionResp struct {
+	ID        int32                          `json:"id"`
+	ProductID int32                          `json:"product_id"`
+	Quantity  int32                          `json:"quantity"`
+	Amount    int32                          `json:"amount"`
+	TStatus   transactions.TransactionStatus `json:"transaction_status"`
+	CreatedAt time.Time                      `json:"created_at"`
+}
+
+type checkoutResp struct {
+	OrderID      int32                     `json:"order_id"`
+	OrderStatus  orders.OrderStatus        `json:"order_status"`
+	WalletID     int32                     `json:"wallet_id"`
+	Balance      int32                     `json:"balance"`
+	TotalAmount  int32                     `json:"total_amount"`
+	Transactions []checkoutTransactionResp `json:"transactions"`
+}
+
+func toCheckoutResp(input *carts.CheckoutResult) checkoutResp {
+	res := checkoutResp{
+		OrderID:     input.Order.ID,
+		OrderStatus: input.Order.Status,
+		WalletID:    input.Wallet.ID,
+		Balance:     input.Wallet.Balance,
+		TotalAmount: input.TotalAmount,
+	}
+	for _, t := range input.Transactions {
+		res.Transactions = append(res.Transactions, checkoutTransactionResp{
+			ID:        t.ID,
+			ProductID: t.ProductID.Int32,
+			Quantity:  t.Quantity.Int32,
+			Amount:    t.Amount,
+			TStatus:   t.TStatus,
+			CreatedAt: t.CreatedAt.Time,
+		})
+	}
+
+	return res
+}
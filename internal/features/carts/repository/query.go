@@ -0,0 +1,417 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	db "github.com/dwiw96/GoCommerceAPI/internal/db"
+	carts "github.com/dwiw96/GoCommerceAPI/internal/features/carts"
+	ledger "github.com/dwiw96/GoCommerceAPI/internal/features/ledger"
+	ledgerRepo "github.com/dwiw96/GoCommerceAPI/internal/features/ledger/repository"
+	orders "github.com/dwiw96/GoCommerceAPI/internal/features/orders"
+	ordersRepo "github.com/dwiw96/GoCommerceAPI/internal/features/orders/repository"
+	products "github.com/dwiw96/GoCommerceAPI/internal/features/products"
+	productsRepo "github.com/dwiw96/GoCommerceAPI/internal/features/products/repository"
+	rates "github.com/dwiw96/GoCommerceAPI/internal/features/rates"
+	ratesRepo "github.com/dwiw96/GoCommerceAPI/internal/features/rates/repository"
+	transactions "github.com/dwiw96/GoCommerceAPI/internal/features/transactions"
+	transactionsRepo "github.com/dwiw96/GoCommerceAPI/internal/features/transactions/repository"
+	wallets "github.com/dwiw96/GoCommerceAPI/internal/features/wallets"
+	walletsRepo "github.com/dwiw96/GoCommerceAPI/internal/features/wallets/repository"
+	errs "github.com/dwiw96/GoCommerceAPI/pkg/utils/responses"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type cartsRepository struct {
+	db               db.DBTX
+	dbTx             *pgxpool.Pool
+	ctx              context.Context
+	productsRepo     products.IRepository
+	walletsRepo      wallets.IRepository
+	transactionsRepo transactions.IRepository
+	ordersRepo       orders.IRepository
+	ledgerRepo       ledger.IRepository
+	ratesRepo        rates.IRepository
+}
+
+func NewCartsRepository(db db.DBTX, dbTx *pgxpool.Pool, ctx context.Context) carts.IRepository {
+	return &cartsRepository{
+		db:   db,
+		dbTx: dbTx,
+		ctx:  ctx,
+	}
+}
+
+func (r *cartsRepository) ExecDbTx(fn func(*cartsRepository) error) error {
+	tx, err := r.dbTx.Begin(r.ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start db transaction, err: %w", err)
+	}
+
+	q := &cartsRepository{
+		db:               tx,
+		ctx:              r.ctx,
+		productsRepo:     productsRepo.NewProductRepository(tx),
+		walletsRepo:      walletsRepo.NewWalletsRepository(tx, r.ctx),
+		transactionsRepo: transactionsRepo.NewTransactionsRepository(tx, nil, r.ctx),
+		ordersRepo:       ordersRepo.NewOrdersRepository(tx, r.ctx),
+		ledgerRepo:       ledgerRepo.NewLedgerRepository(tx, r.ctx),
+		ratesRepo:        ratesRepo.NewRatesRepository(tx, r.ctx),
+	}
+	err = fn(q)
+	if err != nil {
+		tx.Rollback(r.ctx)
+		return err
+	}
+
+	if err = tx.Commit(r.ctx); err != nil {
+		return fmt.Errorf("failed to commit db transaction, err: %w", err)
+	}
+
+	return nil
+}
+
+const getOrCreateCart = `-- name: GetOrCreateCart :one
+INSERT INTO carts(
+    user_id
+) VALUES (
+    $1
+) ON CONFLICT ON CONSTRAINT uq_carts_user_id DO UPDATE
+SET
+    updated_at = carts.updated_at
+RETURNING id, user_id, created_at, updated_at
+`
+
+func (r *cartsRepository) GetOrCreateCart(userID int32) (*carts.Cart, error) {
+	row := r.db.QueryRow(r.ctx, getOrCreateCart, userID)
+	var i carts.Cart
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return &i, err
+}
+
+const addCartItem = `-- name: AddCartItem :one
+INSERT INTO cart_items(
+    cart_id,
+    product_id,
+    quantity
+) VALUES (
+    $1, $2, $3
+) ON CONFLICT ON CONSTRAINT uq_cart_items_cart_id_product_id DO UPDATE
+SET
+    quantity = cart_items.quantity + EXCLUDED.quantity,
+    updated_at = NOW()
+RETURNING id, cart_id, product_id, quantity, created_at, updated_at
+`
+
+func (r *cartsRepository) AddCartItem(arg carts.CartItemParams) (*carts.CartItem, error) {
+	row := r.db.QueryRow(r.ctx, addCartItem, arg.CartID, arg.ProductID, arg.Quantity)
+	var i carts.CartItem
+	err := row.Scan(
+		&i.ID,
+		&i.CartID,
+		&i.ProductID,
+		&i.Quantity,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return &i, err
+}
+
+const updateCartItem = `-- name: UpdateCartItem :one
+UPDATE
+    cart_items
+SET
+    quantity = $1,
+    updated_at = NOW()
+WHERE
+    cart_id = $2
+AND
+    product_id = $3
+RETURNING id, cart_id, product_id, quantity, created_at, updated_at
+`
+
+func (r *cartsRepository) UpdateCartItem(arg carts.CartItemParams) (*carts.CartItem, error) {
+	row := r.db.QueryRow(r.ctx, updateCartItem, arg.Quantity, arg.CartID, arg.ProductID)
+	var i carts.CartItem
+	err := row.Scan(
+		&i.ID,
+		&i.CartID,
+		&i.ProductID,
+		&i.Quantity,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return &i, err
+}
+
+const deleteCartItem = `-- name: DeleteCartItem :exec
+DELETE FROM cart_items WHERE cart_id = $1 AND product_id = $2
+`
+
+func (r *cartsRepository) DeleteCartItem(cartID, productID int32) error {
+	res, err := r.db.Exec(r.ctx, deleteCartItem, cartID, productID)
+	if err != nil {
+		return err
+	}
+
+	if res.RowsAffected() == 0 {
+		return errs.ErrNoData
+	}
+
+	return nil
+}
+
+const listCartItems = `-- name: ListCartItems :many
+SELECT
+    ci.id, ci.cart_id, ci.product_id, ci.quantity, ci.created_at, ci.updated_at,
+    p.name, p.price, p.availability
+FROM
+    cart_items ci
+JOIN
+    products p ON p.id = ci.product_id
+WHERE
+    ci.cart_id = $1
+ORDER BY ci.product_id ASC
+`
+
+func (r *cartsRepository) ListCartItems(cartID int32) ([]carts.CartItemDetail, error) {
+	rows, err := r.db.Query(r.ctx, listCartItems, cartID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []carts.CartItemDetail
+	for rows.Next() {
+		var i carts.CartItemDetail
+		if err := rows.Scan(
+			&i.ID,
+			&i.CartID,
+			&i.ProductID,
+			&i.Quantity,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.ProductName,
+			&i.Price,
+			&i.Availability,
+		); err != nil {
+			return nil, err
+		}
+		i.Subtotal = i.Price * i.Quantity
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const clearCart = `-- name: ClearCart :exec
+DELETE FROM cart_items WHERE cart_id = $1
+`
+
+func (r *cartsRepository) ClearCart(cartID int32) error {
+	_, err := r.db.Exec(r.ctx, clearCart, cartID)
+	return err
+}
+
+// Checkout buys every line of the user's cart in one database transaction.
+// Each line decrements the product availability and is recorded as a
+// completed purchase in transaction_histories, then the wallet is debited
+// by the total and the cart is emptied. Any failure rolls back all lines.
+// The user's wallet in arg.Currency pays for the whole order, or the one in
+// the currency of the products when it's empty. Amounts are converted to the
+// wallet's currency; the item price stays the product's own.
+func (r *cartsRepository) Checkout(arg carts.CheckoutParams) (*carts.CheckoutResult, error) {
+	var res carts.CheckoutResult
+	userID := arg.UserID
+
+	err := r.ExecDbTx(func(tr *cartsRepository) error {
+		cart, err := tr.GetOrCreateCart(userID)
+		if err != nil {
+			return fmt.Errorf("failed to get cart, err: %w", err)
+		}
+
+		items, err := tr.ListCartItems(cart.ID)
+		if err != nil {
+			return fmt.Errorf("failed to list cart items, err: %w", err)
+		}
+		if len(items) == 0 {
+			return errs.ErrEmptyCart
+		}
+
+		// reserve the stock first so the order total is known before the
+		// order row is written. the products are locked before the wallet
+		// like in a purchase, and items are sorted by product id, so
+		// products are always locked in the same order.
+		reserved := make([]*products.Product, 0, len(items))
+		for _, item := range items {
+			locked, err := tr.productsRepo.GetProductByIDForUpdate(tr.ctx, item.ProductID)
+			if err != nil {
+				return fmt.Errorf("failed to get product %d, err: %w", item.ProductID, err)
+			}
+			if locked.Availability < item.Quantity {
+				return errs.ErrInsufficientStock
+			}
+
+			updateProductArg := products.UpdateProductAvailabilityParams{
+				ID:           item.ProductID,
+				Availability: -item.Quantity,
+			}
+			product, err := tr.productsRepo.UpdateProductAvailability(tr.ctx, updateProductArg)
+			if err != nil {
+				return fmt.Errorf("failed to update product %d, err: %w", item.ProductID, err)
+			}
+			reserved = append(reserved, product)
+		}
+
+		currency := arg.Currency
+		if currency == "" {
+			currency, err = cartCurrency(reserved)
+			if err != nil {
+				return err
+			}
+		}
+		wallet, err := tr.lockUserWallet(userID, currency)
+		if err != nil {
+			return err
+		}
+
+		var (
+			lines       []orders.CreateOrderItemParams
+			conversions []rates.Conversion
+		)
+		for i, item := range items {
+			product := reserved[i]
+			conversion, err := tr.ratesRepo.ConvertAmount(rates.ConvertParams{
+				Amount: product.Price * item.Quantity,
+				From:   product.Currency,
+				To:     wallet.Currency,
+			})
+			if err != nil {
+				return err
+			}
+
+			lines = append(lines, orders.CreateOrderItemParams{
+				ProductID: item.ProductID,
+				Quantity:  item.Quantity,
+				Price:     product.Price,
+				Amount:    conversion.Amount,
+			})
+			conversions = append(conversions, *conversion)
+			res.TotalAmount += conversion.Amount
+		}
+
+		createOrderArg := orders.CreateOrderParams{
+			UserID:      userID,
+			Status:      orders.OrderStatusCreated,
+			TotalAmount: res.TotalAmount,
+		}
+		order, err := tr.ordersRepo.CreateOrder(createOrderArg)
+		if err != nil {
+			return fmt.Errorf("failed to create order, err: %w", err)
+		}
+
+		for i, line := range lines {
+			line.OrderID = order.ID
+			orderItem, err := tr.ordersRepo.CreateOrderItem(line)
+			if err != nil {
+				return fmt.Errorf("failed to create order item, err: %w", err)
+			}
+			res.Items = append(res.Items, *orderItem)
+
+			createTransactionArg := transactions.CreateTransactionParams{
+				FromWalletID: pgtype.Int4{Int32: wallet.ID, Valid: true},
+				ProductID:    pgtype.Int4{Int32: line.ProductID, Valid: true},
+				Amount:       line.Amount,
+				Quantity:     pgtype.Int4{Int32: line.Quantity, Valid: true},
+				TType:        transactions.TransactionTypesPurchase,
+				TStatus:      transactions.TransactionStatusCompleted,
+				OrderID:      pgtype.Int4{Int32: order.ID, Valid: true},
+				ExchangeRate: conversions[i].Rate,
+			}
+			if conversions[i].Rate.Valid {
+				createTransactionArg.ConvertedAmount = pgtype.Int4{Int32: line.Price * line.Quantity, Valid: true}
+			}
+			history, err := tr.transactionsRepo.CreateTransaction(createTransactionArg)
+			if err != nil {
+				return fmt.Errorf("failed to create transaction, err: %w", err)
+			}
+			_, err = tr.ledgerRepo.PostTransaction(*history)
+			if err != nil {
+				return fmt.Errorf("failed to post transaction to ledger, err: %w", err)
+			}
+			res.Transactions = append(res.Transactions, *history)
+		}
+
+		if wallet.Balance < res.TotalAmount {
+			return errs.ErrInsufficientBalance
+		}
+
+		updateWalletArg := wallets.UpdateWalletParams{
+			Amount:   -res.TotalAmount,
+			WalletID: wallet.ID,
+		}
+		res.Wallet, err = tr.walletsRepo.UpdateWalletByID(updateWalletArg)
+		if err != nil {
+			return fmt.Errorf("failed to update wallet, err: %w", err)
+		}
+
+		updateOrderArg := orders.UpdateOrderStatusParams{
+			ID:         order.ID,
+			FromStatus: orders.OrderStatusCreated,
+			ToStatus:   orders.OrderStatusPaid,
+		}
+		res.Order, err = tr.ordersRepo.UpdateOrderStatus(updateOrderArg)
+		if err != nil {
+			return fmt.Errorf("failed to update order status, err: %w", err)
+		}
+
+		err = tr.ClearCart(cart.ID)
+		if err != nil {
+			return fmt.Errorf("failed to clear cart, err: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+// cartCurrency is the currency every product in the cart is priced in, a
+// cart mixing currencies has to be paid with a wallet picked by the user.
+func cartCurrency(items []*products.Product) (string, error) {
+	currency := items[0].Currency
+	for _, item := range items[1:] {
+		if item.Currency != currency {
+			return "", errs.ErrCartCurrencyRequired
+		}
+	}
+
+	return currency, nil
+}
+
+// lockUserWallet locks the user's wallet in currency until the surrounding db
+// transaction ends.
+func (r *cartsRepository) lockUserWallet(userID int32, currency string) (*wallets.Wallet, error) {
+	wallet, err := r.walletsRepo.GetWalletByUserIDAndCurrency(userID, currency)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s wallet, err: %w", currency, err)
+	}
+
+	wallet, err = r.walletsRepo.GetWalletByIDForUpdate(wallet.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock wallet, err: %w", err)
+	}
+
+	return wallet, nil
+}
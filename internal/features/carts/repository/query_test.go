@@ -0,0 +1,435 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	auth "github.com/dwiw96/GoCommerceAPI/internal/features/auth"
+	authRepo "github.com/dwiw96/GoCommerceAPI/internal/features/auth/repository"
+	carts "github.com/dwiw96/GoCommerceAPI/internal/features/carts"
+	orders "github.com/dwiw96/GoCommerceAPI/internal/features/orders"
+	products "github.com/dwiw96/GoCommerceAPI/internal/features/products"
+	productsRepo "github.com/dwiw96/GoCommerceAPI/internal/features/products/repository"
+	transactions "github.com/dwiw96/GoCommerceAPI/internal/features/transactions"
+	wallets "github.com/dwiw96/GoCommerceAPI/internal/features/wallets"
+	walletsRepo "github.com/dwiw96/GoCommerceAPI/internal/features/wallets/repository"
+	testUtils "github.com/dwiw96/GoCommerceAPI/testutils"
+
+	generator "github.com/dwiw96/GoCommerceAPI/pkg/utils/generator"
+	errs "github.com/dwiw96/GoCommerceAPI/pkg/utils/responses"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	repoTest        carts.IRepository
+	ctx             context.Context
+	pool            *pgxpool.Pool
+	productRepoTest products.IRepository
+	walletRepoTest  wallets.IRepository
+	authRepoTest    auth.IRepository
+)
+
+func TestMain(m *testing.M) {
+	pool = testUtils.GetPool()
+	defer pool.Close()
+	ctx = testUtils.GetContext()
+	defer ctx.Done()
+
+	schemaCleanup := testUtils.SetupDB("test_repo_carts")
+
+	authRepoTest = authRepo.NewAuthRepository(pool, pool)
+	productRepoTest = productsRepo.NewProductRepository(pool)
+	walletRepoTest = walletsRepo.NewWalletsRepository(pool, ctx)
+	repoTest = NewCartsRepository(pool, pool, ctx)
+
+	exitTest := m.Run()
+
+	schemaCleanup()
+
+	os.Exit(exitTest)
+}
+
+func createRandomUser(t *testing.T) (res *auth.User) {
+	username := generator.CreateRandomString(generator.RandomInt(3, 13))
+	arg := auth.CreateUserParams{
+		Username:       username,
+		Email:          generator.CreateRandomEmail(username),
+		HashedPassword: generator.CreateRandomString(generator.RandomInt(20, 20)),
+	}
+
+	res, err := authRepoTest.CreateUser(ctx, arg)
+	require.NoError(t, err)
+	assert.NotZero(t, res.ID)
+
+	return res
+}
+
+func createWalletTest(t *testing.T, user *auth.User, balance int32) (res *wallets.Wallet) {
+	arg := wallets.CreateWalletParams{
+		UserID:  user.ID,
+		Balance: balance,
+	}
+
+	res, err := walletRepoTest.CreateWallet(arg)
+	require.NoError(t, err)
+	assert.NotZero(t, res.ID)
+
+	return res
+}
+
+func createProductTest(t *testing.T, price, availability int32) (res *products.Product) {
+	arg := products.CreateProductParams{
+		Name:         generator.CreateRandomString(7),
+		Description:  generator.CreateRandomString(50),
+		Price:        price,
+		Availability: availability,
+	}
+
+	res, err := productRepoTest.CreateProduct(ctx, arg)
+	require.NoError(t, err)
+	assert.NotZero(t, res.ID)
+
+	return res
+}
+
+func createProductInCurrencyTest(t *testing.T, price, availability int32, currency string) (res *products.Product) {
+	arg := products.CreateProductParams{
+		Name:         generator.CreateRandomString(7),
+		Description:  generator.CreateRandomString(50),
+		Price:        price,
+		Availability: availability,
+		Currency:     currency,
+	}
+
+	res, err := productRepoTest.CreateProduct(ctx, arg)
+	require.NoError(t, err)
+	assert.NotZero(t, res.ID)
+
+	return res
+}
+
+func createCartItemTest(t *testing.T, cartID, productID, quantity int32) (res *carts.CartItem) {
+	arg := carts.CartItemParams{
+		CartID:    cartID,
+		ProductID: productID,
+		Quantity:  quantity,
+	}
+
+	res, err := repoTest.AddCartItem(arg)
+	require.NoError(t, err)
+	assert.NotZero(t, res.ID)
+
+	return res
+}
+
+func TestGetOrCreateCart(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user := createRandomUser(t)
+
+	res1, err := repoTest.GetOrCreateCart(user.ID)
+	require.NoError(t, err)
+	assert.NotZero(t, res1.ID)
+	assert.Equal(t, user.ID, res1.UserID)
+	assert.False(t, res1.CreatedAt.IsZero())
+
+	res2, err := repoTest.GetOrCreateCart(user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, res1.ID, res2.ID)
+
+	_, err = repoTest.GetOrCreateCart(user.ID + 5)
+	require.Error(t, err)
+}
+
+func TestAddCartItem(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user := createRandomUser(t)
+	product := createProductTest(t, 20, 50)
+	cart, err := repoTest.GetOrCreateCart(user.ID)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		desc  string
+		arg   carts.CartItemParams
+		ans   int32
+		isErr bool
+	}{
+		{
+			desc: "success_new_item",
+			arg: carts.CartItemParams{
+				CartID:    cart.ID,
+				ProductID: product.ID,
+				Quantity:  2,
+			},
+			ans:   2,
+			isErr: false,
+		}, {
+			desc: "success_merge_quantity",
+			arg: carts.CartItemParams{
+				CartID:    cart.ID,
+				ProductID: product.ID,
+				Quantity:  3,
+			},
+			ans:   5,
+			isErr: false,
+		}, {
+			desc: "failed_zero_quantity",
+			arg: carts.CartItemParams{
+				CartID:    cart.ID,
+				ProductID: product.ID,
+				Quantity:  0,
+			},
+			isErr: true,
+		}, {
+			desc: "failed_wrong_product_id",
+			arg: carts.CartItemParams{
+				CartID:    cart.ID,
+				ProductID: product.ID + 5,
+				Quantity:  1,
+			},
+			isErr: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			res, err := repoTest.AddCartItem(tC.arg)
+			if !tC.isErr {
+				require.NoError(t, err)
+				assert.Equal(t, tC.arg.CartID, res.CartID)
+				assert.Equal(t, tC.arg.ProductID, res.ProductID)
+				assert.Equal(t, tC.ans, res.Quantity)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestUpdateCartItem(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user := createRandomUser(t)
+	product := createProductTest(t, 20, 50)
+	cart, err := repoTest.GetOrCreateCart(user.ID)
+	require.NoError(t, err)
+	createCartItemTest(t, cart.ID, product.ID, 2)
+
+	res, err := repoTest.UpdateCartItem(carts.CartItemParams{CartID: cart.ID, ProductID: product.ID, Quantity: 7})
+	require.NoError(t, err)
+	assert.Equal(t, int32(7), res.Quantity)
+
+	_, err = repoTest.UpdateCartItem(carts.CartItemParams{CartID: cart.ID, ProductID: product.ID + 5, Quantity: 7})
+	require.Error(t, err)
+}
+
+func TestDeleteCartItem(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user := createRandomUser(t)
+	product := createProductTest(t, 20, 50)
+	cart, err := repoTest.GetOrCreateCart(user.ID)
+	require.NoError(t, err)
+	createCartItemTest(t, cart.ID, product.ID, 2)
+
+	err = repoTest.DeleteCartItem(cart.ID, product.ID)
+	require.NoError(t, err)
+
+	err = repoTest.DeleteCartItem(cart.ID, product.ID)
+	require.ErrorIs(t, err, errs.ErrNoData)
+}
+
+func TestListCartItems(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user := createRandomUser(t)
+	product1 := createProductTest(t, 20, 50)
+	product2 := createProductTest(t, 35, 50)
+	cart, err := repoTest.GetOrCreateCart(user.ID)
+	require.NoError(t, err)
+
+	res, err := repoTest.ListCartItems(cart.ID)
+	require.NoError(t, err)
+	assert.Empty(t, res)
+
+	createCartItemTest(t, cart.ID, product1.ID, 2)
+	createCartItemTest(t, cart.ID, product2.ID, 3)
+
+	res, err = repoTest.ListCartItems(cart.ID)
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	assert.Equal(t, product1.ID, res[0].ProductID)
+	assert.Equal(t, product1.Name, res[0].ProductName)
+	assert.Equal(t, product1.Price*2, res[0].Subtotal)
+	assert.Equal(t, product2.ID, res[1].ProductID)
+	assert.Equal(t, product2.Price*3, res[1].Subtotal)
+}
+
+func TestCheckout(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	t.Run("success", func(t *testing.T) {
+		user := createRandomUser(t)
+		wallet := createWalletTest(t, user, 1000)
+		product1 := createProductTest(t, 20, 50)
+		product2 := createProductTest(t, 35, 10)
+		cart, err := repoTest.GetOrCreateCart(user.ID)
+		require.NoError(t, err)
+		createCartItemTest(t, cart.ID, product1.ID, 2)
+		createCartItemTest(t, cart.ID, product2.ID, 3)
+
+		total := product1.Price*2 + product2.Price*3
+
+		res, err := repoTest.Checkout(carts.CheckoutParams{UserID: user.ID})
+		require.NoError(t, err)
+		assert.Equal(t, total, res.TotalAmount)
+		assert.Equal(t, wallet.Balance-total, res.Wallet.Balance)
+		require.NotNil(t, res.Order)
+		assert.Equal(t, user.ID, res.Order.UserID)
+		assert.Equal(t, orders.OrderStatusPaid, res.Order.Status)
+		assert.Equal(t, total, res.Order.TotalAmount)
+		require.Len(t, res.Items, 2)
+		require.Len(t, res.Transactions, 2)
+		for _, history := range res.Transactions {
+			assert.Equal(t, wallet.ID, history.FromWalletID.Int32)
+			assert.Equal(t, transactions.TransactionTypesPurchase, history.TType)
+			assert.Equal(t, transactions.TransactionStatusCompleted, history.TStatus)
+			assert.Equal(t, res.Order.ID, history.OrderID.Int32)
+		}
+
+		resProduct1, err := productRepoTest.GetProductByID(ctx, product1.ID)
+		require.NoError(t, err)
+		assert.Equal(t, product1.Availability-2, resProduct1.Availability)
+		resProduct2, err := productRepoTest.GetProductByID(ctx, product2.ID)
+		require.NoError(t, err)
+		assert.Equal(t, product2.Availability-3, resProduct2.Availability)
+
+		items, err := repoTest.ListCartItems(cart.ID)
+		require.NoError(t, err)
+		assert.Empty(t, items)
+	})
+
+	t.Run("success_wallet_in_cart_currency", func(t *testing.T) {
+		user := createRandomUser(t)
+		idrWallet := createWalletTest(t, user, 1000)
+		usdWallet, err := walletRepoTest.CreateWallet(wallets.CreateWalletParams{UserID: user.ID, Balance: 1000, Currency: "USD"})
+		require.NoError(t, err)
+		product := createProductInCurrencyTest(t, 20, 50, "USD")
+		cart, err := repoTest.GetOrCreateCart(user.ID)
+		require.NoError(t, err)
+		createCartItemTest(t, cart.ID, product.ID, 2)
+
+		// the first wallet is in IDR, the USD one pays without a conversion
+		res, err := repoTest.Checkout(carts.CheckoutParams{UserID: user.ID})
+		require.NoError(t, err)
+		assert.Equal(t, usdWallet.ID, res.Wallet.ID)
+		assert.Equal(t, usdWallet.Balance-product.Price*2, res.Wallet.Balance)
+		require.Len(t, res.Transactions, 1)
+		assert.Equal(t, usdWallet.ID, res.Transactions[0].FromWalletID.Int32)
+		assert.False(t, res.Transactions[0].ExchangeRate.Valid)
+
+		resWallet, err := walletRepoTest.GetWalletByID(idrWallet.ID)
+		require.NoError(t, err)
+		assert.Equal(t, idrWallet.Balance, resWallet.Balance)
+	})
+
+	t.Run("failed_mixed_currencies", func(t *testing.T) {
+		user := createRandomUser(t)
+		wallet := createWalletTest(t, user, 1000)
+		_, err := walletRepoTest.CreateWallet(wallets.CreateWalletParams{UserID: user.ID, Balance: 1000, Currency: "USD"})
+		require.NoError(t, err)
+		product1 := createProductTest(t, 20, 50)
+		product2 := createProductInCurrencyTest(t, 20, 50, "USD")
+		cart, err := repoTest.GetOrCreateCart(user.ID)
+		require.NoError(t, err)
+		createCartItemTest(t, cart.ID, product1.ID, 1)
+		createCartItemTest(t, cart.ID, product2.ID, 1)
+
+		_, err = repoTest.Checkout(carts.CheckoutParams{UserID: user.ID})
+		require.ErrorIs(t, err, errs.ErrCartCurrencyRequired)
+
+		resProduct1, err := productRepoTest.GetProductByID(ctx, product1.ID)
+		require.NoError(t, err)
+		assert.Equal(t, product1.Availability, resProduct1.Availability)
+		resWallet, err := walletRepoTest.GetWalletByID(wallet.ID)
+		require.NoError(t, err)
+		assert.Equal(t, wallet.Balance, resWallet.Balance)
+	})
+
+	t.Run("failed_no_wallet_in_currency", func(t *testing.T) {
+		user := createRandomUser(t)
+		createWalletTest(t, user, 1000)
+		product := createProductTest(t, 20, 50)
+		cart, err := repoTest.GetOrCreateCart(user.ID)
+		require.NoError(t, err)
+		createCartItemTest(t, cart.ID, product.ID, 1)
+
+		_, err = repoTest.Checkout(carts.CheckoutParams{UserID: user.ID, Currency: "USD"})
+		require.ErrorIs(t, err, pgx.ErrNoRows)
+	})
+
+	t.Run("failed_empty_cart", func(t *testing.T) {
+		user := createRandomUser(t)
+		createWalletTest(t, user, 1000)
+
+		_, err := repoTest.Checkout(carts.CheckoutParams{UserID: user.ID})
+		require.ErrorIs(t, err, errs.ErrEmptyCart)
+	})
+
+	t.Run("failed_insufficient_stock_rollback", func(t *testing.T) {
+		user := createRandomUser(t)
+		wallet := createWalletTest(t, user, 1000)
+		product1 := createProductTest(t, 20, 50)
+		product2 := createProductTest(t, 35, 1)
+		cart, err := repoTest.GetOrCreateCart(user.ID)
+		require.NoError(t, err)
+		createCartItemTest(t, cart.ID, product1.ID, 2)
+		createCartItemTest(t, cart.ID, product2.ID, 3)
+
+		_, err = repoTest.Checkout(carts.CheckoutParams{UserID: user.ID})
+		require.Error(t, err)
+
+		resProduct1, err := productRepoTest.GetProductByID(ctx, product1.ID)
+		require.NoError(t, err)
+		assert.Equal(t, product1.Availability, resProduct1.Availability)
+
+		resWallet, err := walletRepoTest.GetWalletByUserID(user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, wallet.Balance, resWallet.Balance)
+
+		items, err := repoTest.ListCartItems(cart.ID)
+		require.NoError(t, err)
+		assert.Len(t, items, 2)
+	})
+
+	t.Run("failed_insufficient_balance_rollback", func(t *testing.T) {
+		user := createRandomUser(t)
+		wallet := createWalletTest(t, user, 10)
+		product := createProductTest(t, 20, 50)
+		cart, err := repoTest.GetOrCreateCart(user.ID)
+		require.NoError(t, err)
+		createCartItemTest(t, cart.ID, product.ID, 2)
+
+		_, err = repoTest.Checkout(carts.CheckoutParams{UserID: user.ID})
+		require.Error(t, err)
+
+		resProduct, err := productRepoTest.GetProductByID(ctx, product.ID)
+		require.NoError(t, err)
+		assert.Equal(t, product.Availability, resProduct.Availability)
+
+		resWallet, err := walletRepoTest.GetWalletByUserID(user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, wallet.Balance, resWallet.Balance)
+	})
+}
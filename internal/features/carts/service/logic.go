@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	carts "github.com/dwiw96/GoCommerceAPI/internal/features/carts"
+	errs "github.com/dwiw96/GoCommerceAPI/pkg/utils/responses"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type cartsService struct {
+	ctx  context.Context
+	repo carts.IRepository
+}
+
+func NewCartsService(ctx context.Context, repo carts.IRepository) carts.IService {
+	return &cartsService{
+		ctx:  ctx,
+		repo: repo,
+	}
+}
+
+func handleError(arg error) (code int, err error) {
+	if errors.Is(arg, pgx.ErrNoRows) || errors.Is(arg, errs.ErrNoData) {
+		return errs.CodeFailedUser, errs.ErrNoData
+	}
+	for _, userErr := range []error{
+		errs.ErrEmptyCart,
+		errs.ErrCartCurrencyRequired,
+		errs.ErrInsufficientBalance,
+		errs.ErrInsufficientStock,
+		errs.ErrRateNotFound,
+		errs.ErrAmountTooSmall,
+	} {
+		if errors.Is(arg, userErr) {
+			return errs.CodeFailedUser, userErr
+		}
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(arg, &pgErr) {
+		switch pgErr.Code {
+		case "23505": // UNIQUE violation
+			return errs.CodeFailedDuplicated, errs.ErrDuplicate
+		case "23514": // CHECK violation
+			if pgErr.ConstraintName == "ck_wallets_balance" {
+				return errs.CodeFailedUser, errs.ErrInsufficientBalance
+			}
+			if pgErr.ConstraintName == "ck_products_availability" {
+				return errs.CodeFailedUser, errs.ErrInsufficientStock
+			}
+			return errs.CodeFailedUser, errs.ErrCheckConstraint
+		case "23502": // NOT NULL violation
+			return errs.CodeFailedUser, errs.ErrNotNull
+		case "23503": // Foreign Key violation
+			return errs.CodeFailedUser, errs.ErrViolation
+		}
+	}
+
+	return errs.CodeFailedServer, fmt.Errorf("database error occurred")
+}
+
+func (s *cartsService) GetCart(userID int32) (res *carts.CartDetail, code int, err error) {
+	cart, err := s.repo.GetOrCreateCart(userID)
+	if err != nil {
+		code, err = handleError(err)
+		return nil, code, err
+	}
+
+	items, err := s.repo.ListCartItems(cart.ID)
+	if err != nil {
+		code, err = handleError(err)
+		return nil, code, err
+	}
+
+	res = &carts.CartDetail{
+		Cart:  *cart,
+		Items: items,
+	}
+	for _, item := range items {
+		res.TotalAmount += item.Subtotal
+	}
+
+	return res, errs.CodeSuccess, nil
+}
+
+func (s *cartsService) AddItem(arg carts.AddItemParams) (res *carts.CartItem, code int, err error) {
+	if arg.Quantity <= 0 {
+		return nil, errs.CodeFailedUser, errs.ErrInvalidInput
+	}
+
+	cart, err := s.repo.GetOrCreateCart(arg.UserID)
+	if err != nil {
+		code, err = handleError(err)
+		return nil, code, err
+	}
+
+	itemArg := carts.CartItemParams{
+		CartID:    cart.ID,
+		ProductID: arg.ProductID,
+		Quantity:  arg.Quantity,
+	}
+	res, err = s.repo.AddCartItem(itemArg)
+	if err != nil {
+		code, err = handleError(err)
+		return nil, code, err
+	}
+
+	return res, errs.CodeSuccessCreate, nil
+}
+
+func (s *cartsService) UpdateItem(arg carts.UpdateItemParams) (res *carts.CartItem, code int, err error) {
+	if arg.Quantity <= 0 {
+		return nil, errs.CodeFailedUser, errs.ErrInvalidInput
+	}
+
+	cart, err := s.repo.GetOrCreateCart(arg.UserID)
+	if err != nil {
+		code, err = handleError(err)
+		return nil, code, err
+	}
+
+	itemArg := carts.CartItemParams{
+		CartID:    cart.ID,
+		ProductID: arg.ProductID,
+		Quantity:  arg.Quantity,
+	}
+	res, err = s.repo.UpdateCartItem(itemArg)
+	if err != nil {
+		code, err = handleError(err)
+		return nil, code, err
+	}
+
+	return res, errs.CodeSuccess, nil
+}
+
+func (s *cartsService) RemoveItem(arg carts.RemoveItemParams) (code int, err error) {
+	cart, err := s.repo.GetOrCreateCart(arg.UserID)
+	if err != nil {
+		return handleError(err)
+	}
+
+	err = s.repo.DeleteCartItem(cart.ID, arg.ProductID)
+	if err != nil {
+		return handleError(err)
+	}
+
+	return errs.CodeSuccess, nil
+}
+
+func (s *cartsService) Checkout(arg carts.CheckoutParams) (res *carts.CheckoutResult, code int, err error) {
+	res, err = s.repo.Checkout(arg)
+	if err != nil {
+		code, err = handleError(err)
+		return nil, code, err
+	}
+
+	return res, errs.CodeSuccess, nil
+}
@@ -0,0 +1,280 @@
+package service
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	auth "github.com/dwiw96/GoCommerceAPI/internal/features/auth"
+	authRepo "github.com/dwiw96/GoCommerceAPI/internal/features/auth/repository"
+	carts "github.com/dwiw96/GoCommerceAPI/internal/features/carts"
+	cartsRepo "github.com/dwiw96/GoCommerceAPI/internal/features/carts/repository"
+	orders "github.com/dwiw96/GoCommerceAPI/internal/features/orders"
+	products "github.com/dwiw96/GoCommerceAPI/internal/features/products"
+	productsRepo "github.com/dwiw96/GoCommerceAPI/internal/features/products/repository"
+	wallets "github.com/dwiw96/GoCommerceAPI/internal/features/wallets"
+	walletsRepo "github.com/dwiw96/GoCommerceAPI/internal/features/wallets/repository"
+	testUtils "github.com/dwiw96/GoCommerceAPI/testutils"
+
+	generator "github.com/dwiw96/GoCommerceAPI/pkg/utils/generator"
+	errs "github.com/dwiw96/GoCommerceAPI/pkg/utils/responses"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	serviceTest     carts.IService
+	repoTest        carts.IRepository
+	ctx             context.Context
+	pool            *pgxpool.Pool
+	productRepoTest products.IRepository
+	walletRepoTest  wallets.IRepository
+	authRepoTest    auth.IRepository
+)
+
+func TestMain(m *testing.M) {
+	pool = testUtils.GetPool()
+	defer pool.Close()
+	ctx = testUtils.GetContext()
+	defer ctx.Done()
+
+	schemaCleanup := testUtils.SetupDB("test_service_carts")
+
+	authRepoTest = authRepo.NewAuthRepository(pool, pool)
+	productRepoTest = productsRepo.NewProductRepository(pool)
+	walletRepoTest = walletsRepo.NewWalletsRepository(pool, ctx)
+	repoTest = cartsRepo.NewCartsRepository(pool, pool, ctx)
+	serviceTest = NewCartsService(ctx, repoTest)
+
+	exitTest := m.Run()
+
+	schemaCleanup()
+
+	os.Exit(exitTest)
+}
+
+func createRandomUser(t *testing.T) (res *auth.User) {
+	username := generator.CreateRandomString(generator.RandomInt(3, 13))
+	arg := auth.CreateUserParams{
+		Username:       username,
+		Email:          generator.CreateRandomEmail(username),
+		HashedPassword: generator.CreateRandomString(generator.RandomInt(20, 20)),
+	}
+
+	res, err := authRepoTest.CreateUser(ctx, arg)
+	require.NoError(t, err)
+	assert.NotZero(t, res.ID)
+
+	return res
+}
+
+func createWalletTest(t *testing.T, user *auth.User, balance int32) (res *wallets.Wallet) {
+	arg := wallets.CreateWalletParams{
+		UserID:  user.ID,
+		Balance: balance,
+	}
+
+	res, err := walletRepoTest.CreateWallet(arg)
+	require.NoError(t, err)
+	assert.NotZero(t, res.ID)
+
+	return res
+}
+
+func createProductTest(t *testing.T, price, availability int32) (res *products.Product) {
+	arg := products.CreateProductParams{
+		Name:         generator.CreateRandomString(7),
+		Description:  generator.CreateRandomString(50),
+		Price:        price,
+		Availability: availability,
+	}
+
+	res, err := productRepoTest.CreateProduct(ctx, arg)
+	require.NoError(t, err)
+	assert.NotZero(t, res.ID)
+
+	return res
+}
+
+func TestGetCart(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user := createRandomUser(t)
+	product := createProductTest(t, 20, 50)
+
+	res, code, err := serviceTest.GetCart(user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, errs.CodeSuccess, code)
+	assert.Empty(t, res.Items)
+	assert.Zero(t, res.TotalAmount)
+
+	_, _, err = serviceTest.AddItem(carts.AddItemParams{UserID: user.ID, ProductID: product.ID, Quantity: 3})
+	require.NoError(t, err)
+
+	res, code, err = serviceTest.GetCart(user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, errs.CodeSuccess, code)
+	require.Len(t, res.Items, 1)
+	assert.Equal(t, product.Price*3, res.TotalAmount)
+}
+
+func TestAddItem(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user := createRandomUser(t)
+	product := createProductTest(t, 20, 50)
+
+	testCases := []struct {
+		desc  string
+		arg   carts.AddItemParams
+		code  int
+		err   error
+		isErr bool
+	}{
+		{
+			desc: "success",
+			arg: carts.AddItemParams{
+				UserID:    user.ID,
+				ProductID: product.ID,
+				Quantity:  2,
+			},
+			code:  errs.CodeSuccessCreate,
+			isErr: false,
+		}, {
+			desc: "failed_zero_quantity",
+			arg: carts.AddItemParams{
+				UserID:    user.ID,
+				ProductID: product.ID,
+				Quantity:  0,
+			},
+			code:  errs.CodeFailedUser,
+			err:   errs.ErrInvalidInput,
+			isErr: true,
+		}, {
+			desc: "failed_wrong_product_id",
+			arg: carts.AddItemParams{
+				UserID:    user.ID,
+				ProductID: product.ID + 5,
+				Quantity:  1,
+			},
+			code:  errs.CodeFailedUser,
+			err:   errs.ErrViolation,
+			isErr: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			res, code, err := serviceTest.AddItem(tC.arg)
+			assert.Equal(t, tC.code, code)
+			if !tC.isErr {
+				require.NoError(t, err)
+				assert.Equal(t, tC.arg.ProductID, res.ProductID)
+				assert.Equal(t, tC.arg.Quantity, res.Quantity)
+			} else {
+				require.Error(t, err)
+				assert.Equal(t, tC.err, err)
+			}
+		})
+	}
+}
+
+func TestUpdateItem(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user := createRandomUser(t)
+	product := createProductTest(t, 20, 50)
+	_, _, err = serviceTest.AddItem(carts.AddItemParams{UserID: user.ID, ProductID: product.ID, Quantity: 2})
+	require.NoError(t, err)
+
+	res, code, err := serviceTest.UpdateItem(carts.UpdateItemParams{UserID: user.ID, ProductID: product.ID, Quantity: 9})
+	require.NoError(t, err)
+	assert.Equal(t, errs.CodeSuccess, code)
+	assert.Equal(t, int32(9), res.Quantity)
+
+	_, code, err = serviceTest.UpdateItem(carts.UpdateItemParams{UserID: user.ID, ProductID: product.ID + 5, Quantity: 9})
+	require.Error(t, err)
+	assert.Equal(t, errs.CodeFailedUser, code)
+	assert.Equal(t, errs.ErrNoData, err)
+}
+
+func TestRemoveItem(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user := createRandomUser(t)
+	product := createProductTest(t, 20, 50)
+	_, _, err = serviceTest.AddItem(carts.AddItemParams{UserID: user.ID, ProductID: product.ID, Quantity: 2})
+	require.NoError(t, err)
+
+	code, err := serviceTest.RemoveItem(carts.RemoveItemParams{UserID: user.ID, ProductID: product.ID})
+	require.NoError(t, err)
+	assert.Equal(t, errs.CodeSuccess, code)
+
+	code, err = serviceTest.RemoveItem(carts.RemoveItemParams{UserID: user.ID, ProductID: product.ID})
+	require.Error(t, err)
+	assert.Equal(t, errs.CodeFailedUser, code)
+	assert.Equal(t, errs.ErrNoData, err)
+}
+
+func TestCheckout(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	t.Run("success", func(t *testing.T) {
+		user := createRandomUser(t)
+		wallet := createWalletTest(t, user, 1000)
+		product := createProductTest(t, 20, 50)
+		_, _, err = serviceTest.AddItem(carts.AddItemParams{UserID: user.ID, ProductID: product.ID, Quantity: 4})
+		require.NoError(t, err)
+
+		res, code, err := serviceTest.Checkout(carts.CheckoutParams{UserID: user.ID})
+		require.NoError(t, err)
+		assert.Equal(t, errs.CodeSuccess, code)
+		assert.Equal(t, product.Price*4, res.TotalAmount)
+		assert.Equal(t, wallet.Balance-product.Price*4, res.Wallet.Balance)
+		assert.Len(t, res.Transactions, 1)
+		require.NotNil(t, res.Order)
+		assert.Equal(t, orders.OrderStatusPaid, res.Order.Status)
+	})
+
+	t.Run("failed_empty_cart", func(t *testing.T) {
+		user := createRandomUser(t)
+		createWalletTest(t, user, 1000)
+
+		_, code, err := serviceTest.Checkout(carts.CheckoutParams{UserID: user.ID})
+		require.Error(t, err)
+		assert.Equal(t, errs.CodeFailedUser, code)
+		assert.Equal(t, errs.ErrEmptyCart, err)
+	})
+
+	t.Run("failed_insufficient_stock", func(t *testing.T) {
+		user := createRandomUser(t)
+		createWalletTest(t, user, 1000)
+		product := createProductTest(t, 20, 1)
+		_, _, err = serviceTest.AddItem(carts.AddItemParams{UserID: user.ID, ProductID: product.ID, Quantity: 2})
+		require.NoError(t, err)
+
+		_, code, err := serviceTest.Checkout(carts.CheckoutParams{UserID: user.ID})
+		require.Error(t, err)
+		assert.Equal(t, errs.CodeFailedUser, code)
+		assert.Equal(t, errs.ErrInsufficientStock, err)
+	})
+
+	t.Run("failed_insufficient_balance", func(t *testing.T) {
+		user := createRandomUser(t)
+		createWalletTest(t, user, 10)
+		product := createProductTest(t, 20, 50)
+		_, _, err = serviceTest.AddItem(carts.AddItemParams{UserID: user.ID, ProductID: product.ID, Quantity: 2})
+		require.NoError(t, err)
+
+		_, code, err := serviceTest.Checkout(carts.CheckoutParams{UserID: user.ID})
+		require.Error(t, err)
+		assert.Equal(t, errs.CodeFailedUser, code)
+		assert.Equal(t, errs.ErrInsufficientBalance, err)
+	})
+}
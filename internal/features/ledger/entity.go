@@ -0,0 +1,149 @@
+package ledger
+
+import (
+	"time"
+
+	transactions "github.com/dwiw96/GoCommerceAPI/internal/features/transactions"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Account is one side of the books. Wallet entries carry the wallet id, the
+// other accounts are shared: external is money entering or leaving the
+// system, sales is what was paid for products, opening is the balance a
+// wallet had when it was first put on the ledger, exchange takes one currency
+// in and pays another out on a transfer between currencies.
+type Account string
+
+const (
+	AccountWallet   Account = "wallet"
+	AccountExternal Account = "external"
+	AccountSales    Account = "sales"
+	AccountOpening  Account = "opening"
+	AccountExchange Account = "exchange"
+)
+
+// Side of an entry. A credit raises a wallet's balance and a debit lowers it.
+type Side string
+
+const (
+	SideDebit  Side = "debit"
+	SideCredit Side = "credit"
+)
+
+type Journal struct {
+	ID            int32
+	TransactionID pgtype.Int4
+	Description   string
+	CreatedAt     time.Time
+}
+
+type Entry struct {
+	ID        int32
+	JournalID int32
+	Account   Account
+	WalletID  pgtype.Int4
+	Side      Side
+	Amount    int32
+	CreatedAt time.Time
+}
+
+type Posting struct {
+	Account  Account
+	WalletID pgtype.Int4
+	Side     Side
+	Amount   int32
+}
+
+// PostJournalParams is one balanced set of postings, the debits must add up
+// to the credits.
+type PostJournalParams struct {
+	TransactionID pgtype.Int4
+	Description   string
+	Postings      []Posting
+}
+
+// WalletDrift is a wallet whose balance differs from what the ledger says.
+type WalletDrift struct {
+	WalletID      int32
+	Balance       int32
+	LedgerBalance int32
+}
+
+// UnbalancedJournal is a journal whose debits and credits differ.
+type UnbalancedJournal struct {
+	JournalID int32
+	Debit     int64
+	Credit    int64
+}
+
+func walletPosting(walletID int32, side Side, amount int32) Posting {
+	return Posting{
+		Account:  AccountWallet,
+		WalletID: pgtype.Int4{Int32: walletID, Valid: true},
+		Side:     side,
+		Amount:   amount,
+	}
+}
+
+// TransactionPostings are the postings of a completed transaction, empty when
+// it moves no money. The wallet side must follow transactions.WalletEffect.
+func TransactionPostings(t transactions.TransactionHistory) []Posting {
+	amount := t.Amount
+	// withdrawal amounts are stored negative
+	if amount < 0 {
+		amount = -amount
+	}
+	if amount == 0 {
+		return nil
+	}
+
+	switch t.TType {
+	case transactions.TransactionTypesDeposit:
+		return []Posting{
+			{Account: AccountExternal, Side: SideDebit, Amount: amount},
+			walletPosting(t.ToWalletID.Int32, SideCredit, amount),
+		}
+	case transactions.TransactionTypesWithdrawal:
+		return []Posting{
+			walletPosting(t.FromWalletID.Int32, SideDebit, amount),
+			{Account: AccountExternal, Side: SideCredit, Amount: amount},
+		}
+	case transactions.TransactionTypesPurchase:
+		return []Posting{
+			walletPosting(t.FromWalletID.Int32, SideDebit, amount),
+			{Account: AccountSales, Side: SideCredit, Amount: amount},
+		}
+	case transactions.TransactionTypesTransfer:
+		credited := t.CreditedAmount()
+		if credited == amount {
+			return []Posting{
+				walletPosting(t.FromWalletID.Int32, SideDebit, amount),
+				walletPosting(t.ToWalletID.Int32, SideCredit, amount),
+			}
+		}
+		return []Posting{
+			walletPosting(t.FromWalletID.Int32, SideDebit, amount),
+			{Account: AccountExchange, Side: SideCredit, Amount: amount},
+			{Account: AccountExchange, Side: SideDebit, Amount: credited},
+			walletPosting(t.ToWalletID.Int32, SideCredit, credited),
+		}
+	case transactions.TransactionTypesRefund:
+		return []Posting{
+			{Account: AccountSales, Side: SideDebit, Amount: amount},
+			walletPosting(t.ToWalletID.Int32, SideCredit, amount),
+		}
+	}
+
+	return nil
+}
+
+type IRepository interface {
+	PostJournal(arg PostJournalParams) (*Journal, error)
+	PostTransaction(t transactions.TransactionHistory) (*Journal, error)
+	ListJournalEntries(journalID int32) ([]Entry, error)
+	GetWalletLedgerBalance(walletID int32) (int32, error)
+	GetWalletOpenedAt(walletID int32) (pgtype.Timestamp, error)
+	ListWalletDrift() ([]WalletDrift, error)
+	ListUnbalancedJournals() ([]UnbalancedJournal, error)
+}
@@ -0,0 +1,261 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	db "github.com/dwiw96/GoCommerceAPI/internal/db"
+	ledger "github.com/dwiw96/GoCommerceAPI/internal/features/ledger"
+	transactions "github.com/dwiw96/GoCommerceAPI/internal/features/transactions"
+	errs "github.com/dwiw96/GoCommerceAPI/pkg/utils/responses"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type ledgerRepository struct {
+	db  db.DBTX
+	ctx context.Context
+}
+
+// NewLedgerRepository returns the ledger on top of db. PostJournal writes
+// more than one row, so db should be the db transaction that also changes the
+// wallet balances.
+func NewLedgerRepository(db db.DBTX, ctx context.Context) ledger.IRepository {
+	return &ledgerRepository{
+		db:  db,
+		ctx: ctx,
+	}
+}
+
+const createJournal = `-- name: CreateJournal :one
+INSERT INTO ledger_journals(
+    transaction_id,
+    description
+) VALUES (
+    $1, $2
+) RETURNING id, transaction_id, description, created_at
+`
+
+const createEntry = `-- name: CreateEntry :exec
+INSERT INTO ledger_entries(
+    journal_id,
+    account,
+    wallet_id,
+    side,
+    amount
+) VALUES (
+    $1, $2, $3, $4, $5
+)
+`
+
+func (r *ledgerRepository) PostJournal(arg ledger.PostJournalParams) (*ledger.Journal, error) {
+	var debit, credit int64
+	for _, posting := range arg.Postings {
+		if posting.Amount <= 0 {
+			return nil, fmt.Errorf("failed to post journal, err: %w", errs.ErrLessOrEqualToZero)
+		}
+		switch posting.Side {
+		case ledger.SideDebit:
+			debit += int64(posting.Amount)
+		case ledger.SideCredit:
+			credit += int64(posting.Amount)
+		}
+	}
+	if len(arg.Postings) == 0 || debit != credit {
+		return nil, errs.ErrUnbalancedJournal
+	}
+
+	row := r.db.QueryRow(r.ctx, createJournal, arg.TransactionID, arg.Description)
+	var i ledger.Journal
+	err := row.Scan(
+		&i.ID,
+		&i.TransactionID,
+		&i.Description,
+		&i.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create journal, err: %w", err)
+	}
+
+	for _, posting := range arg.Postings {
+		_, err = r.db.Exec(r.ctx, createEntry,
+			i.ID,
+			posting.Account,
+			posting.WalletID,
+			posting.Side,
+			posting.Amount,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create journal entry, err: %w", err)
+		}
+	}
+
+	return &i, nil
+}
+
+// PostTransaction posts a completed transaction. A transaction that moves no
+// money has nothing to post and returns a nil journal.
+func (r *ledgerRepository) PostTransaction(t transactions.TransactionHistory) (*ledger.Journal, error) {
+	postings := ledger.TransactionPostings(t)
+	if len(postings) == 0 {
+		return nil, nil
+	}
+
+	arg := ledger.PostJournalParams{
+		TransactionID: pgtype.Int4{Int32: t.ID, Valid: true},
+		Description:   string(t.TType),
+		Postings:      postings,
+	}
+
+	return r.PostJournal(arg)
+}
+
+const listJournalEntries = `-- name: ListJournalEntries :many
+SELECT id, journal_id, account, wallet_id, side, amount, created_at FROM ledger_entries
+WHERE journal_id = $1
+ORDER BY id ASC
+`
+
+func (r *ledgerRepository) ListJournalEntries(journalID int32) ([]ledger.Entry, error) {
+	rows, err := r.db.Query(r.ctx, listJournalEntries, journalID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ledger.Entry
+	for rows.Next() {
+		var i ledger.Entry
+		if err := rows.Scan(
+			&i.ID,
+			&i.JournalID,
+			&i.Account,
+			&i.WalletID,
+			&i.Side,
+			&i.Amount,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getWalletLedgerBalance = `-- name: GetWalletLedgerBalance :one
+SELECT
+	COALESCE(SUM(CASE WHEN side = 'credit' THEN amount ELSE -amount END), 0)::INT
+FROM ledger_entries
+WHERE account = 'wallet'
+AND wallet_id = $1;
+`
+
+func (r *ledgerRepository) GetWalletLedgerBalance(walletID int32) (int32, error) {
+	row := r.db.QueryRow(r.ctx, getWalletLedgerBalance, walletID)
+
+	var res int32
+	err := row.Scan(
+		&res,
+	)
+
+	return res, err
+}
+
+// getWalletOpenedAt is when the wallet got its opening balance, NULL when it
+// never had one.
+const getWalletOpenedAt = `-- name: GetWalletOpenedAt :one
+SELECT
+	MIN(j.created_at)
+FROM ledger_journals j
+JOIN ledger_entries e ON e.journal_id = j.id
+WHERE e.wallet_id = $1
+AND EXISTS (
+	SELECT 1 FROM ledger_entries o
+	WHERE o.journal_id = j.id
+	AND o.account = 'opening'
+);
+`
+
+func (r *ledgerRepository) GetWalletOpenedAt(walletID int32) (pgtype.Timestamp, error) {
+	row := r.db.QueryRow(r.ctx, getWalletOpenedAt, walletID)
+
+	var res pgtype.Timestamp
+	err := row.Scan(
+		&res,
+	)
+
+	return res, err
+}
+
+const listWalletDrift = `-- name: ListWalletDrift :many
+SELECT
+	w.id,
+	w.balance,
+	COALESCE(SUM(CASE WHEN e.side = 'credit' THEN e.amount ELSE -e.amount END), 0)::INT AS ledger_balance
+FROM wallets w
+LEFT JOIN ledger_entries e ON e.account = 'wallet' AND e.wallet_id = w.id
+GROUP BY w.id, w.balance
+HAVING w.balance <> COALESCE(SUM(CASE WHEN e.side = 'credit' THEN e.amount ELSE -e.amount END), 0)
+ORDER BY w.id ASC
+`
+
+func (r *ledgerRepository) ListWalletDrift() ([]ledger.WalletDrift, error) {
+	rows, err := r.db.Query(r.ctx, listWalletDrift)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ledger.WalletDrift
+	for rows.Next() {
+		var i ledger.WalletDrift
+		if err := rows.Scan(
+			&i.WalletID,
+			&i.Balance,
+			&i.LedgerBalance,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUnbalancedJournals = `-- name: ListUnbalancedJournals :many
+SELECT
+	journal_id,
+	COALESCE(SUM(amount) FILTER (WHERE side = 'debit'), 0)::BIGINT AS debit,
+	COALESCE(SUM(amount) FILTER (WHERE side = 'credit'), 0)::BIGINT AS credit
+FROM ledger_entries
+GROUP BY journal_id
+HAVING COALESCE(SUM(amount) FILTER (WHERE side = 'debit'), 0) <> COALESCE(SUM(amount) FILTER (WHERE side = 'credit'), 0)
+ORDER BY journal_id ASC
+`
+
+func (r *ledgerRepository) ListUnbalancedJournals() ([]ledger.UnbalancedJournal, error) {
+	rows, err := r.db.Query(r.ctx, listUnbalancedJournals)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ledger.UnbalancedJournal
+	for rows.Next() {
+		var i ledger.UnbalancedJournal
+		if err := rows.Scan(
+			&i.JournalID,
+			&i.Debit,
+			&i.Credit,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
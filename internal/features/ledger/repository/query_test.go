@@ -0,0 +1,220 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	auth "github.com/dwiw96/GoCommerceAPI/internal/features/auth"
+	authRepo "github.com/dwiw96/GoCommerceAPI/internal/features/auth/repository"
+	ledger "github.com/dwiw96/GoCommerceAPI/internal/features/ledger"
+	transactions "github.com/dwiw96/GoCommerceAPI/internal/features/transactions"
+	wallets "github.com/dwiw96/GoCommerceAPI/internal/features/wallets"
+	walletsRepo "github.com/dwiw96/GoCommerceAPI/internal/features/wallets/repository"
+	testUtils "github.com/dwiw96/GoCommerceAPI/testutils"
+
+	generator "github.com/dwiw96/GoCommerceAPI/pkg/utils/generator"
+	errs "github.com/dwiw96/GoCommerceAPI/pkg/utils/responses"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	repoTest       ledger.IRepository
+	ctx            context.Context
+	pool           *pgxpool.Pool
+	authRepoTest   auth.IRepository
+	walletRepoTest wallets.IRepository
+)
+
+func TestMain(m *testing.M) {
+	pool = testUtils.GetPool()
+	defer pool.Close()
+	ctx = testUtils.GetContext()
+	defer ctx.Done()
+
+	schemaCleanup := testUtils.SetupDB("test_repo_ledger")
+
+	authRepoTest = authRepo.NewAuthRepository(pool, pool)
+	walletRepoTest = walletsRepo.NewWalletsRepository(pool, ctx)
+	repoTest = NewLedgerRepository(pool, ctx)
+
+	exitTest := m.Run()
+
+	schemaCleanup()
+
+	os.Exit(exitTest)
+}
+
+func createWalletTest(t *testing.T, balance int32) (res *wallets.Wallet) {
+	username := generator.CreateRandomString(generator.RandomInt(3, 13))
+	userArg := auth.CreateUserParams{
+		Username:       username,
+		Email:          generator.CreateRandomEmail(username),
+		HashedPassword: generator.CreateRandomString(generator.RandomInt(20, 20)),
+	}
+
+	user, err := authRepoTest.CreateUser(ctx, userArg)
+	require.NoError(t, err)
+
+	res, err = walletRepoTest.CreateWallet(wallets.CreateWalletParams{UserID: user.ID, Balance: balance})
+	require.NoError(t, err)
+	assert.NotZero(t, res.ID)
+
+	return res
+}
+
+func TestPostJournal(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	wallet := createWalletTest(t, 0)
+
+	testCases := []struct {
+		desc     string
+		postings []ledger.Posting
+		err      error
+	}{
+		{
+			desc: "success",
+			postings: []ledger.Posting{
+				{Account: ledger.AccountExternal, Side: ledger.SideDebit, Amount: 100},
+				{Account: ledger.AccountWallet, WalletID: pgtype.Int4{Int32: wallet.ID, Valid: true}, Side: ledger.SideCredit, Amount: 100},
+			},
+		}, {
+			desc: "failed_unbalanced",
+			postings: []ledger.Posting{
+				{Account: ledger.AccountExternal, Side: ledger.SideDebit, Amount: 100},
+				{Account: ledger.AccountWallet, WalletID: pgtype.Int4{Int32: wallet.ID, Valid: true}, Side: ledger.SideCredit, Amount: 90},
+			},
+			err: errs.ErrUnbalancedJournal,
+		}, {
+			desc: "failed_zero_amount",
+			postings: []ledger.Posting{
+				{Account: ledger.AccountExternal, Side: ledger.SideDebit, Amount: 0},
+				{Account: ledger.AccountWallet, WalletID: pgtype.Int4{Int32: wallet.ID, Valid: true}, Side: ledger.SideCredit, Amount: 0},
+			},
+			err: errs.ErrLessOrEqualToZero,
+		}, {
+			desc:     "failed_empty",
+			postings: nil,
+			err:      errs.ErrUnbalancedJournal,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			res, err := repoTest.PostJournal(ledger.PostJournalParams{Description: tC.desc, Postings: tC.postings})
+			if tC.err != nil {
+				require.Error(t, err)
+				assert.ErrorIs(t, err, tC.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.NotZero(t, res.ID)
+			assert.Equal(t, tC.desc, res.Description)
+
+			entries, err := repoTest.ListJournalEntries(res.ID)
+			require.NoError(t, err)
+			require.Len(t, entries, len(tC.postings))
+			for i, entry := range entries {
+				assert.Equal(t, tC.postings[i].Account, entry.Account)
+				assert.Equal(t, tC.postings[i].WalletID, entry.WalletID)
+				assert.Equal(t, tC.postings[i].Side, entry.Side)
+				assert.Equal(t, tC.postings[i].Amount, entry.Amount)
+			}
+		})
+	}
+}
+
+func TestWalletLedgerBalanceAndDrift(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	wallet1 := createWalletTest(t, 1000)
+	wallet2 := createWalletTest(t, 0)
+
+	openedAt, err := repoTest.GetWalletOpenedAt(wallet1.ID)
+	require.NoError(t, err)
+	assert.True(t, openedAt.Valid)
+	openedAt, err = repoTest.GetWalletOpenedAt(wallet2.ID)
+	require.NoError(t, err)
+	assert.False(t, openedAt.Valid)
+
+	balance, err := repoTest.GetWalletLedgerBalance(wallet1.ID)
+	require.NoError(t, err)
+	assert.Equal(t, wallet1.Balance, balance)
+
+	transfer := transactions.TransactionHistory{
+		FromWalletID: pgtype.Int4{Int32: wallet1.ID, Valid: true},
+		ToWalletID:   pgtype.Int4{Int32: wallet2.ID, Valid: true},
+		Amount:       300,
+		TType:        transactions.TransactionTypesTransfer,
+	}
+	_, err = repoTest.PostJournal(ledger.PostJournalParams{Description: "transfer", Postings: ledger.TransactionPostings(transfer)})
+	require.NoError(t, err)
+	_, err = walletRepoTest.UpdateWalletByID(wallets.UpdateWalletParams{WalletID: wallet1.ID, Amount: -300})
+	require.NoError(t, err)
+
+	drifts, err := repoTest.ListWalletDrift()
+	require.NoError(t, err)
+	require.Len(t, drifts, 1)
+	assert.Equal(t, wallet2.ID, drifts[0].WalletID)
+	assert.Equal(t, int32(0), drifts[0].Balance)
+	assert.Equal(t, int32(300), drifts[0].LedgerBalance)
+
+	_, err = walletRepoTest.UpdateWalletByID(wallets.UpdateWalletParams{WalletID: wallet2.ID, Amount: 300})
+	require.NoError(t, err)
+
+	drifts, err = repoTest.ListWalletDrift()
+	require.NoError(t, err)
+	assert.Empty(t, drifts)
+
+	unbalanced, err := repoTest.ListUnbalancedJournals()
+	require.NoError(t, err)
+	assert.Empty(t, unbalanced)
+}
+
+func TestTransactionPostings(t *testing.T) {
+	walletA := pgtype.Int4{Int32: 1, Valid: true}
+	walletB := pgtype.Int4{Int32: 2, Valid: true}
+
+	histories := []transactions.TransactionHistory{
+		{TType: transactions.TransactionTypesDeposit, ToWalletID: walletA, Amount: 100},
+		{TType: transactions.TransactionTypesWithdrawal, FromWalletID: walletA, ToWalletID: walletA, Amount: -40},
+		{TType: transactions.TransactionTypesPurchase, FromWalletID: walletA, Amount: 60},
+		{TType: transactions.TransactionTypesTransfer, FromWalletID: walletA, ToWalletID: walletB, Amount: 25},
+		{TType: transactions.TransactionTypesTransfer, FromWalletID: walletA, ToWalletID: walletB, Amount: 25, ExchangeRate: pgtype.Float8{Float64: 0.5, Valid: true}, ConvertedAmount: pgtype.Int4{Int32: 13, Valid: true}},
+		{TType: transactions.TransactionTypesRefund, ToWalletID: walletB, Amount: 10},
+	}
+	for _, history := range histories {
+		t.Run(string(history.TType), func(t *testing.T) {
+			postings := ledger.TransactionPostings(history)
+			require.NotEmpty(t, postings)
+
+			var debit, credit int32
+			balances := map[int32]int32{}
+			for _, posting := range postings {
+				if posting.Side == ledger.SideDebit {
+					debit += posting.Amount
+				} else {
+					credit += posting.Amount
+				}
+				if posting.Account == ledger.AccountWallet {
+					if posting.Side == ledger.SideCredit {
+						balances[posting.WalletID.Int32] += posting.Amount
+					} else {
+						balances[posting.WalletID.Int32] -= posting.Amount
+					}
+				}
+			}
+			assert.Equal(t, debit, credit)
+			for _, walletID := range []int32{walletA.Int32, walletB.Int32} {
+				assert.Equal(t, transactions.WalletEffect(history, walletID), balances[walletID])
+			}
+		})
+	}
+}
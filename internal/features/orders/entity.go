@@ -0,0 +1,114 @@
+package orders
+
+import (
+	"time"
+
+	transactions "github.com/dwiw96/GoCommerceAPI/internal/features/transactions"
+)
+
+type OrderStatus string
+
+const (
+	OrderStatusCreated   OrderStatus = "created"
+	OrderStatusPaid      OrderStatus = "paid"
+	OrderStatusShipped   OrderStatus = "shipped"
+	OrderStatusDelivered OrderStatus = "delivered"
+	OrderStatusCancelled OrderStatus = "cancelled"
+	OrderStatusRefunded  OrderStatus = "refunded"
+)
+
+// orderStatusTransitions lists, for every status, the statuses an order is
+// allowed to move to next. Cancelled and refunded are final.
+var orderStatusTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusCreated:   {OrderStatusPaid, OrderStatusCancelled},
+	OrderStatusPaid:      {OrderStatusShipped, OrderStatusCancelled, OrderStatusRefunded},
+	OrderStatusShipped:   {OrderStatusDelivered, OrderStatusRefunded},
+	OrderStatusDelivered: {OrderStatusRefunded},
+}
+
+// CanTransitionTo reports whether an order in status s may move to next.
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, allowed := range orderStatusTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+
+	return false
+}
+
+type Order struct {
+	ID          int32
+	UserID      int32
+	Status      OrderStatus
+	TotalAmount int32
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+type OrderItem struct {
+	ID        int32
+	OrderID   int32
+	ProductID int32
+	Quantity  int32
+	Price     int32
+	Amount    int32
+	CreatedAt time.Time
+}
+
+// OrderDetail is an order with its lines and the transaction_histories rows
+// that paid for it.
+type OrderDetail struct {
+	Order
+	Items        []OrderItem
+	Transactions []transactions.TransactionHistory
+}
+
+type CreateOrderParams struct {
+	UserID      int32
+	Status      OrderStatus
+	TotalAmount int32
+}
+
+type CreateOrderItemParams struct {
+	OrderID   int32
+	ProductID int32
+	Quantity  int32
+	Price     int32
+	Amount    int32
+}
+
+type GetOrderParams struct {
+	ID     int32
+	UserID int32
+	// AnyUser skips the UserID check, staff handle the orders of every user.
+	AnyUser bool
+}
+
+type ListOrdersParams struct {
+	UserID int32
+	Limit  int32
+	Offset int32
+}
+
+type UpdateOrderStatusParams struct {
+	ID         int32
+	FromStatus OrderStatus
+	ToStatus   OrderStatus
+}
+
+type IRepository interface {
+	CreateOrder(arg CreateOrderParams) (*Order, error)
+	CreateOrderItem(arg CreateOrderItemParams) (*OrderItem, error)
+	GetOrderByID(arg GetOrderParams) (*Order, error)
+	ListOrders(arg ListOrdersParams) ([]Order, error)
+	GetTotalOrders(userID int32) (int, error)
+	ListOrderItems(orderID int32) ([]OrderItem, error)
+	UpdateOrderStatus(arg UpdateOrderStatusParams) (*Order, error)
+}
+
+type IService interface {
+	ListOrders(userID int32, page, limit string) (res []Order, currentPage, totalPages int, code int, err error)
+	GetOrder(arg GetOrderParams) (res *OrderDetail, code int, err error)
+	UpdateOrderStatus(arg GetOrderParams, status OrderStatus) (res *Order, code int, err error)
+}
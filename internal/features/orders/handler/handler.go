@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"context"
+
+	auth "github.com/dwiw96/GoCommerceAPI/internal/features/auth"
+	orders "github.com/dwiw96/GoCommerceAPI/internal/features/orders"
+	mid "github.com/dwiw96/GoCommerceAPI/pkg/middleware"
+	responses "github.com/dwiw96/GoCommerceAPI/pkg/utils/responses"
+
+	"github.com/go-playground/locales/en"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	en_translations "github.com/go-playground/validator/v10/translations/en"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ordersHandler struct {
+	router   *gin.Engine
+	service  orders.IService
+	validate *validator.Validate
+	trans    ut.Translator
+}
+
+func NewOrdersHandler(router *gin.Engine, service orders.IService, pool *pgxpool.Pool, client *redis.Client, ctx context.Context) {
+	handler := &ordersHandler{
+		router:   router,
+		service:  service,
+		validate: validator.New(),
+	}
+
+	en := en.New()
+	uni := ut.New(en, en)
+	trans, _ := uni.GetTranslator("en")
+	en_translations.RegisterDefaultTranslations(handler.validate, trans)
+	handler.trans = trans
+
+	router.Use(mid.AuthMiddleware(ctx, pool, client))
+
+	router.GET("/api/v1/orders", handler.listOrders)
+	router.GET("/api/v1/orders/:id", handler.getOrder)
+	router.PATCH("/api/v1/orders/:id/status", mid.RoleMiddleware(auth.RoleStaff, auth.RoleAdmin), handler.updateOrderStatus)
+}
+
+func translateError(trans ut.Translator, err error) (errTrans []string) {
+	errs := err.(validator.ValidationErrors)
+	a := (errs.Translate(trans))
+	for _, val := range a {
+		errTrans = append(errTrans, val)
+	}
+
+	return
+}
+
+func (h *ordersHandler) listOrders(c *gin.Context) {
+	authPayload, isExists := c.Keys["payloadKey"].(*auth.JwtPayload)
+	if !isExists {
+		responses.ErrorJSON(c, 401, []string{"token is wrong"}, c.Request.RemoteAddr)
+		return
+	}
+
+	page := c.DefaultQuery("page", "0")
+	limit := c.DefaultQuery("limit", "10")
+
+	res, currentPage, totalPages, code, err := h.service.ListOrders(authPayload.UserID, page, limit)
+	if err != nil {
+		responses.ErrorJSON(c, code, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	response := responses.SuccessWithDataResponsePagination(toListOrderResp(res), currentPage, totalPages, "list of orders")
+	c.IndentedJSON(code, response)
+}
+
+func (h *ordersHandler) getOrder(c *gin.Context) {
+	authPayload, isExists := c.Keys["payloadKey"].(*auth.JwtPayload)
+	if !isExists {
+		responses.ErrorJSON(c, 401, []string{"token is wrong"}, c.Request.RemoteAddr)
+		return
+	}
+
+	var urlParam orderUrlParam
+	if err := c.ShouldBindUri(&urlParam); err != nil {
+		responses.ErrorJSON(c, 422, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	arg := orders.GetOrderParams{
+		ID:     urlParam.ID,
+		UserID: authPayload.UserID,
+	}
+	res, code, err := h.service.GetOrder(arg)
+	if err != nil {
+		responses.ErrorJSON(c, code, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	response := responses.SuccessWithDataResponse(toOrderDetailResp(res), code, "get order success")
+	c.IndentedJSON(code, response)
+}
+
+// updateOrderStatus lets staff move any user's order along, the service
+// refuses a status the order can't reach from the current one.
+func (h *ordersHandler) updateOrderStatus(c *gin.Context) {
+	var urlParam orderUrlParam
+	if err := c.ShouldBindUri(&urlParam); err != nil {
+		responses.ErrorJSON(c, 422, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	var reqBody updateOrderStatusReq
+	err := c.ShouldBindJSON(&reqBody)
+	if err != nil {
+		responses.ErrorJSON(c, 422, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+	err = h.validate.Struct(&reqBody)
+	if err != nil {
+		errTranslated := translateError(h.trans, err)
+		responses.ErrorJSON(c, 422, errTranslated, c.Request.RemoteAddr)
+		return
+	}
+
+	arg := orders.GetOrderParams{
+		ID:      urlParam.ID,
+		AnyUser: true,
+	}
+	res, code, err := h.service.UpdateOrderStatus(arg, orders.OrderStatus(reqBody.Status))
+	if err != nil {
+		responses.ErrorJSON(c, code, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	response := responses.SuccessWithDataResponse(toOrderResp(*res), code, "update order status success")
+	c.IndentedJSON(code, response)
+}
@@ -0,0 +1,11 @@
+package handler
+
+type orderUrlParam struct {
+	ID int32 `uri:"id" validate:"required,number"`
+}
+
+// updateOrderStatusReq moves an order on by hand. paid and refunded aren't
+// accepted, they follow the payment and the refund transactions.
+type updateOrderStatusReq struct {
+	Status string `json:"status" validate:"required,oneof=shipped delivered cancelled"`
+}
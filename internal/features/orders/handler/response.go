@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"time"
+
+	orders "github.com/dwiw96/GoCommerceAPI/internal/features/orders"
+	transactions "github.com/dwiw96/GoCommerceAPI/internal/features/transactions"
+)
+
+type orderResp struct {
+	ID          int32              `json:"id"`
+	Status      orders.OrderStatus `json:"status"`
+	TotalAmount int32              `json:"total_amount"`
+	CreatedAt   time.Time          `json:"created_at"`
+	UpdatedAt   time.Time          `json:"updated_at"`
+}
+
+func toOrderResp(input orders.Order) orderResp {
+	return orderResp{
+		ID:          input.ID,
+		Status:      input.Status,
+		TotalAmount: input.TotalAmount,
+		CreatedAt:   input.CreatedAt,
+		UpdatedAt:   input.UpdatedAt,
+	}
+}
+
+func toListOrderResp(input []orders.Order) []orderResp {
+	res := []orderResp{}
+	for _, order := range input {
+		res = append(res, toOrderResp(order))
+	}
+
+	return res
+}
+
+type orderItemResp struct {
+	ProductID int32 `json:"product_id"`
+	Quantity  int32 `json:"quantity"`
+	Price     int32 `json:"price"`
+	Amount    int32 `json:"amount"`
+}
+
+type orderTransactionResp struct {
+	ID        int32                          `json:"id"`
+	ProductID int32                          `json:"product_id"`
+	Amount    int32                          `json:"amount"`
+	TType     transactions.TransactionTypes  `json:"transaction_type"`
+	TStatus   transactions.TransactionStatus `json:"transaction_status"`
+	CreatedAt time.Time                      `json:"created_at"`
+}
+
+type orderDetailResp struct {
+	orderResp
+	Items        []orderItemResp        `json:"items"`
+	Transactions []orderTransactionResp `json:"transactions"`
+}
+
+func toOrderDetailResp(input *orders.OrderDetail) orderDetailResp {
+	res := orderDetailResp{
+		orderResp:    toOrderResp(input.Order),
+		Items:        []orderItemResp{},
+		Transactions: []orderTransactionResp{},
+	}
+	for _, item := range input.Items {
+		res.Items = append(res.Items, orderItemResp{
+			ProductID: item.ProductID,
+			Quantity:  item.Quantity,
+			Price:     item.Price,
+			Amount:    item.Amount,
+		})
+	}
+	for _, t := range input.Transactions {
+		res.Transactions = append(res.Transactions, orderTransactionResp{
+			ID:        t.ID,
+			ProductID: t.ProductID.Int32,
+			Amount:    t.Amount,
+			TType:     t.TType,
+			TStatus:   t.TStatus,
+			CreatedAt: t.CreatedAt.Time,
+		})
+	}
+
+	return res
+}
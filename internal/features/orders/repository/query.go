@@ -0,0 +1,210 @@
+package repository
+
+import (
+	"context"
+
+	db "github.com/dwiw96/GoCommerceAPI/internal/db"
+	orders "github.com/dwiw96/GoCommerceAPI/internal/features/orders"
+)
+
+type ordersRepository struct {
+	db  db.DBTX
+	ctx context.Context
+}
+
+func NewOrdersRepository(db db.DBTX, ctx context.Context) orders.IRepository {
+	return &ordersRepository{
+		db:  db,
+		ctx: ctx,
+	}
+}
+
+const createOrder = `-- name: CreateOrder :one
+INSERT INTO orders(
+    user_id,
+    status,
+    total_amount
+) VALUES (
+    $1, $2, $3
+) RETURNING id, user_id, status, total_amount, created_at, updated_at
+`
+
+func (r *ordersRepository) CreateOrder(arg orders.CreateOrderParams) (*orders.Order, error) {
+	row := r.db.QueryRow(r.ctx, createOrder, arg.UserID, arg.Status, arg.TotalAmount)
+	var i orders.Order
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Status,
+		&i.TotalAmount,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return &i, err
+}
+
+const createOrderItem = `-- name: CreateOrderItem :one
+INSERT INTO order_items(
+    order_id,
+    product_id,
+    quantity,
+    price,
+    amount
+) VALUES (
+    $1, $2, $3, $4, $5
+) RETURNING id, order_id, product_id, quantity, price, amount, created_at
+`
+
+func (r *ordersRepository) CreateOrderItem(arg orders.CreateOrderItemParams) (*orders.OrderItem, error) {
+	row := r.db.QueryRow(r.ctx, createOrderItem,
+		arg.OrderID,
+		arg.ProductID,
+		arg.Quantity,
+		arg.Price,
+		arg.Amount,
+	)
+	var i orders.OrderItem
+	err := row.Scan(
+		&i.ID,
+		&i.OrderID,
+		&i.ProductID,
+		&i.Quantity,
+		&i.Price,
+		&i.Amount,
+		&i.CreatedAt,
+	)
+	return &i, err
+}
+
+const getOrderByID = `-- name: GetOrderByID :one
+SELECT id, user_id, status, total_amount, created_at, updated_at FROM orders
+WHERE id = $1 AND ($3::BOOLEAN OR user_id = $2)
+`
+
+func (r *ordersRepository) GetOrderByID(arg orders.GetOrderParams) (*orders.Order, error) {
+	row := r.db.QueryRow(r.ctx, getOrderByID, arg.ID, arg.UserID, arg.AnyUser)
+	var i orders.Order
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Status,
+		&i.TotalAmount,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return &i, err
+}
+
+const listOrders = `-- name: ListOrders :many
+SELECT id, user_id, status, total_amount, created_at, updated_at FROM orders
+WHERE user_id = $1
+ORDER BY id DESC LIMIT $2 OFFSET $3
+`
+
+func (r *ordersRepository) ListOrders(arg orders.ListOrdersParams) ([]orders.Order, error) {
+	rows, err := r.db.Query(r.ctx, listOrders, arg.UserID, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []orders.Order
+	for rows.Next() {
+		var i orders.Order
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Status,
+			&i.TotalAmount,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getTotalOrders = `-- name: GetTotalOrders :one
+SELECT
+	COUNT(*)
+FROM orders
+WHERE user_id = $1;
+`
+
+func (r *ordersRepository) GetTotalOrders(userID int32) (int, error) {
+	row := r.db.QueryRow(r.ctx, getTotalOrders, userID)
+
+	var res int
+	err := row.Scan(
+		&res,
+	)
+
+	return res, err
+}
+
+const listOrderItems = `-- name: ListOrderItems :many
+SELECT id, order_id, product_id, quantity, price, amount, created_at FROM order_items
+WHERE order_id = $1
+ORDER BY id ASC
+`
+
+func (r *ordersRepository) ListOrderItems(orderID int32) ([]orders.OrderItem, error) {
+	rows, err := r.db.Query(r.ctx, listOrderItems, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []orders.OrderItem
+	for rows.Next() {
+		var i orders.OrderItem
+		if err := rows.Scan(
+			&i.ID,
+			&i.OrderID,
+			&i.ProductID,
+			&i.Quantity,
+			&i.Price,
+			&i.Amount,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// updateOrderStatus only moves the order when it is still in FromStatus, so
+// two concurrent transitions cannot both succeed.
+const updateOrderStatus = `-- name: UpdateOrderStatus :one
+UPDATE
+    orders
+SET
+    status = $1,
+    updated_at = NOW()
+WHERE
+    id = $2
+AND
+    status = $3
+RETURNING id, user_id, status, total_amount, created_at, updated_at
+`
+
+func (r *ordersRepository) UpdateOrderStatus(arg orders.UpdateOrderStatusParams) (*orders.Order, error) {
+	row := r.db.QueryRow(r.ctx, updateOrderStatus, arg.ToStatus, arg.ID, arg.FromStatus)
+	var i orders.Order
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Status,
+		&i.TotalAmount,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return &i, err
+}
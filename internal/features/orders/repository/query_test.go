@@ -0,0 +1,323 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	auth "github.com/dwiw96/GoCommerceAPI/internal/features/auth"
+	authRepo "github.com/dwiw96/GoCommerceAPI/internal/features/auth/repository"
+	orders "github.com/dwiw96/GoCommerceAPI/internal/features/orders"
+	products "github.com/dwiw96/GoCommerceAPI/internal/features/products"
+	productsRepo "github.com/dwiw96/GoCommerceAPI/internal/features/products/repository"
+	testUtils "github.com/dwiw96/GoCommerceAPI/testutils"
+
+	generator "github.com/dwiw96/GoCommerceAPI/pkg/utils/generator"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	repoTest        orders.IRepository
+	ctx             context.Context
+	pool            *pgxpool.Pool
+	productRepoTest products.IRepository
+	authRepoTest    auth.IRepository
+)
+
+func TestMain(m *testing.M) {
+	pool = testUtils.GetPool()
+	defer pool.Close()
+	ctx = testUtils.GetContext()
+	defer ctx.Done()
+
+	schemaCleanup := testUtils.SetupDB("test_repo_orders")
+
+	authRepoTest = authRepo.NewAuthRepository(pool, pool)
+	productRepoTest = productsRepo.NewProductRepository(pool)
+	repoTest = NewOrdersRepository(pool, ctx)
+
+	exitTest := m.Run()
+
+	schemaCleanup()
+
+	os.Exit(exitTest)
+}
+
+func createRandomUser(t *testing.T) (res *auth.User) {
+	username := generator.CreateRandomString(generator.RandomInt(3, 13))
+	arg := auth.CreateUserParams{
+		Username:       username,
+		Email:          generator.CreateRandomEmail(username),
+		HashedPassword: generator.CreateRandomString(generator.RandomInt(20, 20)),
+	}
+
+	res, err := authRepoTest.CreateUser(ctx, arg)
+	require.NoError(t, err)
+	assert.NotZero(t, res.ID)
+
+	return res
+}
+
+func createProductTest(t *testing.T) (res *products.Product) {
+	arg := products.CreateProductParams{
+		Name:         generator.CreateRandomString(7),
+		Description:  generator.CreateRandomString(50),
+		Price:        int32(20),
+		Availability: int32(50),
+	}
+
+	res, err := productRepoTest.CreateProduct(ctx, arg)
+	require.NoError(t, err)
+	assert.NotZero(t, res.ID)
+
+	return res
+}
+
+func createOrderTest(t *testing.T, user *auth.User, status orders.OrderStatus) (res *orders.Order) {
+	arg := orders.CreateOrderParams{
+		UserID:      user.ID,
+		Status:      status,
+		TotalAmount: int32(generator.RandomInt(10, 1000)),
+	}
+
+	res, err := repoTest.CreateOrder(arg)
+	require.NoError(t, err)
+	assert.NotZero(t, res.ID)
+	assert.Equal(t, arg.UserID, res.UserID)
+	assert.Equal(t, arg.Status, res.Status)
+	assert.Equal(t, arg.TotalAmount, res.TotalAmount)
+	assert.False(t, res.CreatedAt.IsZero())
+	assert.False(t, res.UpdatedAt.IsZero())
+
+	return res
+}
+
+func TestCreateOrder(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user := createRandomUser(t)
+
+	testCases := []struct {
+		desc  string
+		arg   orders.CreateOrderParams
+		isErr bool
+	}{
+		{
+			desc: "success",
+			arg: orders.CreateOrderParams{
+				UserID:      user.ID,
+				Status:      orders.OrderStatusCreated,
+				TotalAmount: 100,
+			},
+			isErr: false,
+		}, {
+			desc: "failed_wrong_user_id",
+			arg: orders.CreateOrderParams{
+				UserID:      user.ID + 5,
+				Status:      orders.OrderStatusCreated,
+				TotalAmount: 100,
+			},
+			isErr: true,
+		}, {
+			desc: "failed_negative_total_amount",
+			arg: orders.CreateOrderParams{
+				UserID:      user.ID,
+				Status:      orders.OrderStatusCreated,
+				TotalAmount: -1,
+			},
+			isErr: true,
+		}, {
+			desc: "failed_wrong_status",
+			arg: orders.CreateOrderParams{
+				UserID:      user.ID,
+				Status:      "unknown",
+				TotalAmount: 100,
+			},
+			isErr: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			res, err := repoTest.CreateOrder(tC.arg)
+			if !tC.isErr {
+				require.NoError(t, err)
+				assert.NotZero(t, res.ID)
+				assert.Equal(t, tC.arg.UserID, res.UserID)
+				assert.Equal(t, tC.arg.Status, res.Status)
+				assert.Equal(t, tC.arg.TotalAmount, res.TotalAmount)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestCreateOrderItem(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user := createRandomUser(t)
+	product := createProductTest(t)
+	order := createOrderTest(t, user, orders.OrderStatusCreated)
+
+	testCases := []struct {
+		desc  string
+		arg   orders.CreateOrderItemParams
+		isErr bool
+	}{
+		{
+			desc: "success",
+			arg: orders.CreateOrderItemParams{
+				OrderID:   order.ID,
+				ProductID: product.ID,
+				Quantity:  2,
+				Price:     product.Price,
+				Amount:    product.Price * 2,
+			},
+			isErr: false,
+		}, {
+			desc: "failed_wrong_order_id",
+			arg: orders.CreateOrderItemParams{
+				OrderID:   order.ID + 5,
+				ProductID: product.ID,
+				Quantity:  2,
+				Price:     product.Price,
+				Amount:    product.Price * 2,
+			},
+			isErr: true,
+		}, {
+			desc: "failed_zero_quantity",
+			arg: orders.CreateOrderItemParams{
+				OrderID:   order.ID,
+				ProductID: product.ID,
+				Quantity:  0,
+				Price:     product.Price,
+				Amount:    0,
+			},
+			isErr: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			res, err := repoTest.CreateOrderItem(tC.arg)
+			if !tC.isErr {
+				require.NoError(t, err)
+				assert.NotZero(t, res.ID)
+				assert.Equal(t, tC.arg.OrderID, res.OrderID)
+				assert.Equal(t, tC.arg.ProductID, res.ProductID)
+				assert.Equal(t, tC.arg.Quantity, res.Quantity)
+				assert.Equal(t, tC.arg.Amount, res.Amount)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+
+	items, err := repoTest.ListOrderItems(order.ID)
+	require.NoError(t, err)
+	assert.Len(t, items, 1)
+}
+
+func TestGetOrderByID(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user := createRandomUser(t)
+	otherUser := createRandomUser(t)
+	order := createOrderTest(t, user, orders.OrderStatusCreated)
+
+	testCases := []struct {
+		desc  string
+		arg   orders.GetOrderParams
+		err   error
+		isErr bool
+	}{
+		{
+			desc:  "success",
+			arg:   orders.GetOrderParams{ID: order.ID, UserID: user.ID},
+			isErr: false,
+		}, {
+			desc:  "failed_other_user",
+			arg:   orders.GetOrderParams{ID: order.ID, UserID: otherUser.ID},
+			err:   pgx.ErrNoRows,
+			isErr: true,
+		}, {
+			desc:  "failed_wrong_id",
+			arg:   orders.GetOrderParams{ID: order.ID + 5, UserID: user.ID},
+			err:   pgx.ErrNoRows,
+			isErr: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			res, err := repoTest.GetOrderByID(tC.arg)
+			if !tC.isErr {
+				require.NoError(t, err)
+				assert.Equal(t, *order, *res)
+			} else {
+				require.Error(t, err)
+				assert.ErrorIs(t, err, tC.err)
+			}
+		})
+	}
+}
+
+func TestListOrders(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user := createRandomUser(t)
+	otherUser := createRandomUser(t)
+	for i := 0; i < 5; i++ {
+		createOrderTest(t, user, orders.OrderStatusCreated)
+	}
+	createOrderTest(t, otherUser, orders.OrderStatusCreated)
+
+	total, err := repoTest.GetTotalOrders(user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 5, total)
+
+	res, err := repoTest.ListOrders(orders.ListOrdersParams{UserID: user.ID, Limit: 3, Offset: 0})
+	require.NoError(t, err)
+	require.Len(t, res, 3)
+	for i, order := range res {
+		assert.Equal(t, user.ID, order.UserID)
+		if i > 0 {
+			assert.Greater(t, res[i-1].ID, order.ID)
+		}
+	}
+
+	res, err = repoTest.ListOrders(orders.ListOrdersParams{UserID: user.ID, Limit: 3, Offset: 3})
+	require.NoError(t, err)
+	assert.Len(t, res, 2)
+}
+
+func TestUpdateOrderStatus(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user := createRandomUser(t)
+	order := createOrderTest(t, user, orders.OrderStatusCreated)
+
+	res, err := repoTest.UpdateOrderStatus(orders.UpdateOrderStatusParams{
+		ID:         order.ID,
+		FromStatus: orders.OrderStatusCreated,
+		ToStatus:   orders.OrderStatusPaid,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, orders.OrderStatusPaid, res.Status)
+
+	// the order is no longer in created, so the same transition must not apply twice
+	_, err = repoTest.UpdateOrderStatus(orders.UpdateOrderStatusParams{
+		ID:         order.ID,
+		FromStatus: orders.OrderStatusCreated,
+		ToStatus:   orders.OrderStatusCancelled,
+	})
+	require.Error(t, err)
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	orders "github.com/dwiw96/GoCommerceAPI/internal/features/orders"
+	transactions "github.com/dwiw96/GoCommerceAPI/internal/features/transactions"
+	converter "github.com/dwiw96/GoCommerceAPI/pkg/utils/converter"
+	errs "github.com/dwiw96/GoCommerceAPI/pkg/utils/responses"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type ordersService struct {
+	ctx              context.Context
+	repo             orders.IRepository
+	transactionsRepo transactions.IRepository
+}
+
+func NewOrdersService(ctx context.Context, repo orders.IRepository, transactionsRepo transactions.IRepository) orders.IService {
+	return &ordersService{
+		ctx:              ctx,
+		repo:             repo,
+		transactionsRepo: transactionsRepo,
+	}
+}
+
+func handleError(arg error) (code int, err error) {
+	if errors.Is(arg, pgx.ErrNoRows) {
+		return errs.CodeFailedUser, errs.ErrNoData
+	}
+
+	return errs.CodeFailedServer, fmt.Errorf("database error occurred")
+}
+
+func (s *ordersService) ListOrders(userID int32, pageInput, limitInput string) (res []orders.Order, currentPage, totalPages int, code int, err error) {
+	pageConverted, err := converter.ConvertStrToInt(pageInput)
+	if err != nil {
+		return nil, 0, 0, errs.CodeFailedUser, errs.ErrInvalidInput
+	}
+	limitConverted, err := converter.ConvertStrToInt(limitInput)
+	if err != nil {
+		return nil, 0, 0, errs.CodeFailedUser, errs.ErrInvalidInput
+	}
+
+	page := int32(pageConverted)
+	limit := int32(limitConverted)
+
+	if page <= 0 {
+		page = 1
+	}
+
+	if limit <= 0 {
+		limit = 10
+	}
+
+	totalData, err := s.repo.GetTotalOrders(userID)
+	if err != nil {
+		return nil, 0, 0, errs.CodeFailedServer, fmt.Errorf("failed to get total data of orders, err: %v", err)
+	}
+	totalPages = int(math.Ceil(float64(totalData) / float64(limit)))
+
+	arg := orders.ListOrdersParams{
+		UserID: userID,
+		Limit:  limit,
+		Offset: (page - 1) * limit,
+	}
+	res, err = s.repo.ListOrders(arg)
+	if err != nil {
+		return nil, 0, 0, errs.CodeFailedServer, fmt.Errorf("failed to list orders, err: %v", err)
+	}
+
+	return res, int(page), totalPages, errs.CodeSuccess, nil
+}
+
+func (s *ordersService) GetOrder(arg orders.GetOrderParams) (res *orders.OrderDetail, code int, err error) {
+	order, err := s.repo.GetOrderByID(arg)
+	if err != nil {
+		code, err = handleError(err)
+		return nil, code, err
+	}
+
+	items, err := s.repo.ListOrderItems(order.ID)
+	if err != nil {
+		code, err = handleError(err)
+		return nil, code, err
+	}
+
+	histories, err := s.transactionsRepo.ListTransactionsByOrderID(order.ID)
+	if err != nil {
+		code, err = handleError(err)
+		return nil, code, err
+	}
+
+	res = &orders.OrderDetail{
+		Order:        *order,
+		Items:        items,
+		Transactions: histories,
+	}
+
+	return res, errs.CodeSuccess, nil
+}
+
+func (s *ordersService) UpdateOrderStatus(arg orders.GetOrderParams, status orders.OrderStatus) (res *orders.Order, code int, err error) {
+	order, err := s.repo.GetOrderByID(arg)
+	if err != nil {
+		code, err = handleError(err)
+		return nil, code, err
+	}
+
+	if !order.Status.CanTransitionTo(status) {
+		return nil, errs.CodeFailedUser, errs.ErrInvalidStatusTransition
+	}
+
+	updateArg := orders.UpdateOrderStatusParams{
+		ID:         order.ID,
+		FromStatus: order.Status,
+		ToStatus:   status,
+	}
+	res, err = s.repo.UpdateOrderStatus(updateArg)
+	if err != nil {
+		// the order changed status between the read and the update
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errs.CodeFailedDuplicated, errs.ErrInvalidStatusTransition
+		}
+		code, err = handleError(err)
+		return nil, code, err
+	}
+
+	return res, errs.CodeSuccess, nil
+}
@@ -0,0 +1,233 @@
+package service
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	auth "github.com/dwiw96/GoCommerceAPI/internal/features/auth"
+	authRepo "github.com/dwiw96/GoCommerceAPI/internal/features/auth/repository"
+	orders "github.com/dwiw96/GoCommerceAPI/internal/features/orders"
+	ordersRepo "github.com/dwiw96/GoCommerceAPI/internal/features/orders/repository"
+	products "github.com/dwiw96/GoCommerceAPI/internal/features/products"
+	productsRepo "github.com/dwiw96/GoCommerceAPI/internal/features/products/repository"
+	transactions "github.com/dwiw96/GoCommerceAPI/internal/features/transactions"
+	transactionsRepo "github.com/dwiw96/GoCommerceAPI/internal/features/transactions/repository"
+	wallets "github.com/dwiw96/GoCommerceAPI/internal/features/wallets"
+	walletsRepo "github.com/dwiw96/GoCommerceAPI/internal/features/wallets/repository"
+	testUtils "github.com/dwiw96/GoCommerceAPI/testutils"
+
+	generator "github.com/dwiw96/GoCommerceAPI/pkg/utils/generator"
+	errs "github.com/dwiw96/GoCommerceAPI/pkg/utils/responses"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	serviceTest          orders.IService
+	repoTest             orders.IRepository
+	ctx                  context.Context
+	pool                 *pgxpool.Pool
+	productRepoTest      products.IRepository
+	walletRepoTest       wallets.IRepository
+	transactionsRepoTest transactions.IRepository
+	authRepoTest         auth.IRepository
+)
+
+func TestMain(m *testing.M) {
+	pool = testUtils.GetPool()
+	defer pool.Close()
+	ctx = testUtils.GetContext()
+	defer ctx.Done()
+
+	schemaCleanup := testUtils.SetupDB("test_service_orders")
+
+	authRepoTest = authRepo.NewAuthRepository(pool, pool)
+	productRepoTest = productsRepo.NewProductRepository(pool)
+	walletRepoTest = walletsRepo.NewWalletsRepository(pool, ctx)
+	transactionsRepoTest = transactionsRepo.NewTransactionsRepository(pool, pool, ctx)
+	repoTest = ordersRepo.NewOrdersRepository(pool, ctx)
+	serviceTest = NewOrdersService(ctx, repoTest, transactionsRepoTest)
+
+	exitTest := m.Run()
+
+	schemaCleanup()
+
+	os.Exit(exitTest)
+}
+
+func createRandomUser(t *testing.T) (res *auth.User) {
+	username := generator.CreateRandomString(generator.RandomInt(3, 13))
+	arg := auth.CreateUserParams{
+		Username:       username,
+		Email:          generator.CreateRandomEmail(username),
+		HashedPassword: generator.CreateRandomString(generator.RandomInt(20, 20)),
+	}
+
+	res, err := authRepoTest.CreateUser(ctx, arg)
+	require.NoError(t, err)
+	assert.NotZero(t, res.ID)
+
+	return res
+}
+
+// createPaidOrderTest writes an order with a single line and the purchase
+// transaction that paid for it.
+func createPaidOrderTest(t *testing.T, user *auth.User) (res *orders.Order) {
+	wallet, err := walletRepoTest.CreateWallet(wallets.CreateWalletParams{UserID: user.ID, Balance: 1000})
+	require.NoError(t, err)
+
+	product, err := productRepoTest.CreateProduct(ctx, products.CreateProductParams{
+		Name:         generator.CreateRandomString(7),
+		Description:  generator.CreateRandomString(50),
+		Price:        20,
+		Availability: 50,
+	})
+	require.NoError(t, err)
+
+	res, err = repoTest.CreateOrder(orders.CreateOrderParams{
+		UserID:      user.ID,
+		Status:      orders.OrderStatusPaid,
+		TotalAmount: product.Price * 2,
+	})
+	require.NoError(t, err)
+
+	_, err = repoTest.CreateOrderItem(orders.CreateOrderItemParams{
+		OrderID:   res.ID,
+		ProductID: product.ID,
+		Quantity:  2,
+		Price:     product.Price,
+		Amount:    product.Price * 2,
+	})
+	require.NoError(t, err)
+
+	_, err = transactionsRepoTest.CreateTransaction(transactions.CreateTransactionParams{
+		FromWalletID: pgtype.Int4{Int32: wallet.ID, Valid: true},
+		ProductID:    pgtype.Int4{Int32: product.ID, Valid: true},
+		Amount:       product.Price * 2,
+		Quantity:     pgtype.Int4{Int32: 2, Valid: true},
+		TType:        transactions.TransactionTypesPurchase,
+		TStatus:      transactions.TransactionStatusCompleted,
+		OrderID:      pgtype.Int4{Int32: res.ID, Valid: true},
+	})
+	require.NoError(t, err)
+
+	return res
+}
+
+func TestListOrders(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user := createRandomUser(t)
+	for i := 0; i < 3; i++ {
+		_, err := repoTest.CreateOrder(orders.CreateOrderParams{UserID: user.ID, Status: orders.OrderStatusCreated, TotalAmount: 10})
+		require.NoError(t, err)
+	}
+
+	testCases := []struct {
+		desc        string
+		page        string
+		limit       string
+		length      int
+		currentPage int
+		totalPages  int
+		code        int
+		isErr       bool
+	}{
+		{
+			desc:        "success",
+			page:        "1",
+			limit:       "2",
+			length:      2,
+			currentPage: 1,
+			totalPages:  2,
+			code:        errs.CodeSuccess,
+			isErr:       false,
+		}, {
+			desc:        "success_default_page",
+			page:        "0",
+			limit:       "10",
+			length:      3,
+			currentPage: 1,
+			totalPages:  1,
+			code:        errs.CodeSuccess,
+			isErr:       false,
+		}, {
+			desc:  "failed_invalid_page",
+			page:  "a",
+			limit: "10",
+			code:  errs.CodeFailedUser,
+			isErr: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			res, currentPage, totalPages, code, err := serviceTest.ListOrders(user.ID, tC.page, tC.limit)
+			assert.Equal(t, tC.code, code)
+			if !tC.isErr {
+				require.NoError(t, err)
+				assert.Len(t, res, tC.length)
+				assert.Equal(t, tC.currentPage, currentPage)
+				assert.Equal(t, tC.totalPages, totalPages)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestGetOrder(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user := createRandomUser(t)
+	otherUser := createRandomUser(t)
+	order := createPaidOrderTest(t, user)
+
+	res, code, err := serviceTest.GetOrder(orders.GetOrderParams{ID: order.ID, UserID: user.ID})
+	require.NoError(t, err)
+	assert.Equal(t, errs.CodeSuccess, code)
+	assert.Equal(t, order.ID, res.ID)
+	require.Len(t, res.Items, 1)
+	require.Len(t, res.Transactions, 1)
+	assert.Equal(t, order.ID, res.Transactions[0].OrderID.Int32)
+
+	_, code, err = serviceTest.GetOrder(orders.GetOrderParams{ID: order.ID, UserID: otherUser.ID})
+	require.Error(t, err)
+	assert.Equal(t, errs.CodeFailedUser, code)
+	assert.Equal(t, errs.ErrNoData, err)
+}
+
+func TestUpdateOrderStatus(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user := createRandomUser(t)
+	order := createPaidOrderTest(t, user)
+	arg := orders.GetOrderParams{ID: order.ID, UserID: user.ID}
+
+	res, code, err := serviceTest.UpdateOrderStatus(arg, orders.OrderStatusShipped)
+	require.NoError(t, err)
+	assert.Equal(t, errs.CodeSuccess, code)
+	assert.Equal(t, orders.OrderStatusShipped, res.Status)
+
+	_, code, err = serviceTest.UpdateOrderStatus(arg, orders.OrderStatusCancelled)
+	require.Error(t, err)
+	assert.Equal(t, errs.CodeFailedUser, code)
+	assert.Equal(t, errs.ErrInvalidStatusTransition, err)
+
+	_, code, err = serviceTest.UpdateOrderStatus(orders.GetOrderParams{ID: order.ID, UserID: user.ID + 1}, orders.OrderStatusDelivered)
+	require.Error(t, err)
+	assert.Equal(t, errs.CodeFailedUser, code)
+	assert.Equal(t, errs.ErrNoData, err)
+
+	// staff move the order without being its owner
+	res, code, err = serviceTest.UpdateOrderStatus(orders.GetOrderParams{ID: order.ID, AnyUser: true}, orders.OrderStatusDelivered)
+	require.NoError(t, err)
+	assert.Equal(t, errs.CodeSuccess, code)
+	assert.Equal(t, orders.OrderStatusDelivered, res.Status)
+}
@@ -4,27 +4,35 @@ import (
 	"context"
 )
 
+// Product is priced in Currency, buyers paying from a wallet in another
+// currency are charged the converted price.
 type Product struct {
 	ID           int32  `json:"id"`
 	Name         string `json:"name"`
 	Description  string `json:"description"`
 	Price        int32  `json:"price"`
 	Availability int32  `json:"availability"`
+	Currency     string `json:"currency"`
 }
 
+// CreateProductParams creates a product in Currency, rates.DefaultCurrency
+// when empty.
 type CreateProductParams struct {
 	Name         string
 	Description  string
 	Price        int32
 	Availability int32
+	Currency     string
 }
 
+// UpdateProductParams keeps the currency when Currency is empty.
 type UpdateProductParams struct {
 	ID           int32  `json:"id"`
 	Name         string `json:"name"`
 	Description  string `json:"description"`
 	Price        int32  `json:"price"`
 	Availability int32  `json:"availability"`
+	Currency     string `json:"currency"`
 }
 
 type ListProductsParams struct {
@@ -53,4 +61,5 @@ type IRepository interface {
 	UpdateProduct(ctx context.Context, arg UpdateProductParams) (*Product, error)
 	DeleteProduct(ctx context.Context, id int32) error
 	UpdateProductAvailability(ctx context.Context, arg UpdateProductAvailabilityParams) (*Product, error)
+	GetProductByIDForUpdate(ctx context.Context, id int32) (*Product, error)
 }
@@ -3,6 +3,7 @@ package handler
 import (
 	"context"
 
+	auth "github.com/dwiw96/GoCommerceAPI/internal/features/auth"
 	product "github.com/dwiw96/GoCommerceAPI/internal/features/products"
 	mid "github.com/dwiw96/GoCommerceAPI/pkg/middleware"
 	responses "github.com/dwiw96/GoCommerceAPI/pkg/utils/responses"
@@ -39,11 +40,11 @@ func NewProductHandler(router *gin.Engine, service product.IService, pool *pgxpo
 
 	router.Use(mid.AuthMiddleware(ctx, pool, client))
 
-	router.POST("/api/v1/product/create", handler.createProduct)
+	router.POST("/api/v1/product/create", mid.RoleMiddleware(auth.RoleStaff, auth.RoleAdmin), handler.createProduct)
 	router.GET("/api/v1/product/get/:id", handler.getProduct)
 	router.GET("/api/v1/product/list", handler.listProduct)
-	router.PUT("/api/v1/product/update", handler.updateProduct)
-	router.DELETE("/api/v1/product/delete/:id", handler.deleteProduct)
+	router.PUT("/api/v1/product/update", mid.RoleMiddleware(auth.RoleStaff, auth.RoleAdmin), handler.updateProduct)
+	router.DELETE("/api/v1/product/delete/:id", mid.RoleMiddleware(auth.RoleStaff, auth.RoleAdmin), handler.deleteProduct)
 }
 
 func translateError(trans ut.Translator, err error) (errTrans []string) {
@@ -77,6 +78,7 @@ func (h *productHandler) createProduct(c *gin.Context) {
 		Description:  request.Description,
 		Price:        request.Price,
 		Availability: request.Availability,
+		Currency:     request.Currency,
 	}
 
 	res, code, err := h.service.CreateProduct(serviceArg)
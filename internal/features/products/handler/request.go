@@ -5,6 +5,7 @@ type createProductReq struct {
 	Description  string `json:"description"`
 	Price        int32  `json:"price" validate:"min=0"`
 	Availability int32  `json:"availability" validate:"min=0"`
+	Currency     string `json:"currency" validate:"omitempty,iso4217"`
 }
 
 type updateProductReq struct {
@@ -13,4 +14,5 @@ type updateProductReq struct {
 	Description  string `json:"description"`
 	Price        int32  `json:"price" validate:"min=0"`
 	Availability int32  `json:"availability" validate:"min=0"`
+	Currency     string `json:"currency" validate:"omitempty,iso4217"`
 }
@@ -6,4 +6,5 @@ type productResp struct {
 	Description  string `json:"description"`
 	Price        int32  `json:"price" validate:"min=0"`
 	Availability int32  `json:"availability" validate:"min=0"`
+	Currency     string `json:"currency"`
 }
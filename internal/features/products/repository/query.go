@@ -6,6 +6,7 @@ import (
 
 	db "github.com/dwiw96/GoCommerceAPI/internal/db"
 	product "github.com/dwiw96/GoCommerceAPI/internal/features/products"
+	rates "github.com/dwiw96/GoCommerceAPI/internal/features/rates"
 )
 
 type productRepository struct {
@@ -23,18 +24,24 @@ INSERT INTO products(
     name, 
     description, 
     price, 
-    availability
+    availability,
+    currency
 ) VALUES (
-    $1, $2, $3, $4
-) RETURNING id, name, description, price, availability
+    $1, $2, $3, $4, $5
+) RETURNING id, name, description, price, availability, currency
 `
 
 func (q *productRepository) CreateProduct(ctx context.Context, arg product.CreateProductParams) (*product.Product, error) {
+	if arg.Currency == "" {
+		arg.Currency = rates.DefaultCurrency
+	}
+
 	row := q.db.QueryRow(ctx, createProduct,
 		arg.Name,
 		arg.Description,
 		arg.Price,
 		arg.Availability,
+		arg.Currency,
 	)
 	var i product.Product
 	err := row.Scan(
@@ -43,12 +50,13 @@ func (q *productRepository) CreateProduct(ctx context.Context, arg product.Creat
 		&i.Description,
 		&i.Price,
 		&i.Availability,
+		&i.Currency,
 	)
 	return &i, err
 }
 
 const getProductByID = `-- name: GetProductByID :one
-SELECT id, name, description, price, availability FROM products
+SELECT id, name, description, price, availability, currency FROM products
 WHERE id = $1 LIMIT 1
 `
 
@@ -61,12 +69,35 @@ func (q *productRepository) GetProductByID(ctx context.Context, id int32) (*prod
 		&i.Description,
 		&i.Price,
 		&i.Availability,
+		&i.Currency,
+	)
+	return &i, err
+}
+
+// getProductByIDForUpdate locks the product row until the surrounding db
+// transaction ends, so two buyers can't both take the last unit.
+const getProductByIDForUpdate = `-- name: GetProductByIDForUpdate :one
+SELECT id, name, description, price, availability, currency FROM products
+WHERE id = $1 LIMIT 1
+FOR UPDATE
+`
+
+func (q *productRepository) GetProductByIDForUpdate(ctx context.Context, id int32) (*product.Product, error) {
+	row := q.db.QueryRow(ctx, getProductByIDForUpdate, id)
+	var i product.Product
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Description,
+		&i.Price,
+		&i.Availability,
+		&i.Currency,
 	)
 	return &i, err
 }
 
 const listProducts = `-- name: ListProducts :many
-SELECT id, name, description, price, availability FROM products
+SELECT id, name, description, price, availability, currency FROM products
 ORDER BY id ASC LIMIT $1 OFFSET $2
 `
 
@@ -90,6 +121,7 @@ func (q *productRepository) ListProducts(ctx context.Context, arg product.ListPr
 			&i.Description,
 			&i.Price,
 			&i.Availability,
+			&i.Currency,
 		); err != nil {
 			return nil, err
 		}
@@ -125,15 +157,17 @@ SET
     name = coalesce($1, name),
     description = coalesce($2, description),
     price = coalesce($3, price),
-    availability = coalesce($4, availability)
+    availability = coalesce($4, availability),
+    currency = coalesce(NULLIF($6::VARCHAR, ''), currency)
 WHERE 
     id = $5
 AND (
     $1::VARCHAR IS NOT NULL AND $1 IS DISTINCT FROM name OR
     $2::TEXT IS NOT NULL AND $2 IS DISTINCT FROM description OR
     $3::INT IS NOT NULL AND $3 IS DISTINCT FROM price OR
-    $4::INT IS NOT NULL AND $4 IS DISTINCT FROM availability
-)  RETURNING id, name, description, price, availability
+    $4::INT IS NOT NULL AND $4 IS DISTINCT FROM availability OR
+    NULLIF($6::VARCHAR, '') IS NOT NULL AND $6 IS DISTINCT FROM currency
+)  RETURNING id, name, description, price, availability, currency
 `
 
 func (q *productRepository) UpdateProduct(ctx context.Context, arg product.UpdateProductParams) (*product.Product, error) {
@@ -143,6 +177,7 @@ func (q *productRepository) UpdateProduct(ctx context.Context, arg product.Updat
 		arg.Price,
 		arg.Availability,
 		arg.ID,
+		arg.Currency,
 	)
 	var i product.Product
 	err := row.Scan(
@@ -151,6 +186,7 @@ func (q *productRepository) UpdateProduct(ctx context.Context, arg product.Updat
 		&i.Description,
 		&i.Price,
 		&i.Availability,
+		&i.Currency,
 	)
 	return &i, err
 }
@@ -177,7 +213,7 @@ WHERE
     id = $2
 -- AND 
     -- $1::INT IS NOT NULL AND (availability + $1) >= 0
-RETURNING id, name, description, price, availability
+RETURNING id, name, description, price, availability, currency
 `
 
 func (q *productRepository) UpdateProductAvailability(ctx context.Context, arg product.UpdateProductAvailabilityParams) (*product.Product, error) {
@@ -192,6 +228,7 @@ func (q *productRepository) UpdateProductAvailability(ctx context.Context, arg p
 		&i.Description,
 		&i.Price,
 		&i.Availability,
+		&i.Currency,
 	)
 	return &i, err
 }
@@ -0,0 +1,74 @@
+package rates
+
+import (
+	"math"
+	"time"
+
+	errs "github.com/dwiw96/GoCommerceAPI/pkg/utils/responses"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// DefaultCurrency is used for wallets and products created without one.
+const DefaultCurrency = "IDR"
+
+// ExchangeRate says one BaseCurrency is worth Rate QuoteCurrency.
+type ExchangeRate struct {
+	ID            int32
+	BaseCurrency  string
+	QuoteCurrency string
+	Rate          float64
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+type UpsertRateParams struct {
+	BaseCurrency  string
+	QuoteCurrency string
+	Rate          float64
+}
+
+type DeleteRateParams struct {
+	BaseCurrency  string
+	QuoteCurrency string
+}
+
+type ConvertParams struct {
+	Amount int32
+	From   string
+	To     string
+}
+
+// Conversion is ConvertParams.Amount in the To currency. Rate is not Valid
+// when both currencies are the same and nothing was converted.
+type Conversion struct {
+	Amount int32
+	Rate   pgtype.Float8
+}
+
+// Convert applies rate to amount, rounded to the nearest unit. A positive
+// amount never converts to 0, the money would disappear.
+func Convert(amount int32, rate float64) (int32, error) {
+	converted := math.Round(float64(amount) * rate)
+	if converted > math.MaxInt32 || converted < math.MinInt32 {
+		return 0, errs.ErrInvalidInput
+	}
+	if amount > 0 && converted <= 0 {
+		return 0, errs.ErrAmountTooSmall
+	}
+
+	return int32(converted), nil
+}
+
+type IRepository interface {
+	UpsertRate(arg UpsertRateParams) (*ExchangeRate, error)
+	ListRates() ([]ExchangeRate, error)
+	DeleteRate(arg DeleteRateParams) error
+	ConvertAmount(arg ConvertParams) (*Conversion, error)
+}
+
+type IService interface {
+	UpsertRate(arg UpsertRateParams) (res *ExchangeRate, code int, err error)
+	ListRates() (res []ExchangeRate, code int, err error)
+	DeleteRate(arg DeleteRateParams) (code int, err error)
+}
@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"context"
+
+	auth "github.com/dwiw96/GoCommerceAPI/internal/features/auth"
+	rates "github.com/dwiw96/GoCommerceAPI/internal/features/rates"
+	mid "github.com/dwiw96/GoCommerceAPI/pkg/middleware"
+	responses "github.com/dwiw96/GoCommerceAPI/pkg/utils/responses"
+
+	"github.com/go-playground/locales/en"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	en_translations "github.com/go-playground/validator/v10/translations/en"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ratesHandler struct {
+	router   *gin.Engine
+	service  rates.IService
+	validate *validator.Validate
+	trans    ut.Translator
+}
+
+func NewRatesHandler(router *gin.Engine, service rates.IService, pool *pgxpool.Pool, client *redis.Client, ctx context.Context) {
+	handler := &ratesHandler{
+		router:   router,
+		service:  service,
+		validate: validator.New(),
+	}
+
+	en := en.New()
+	uni := ut.New(en, en)
+	trans, _ := uni.GetTranslator("en")
+	en_translations.RegisterDefaultTranslations(handler.validate, trans)
+	handler.trans = trans
+
+	router.Use(mid.AuthMiddleware(ctx, pool, client))
+
+	router.GET("/api/v1/rates", handler.listRates)
+	router.PUT("/api/v1/admin/rates", mid.RoleMiddleware(auth.RoleAdmin), handler.upsertRate)
+	router.DELETE("/api/v1/admin/rates/:base/:quote", mid.RoleMiddleware(auth.RoleAdmin), handler.deleteRate)
+}
+
+func translateError(trans ut.Translator, err error) (errTrans []string) {
+	errs := err.(validator.ValidationErrors)
+	a := (errs.Translate(trans))
+	for _, val := range a {
+		errTrans = append(errTrans, val)
+	}
+
+	return
+}
+
+func (h *ratesHandler) listRates(c *gin.Context) {
+	res, code, err := h.service.ListRates()
+	if err != nil {
+		responses.ErrorJSON(c, code, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	response := responses.SuccessWithDataResponse(toListRateResp(res), code, "list of exchange rates")
+	c.IndentedJSON(code, response)
+}
+
+func (h *ratesHandler) upsertRate(c *gin.Context) {
+	var request upsertRateReq
+
+	err := c.BindJSON(&request)
+	if err != nil {
+		responses.ErrorJSON(c, 422, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	err = h.validate.Struct(request)
+	if err != nil {
+		errTranslated := translateError(h.trans, err)
+		responses.ErrorJSON(c, 422, errTranslated, c.Request.RemoteAddr)
+		return
+	}
+
+	arg := rates.UpsertRateParams{
+		BaseCurrency:  request.BaseCurrency,
+		QuoteCurrency: request.QuoteCurrency,
+		Rate:          request.Rate,
+	}
+
+	res, code, err := h.service.UpsertRate(arg)
+	if err != nil {
+		responses.ErrorJSON(c, code, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	response := responses.SuccessWithDataResponse(toRateResp(*res), code, "exchange rate is saved")
+	c.IndentedJSON(code, response)
+}
+
+func (h *ratesHandler) deleteRate(c *gin.Context) {
+	var urlParam rateUrlParam
+	if err := c.ShouldBindUri(&urlParam); err != nil {
+		responses.ErrorJSON(c, 422, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	err := h.validate.Struct(urlParam)
+	if err != nil {
+		errTranslated := translateError(h.trans, err)
+		responses.ErrorJSON(c, 422, errTranslated, c.Request.RemoteAddr)
+		return
+	}
+
+	arg := rates.DeleteRateParams{
+		BaseCurrency:  urlParam.BaseCurrency,
+		QuoteCurrency: urlParam.QuoteCurrency,
+	}
+
+	code, err := h.service.DeleteRate(arg)
+	if err != nil {
+		responses.ErrorJSON(c, code, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	response := responses.SuccessResponse("exchange rate is deleted")
+	c.IndentedJSON(code, response)
+}
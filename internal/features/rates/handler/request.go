@@ -0,0 +1,12 @@
+package handler
+
+type upsertRateReq struct {
+	BaseCurrency  string  `json:"base_currency" validate:"required,iso4217"`
+	QuoteCurrency string  `json:"quote_currency" validate:"required,iso4217,nefield=BaseCurrency"`
+	Rate          float64 `json:"rate" validate:"required,gt=0"`
+}
+
+type rateUrlParam struct {
+	BaseCurrency  string `uri:"base" validate:"required,iso4217"`
+	QuoteCurrency string `uri:"quote" validate:"required,iso4217"`
+}
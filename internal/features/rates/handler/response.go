@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"time"
+
+	rates "github.com/dwiw96/GoCommerceAPI/internal/features/rates"
+)
+
+type rateResp struct {
+	BaseCurrency  string    `json:"base_currency"`
+	QuoteCurrency string    `json:"quote_currency"`
+	Rate          float64   `json:"rate"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+func toRateResp(input rates.ExchangeRate) rateResp {
+	return rateResp{
+		BaseCurrency:  input.BaseCurrency,
+		QuoteCurrency: input.QuoteCurrency,
+		Rate:          input.Rate,
+		UpdatedAt:     input.UpdatedAt,
+	}
+}
+
+func toListRateResp(input []rates.ExchangeRate) []rateResp {
+	res := []rateResp{}
+	for _, rate := range input {
+		res = append(res, toRateResp(rate))
+	}
+
+	return res
+}
@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	db "github.com/dwiw96/GoCommerceAPI/internal/db"
+	rates "github.com/dwiw96/GoCommerceAPI/internal/features/rates"
+	errs "github.com/dwiw96/GoCommerceAPI/pkg/utils/responses"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type ratesRepository struct {
+	db  db.DBTX
+	ctx context.Context
+}
+
+func NewRatesRepository(db db.DBTX, ctx context.Context) rates.IRepository {
+	return &ratesRepository{
+		db:  db,
+		ctx: ctx,
+	}
+}
+
+const upsertRate = `-- name: UpsertRate :one
+INSERT INTO exchange_rates(
+    base_currency,
+    quote_currency,
+    rate
+) VALUES (
+    $1, $2, $3
+) ON CONFLICT (base_currency, quote_currency) DO UPDATE SET
+    rate = EXCLUDED.rate,
+    updated_at = NOW()
+RETURNING id, base_currency, quote_currency, rate, created_at, updated_at
+`
+
+func (r *ratesRepository) UpsertRate(arg rates.UpsertRateParams) (*rates.ExchangeRate, error) {
+	row := r.db.QueryRow(r.ctx, upsertRate, arg.BaseCurrency, arg.QuoteCurrency, arg.Rate)
+	var i rates.ExchangeRate
+	err := row.Scan(
+		&i.ID,
+		&i.BaseCurrency,
+		&i.QuoteCurrency,
+		&i.Rate,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return &i, err
+}
+
+const listRates = `-- name: ListRates :many
+SELECT id, base_currency, quote_currency, rate, created_at, updated_at FROM exchange_rates
+ORDER BY base_currency ASC, quote_currency ASC
+`
+
+func (r *ratesRepository) ListRates() ([]rates.ExchangeRate, error) {
+	rows, err := r.db.Query(r.ctx, listRates)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []rates.ExchangeRate
+	for rows.Next() {
+		var i rates.ExchangeRate
+		if err := rows.Scan(
+			&i.ID,
+			&i.BaseCurrency,
+			&i.QuoteCurrency,
+			&i.Rate,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const deleteRate = `-- name: DeleteRate :one
+DELETE FROM exchange_rates
+WHERE base_currency = $1
+AND quote_currency = $2
+RETURNING id
+`
+
+func (r *ratesRepository) DeleteRate(arg rates.DeleteRateParams) error {
+	var id int32
+	return r.db.QueryRow(r.ctx, deleteRate, arg.BaseCurrency, arg.QuoteCurrency).Scan(&id)
+}
+
+// getConversionRate prefers the rate stored for the pair and falls back to
+// the inverse of the opposite pair.
+const getConversionRate = `-- name: GetConversionRate :one
+SELECT rate::FLOAT8 FROM (
+    SELECT rate, 0 AS priority FROM exchange_rates
+    WHERE base_currency = $1 AND quote_currency = $2
+    UNION ALL
+    SELECT 1 / rate, 1 AS priority FROM exchange_rates
+    WHERE base_currency = $2 AND quote_currency = $1
+) r
+ORDER BY priority ASC
+LIMIT 1
+`
+
+func (r *ratesRepository) ConvertAmount(arg rates.ConvertParams) (*rates.Conversion, error) {
+	if arg.From == arg.To {
+		return &rates.Conversion{Amount: arg.Amount}, nil
+	}
+
+	var rate float64
+	err := r.db.QueryRow(r.ctx, getConversionRate, arg.From, arg.To).Scan(&rate)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("failed to convert %s to %s, err: %w", arg.From, arg.To, errs.ErrRateNotFound)
+		}
+		return nil, fmt.Errorf("failed to get exchange rate, err: %w", err)
+	}
+
+	amount, err := rates.Convert(arg.Amount, rate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert %s to %s, err: %w", arg.From, arg.To, err)
+	}
+
+	return &rates.Conversion{Amount: amount, Rate: pgtype.Float8{Float64: rate, Valid: true}}, nil
+}
@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"context"
+	"math"
+	"os"
+	"testing"
+
+	rates "github.com/dwiw96/GoCommerceAPI/internal/features/rates"
+	testUtils "github.com/dwiw96/GoCommerceAPI/testutils"
+
+	errs "github.com/dwiw96/GoCommerceAPI/pkg/utils/responses"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	repoTest rates.IRepository
+	ctx      context.Context
+	pool     *pgxpool.Pool
+)
+
+func TestMain(m *testing.M) {
+	pool = testUtils.GetPool()
+	defer pool.Close()
+	ctx = testUtils.GetContext()
+	defer ctx.Done()
+
+	schemaCleanup := testUtils.SetupDB("test_repo_rates")
+
+	repoTest = NewRatesRepository(pool, ctx)
+
+	exitTest := m.Run()
+
+	schemaCleanup()
+
+	os.Exit(exitTest)
+}
+
+func TestUpsertRate(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	arg := rates.UpsertRateParams{BaseCurrency: "USD", QuoteCurrency: "IDR", Rate: 16000}
+	res, err := repoTest.UpsertRate(arg)
+	require.NoError(t, err)
+	assert.NotZero(t, res.ID)
+	assert.Equal(t, arg.BaseCurrency, res.BaseCurrency)
+	assert.Equal(t, arg.QuoteCurrency, res.QuoteCurrency)
+	assert.Equal(t, arg.Rate, res.Rate)
+
+	arg.Rate = 15500.5
+	updated, err := repoTest.UpsertRate(arg)
+	require.NoError(t, err)
+	assert.Equal(t, res.ID, updated.ID)
+	assert.Equal(t, arg.Rate, updated.Rate)
+	assert.False(t, updated.UpdatedAt.Before(res.UpdatedAt))
+
+	_, err = repoTest.UpsertRate(rates.UpsertRateParams{BaseCurrency: "USD", QuoteCurrency: "USD", Rate: 1})
+	require.Error(t, err)
+	_, err = repoTest.UpsertRate(rates.UpsertRateParams{BaseCurrency: "EUR", QuoteCurrency: "USD", Rate: 0})
+	require.Error(t, err)
+
+	list, err := repoTest.ListRates()
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, updated.ID, list[0].ID)
+
+	err = repoTest.DeleteRate(rates.DeleteRateParams{BaseCurrency: "USD", QuoteCurrency: "IDR"})
+	require.NoError(t, err)
+	err = repoTest.DeleteRate(rates.DeleteRateParams{BaseCurrency: "USD", QuoteCurrency: "IDR"})
+	require.Error(t, err)
+}
+
+func TestConvertAmount(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	_, err = repoTest.UpsertRate(rates.UpsertRateParams{BaseCurrency: "USD", QuoteCurrency: "IDR", Rate: 16000})
+	require.NoError(t, err)
+	// a stored rate wins over the inverse of the opposite pair
+	_, err = repoTest.UpsertRate(rates.UpsertRateParams{BaseCurrency: "EUR", QuoteCurrency: "USD", Rate: 1.1})
+	require.NoError(t, err)
+	_, err = repoTest.UpsertRate(rates.UpsertRateParams{BaseCurrency: "USD", QuoteCurrency: "EUR", Rate: 0.9})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		desc   string
+		arg    rates.ConvertParams
+		amount int32
+		rate   float64
+		err    error
+	}{
+		{
+			desc:   "success_same_currency",
+			arg:    rates.ConvertParams{Amount: 150, From: "IDR", To: "IDR"},
+			amount: 150,
+		}, {
+			desc:   "success_stored_rate",
+			arg:    rates.ConvertParams{Amount: 3, From: "USD", To: "IDR"},
+			amount: 48000,
+			rate:   16000,
+		}, {
+			desc:   "success_inverse_rate",
+			arg:    rates.ConvertParams{Amount: 40000, From: "IDR", To: "USD"},
+			amount: 3,
+			rate:   1.0 / 16000,
+		}, {
+			desc:   "success_prefers_stored_rate",
+			arg:    rates.ConvertParams{Amount: 100, From: "USD", To: "EUR"},
+			amount: 90,
+			rate:   0.9,
+		}, {
+			desc: "failed_rate_not_found",
+			arg:  rates.ConvertParams{Amount: 100, From: "JPY", To: "IDR"},
+			err:  errs.ErrRateNotFound,
+		}, {
+			desc: "failed_amount_too_small",
+			arg:  rates.ConvertParams{Amount: 100, From: "IDR", To: "USD"},
+			err:  errs.ErrAmountTooSmall,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			res, err := repoTest.ConvertAmount(tC.arg)
+			if tC.err != nil {
+				require.Error(t, err)
+				assert.ErrorIs(t, err, tC.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tC.amount, res.Amount)
+			assert.Equal(t, tC.rate != 0, res.Rate.Valid)
+			assert.InDelta(t, tC.rate, res.Rate.Float64, 1e-9)
+		})
+	}
+}
+
+func TestConvert(t *testing.T) {
+	res, err := rates.Convert(5, 0.5)
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), res)
+
+	_, err = rates.Convert(math.MaxInt32, 2)
+	assert.ErrorIs(t, err, errs.ErrInvalidInput)
+
+	_, err = rates.Convert(1, 0.1)
+	assert.ErrorIs(t, err, errs.ErrAmountTooSmall)
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	rates "github.com/dwiw96/GoCommerceAPI/internal/features/rates"
+	errs "github.com/dwiw96/GoCommerceAPI/pkg/utils/responses"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type ratesService struct {
+	ctx  context.Context
+	repo rates.IRepository
+}
+
+func NewRatesService(ctx context.Context, repo rates.IRepository) rates.IService {
+	return &ratesService{
+		ctx:  ctx,
+		repo: repo,
+	}
+}
+
+func handleError(arg error) (code int, err error) {
+	if errors.Is(arg, pgx.ErrNoRows) {
+		return errs.CodeFailedUser, errs.ErrNoData
+	}
+
+	return errs.CodeFailedServer, fmt.Errorf("database error occurred")
+}
+
+func (s *ratesService) UpsertRate(arg rates.UpsertRateParams) (res *rates.ExchangeRate, code int, err error) {
+	if arg.BaseCurrency == arg.QuoteCurrency || arg.Rate <= 0 {
+		return nil, errs.CodeFailedUser, errs.ErrInvalidInput
+	}
+
+	res, err = s.repo.UpsertRate(arg)
+	if err != nil {
+		code, err = handleError(err)
+		return nil, code, err
+	}
+
+	return res, errs.CodeSuccess, nil
+}
+
+func (s *ratesService) ListRates() (res []rates.ExchangeRate, code int, err error) {
+	res, err = s.repo.ListRates()
+	if err != nil {
+		code, err = handleError(err)
+		return nil, code, err
+	}
+
+	return res, errs.CodeSuccess, nil
+}
+
+func (s *ratesService) DeleteRate(arg rates.DeleteRateParams) (code int, err error) {
+	err = s.repo.DeleteRate(arg)
+	if err != nil {
+		return handleError(err)
+	}
+
+	return errs.CodeSuccess, nil
+}
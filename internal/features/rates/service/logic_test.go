@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	rates "github.com/dwiw96/GoCommerceAPI/internal/features/rates"
+	ratesRepo "github.com/dwiw96/GoCommerceAPI/internal/features/rates/repository"
+	testUtils "github.com/dwiw96/GoCommerceAPI/testutils"
+
+	errs "github.com/dwiw96/GoCommerceAPI/pkg/utils/responses"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	serviceTest rates.IService
+	ctx         context.Context
+	pool        *pgxpool.Pool
+)
+
+func TestMain(m *testing.M) {
+	pool = testUtils.GetPool()
+	defer pool.Close()
+	ctx = testUtils.GetContext()
+	defer ctx.Done()
+
+	schemaCleanup := testUtils.SetupDB("test_service_rates")
+
+	serviceTest = NewRatesService(ctx, ratesRepo.NewRatesRepository(pool, ctx))
+
+	exitTest := m.Run()
+
+	schemaCleanup()
+
+	os.Exit(exitTest)
+}
+
+func TestUpsertRate(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		desc string
+		arg  rates.UpsertRateParams
+		code int
+		err  error
+	}{
+		{
+			desc: "success",
+			arg:  rates.UpsertRateParams{BaseCurrency: "USD", QuoteCurrency: "IDR", Rate: 16000},
+			code: errs.CodeSuccess,
+		}, {
+			desc: "failed_same_currency",
+			arg:  rates.UpsertRateParams{BaseCurrency: "USD", QuoteCurrency: "USD", Rate: 1},
+			code: errs.CodeFailedUser,
+			err:  errs.ErrInvalidInput,
+		}, {
+			desc: "failed_zero_rate",
+			arg:  rates.UpsertRateParams{BaseCurrency: "EUR", QuoteCurrency: "USD", Rate: 0},
+			code: errs.CodeFailedUser,
+			err:  errs.ErrInvalidInput,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			res, code, err := serviceTest.UpsertRate(tC.arg)
+			assert.Equal(t, tC.code, code)
+			if tC.err != nil {
+				require.Error(t, err)
+				assert.Equal(t, tC.err, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tC.arg.Rate, res.Rate)
+		})
+	}
+}
+
+func TestListAndDeleteRate(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	_, _, err = serviceTest.UpsertRate(rates.UpsertRateParams{BaseCurrency: "USD", QuoteCurrency: "IDR", Rate: 16000})
+	require.NoError(t, err)
+
+	res, code, err := serviceTest.ListRates()
+	require.NoError(t, err)
+	assert.Equal(t, errs.CodeSuccess, code)
+	require.Len(t, res, 1)
+
+	code, err = serviceTest.DeleteRate(rates.DeleteRateParams{BaseCurrency: "USD", QuoteCurrency: "IDR"})
+	require.NoError(t, err)
+	assert.Equal(t, errs.CodeSuccess, code)
+
+	code, err = serviceTest.DeleteRate(rates.DeleteRateParams{BaseCurrency: "USD", QuoteCurrency: "IDR"})
+	require.Error(t, err)
+	assert.Equal(t, errs.CodeFailedUser, code)
+	assert.Equal(t, errs.ErrNoData, err)
+}
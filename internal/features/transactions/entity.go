@@ -1,6 +1,8 @@
 package transactions
 
 import (
+	"time"
+
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
@@ -24,6 +26,7 @@ const (
 	TransactionTypesDeposit    TransactionTypes = "deposit"
 	TransactionTypesWithdrawal TransactionTypes = "withdrawal"
 	TransactionTypesTransfer   TransactionTypes = "transfer"
+	TransactionTypesRefund     TransactionTypes = "refund"
 )
 
 type NullTransactionTypes struct {
@@ -32,25 +35,37 @@ type NullTransactionTypes struct {
 }
 
 type TransactionHistory struct {
-	ID           int32
-	FromWalletID pgtype.Int4
-	ToWalletID   pgtype.Int4
-	ProductID    pgtype.Int4
-	Amount       int32
-	Quantity     pgtype.Int4
-	TType        TransactionTypes
-	TStatus      TransactionStatus
-	CreatedAt    pgtype.Timestamp
+	ID               int32
+	FromWalletID     pgtype.Int4
+	ToWalletID       pgtype.Int4
+	ProductID        pgtype.Int4
+	Amount           int32
+	Quantity         pgtype.Int4
+	TType            TransactionTypes
+	TStatus          TransactionStatus
+	OrderID          pgtype.Int4
+	RefTransactionID pgtype.Int4
+	// ExchangeRate is the rate applied when the two sides of the transaction
+	// use different currencies, ConvertedAmount is Amount in the other
+	// currency: the receiving wallet's for a transfer, the product's for a
+	// purchase. Both are NULL when no conversion happened.
+	ExchangeRate    pgtype.Float8
+	ConvertedAmount pgtype.Int4
+	CreatedAt       pgtype.Timestamp
 }
 
 type CreateTransactionParams struct {
-	FromWalletID pgtype.Int4
-	ToWalletID   pgtype.Int4
-	ProductID    pgtype.Int4
-	Amount       int32
-	Quantity     pgtype.Int4
-	TType        TransactionTypes
-	TStatus      TransactionStatus
+	FromWalletID     pgtype.Int4
+	ToWalletID       pgtype.Int4
+	ProductID        pgtype.Int4
+	Amount           int32
+	Quantity         pgtype.Int4
+	TType            TransactionTypes
+	TStatus          TransactionStatus
+	OrderID          pgtype.Int4
+	RefTransactionID pgtype.Int4
+	ExchangeRate     pgtype.Float8
+	ConvertedAmount  pgtype.Int4
 }
 
 type UpdateTransactionStatusParams struct {
@@ -67,6 +82,93 @@ type TransactionParams struct {
 	Amount       int32
 	Quantity     pgtype.Int4
 	TType        TransactionTypes
+	// RefTransactionID is the purchase being refunded, only used by refund.
+	RefTransactionID pgtype.Int4
+	// AsAdmin lets a transfer send money from a wallet UserID doesn't own.
+	AsAdmin bool
+}
+
+// ListTransactionsParams filters the transactions of one user. Every
+// optional filter is skipped when not Valid. AfterID is the cursor, only rows
+// with a smaller id are returned.
+type ListTransactionsParams struct {
+	UserID      int32
+	TType       NullTransactionTypes
+	TStatus     NullTransactionStatus
+	ProductID   pgtype.Int4
+	CreatedFrom pgtype.Timestamp
+	CreatedTo   pgtype.Timestamp
+	MinAmount   pgtype.Int4
+	MaxAmount   pgtype.Int4
+	AfterID     pgtype.Int4
+	Limit       int32
+}
+
+// ListWalletTransactionsParams selects the rows of one wallet created in
+// [CreatedFrom, CreatedTo), a bound is skipped when not Valid.
+type ListWalletTransactionsParams struct {
+	WalletID    int32
+	CreatedFrom pgtype.Timestamp
+	CreatedTo   pgtype.Timestamp
+}
+
+// RefundTotals is what has already been refunded from one purchase.
+type RefundTotals struct {
+	Quantity int32
+	Amount   int32
+}
+
+// WalletEffect is how much t changes the balance of walletID once it is
+// completed, 0 when the wallet is not part of t. Withdrawal amounts are
+// stored negative, older rows may have them positive. A transfer between
+// currencies credits the receiving wallet with ConvertedAmount.
+func WalletEffect(t TransactionHistory, walletID int32) int32 {
+	var effect int32
+	if t.FromWalletID.Valid && t.FromWalletID.Int32 == walletID {
+		switch t.TType {
+		case TransactionTypesWithdrawal:
+			if t.Amount > 0 {
+				effect -= t.Amount
+			} else {
+				effect += t.Amount
+			}
+		case TransactionTypesPurchase, TransactionTypesTransfer:
+			effect -= t.Amount
+		}
+	}
+	if t.ToWalletID.Valid && t.ToWalletID.Int32 == walletID {
+		switch t.TType {
+		case TransactionTypesDeposit, TransactionTypesRefund:
+			effect += t.Amount
+		case TransactionTypesTransfer:
+			effect += t.CreditedAmount()
+		}
+	}
+
+	return effect
+}
+
+// CreditedAmount is what a transfer adds to the receiving wallet.
+func (t TransactionHistory) CreditedAmount() int32 {
+	if t.TType == TransactionTypesTransfer && t.ConvertedAmount.Valid {
+		return t.ConvertedAmount.Int32
+	}
+
+	return t.Amount
+}
+
+type ReconcileDecision string
+
+const (
+	ReconcileDecisionCompleted ReconcileDecision = "completed"
+	ReconcileDecisionFailed    ReconcileDecision = "failed"
+	ReconcileDecisionSkipped   ReconcileDecision = "skipped"
+)
+
+type ReconcileResult struct {
+	Transaction TransactionHistory
+	Decision    ReconcileDecision
+	Reason      string
 }
 
 type IRepository interface {
@@ -75,10 +177,23 @@ type IRepository interface {
 	TransactionPurchaseProduct(arg TransactionParams) (*TransactionHistory, error)
 	TransactionDepositOrWithdraw(arg TransactionParams) (*TransactionHistory, error)
 	TransactionTransfer(arg TransactionParams) (*TransactionHistory, error)
+	ListTransactionsByOrderID(orderID int32) ([]TransactionHistory, error)
+	GetTransactionByIDForUpdate(id int32) (*TransactionHistory, error)
+	GetRefundTotals(refTransactionID int32) (*RefundTotals, error)
+	GetOrderRefundedAmount(orderID int32) (int32, error)
+	TransactionRefund(arg TransactionParams) (*TransactionHistory, error)
+	ListStalePendingTransactions(olderThan time.Duration, limit int32) ([]TransactionHistory, error)
+	GetWalletCompletedEffect(walletID int32) (int32, error)
+	ReconcileTransaction(id int32) (*ReconcileResult, error)
+	ListTransactionsByUserID(arg ListTransactionsParams) ([]TransactionHistory, error)
+	EachTransactionByWalletID(arg ListWalletTransactionsParams, fn func(TransactionHistory) error) error
+	GetWalletBalanceBefore(walletID int32, before pgtype.Timestamp) (int32, error)
 }
 
 type IService interface {
 	PurchaseProduct(arg TransactionParams) (res *TransactionHistory, code int, err error)
 	DepositOrWithdraw(arg TransactionParams) (res *TransactionHistory, code int, err error)
 	Transfer(arg TransactionParams) (res *TransactionHistory, code int, err error)
+	Refund(arg TransactionParams) (res *TransactionHistory, code int, err error)
+	ListTransactions(arg ListTransactionsParams, cursor string) (res []TransactionHistory, nextCursor string, code int, err error)
 }
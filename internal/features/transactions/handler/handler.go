@@ -19,17 +19,25 @@ import (
 )
 
 type transactionsHandler struct {
-	router   *gin.Engine
-	service  transactions.IService
-	validate *validator.Validate
-	trans    ut.Translator
+	router          *gin.Engine
+	service         transactions.IService
+	stepUp          auth.IStepUp
+	validate        *validator.Validate
+	trans           ut.Translator
+	requireVerified bool
 }
 
-func NewTransactionsHandler(router *gin.Engine, service transactions.IService, pool *pgxpool.Pool, client *redis.Client, ctx context.Context) {
+// NewTransactionsHandler registers the transaction routes. With
+// requireVerified a user must verify the email before purchases and
+// transfers. stepUp asks for a TOTP code before a large withdrawal or
+// transfer.
+func NewTransactionsHandler(router *gin.Engine, service transactions.IService, stepUp auth.IStepUp, pool *pgxpool.Pool, client *redis.Client, ctx context.Context, requireVerified bool) {
 	handler := &transactionsHandler{
-		router:   router,
-		service:  service,
-		validate: validator.New(),
+		router:          router,
+		service:         service,
+		stepUp:          stepUp,
+		validate:        validator.New(),
+		requireVerified: requireVerified,
 	}
 
 	en := en.New()
@@ -40,7 +48,8 @@ func NewTransactionsHandler(router *gin.Engine, service transactions.IService, p
 
 	router.Use(mid.AuthMiddleware(ctx, pool, client))
 
-	router.POST("/api/v1/transactions", handler.transaction)
+	router.POST("/api/v1/transactions", mid.IdempotencyMiddleware(ctx, client), handler.transaction)
+	router.GET("/api/v1/transactions", handler.listTransactions)
 }
 
 func translateError(trans ut.Translator, err error) (errTrans []string) {
@@ -73,12 +82,27 @@ func (h *transactionsHandler) transaction(c *gin.Context) {
 		return
 	}
 
+	// the route takes every type, so only payments go through the check of
+	// mid.VerifiedMiddleware
+	isPayment := reqBody.TransactionType == string(transactions.TransactionTypesPurchase) || reqBody.TransactionType == string(transactions.TransactionTypesTransfer)
+	if isPayment && !mid.CheckVerified(c, h.requireVerified) {
+		return
+	}
+
+	if reqBody.TransactionType == string(transactions.TransactionTypesWithdrawal) || reqBody.TransactionType == string(transactions.TransactionTypesTransfer) {
+		code, err := h.stepUp.CheckStepUp(*authPayload, reqBody.Amount, c.GetHeader(auth.TOTPCodeHeader))
+		if err != nil {
+			responses.ErrorJSON(c, code, []string{err.Error()}, c.Request.RemoteAddr)
+			return
+		}
+	}
+
 	var (
 		res  *transactions.TransactionHistory
 		code int
 	)
 
-	transactionsArg := toTransactionstArg(authPayload.UserID, reqBody)
+	transactionsArg := toTransactionstArg(authPayload, reqBody)
 	switch reqBody.TransactionType {
 	case string(transactions.TransactionTypesPurchase):
 		res, code, err = h.service.PurchaseProduct(transactionsArg)
@@ -86,6 +110,8 @@ func (h *transactionsHandler) transaction(c *gin.Context) {
 		res, code, err = h.service.DepositOrWithdraw(transactionsArg)
 	case string(transactions.TransactionTypesTransfer):
 		res, code, err = h.service.Transfer(transactionsArg)
+	case string(transactions.TransactionTypesRefund):
+		res, code, err = h.service.Refund(transactionsArg)
 	}
 
 	if err != nil && res != nil {
@@ -103,3 +129,34 @@ func (h *transactionsHandler) transaction(c *gin.Context) {
 	response := responses.SuccessWithDataResponse(respBody, code, "success")
 	c.IndentedJSON(code, response)
 }
+
+func (h *transactionsHandler) listTransactions(c *gin.Context) {
+	authPayload, isExists := c.Keys["payloadKey"].(*auth.JwtPayload)
+	if !isExists {
+		responses.ErrorJSON(c, 401, []string{"token is wrong"}, c.Request.RemoteAddr)
+		return
+	}
+
+	var reqQuery listTransactionsReq
+	err := c.ShouldBindQuery(&reqQuery)
+	if err != nil {
+		responses.ErrorJSON(c, 422, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+	err = h.validate.Struct(&reqQuery)
+	if err != nil {
+		errTranslated := translateError(h.trans, err)
+		responses.ErrorJSON(c, 422, errTranslated, c.Request.RemoteAddr)
+		return
+	}
+
+	arg := toListTransactionsArg(authPayload.UserID, reqQuery)
+	res, nextCursor, code, err := h.service.ListTransactions(arg, reqQuery.Cursor)
+	if err != nil {
+		responses.ErrorJSON(c, code, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	response := responses.SuccessWithDataResponseCursor(toListTransactionResp(res), nextCursor, "list of transactions")
+	c.IndentedJSON(code, response)
+}
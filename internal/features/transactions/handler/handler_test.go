@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	cfg "github.com/dwiw96/GoCommerceAPI/config"
+	auth "github.com/dwiw96/GoCommerceAPI/internal/features/auth"
+	transactions "github.com/dwiw96/GoCommerceAPI/internal/features/transactions"
+	rd "github.com/dwiw96/GoCommerceAPI/pkg/driver/redis"
+	mid "github.com/dwiw96/GoCommerceAPI/pkg/middleware"
+	generator "github.com/dwiw96/GoCommerceAPI/pkg/utils/generator"
+	responses "github.com/dwiw96/GoCommerceAPI/pkg/utils/responses"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	ctx    context.Context
+	client *redis.Client
+)
+
+func TestMain(m *testing.M) {
+	os.Setenv("REDIS_HOST", "localhost:6379")
+	os.Setenv("REDIS_PASSWORD", "")
+
+	env := &cfg.EnvConfig{
+		REDIS_HOST:     os.Getenv("REDIS_HOST"),
+		REDIS_PASSWORD: os.Getenv("REDIS_PASSWORD"),
+	}
+	client = rd.ConnectToRedis(env)
+	defer client.Close()
+
+	ctx = context.Background()
+
+	os.Exit(m.Run())
+}
+
+// serviceStub only withdraws, it counts the withdrawals it did.
+type serviceStub struct {
+	transactions.IService
+	withdrawals int
+}
+
+func (s *serviceStub) DepositOrWithdraw(arg transactions.TransactionParams) (*transactions.TransactionHistory, int, error) {
+	s.withdrawals++
+	return &transactions.TransactionHistory{ID: int32(s.withdrawals), TType: arg.TType, Amount: arg.Amount}, responses.CodeSuccess, nil
+}
+
+// stepUpStub asks every amount for the code in totpCode.
+type stepUpStub struct {
+	totpCode string
+}
+
+func (s stepUpStub) CheckStepUp(payload auth.JwtPayload, amount int32, totpCode string) (int, error) {
+	switch totpCode {
+	case "":
+		return responses.CodeFailedForbidden, responses.ErrTOTPRequired
+	case s.totpCode:
+		return responses.CodeSuccess, nil
+	}
+
+	return responses.CodeFailedForbidden, responses.ErrInvalidTOTPCode
+}
+
+func TestTransactionStepUpRetry(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	service := &serviceStub{}
+	handler := &transactionsHandler{
+		router:   router,
+		service:  service,
+		stepUp:   stepUpStub{totpCode: "123456"},
+		validate: validator.New(),
+	}
+	payload := &auth.JwtPayload{UserID: generator.RandomInt32(1, 1000000)}
+	router.Use(func(c *gin.Context) {
+		c.Set("payloadKey", payload)
+		c.Next()
+	})
+	router.POST("/api/v1/transactions", mid.IdempotencyMiddleware(ctx, client), handler.transaction)
+
+	key := generator.CreateRandomString(20)
+	withdraw := func(totpCode string) *httptest.ResponseRecorder {
+		body := `{"transaction_type":"withdrawal","from_wallet_id":1,"amount":5000}`
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/transactions", strings.NewReader(body))
+		req.Header.Set(mid.IdempotencyKeyHeader, key)
+		if totpCode != "" {
+			req.Header.Set(auth.TOTPCodeHeader, totpCode)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	res := withdraw("")
+	require.Equal(t, http.StatusForbidden, res.Code)
+	assert.Contains(t, res.Body.String(), responses.ErrTOTPRequired.Error())
+
+	res = withdraw("000000")
+	require.Equal(t, http.StatusForbidden, res.Code)
+	assert.Contains(t, res.Body.String(), responses.ErrInvalidTOTPCode.Error())
+	assert.Empty(t, res.Header().Get(mid.IdempotencyReplayedHeader))
+
+	// the retry with the code runs, the step up answers weren't stored
+	res = withdraw("123456")
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Empty(t, res.Header().Get(mid.IdempotencyReplayedHeader))
+	assert.Equal(t, 1, service.withdrawals)
+
+	// from now on the withdrawal is replayed
+	res = withdraw("123456")
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "true", res.Header().Get(mid.IdempotencyReplayedHeader))
+	assert.Equal(t, 1, service.withdrawals)
+}
+
+func TestTransactionNegativeAmount(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	service := &serviceStub{}
+	handler := &transactionsHandler{
+		router:   router,
+		service:  service,
+		stepUp:   stepUpStub{totpCode: "123456"},
+		validate: validator.New(),
+	}
+	payload := &auth.JwtPayload{UserID: generator.RandomInt32(1, 1000000)}
+	router.Use(func(c *gin.Context) {
+		c.Set("payloadKey", payload)
+		c.Next()
+	})
+	router.POST("/api/v1/transactions", handler.transaction)
+
+	// a negative amount would dodge the step up threshold
+	body := `{"transaction_type":"withdrawal","from_wallet_id":1,"amount":-5000}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/transactions", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Equal(t, 0, service.withdrawals)
+}
+
+func TestTransactionRequireVerified(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	service := &serviceStub{}
+	handler := &transactionsHandler{
+		router:          router,
+		service:         service,
+		stepUp:          stepUpStub{totpCode: "123456"},
+		validate:        validator.New(),
+		requireVerified: true,
+	}
+	payload := &auth.JwtPayload{UserID: generator.RandomInt32(1, 1000000)}
+	router.Use(func(c *gin.Context) {
+		c.Set("payloadKey", payload)
+		c.Next()
+	})
+	router.POST("/api/v1/transactions", handler.transaction)
+
+	send := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/transactions", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// only payments need a verified email
+	res := send(`{"transaction_type":"transfer","from_wallet_id":1,"to_wallet_id":2,"amount":100}`)
+	require.Equal(t, http.StatusForbidden, res.Code)
+	assert.Contains(t, res.Body.String(), responses.ErrEmailNotVerified.Error())
+
+	res = send(`{"transaction_type":"purchase","from_wallet_id":1,"product_id":1,"quantity":1}`)
+	require.Equal(t, http.StatusForbidden, res.Code)
+	assert.Contains(t, res.Body.String(), responses.ErrEmailNotVerified.Error())
+
+	res = send(`{"transaction_type":"deposit","to_wallet_id":1,"amount":100}`)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, 1, service.withdrawals)
+}
@@ -1,27 +1,81 @@
 package handler
 
 import (
+	"time"
+
+	auth "github.com/dwiw96/GoCommerceAPI/internal/features/auth"
 	"github.com/dwiw96/GoCommerceAPI/internal/features/transactions"
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
 type transactionReq struct {
-	TransactionType  string `json:"transaction_type" validate:"required,oneof=purchase transfer deposit withdrawal"`
+	TransactionType  string `json:"transaction_type" validate:"required,oneof=purchase transfer deposit withdrawal refund"`
 	FromWalletUserID int32  `json:"from_wallet_id" validate:"number"`
 	ToWalletUserID   int32  `json:"to_wallet_id" validate:"number"`
 	ProductID        int32  `json:"product_id"`
-	Amount           int32  `json:"amount"`
+	Amount           int32  `json:"amount" validate:"omitempty,gt=0"`
 	Quantity         int32  `json:"quantity" validate:"number"`
+	TransactionID    int32  `json:"transaction_id" validate:"number"`
 }
 
-func toTransactionstArg(userID int32, input transactionReq) transactions.TransactionParams {
+func toTransactionstArg(payload *auth.JwtPayload, input transactionReq) transactions.TransactionParams {
 	return transactions.TransactionParams{
-		UserID:       pgtype.Int4{Int32: userID, Valid: true},
-		FromWalletID: pgtype.Int4{Int32: input.FromWalletUserID, Valid: true},
-		ToWalletID:   pgtype.Int4{Int32: input.ToWalletUserID, Valid: true},
-		Amount:       input.Amount,
-		ProductID:    pgtype.Int4{Int32: input.ProductID, Valid: true},
-		Quantity:     pgtype.Int4{Int32: input.Quantity, Valid: true},
-		TType:        transactions.TransactionTypes(input.TransactionType),
+		UserID:           pgtype.Int4{Int32: payload.UserID, Valid: true},
+		FromWalletID:     pgtype.Int4{Int32: input.FromWalletUserID, Valid: true},
+		ToWalletID:       pgtype.Int4{Int32: input.ToWalletUserID, Valid: true},
+		Amount:           input.Amount,
+		ProductID:        pgtype.Int4{Int32: input.ProductID, Valid: true},
+		Quantity:         pgtype.Int4{Int32: input.Quantity, Valid: true},
+		TType:            transactions.TransactionTypes(input.TransactionType),
+		RefTransactionID: pgtype.Int4{Int32: input.TransactionID, Valid: true},
+		AsAdmin:          payload.Role == auth.RoleAdmin,
+	}
+}
+
+const dateLayout = "2006-01-02"
+
+// listTransactionsReq is the query string of GET /api/v1/transactions, from
+// and to are dates and both are inclusive.
+type listTransactionsReq struct {
+	TransactionType   string `form:"transaction_type" validate:"omitempty,oneof=purchase transfer deposit withdrawal refund"`
+	TransactionStatus string `form:"transaction_status" validate:"omitempty,oneof=completed pending failed"`
+	ProductID         int32  `form:"product_id" validate:"omitempty,min=1"`
+	From              string `form:"from" validate:"omitempty,datetime=2006-01-02"`
+	To                string `form:"to" validate:"omitempty,datetime=2006-01-02"`
+	MinAmount         *int32 `form:"min_amount" validate:"omitempty,min=0"`
+	MaxAmount         *int32 `form:"max_amount" validate:"omitempty,min=0"`
+	Limit             int32  `form:"limit" validate:"omitempty,min=1,max=100"`
+	Cursor            string `form:"cursor"`
+}
+
+func toListTransactionsArg(userID int32, input listTransactionsReq) transactions.ListTransactionsParams {
+	res := transactions.ListTransactionsParams{
+		UserID: userID,
+		TType: transactions.NullTransactionTypes{
+			TransactionTypes: transactions.TransactionTypes(input.TransactionType),
+			Valid:            input.TransactionType != "",
+		},
+		TStatus: transactions.NullTransactionStatus{
+			TransactionStatus: transactions.TransactionStatus(input.TransactionStatus),
+			Valid:             input.TransactionStatus != "",
+		},
+		ProductID: pgtype.Int4{Int32: input.ProductID, Valid: input.ProductID != 0},
+		Limit:     input.Limit,
 	}
+
+	// the layout is already checked by the validator
+	if from, err := time.Parse(dateLayout, input.From); err == nil {
+		res.CreatedFrom = pgtype.Timestamp{Time: from, Valid: true}
+	}
+	if to, err := time.Parse(dateLayout, input.To); err == nil {
+		res.CreatedTo = pgtype.Timestamp{Time: to.AddDate(0, 0, 1), Valid: true}
+	}
+	if input.MinAmount != nil {
+		res.MinAmount = pgtype.Int4{Int32: *input.MinAmount, Valid: true}
+	}
+	if input.MaxAmount != nil {
+		res.MaxAmount = pgtype.Int4{Int32: *input.MaxAmount, Valid: true}
+	}
+
+	return res
 }
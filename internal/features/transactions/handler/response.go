@@ -7,6 +7,7 @@ import (
 )
 
 type transactionResp struct {
+	ID               int32                          `json:"id"`
 	FromWalletUserID int32                          `json:"from_wallet_id" validate:"number"`
 	ToWalletUserID   int32                          `json:"to_wallet_id" validate:"number"`
 	ProductID        int32                          `json:"product_id"`
@@ -14,11 +15,16 @@ type transactionResp struct {
 	Amount           int32                          `json:"amount"`
 	TType            transactions.TransactionTypes  `json:"transaction_type"`
 	TStatus          transactions.TransactionStatus `json:"transaction_status"`
+	OrderID          int32                          `json:"order_id,omitempty"`
+	RefTransactionID int32                          `json:"ref_transaction_id,omitempty"`
+	ExchangeRate     float64                        `json:"exchange_rate,omitempty"`
+	ConvertedAmount  int32                          `json:"converted_amount,omitempty"`
 	CreatedAt        time.Time                      `json:"created_at"`
 }
 
 func toTransactionResp(input *transactions.TransactionHistory) transactionResp {
 	return transactionResp{
+		ID:               input.ID,
 		FromWalletUserID: input.FromWalletID.Int32,
 		ToWalletUserID:   input.ToWalletID.Int32,
 		ProductID:        input.ProductID.Int32,
@@ -26,6 +32,19 @@ func toTransactionResp(input *transactions.TransactionHistory) transactionResp {
 		Amount:           input.Amount,
 		TType:            input.TType,
 		TStatus:          input.TStatus,
+		OrderID:          input.OrderID.Int32,
+		RefTransactionID: input.RefTransactionID.Int32,
+		ExchangeRate:     input.ExchangeRate.Float64,
+		ConvertedAmount:  input.ConvertedAmount.Int32,
 		CreatedAt:        input.CreatedAt.Time,
 	}
 }
+
+func toListTransactionResp(input []transactions.TransactionHistory) []transactionResp {
+	res := []transactionResp{}
+	for i := range input {
+		res = append(res, toTransactionResp(&input[i]))
+	}
+
+	return res
+}
@@ -2,15 +2,28 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
 
 	db "github.com/dwiw96/GoCommerceAPI/internal/db"
+	ledger "github.com/dwiw96/GoCommerceAPI/internal/features/ledger"
+	ledgerRepo "github.com/dwiw96/GoCommerceAPI/internal/features/ledger/repository"
+	orders "github.com/dwiw96/GoCommerceAPI/internal/features/orders"
+	ordersRepo "github.com/dwiw96/GoCommerceAPI/internal/features/orders/repository"
 	products "github.com/dwiw96/GoCommerceAPI/internal/features/products"
 	productsRepo "github.com/dwiw96/GoCommerceAPI/internal/features/products/repository"
+	rates "github.com/dwiw96/GoCommerceAPI/internal/features/rates"
+	ratesRepo "github.com/dwiw96/GoCommerceAPI/internal/features/rates/repository"
 	transactions "github.com/dwiw96/GoCommerceAPI/internal/features/transactions"
 	wallets "github.com/dwiw96/GoCommerceAPI/internal/features/wallets"
 	walletsRepo "github.com/dwiw96/GoCommerceAPI/internal/features/wallets/repository"
+	errs "github.com/dwiw96/GoCommerceAPI/pkg/utils/responses"
 
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -20,6 +33,9 @@ type transactionsRepository struct {
 	ctx          context.Context
 	walletsRepo  wallets.IRepository
 	productsRepo products.IRepository
+	ordersRepo   orders.IRepository
+	ledgerRepo   ledger.IRepository
+	ratesRepo    rates.IRepository
 }
 
 func NewTransactionsRepository(db db.DBTX, dbTx *pgxpool.Pool, ctx context.Context) transactions.IRepository {
@@ -48,19 +64,22 @@ func (r *transactionsRepository) ExecDbTx(fn func(*transactionsRepository) error
 
 	productRepo := productsRepo.NewProductRepository(tx)
 	walletRepo := walletsRepo.NewWalletsRepository(tx, r.ctx)
+	orderRepo := ordersRepo.NewOrdersRepository(tx, r.ctx)
+	ledgerRepository := ledgerRepo.NewLedgerRepository(tx, r.ctx)
+	rateRepo := ratesRepo.NewRatesRepository(tx, r.ctx)
 
-	q := &transactionsRepository{db: tx, ctx: r.ctx, walletsRepo: walletRepo, productsRepo: productRepo}
+	q := &transactionsRepository{db: tx, ctx: r.ctx, walletsRepo: walletRepo, productsRepo: productRepo, ordersRepo: orderRepo, ledgerRepo: ledgerRepository, ratesRepo: rateRepo}
 	err = fn(q)
+	if err != nil {
+		tx.Rollback(r.ctx)
+		return err
+	}
 
-	defer func() {
-		if err != nil {
-			tx.Rollback(r.ctx)
-		} else {
-			tx.Commit(r.ctx)
-		}
-	}()
+	if err = tx.Commit(r.ctx); err != nil {
+		return fmt.Errorf("failed to commit db transaction, err: %w", err)
+	}
 
-	return err
+	return nil
 }
 
 const createTransaction = `-- name: CreateTransaction :one
@@ -72,11 +91,15 @@ INSERT INTO
         amount,
         quantity,
         t_type,
-        t_status
+        t_status,
+        order_id,
+        ref_transaction_id,
+        exchange_rate,
+        converted_amount
     )
 VALUES (
-    $1, $2, $3, $4, $5, $6, $7
-) RETURNING id, from_wallet_id, to_wallet_id, product_id, amount, quantity, t_type, t_status, created_at
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11
+) RETURNING id, from_wallet_id, to_wallet_id, product_id, amount, quantity, t_type, t_status, order_id, ref_transaction_id, exchange_rate, converted_amount, created_at
 `
 
 func (r *transactionsRepository) CreateTransaction(arg transactions.CreateTransactionParams) (*transactions.TransactionHistory, error) {
@@ -88,6 +111,10 @@ func (r *transactionsRepository) CreateTransaction(arg transactions.CreateTransa
 		arg.Quantity,
 		arg.TType,
 		arg.TStatus,
+		arg.OrderID,
+		arg.RefTransactionID,
+		arg.ExchangeRate,
+		arg.ConvertedAmount,
 	)
 	var i transactions.TransactionHistory
 	err := row.Scan(
@@ -99,6 +126,10 @@ func (r *transactionsRepository) CreateTransaction(arg transactions.CreateTransa
 		&i.Quantity,
 		&i.TType,
 		&i.TStatus,
+		&i.OrderID,
+		&i.RefTransactionID,
+		&i.ExchangeRate,
+		&i.ConvertedAmount,
 		&i.CreatedAt,
 	)
 	return &i, err
@@ -112,7 +143,7 @@ SET
     t_status = $2
 WHERE 
     id = $3
-RETURNING id, from_wallet_id, to_wallet_id, product_id, amount, quantity, t_type, t_status, created_at
+RETURNING id, from_wallet_id, to_wallet_id, product_id, amount, quantity, t_type, t_status, order_id, ref_transaction_id, exchange_rate, converted_amount, created_at
 `
 
 func (r *transactionsRepository) UpdateTransactionStatus(arg transactions.UpdateTransactionStatusParams) (*transactions.TransactionHistory, error) {
@@ -127,47 +158,319 @@ func (r *transactionsRepository) UpdateTransactionStatus(arg transactions.Update
 		&i.Quantity,
 		&i.TType,
 		&i.TStatus,
+		&i.OrderID,
+		&i.RefTransactionID,
+		&i.ExchangeRate,
+		&i.ConvertedAmount,
 		&i.CreatedAt,
 	)
 	return &i, err
 }
 
+const listTransactionsByOrderID = `-- name: ListTransactionsByOrderID :many
+SELECT id, from_wallet_id, to_wallet_id, product_id, amount, quantity, t_type, t_status, order_id, ref_transaction_id, exchange_rate, converted_amount, created_at
+FROM transaction_histories
+WHERE order_id = $1
+ORDER BY id ASC
+`
+
+func (r *transactionsRepository) ListTransactionsByOrderID(orderID int32) ([]transactions.TransactionHistory, error) {
+	rows, err := r.db.Query(r.ctx, listTransactionsByOrderID, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []transactions.TransactionHistory
+	for rows.Next() {
+		var i transactions.TransactionHistory
+		if err := rows.Scan(
+			&i.ID,
+			&i.FromWalletID,
+			&i.ToWalletID,
+			&i.ProductID,
+			&i.Amount,
+			&i.Quantity,
+			&i.TType,
+			&i.TStatus,
+			&i.OrderID,
+			&i.RefTransactionID,
+			&i.ExchangeRate,
+			&i.ConvertedAmount,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// listTransactionsByUserID returns the rows where one of the user's wallets
+// is on either side, newest first.
+const listTransactionsByUserID = `-- name: ListTransactionsByUserID :many
+SELECT id, from_wallet_id, to_wallet_id, product_id, amount, quantity, t_type, t_status, order_id, ref_transaction_id, exchange_rate, converted_amount, created_at
+FROM transaction_histories
+WHERE
+    (from_wallet_id IN (SELECT id FROM wallets WHERE user_id = $1)
+    OR to_wallet_id IN (SELECT id FROM wallets WHERE user_id = $1))
+AND ($2::TEXT IS NULL OR t_type = $2::TEXT::transaction_types)
+AND ($3::TEXT IS NULL OR t_status = $3::TEXT::transaction_status)
+AND ($4::INT IS NULL OR product_id = $4)
+AND ($5::TIMESTAMP IS NULL OR created_at >= $5)
+AND ($6::TIMESTAMP IS NULL OR created_at < $6)
+AND ($7::INT IS NULL OR ABS(amount) >= $7)
+AND ($8::INT IS NULL OR ABS(amount) <= $8)
+AND ($9::INT IS NULL OR id < $9)
+ORDER BY id DESC
+LIMIT $10
+`
+
+func (r *transactionsRepository) ListTransactionsByUserID(arg transactions.ListTransactionsParams) ([]transactions.TransactionHistory, error) {
+	rows, err := r.db.Query(r.ctx, listTransactionsByUserID,
+		arg.UserID,
+		pgtype.Text{String: string(arg.TType.TransactionTypes), Valid: arg.TType.Valid},
+		pgtype.Text{String: string(arg.TStatus.TransactionStatus), Valid: arg.TStatus.Valid},
+		arg.ProductID,
+		arg.CreatedFrom,
+		arg.CreatedTo,
+		arg.MinAmount,
+		arg.MaxAmount,
+		arg.AfterID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []transactions.TransactionHistory
+	for rows.Next() {
+		var i transactions.TransactionHistory
+		if err := rows.Scan(
+			&i.ID,
+			&i.FromWalletID,
+			&i.ToWalletID,
+			&i.ProductID,
+			&i.Amount,
+			&i.Quantity,
+			&i.TType,
+			&i.TStatus,
+			&i.OrderID,
+			&i.RefTransactionID,
+			&i.ExchangeRate,
+			&i.ConvertedAmount,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// eachTransactionByWalletID returns the rows where the wallet is on either
+// side, oldest first so a running balance can be built on top of them.
+const eachTransactionByWalletID = `-- name: EachTransactionByWalletID :many
+SELECT id, from_wallet_id, to_wallet_id, product_id, amount, quantity, t_type, t_status, order_id, ref_transaction_id, exchange_rate, converted_amount, created_at
+FROM transaction_histories
+WHERE
+    (from_wallet_id = $1 OR to_wallet_id = $1)
+AND ($2::TIMESTAMP IS NULL OR created_at >= $2)
+AND ($3::TIMESTAMP IS NULL OR created_at < $3)
+ORDER BY created_at ASC, id ASC
+`
+
+// EachTransactionByWalletID calls fn with every row as it's read instead of
+// collecting them, so a wallet with a long history isn't held in memory. An
+// error from fn stops the scan and is returned.
+func (r *transactionsRepository) EachTransactionByWalletID(arg transactions.ListWalletTransactionsParams, fn func(transactions.TransactionHistory) error) error {
+	rows, err := r.db.Query(r.ctx, eachTransactionByWalletID, arg.WalletID, arg.CreatedFrom, arg.CreatedTo)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var i transactions.TransactionHistory
+		if err := rows.Scan(
+			&i.ID,
+			&i.FromWalletID,
+			&i.ToWalletID,
+			&i.ProductID,
+			&i.Amount,
+			&i.Quantity,
+			&i.TType,
+			&i.TStatus,
+			&i.OrderID,
+			&i.RefTransactionID,
+			&i.ExchangeRate,
+			&i.ConvertedAmount,
+			&i.CreatedAt,
+		); err != nil {
+			return err
+		}
+		if err := fn(i); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// getTransactionByIDForUpdate locks the row until the surrounding db
+// transaction ends, so two refunds of the same purchase run one after another.
+const getTransactionByIDForUpdate = `-- name: GetTransactionByIDForUpdate :one
+SELECT id, from_wallet_id, to_wallet_id, product_id, amount, quantity, t_type, t_status, order_id, ref_transaction_id, exchange_rate, converted_amount, created_at
+FROM transaction_histories
+WHERE id = $1
+FOR UPDATE
+`
+
+func (r *transactionsRepository) GetTransactionByIDForUpdate(id int32) (*transactions.TransactionHistory, error) {
+	row := r.db.QueryRow(r.ctx, getTransactionByIDForUpdate, id)
+	var i transactions.TransactionHistory
+	err := row.Scan(
+		&i.ID,
+		&i.FromWalletID,
+		&i.ToWalletID,
+		&i.ProductID,
+		&i.Amount,
+		&i.Quantity,
+		&i.TType,
+		&i.TStatus,
+		&i.OrderID,
+		&i.RefTransactionID,
+		&i.ExchangeRate,
+		&i.ConvertedAmount,
+		&i.CreatedAt,
+	)
+	return &i, err
+}
+
+const getRefundTotals = `-- name: GetRefundTotals :one
+SELECT
+	COALESCE(SUM(quantity), 0)::INT,
+	COALESCE(SUM(amount), 0)::INT
+FROM transaction_histories
+WHERE ref_transaction_id = $1
+AND t_type = 'refund'
+AND t_status = 'completed';
+`
+
+func (r *transactionsRepository) GetRefundTotals(refTransactionID int32) (*transactions.RefundTotals, error) {
+	row := r.db.QueryRow(r.ctx, getRefundTotals, refTransactionID)
+	var i transactions.RefundTotals
+	err := row.Scan(
+		&i.Quantity,
+		&i.Amount,
+	)
+	return &i, err
+}
+
+const getOrderRefundedAmount = `-- name: GetOrderRefundedAmount :one
+SELECT
+	COALESCE(SUM(amount), 0)::INT
+FROM transaction_histories
+WHERE order_id = $1
+AND t_type = 'refund'
+AND t_status = 'completed';
+`
+
+func (r *transactionsRepository) GetOrderRefundedAmount(orderID int32) (int32, error) {
+	row := r.db.QueryRow(r.ctx, getOrderRefundedAmount, orderID)
+
+	var res int32
+	err := row.Scan(
+		&res,
+	)
+
+	return res, err
+}
+
+// createFailedTransaction records an attempt whose db transaction was rolled
+// back. It runs on r.db outside that transaction, so the failed row is kept.
+func (r *transactionsRepository) createFailedTransaction(arg transactions.CreateTransactionParams) *transactions.TransactionHistory {
+	arg.TStatus = transactions.TransactionStatusFailed
+	res, err := r.CreateTransaction(arg)
+	if err != nil {
+		log.Printf("failed to record failed transaction, err: %v", err)
+		return nil
+	}
+
+	return res
+}
+
+// createPostedTransaction creates a completed transaction and posts it to
+// the ledger, it must run inside ExecDbTx next to the balance changes.
+func (r *transactionsRepository) createPostedTransaction(arg transactions.CreateTransactionParams) (*transactions.TransactionHistory, error) {
+	res, err := r.CreateTransaction(arg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transaction, err: %w", err)
+	}
+
+	_, err = r.ledgerRepo.PostTransaction(*res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to post transaction to ledger, err: %w", err)
+	}
+
+	return res, nil
+}
+
+// isBusinessFailure reports whether err means the request itself can't be
+// fulfilled, as opposed to bad input or a database failure.
+func isBusinessFailure(err error) bool {
+	return errors.Is(err, errs.ErrInsufficientBalance) || errors.Is(err, errs.ErrInsufficientStock)
+}
+
 func (t *transactionsRepository) TransactionPurchaseProduct(arg transactions.TransactionParams) (*transactions.TransactionHistory, error) {
 	var (
-		res    *transactions.TransactionHistory
-		amount int32
-		err    error
+		res            *transactions.TransactionHistory
+		createTransArg transactions.CreateTransactionParams
 	)
 
-	errCreateTransaction := t.ExecDbTx(func(tr *transactionsRepository) error {
-		resGetProduct, err := tr.productsRepo.GetProductByID(tr.ctx, arg.ProductID.Int32)
+	err := t.ExecDbTx(func(tr *transactionsRepository) error {
+		product, err := tr.productsRepo.GetProductByIDForUpdate(tr.ctx, arg.ProductID.Int32)
 		if err != nil {
 			return fmt.Errorf("failed to get product, err: %w", err)
 		}
-		amount = resGetProduct.Price * arg.Quantity.Int32
 
-		createTransactionArg := transactions.CreateTransactionParams{
-			FromWalletID: arg.FromWalletID,
+		wallet, err := tr.lockUserWallet(arg.UserID.Int32, arg.FromWalletID)
+		if err != nil {
+			return err
+		}
+
+		// the wallet pays the price converted to its own currency
+		price := product.Price * arg.Quantity.Int32
+		conversion, err := tr.ratesRepo.ConvertAmount(rates.ConvertParams{Amount: price, From: product.Currency, To: wallet.Currency})
+		if err != nil {
+			return err
+		}
+
+		createTransArg = transactions.CreateTransactionParams{
+			FromWalletID: pgtype.Int4{Int32: wallet.ID, Valid: true},
 			ProductID:    arg.ProductID,
-			Amount:       0,
+			Amount:       conversion.Amount,
 			Quantity:     arg.Quantity,
 			TType:        transactions.TransactionTypesPurchase,
-			TStatus:      transactions.TransactionStatusPending,
+			TStatus:      transactions.TransactionStatusCompleted,
+			ExchangeRate: conversion.Rate,
 		}
-		res, err = tr.CreateTransaction(createTransactionArg)
-		if err != nil {
-			return fmt.Errorf("failed to create transaction, err: %w", err)
+		if conversion.Rate.Valid {
+			createTransArg.ConvertedAmount = pgtype.Int4{Int32: price, Valid: true}
 		}
 
-		return err
-	})
-	if errCreateTransaction != nil {
-		return nil, errCreateTransaction
-	}
+		if product.Availability < arg.Quantity.Int32 {
+			return errs.ErrInsufficientStock
+		}
+		if wallet.Balance < createTransArg.Amount {
+			return errs.ErrInsufficientBalance
+		}
 
-	errUpdate := t.ExecDbTx(func(tr *transactionsRepository) error {
 		updateProductArg := products.UpdateProductAvailabilityParams{
-			ID:           arg.ProductID.Int32,
+			ID:           product.ID,
 			Availability: -arg.Quantity.Int32,
 		}
 		_, err = tr.productsRepo.UpdateProductAvailability(tr.ctx, updateProductArg)
@@ -176,133 +479,121 @@ func (t *transactionsRepository) TransactionPurchaseProduct(arg transactions.Tra
 		}
 
 		updateWalletArg := wallets.UpdateWalletParams{
-			Amount: -amount,
-			UserID: arg.UserID.Int32,
+			Amount:   -createTransArg.Amount,
+			WalletID: wallet.ID,
 		}
-		_, err = tr.walletsRepo.UpdateWalletByUserID(updateWalletArg)
+		_, err = tr.walletsRepo.UpdateWalletByID(updateWalletArg)
 		if err != nil {
 			return fmt.Errorf("failed to update wallet, err: %w", err)
 		}
 
-		return err
-	})
-
-	// change transaction status
-	var errUpdateTransaction error
-	errUpdateStatus := t.ExecDbTx(func(tr *transactionsRepository) error {
-		argUpdateStatus := transactions.UpdateTransactionStatusParams{
-			Amount: amount,
-			ID:     res.ID,
-		}
-
-		if errUpdate == nil {
-			argUpdateStatus.TStatus = transactions.TransactionStatusCompleted
-		} else {
-			argUpdateStatus.TStatus = transactions.TransactionStatusFailed
-		}
-
-		res, errUpdateTransaction = tr.UpdateTransactionStatus(argUpdateStatus)
-		if errUpdateTransaction != nil {
-			return fmt.Errorf("failed to update transaction, err: %w", errUpdateTransaction)
+		res, err = tr.createPostedTransaction(createTransArg)
+		if err != nil {
+			return err
 		}
 
-		return errUpdateTransaction
+		return nil
 	})
-
-	if errUpdateStatus == nil {
-		return res, errUpdate
+	if err != nil {
+		if isBusinessFailure(err) {
+			return t.createFailedTransaction(createTransArg), err
+		}
+		return nil, err
 	}
 
-	return res, errUpdateStatus
+	return res, nil
 }
 
 func (r *transactionsRepository) TransactionDepositOrWithdraw(arg transactions.TransactionParams) (*transactions.TransactionHistory, error) {
-	var (
-		res *transactions.TransactionHistory
-		err error
-	)
+	var res *transactions.TransactionHistory
 
-	// create transaction history with 'pending' status
-	createTransactionArg := transactions.CreateTransactionParams{
+	createTransArg := transactions.CreateTransactionParams{
 		FromWalletID: arg.FromWalletID,
 		ToWalletID:   arg.ToWalletID,
 		Amount:       arg.Amount,
 		TType:        arg.TType,
-		TStatus:      transactions.TransactionStatusPending,
-	}
-	res, err = r.CreateTransaction(createTransactionArg)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create transaction, err: %w", err)
+		TStatus:      transactions.TransactionStatusCompleted,
 	}
 
-	// update wallet balance
-	errTransaction := r.ExecDbTx(func(tr *transactionsRepository) error {
-		updateWalletArg := wallets.UpdateWalletParams{
-			Amount: arg.Amount,
-			UserID: arg.UserID.Int32,
+	err := r.ExecDbTx(func(tr *transactionsRepository) error {
+		walletID := &createTransArg.ToWalletID
+		if arg.TType == transactions.TransactionTypesWithdrawal {
+			walletID = &createTransArg.FromWalletID
 		}
-		_, err = tr.walletsRepo.UpdateWalletByUserID(updateWalletArg)
+		wallet, err := tr.lockUserWallet(arg.UserID.Int32, *walletID)
 		if err != nil {
-			return fmt.Errorf("failed to update wallet, err: %w", err)
+			return err
 		}
+		*walletID = pgtype.Int4{Int32: wallet.ID, Valid: true}
 
-		return err
-	})
-
-	// update transaction status
-	var errUpdateTransaction error
-	errUpdateStatus := r.ExecDbTx(func(tr *transactionsRepository) error {
-		argUpdateStatus := transactions.UpdateTransactionStatusParams{
-			Amount: arg.Amount,
-			ID:     res.ID,
+		if wallet.Balance+arg.Amount < 0 {
+			return errs.ErrInsufficientBalance
 		}
 
-		if errTransaction == nil {
-			argUpdateStatus.TStatus = transactions.TransactionStatusCompleted
-		} else {
-			argUpdateStatus.TStatus = transactions.TransactionStatusFailed
+		updateWalletArg := wallets.UpdateWalletParams{
+			Amount:   arg.Amount,
+			WalletID: wallet.ID,
+		}
+		_, err = tr.walletsRepo.UpdateWalletByID(updateWalletArg)
+		if err != nil {
+			return fmt.Errorf("failed to update wallet, err: %w", err)
 		}
 
-		res, errUpdateTransaction = tr.UpdateTransactionStatus(argUpdateStatus)
-		if errUpdateTransaction != nil {
-			return fmt.Errorf("failed to update transaction, err: %w", errUpdateTransaction)
+		res, err = tr.createPostedTransaction(createTransArg)
+		if err != nil {
+			return err
 		}
 
-		return errUpdateTransaction
+		return nil
 	})
-
-	if errTransaction != nil {
-		return res, errTransaction
+	if err != nil {
+		if isBusinessFailure(err) {
+			return r.createFailedTransaction(createTransArg), err
+		}
+		return nil, err
 	}
 
-	return res, errUpdateStatus
+	return res, nil
 }
 
 func (r *transactionsRepository) TransactionTransfer(arg transactions.TransactionParams) (*transactions.TransactionHistory, error) {
-	var (
-		res *transactions.TransactionHistory
-		err error
-	)
+	var res *transactions.TransactionHistory
 
-	// create transaction history with 'pending' status
-	createTransactionArg := transactions.CreateTransactionParams{
+	createTransArg := transactions.CreateTransactionParams{
 		FromWalletID: arg.FromWalletID,
 		ToWalletID:   arg.ToWalletID,
 		Amount:       arg.Amount,
 		TType:        arg.TType,
-		TStatus:      transactions.TransactionStatusPending,
-	}
-	res, err = r.CreateTransaction(createTransactionArg)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create transaction, err: %w", err)
+		TStatus:      transactions.TransactionStatusCompleted,
 	}
 
-	// update wallet balance
-	errTransaction := r.ExecDbTx(func(tr *transactionsRepository) error {
+	err := r.ExecDbTx(func(tr *transactionsRepository) error {
+		fromWallet, toWallet, err := tr.lockTransferWallets(arg.FromWalletID.Int32, arg.ToWalletID.Int32)
+		if err != nil {
+			return err
+		}
+		if fromWallet.UserID != arg.UserID.Int32 && !arg.AsAdmin {
+			return fmt.Errorf("failed to transfer, err: %w", errs.ErrForbidden)
+		}
+
+		// the receiving wallet is credited in its own currency
+		conversion, err := tr.ratesRepo.ConvertAmount(rates.ConvertParams{Amount: arg.Amount, From: fromWallet.Currency, To: toWallet.Currency})
+		if err != nil {
+			return err
+		}
+		createTransArg.ExchangeRate = conversion.Rate
+		if conversion.Rate.Valid {
+			createTransArg.ConvertedAmount = pgtype.Int4{Int32: conversion.Amount, Valid: true}
+		}
+
+		if fromWallet.Balance < arg.Amount {
+			return errs.ErrInsufficientBalance
+		}
+
 		// update 'from_wallet' balance
 		updateWalletArg := wallets.UpdateWalletParams{
 			Amount:   -arg.Amount,
-			WalletID: arg.FromWalletID.Int32,
+			WalletID: fromWallet.ID,
 		}
 		_, err = tr.walletsRepo.UpdateWalletByID(updateWalletArg)
 		if err != nil {
@@ -311,42 +602,448 @@ func (r *transactionsRepository) TransactionTransfer(arg transactions.Transactio
 
 		// update 'to_wallet' balance
 		updateWalletArg = wallets.UpdateWalletParams{
-			Amount:   arg.Amount,
-			WalletID: arg.ToWalletID.Int32,
+			Amount:   conversion.Amount,
+			WalletID: toWallet.ID,
 		}
 		_, err = tr.walletsRepo.UpdateWalletByID(updateWalletArg)
 		if err != nil {
 			return fmt.Errorf("failed to update 'to_wallet', err: %w", err)
 		}
 
-		return err
+		res, err = tr.createPostedTransaction(createTransArg)
+		if err != nil {
+			return err
+		}
+
+		return nil
 	})
+	if err != nil {
+		if isBusinessFailure(err) {
+			return r.createFailedTransaction(createTransArg), err
+		}
+		return nil, err
+	}
 
-	// update transaction status
-	var errUpdateTransaction error
-	errUpdateStatus := r.ExecDbTx(func(tr *transactionsRepository) error {
-		argUpdateStatus := transactions.UpdateTransactionStatusParams{
-			Amount: arg.Amount,
-			ID:     res.ID,
+	return res, nil
+}
+
+// lockUserWallet locks the user's wallet walletID, or the user's first wallet
+// when walletID is not Valid.
+func (r *transactionsRepository) lockUserWallet(userID int32, walletID pgtype.Int4) (*wallets.Wallet, error) {
+	if !walletID.Valid {
+		wallet, err := r.walletsRepo.GetWalletByUserIDForUpdate(userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get wallet, err: %w", err)
 		}
+		return wallet, nil
+	}
+
+	wallet, err := r.walletsRepo.GetWalletByIDForUpdate(walletID.Int32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get wallet, err: %w", err)
+	}
+	// the wallet in the request must be the user's own wallet
+	if wallet.UserID != userID {
+		return nil, fmt.Errorf("failed to get wallet, err: %w", errs.ErrNoData)
+	}
+
+	return wallet, nil
+}
 
-		if errTransaction == nil {
-			argUpdateStatus.TStatus = transactions.TransactionStatusCompleted
-		} else {
-			argUpdateStatus.TStatus = transactions.TransactionStatusFailed
+// lockTransferWallets locks both wallets of a transfer in ascending id order,
+// so two opposite transfers between the same wallets can't deadlock.
+func (r *transactionsRepository) lockTransferWallets(fromWalletID, toWalletID int32) (fromWallet, toWallet *wallets.Wallet, err error) {
+	if fromWalletID == toWalletID {
+		return nil, nil, fmt.Errorf("failed to transfer, err: %w", errs.ErrInvalidInput)
+	}
+
+	firstID, secondID := fromWalletID, toWalletID
+	if secondID < firstID {
+		firstID, secondID = secondID, firstID
+	}
+
+	first, err := r.walletsRepo.GetWalletByIDForUpdate(firstID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get wallet %d, err: %w", firstID, err)
+	}
+	second, err := r.walletsRepo.GetWalletByIDForUpdate(secondID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get wallet %d, err: %w", secondID, err)
+	}
+
+	if first.ID == fromWalletID {
+		return first, second, nil
+	}
+
+	return second, first, nil
+}
+
+// TransactionRefund gives back arg.Quantity items of the purchase in
+// arg.RefTransactionID, or everything not refunded yet when Quantity is 0.
+// The buyer's wallet is credited at the price paid, so a purchase made across
+// currencies is refunded at its own rate. The stock is restored, and the
+// order moves to refunded once all of it has been paid back.
+func (r *transactionsRepository) TransactionRefund(arg transactions.TransactionParams) (*transactions.TransactionHistory, error) {
+	var res *transactions.TransactionHistory
+
+	err := r.ExecDbTx(func(tr *transactionsRepository) error {
+		purchase, err := tr.GetTransactionByIDForUpdate(arg.RefTransactionID.Int32)
+		if err != nil {
+			return fmt.Errorf("failed to get purchase transaction, err: %w", err)
 		}
 
-		res, errUpdateTransaction = tr.UpdateTransactionStatus(argUpdateStatus)
-		if errUpdateTransaction != nil {
-			return fmt.Errorf("failed to update transaction, err: %w", errUpdateTransaction)
+		if purchase.TType != transactions.TransactionTypesPurchase || purchase.TStatus != transactions.TransactionStatusCompleted {
+			return errs.ErrNotRefundable
 		}
 
-		return errUpdateTransaction
+		wallet, err := tr.walletsRepo.GetWalletByID(purchase.FromWalletID.Int32)
+		if err != nil {
+			return fmt.Errorf("failed to get wallet, err: %w", err)
+		}
+		// only the buyer can refund a purchase
+		if wallet.UserID != arg.UserID.Int32 {
+			return errs.ErrNoData
+		}
+
+		refunded, err := tr.GetRefundTotals(purchase.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get refund totals, err: %w", err)
+		}
+
+		remaining := purchase.Quantity.Int32 - refunded.Quantity
+		quantity := arg.Quantity.Int32
+		if quantity == 0 {
+			quantity = remaining
+		}
+		if quantity <= 0 || quantity > remaining {
+			return errs.ErrRefundExceedsPurchase
+		}
+
+		// the last refund takes whatever is left of the amount, so partial
+		// refunds always add up to what was paid
+		amount := purchase.Amount / purchase.Quantity.Int32 * quantity
+		if quantity == remaining {
+			amount = purchase.Amount - refunded.Amount
+		}
+
+		updateProductArg := products.UpdateProductAvailabilityParams{
+			ID:           purchase.ProductID.Int32,
+			Availability: quantity,
+		}
+		_, err = tr.productsRepo.UpdateProductAvailability(tr.ctx, updateProductArg)
+		if err != nil {
+			return fmt.Errorf("failed to update product, err: %w", err)
+		}
+
+		updateWalletArg := wallets.UpdateWalletParams{
+			Amount:   amount,
+			WalletID: purchase.FromWalletID.Int32,
+		}
+		_, err = tr.walletsRepo.UpdateWalletByID(updateWalletArg)
+		if err != nil {
+			return fmt.Errorf("failed to update wallet, err: %w", err)
+		}
+
+		createTransactionArg := transactions.CreateTransactionParams{
+			ToWalletID:       purchase.FromWalletID,
+			ProductID:        purchase.ProductID,
+			Amount:           amount,
+			Quantity:         pgtype.Int4{Int32: quantity, Valid: true},
+			TType:            transactions.TransactionTypesRefund,
+			TStatus:          transactions.TransactionStatusCompleted,
+			OrderID:          purchase.OrderID,
+			RefTransactionID: pgtype.Int4{Int32: purchase.ID, Valid: true},
+		}
+		res, err = tr.createPostedTransaction(createTransactionArg)
+		if err != nil {
+			return err
+		}
+
+		if !purchase.OrderID.Valid {
+			return nil
+		}
+
+		return tr.refundOrder(purchase.OrderID.Int32, arg.UserID.Int32)
 	})
+	if err != nil {
+		return nil, err
+	}
 
-	if errTransaction != nil {
-		return res, errTransaction
+	return res, nil
+}
+
+// refundOrder marks the order refunded when its refunds cover the total.
+func (r *transactionsRepository) refundOrder(orderID, userID int32) error {
+	order, err := r.ordersRepo.GetOrderByID(orders.GetOrderParams{ID: orderID, UserID: userID})
+	if err != nil {
+		return fmt.Errorf("failed to get order, err: %w", err)
+	}
+
+	refundedAmount, err := r.GetOrderRefundedAmount(orderID)
+	if err != nil {
+		return fmt.Errorf("failed to get order refunded amount, err: %w", err)
+	}
+
+	if refundedAmount < order.TotalAmount || !order.Status.CanTransitionTo(orders.OrderStatusRefunded) {
+		return nil
+	}
+
+	updateOrderArg := orders.UpdateOrderStatusParams{
+		ID:         order.ID,
+		FromStatus: order.Status,
+		ToStatus:   orders.OrderStatusRefunded,
+	}
+	_, err = r.ordersRepo.UpdateOrderStatus(updateOrderArg)
+	if err != nil {
+		return fmt.Errorf("failed to update order status, err: %w", err)
+	}
+
+	return nil
+}
+
+const listStalePendingTransactions = `-- name: ListStalePendingTransactions :many
+SELECT id, from_wallet_id, to_wallet_id, product_id, amount, quantity, t_type, t_status, order_id, ref_transaction_id, exchange_rate, converted_amount, created_at
+FROM transaction_histories
+WHERE t_status = 'pending'
+AND created_at < NOW() - make_interval(secs => $1)
+ORDER BY id ASC
+LIMIT $2
+`
+
+func (r *transactionsRepository) ListStalePendingTransactions(olderThan time.Duration, limit int32) ([]transactions.TransactionHistory, error) {
+	rows, err := r.db.Query(r.ctx, listStalePendingTransactions, olderThan.Seconds(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []transactions.TransactionHistory
+	for rows.Next() {
+		var i transactions.TransactionHistory
+		if err := rows.Scan(
+			&i.ID,
+			&i.FromWalletID,
+			&i.ToWalletID,
+			&i.ProductID,
+			&i.Amount,
+			&i.Quantity,
+			&i.TType,
+			&i.TStatus,
+			&i.OrderID,
+			&i.RefTransactionID,
+			&i.ExchangeRate,
+			&i.ConvertedAmount,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// getWalletCompletedEffect sums what every completed transaction did to the
+// wallet, it must follow transactions.WalletEffect.
+const getWalletCompletedEffect = `-- name: GetWalletCompletedEffect :one
+SELECT
+	COALESCE(SUM(
+		CASE
+			WHEN from_wallet_id = $1 AND t_type = 'withdrawal' THEN -ABS(amount)
+			WHEN from_wallet_id = $1 AND t_type IN ('purchase', 'transfer') THEN -amount
+			ELSE 0
+		END +
+		CASE
+			WHEN to_wallet_id = $1 AND t_type IN ('deposit', 'refund') THEN amount
+			WHEN to_wallet_id = $1 AND t_type = 'transfer' THEN COALESCE(converted_amount, amount)
+			ELSE 0
+		END
+	), 0)::INT
+FROM transaction_histories
+WHERE t_status = 'completed'
+AND (from_wallet_id = $1 OR to_wallet_id = $1);
+`
+
+func (r *transactionsRepository) GetWalletCompletedEffect(walletID int32) (int32, error) {
+	row := r.db.QueryRow(r.ctx, getWalletCompletedEffect, walletID)
+
+	var res int32
+	err := row.Scan(
+		&res,
+	)
+
+	return res, err
+}
+
+// getWalletBalanceBefore takes the effect of every completed transaction
+// created at or after $2 back out of the current balance, with $2 NULL it is
+// the balance before the wallet's first transaction. It is one statement so
+// the balance and the sum come from the same snapshot.
+const getWalletBalanceBefore = `-- name: GetWalletBalanceBefore :one
+SELECT
+	(w.balance - COALESCE((
+		SELECT SUM(
+			CASE
+				WHEN t.from_wallet_id = w.id AND t.t_type = 'withdrawal' THEN -ABS(t.amount)
+				WHEN t.from_wallet_id = w.id AND t.t_type IN ('purchase', 'transfer') THEN -t.amount
+				ELSE 0
+			END +
+			CASE
+				WHEN t.to_wallet_id = w.id AND t.t_type IN ('deposit', 'refund') THEN t.amount
+				WHEN t.to_wallet_id = w.id AND t.t_type = 'transfer' THEN COALESCE(t.converted_amount, t.amount)
+				ELSE 0
+			END
+		)
+		FROM transaction_histories t
+		WHERE t.t_status = 'completed'
+		AND (t.from_wallet_id = w.id OR t.to_wallet_id = w.id)
+		AND ($2::TIMESTAMP IS NULL OR t.created_at >= $2)
+	), 0))::INT
+FROM wallets w
+WHERE w.id = $1;
+`
+
+func (r *transactionsRepository) GetWalletBalanceBefore(walletID int32, before pgtype.Timestamp) (int32, error) {
+	row := r.db.QueryRow(r.ctx, getWalletBalanceBefore, walletID, before)
+
+	var res int32
+	err := row.Scan(
+		&res,
+	)
+
+	return res, err
+}
+
+// postReconciled posts a transaction the reconciler found completed. Wallets
+// put on the ledger after the transaction was written opened with a balance
+// that already holds it, posting it again would count it twice.
+func (r *transactionsRepository) postReconciled(t transactions.TransactionHistory, walletIDs []int32) error {
+	for _, walletID := range walletIDs {
+		openedAt, err := r.ledgerRepo.GetWalletOpenedAt(walletID)
+		if err != nil {
+			return fmt.Errorf("failed to get wallet %d opening, err: %w", walletID, err)
+		}
+		if openedAt.Valid && t.CreatedAt.Time.Before(openedAt.Time) {
+			return nil
+		}
+	}
+
+	_, err := r.ledgerRepo.PostTransaction(t)
+	if err != nil {
+		return fmt.Errorf("failed to post transaction to ledger, err: %w", err)
+	}
+
+	return nil
+}
+
+// ReconcileTransaction decides what happened to a transaction left in
+// pending. Wallets start empty and only move through recorded transactions,
+// so a wallet's drift, its balance minus the effect of its completed
+// transactions, shows whether the pending transaction moved the money. The
+// stock of a purchase changed in the same db transaction as the wallet, so
+// the wallet side decides for both. When the drift matches neither outcome
+// the row is left pending for a person to look at.
+func (r *transactionsRepository) ReconcileTransaction(id int32) (*transactions.ReconcileResult, error) {
+	var res transactions.ReconcileResult
+
+	err := r.ExecDbTx(func(tr *transactionsRepository) error {
+		pending, err := tr.GetTransactionByIDForUpdate(id)
+		if err != nil {
+			return fmt.Errorf("failed to get transaction, err: %w", err)
+		}
+		res.Transaction = *pending
+
+		if pending.TStatus != transactions.TransactionStatusPending {
+			res.Decision = transactions.ReconcileDecisionSkipped
+			res.Reason = "transaction is no longer pending"
+			return nil
+		}
+
+		// pending purchases were written with amount 0, the amount was only
+		// set when the status changed. They predate currencies, the product
+		// and the wallet share one.
+		if pending.TType == transactions.TransactionTypesPurchase && pending.Amount == 0 {
+			product, err := tr.productsRepo.GetProductByID(tr.ctx, pending.ProductID.Int32)
+			if err != nil {
+				return fmt.Errorf("failed to get product, err: %w", err)
+			}
+			pending.Amount = product.Price * pending.Quantity.Int32
+		}
+
+		var walletIDs []int32
+		if pending.FromWalletID.Valid {
+			walletIDs = append(walletIDs, pending.FromWalletID.Int32)
+		}
+		if pending.ToWalletID.Valid && pending.ToWalletID.Int32 != pending.FromWalletID.Int32 {
+			walletIDs = append(walletIDs, pending.ToWalletID.Int32)
+		}
+		sort.Slice(walletIDs, func(i, j int) bool { return walletIDs[i] < walletIDs[j] })
+
+		isApplied, isNotApplied := true, true
+		var reasons []string
+		for _, walletID := range walletIDs {
+			wallet, err := tr.walletsRepo.GetWalletByIDForUpdate(walletID)
+			if err != nil {
+				return fmt.Errorf("failed to get wallet %d, err: %w", walletID, err)
+			}
+			completedEffect, err := tr.GetWalletCompletedEffect(walletID)
+			if err != nil {
+				return fmt.Errorf("failed to get wallet %d completed effect, err: %w", walletID, err)
+			}
+
+			drift := wallet.Balance - completedEffect
+			effect := transactions.WalletEffect(*pending, walletID)
+			reasons = append(reasons, fmt.Sprintf("wallet %d drift %d, transaction effect %d", walletID, drift, effect))
+
+			if drift != effect {
+				isApplied = false
+			}
+			if drift != 0 {
+				isNotApplied = false
+			}
+		}
+		res.Reason = strings.Join(reasons, "; ")
+
+		var status transactions.TransactionStatus
+		switch {
+		case len(walletIDs) == 0:
+			res.Decision = transactions.ReconcileDecisionSkipped
+			res.Reason = "transaction has no wallet"
+			return nil
+		case isNotApplied:
+			// checked first, an amount of 0 is both applied and not applied
+			// and nothing has moved either way
+			res.Decision = transactions.ReconcileDecisionFailed
+			status = transactions.TransactionStatusFailed
+		case isApplied:
+			res.Decision = transactions.ReconcileDecisionCompleted
+			status = transactions.TransactionStatusCompleted
+		default:
+			res.Decision = transactions.ReconcileDecisionSkipped
+			return nil
+		}
+
+		updateArg := transactions.UpdateTransactionStatusParams{
+			Amount:  pending.Amount,
+			TStatus: status,
+			ID:      pending.ID,
+		}
+		updated, err := tr.UpdateTransactionStatus(updateArg)
+		if err != nil {
+			return fmt.Errorf("failed to update transaction status, err: %w", err)
+		}
+		res.Transaction = *updated
+
+		if status != transactions.TransactionStatusCompleted {
+			return nil
+		}
+
+		return tr.postReconciled(*updated, walletIDs)
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return res, errUpdateStatus
+	return &res, nil
 }
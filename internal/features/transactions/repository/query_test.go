@@ -2,21 +2,28 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"os"
+	"sync"
 	"testing"
+	"time"
 
 	testUtils "github.com/dwiw96/GoCommerceAPI/testutils"
 	// cfg "github.com/dwiw96/GoCommerceAPI/config"
 	auth "github.com/dwiw96/GoCommerceAPI/internal/features/auth"
 	authRepo "github.com/dwiw96/GoCommerceAPI/internal/features/auth/repository"
+	ledgerRepo "github.com/dwiw96/GoCommerceAPI/internal/features/ledger/repository"
 	products "github.com/dwiw96/GoCommerceAPI/internal/features/products"
 	productsRepo "github.com/dwiw96/GoCommerceAPI/internal/features/products/repository"
+	rates "github.com/dwiw96/GoCommerceAPI/internal/features/rates"
+	ratesRepo "github.com/dwiw96/GoCommerceAPI/internal/features/rates/repository"
 	transactions "github.com/dwiw96/GoCommerceAPI/internal/features/transactions"
 	wallets "github.com/dwiw96/GoCommerceAPI/internal/features/wallets"
 	walletsRepo "github.com/dwiw96/GoCommerceAPI/internal/features/wallets/repository"
 
 	// pg "github.com/dwiw96/GoCommerceAPI/pkg/driver/postgresql"
 	generator "github.com/dwiw96/GoCommerceAPI/pkg/utils/generator"
+	errs "github.com/dwiw96/GoCommerceAPI/pkg/utils/responses"
 
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -707,9 +714,10 @@ func TestTransactionTransfer(t *testing.T) {
 	require.NoError(t, err)
 
 	user1, wallet1, _ := createPreparationTest(t)
-	_, wallet2, _ := createPreparationTest(t)
+	user2, wallet2, _ := createPreparationTest(t)
 
 	userID := pgtype.Int4{Int32: user1.ID, Valid: true}
+	user2ID := pgtype.Int4{Int32: user2.ID, Valid: true}
 	wallet1ID := pgtype.Int4{Int32: wallet1.ID, Valid: true}
 	wallet2ID := pgtype.Int4{Int32: wallet2.ID, Valid: true}
 	amount := generator.RandomInt32(100, 1000)
@@ -746,7 +754,7 @@ func TestTransactionTransfer(t *testing.T) {
 		}, {
 			desc: "success_failed_insufficient_balance",
 			arg: transactions.TransactionParams{
-				UserID:       userID,
+				UserID:       user2ID,
 				FromWalletID: wallet2ID,
 				ToWalletID:   wallet1ID,
 				Amount:       wallet2.Balance + amount + 1,
@@ -763,6 +771,38 @@ func TestTransactionTransfer(t *testing.T) {
 			},
 			isSuccess: true,
 			isErr:     true,
+		}, {
+			desc: "error_not_owner",
+			arg: transactions.TransactionParams{
+				UserID:       user2ID,
+				FromWalletID: wallet1ID,
+				ToWalletID:   wallet2ID,
+				Amount:       amount,
+				TType:        transferType,
+			},
+			isSuccess: false,
+			isErr:     true,
+		}, {
+			desc: "success_admin_not_owner",
+			arg: transactions.TransactionParams{
+				UserID:       userID,
+				FromWalletID: wallet2ID,
+				ToWalletID:   wallet1ID,
+				Amount:       1,
+				TType:        transferType,
+				AsAdmin:      true,
+			},
+			ans: transactions.TransactionHistory{
+				FromWalletID: wallet2ID,
+				ToWalletID:   wallet1ID,
+				ProductID:    pgtype.Int4{Valid: false},
+				Amount:       1,
+				Quantity:     pgtype.Int4{Valid: false},
+				TType:        transferType,
+				TStatus:      transactions.TransactionStatusCompleted,
+			},
+			isSuccess: true,
+			isErr:     false,
 		}, {
 			desc: "error_not_found_from_wallet",
 			arg: transactions.TransactionParams{
@@ -810,3 +850,532 @@ func TestTransactionTransfer(t *testing.T) {
 		})
 	}
 }
+
+func TestTransactionRefund(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user1, wallet1, product1 := createPreparationTest(t)
+	user2 := createRandomUser(t)
+	_, wallet2 := createWalletTest(t, user2)
+
+	purchase, err := repoTest.TransactionPurchaseProduct(transactions.TransactionParams{
+		UserID:       pgtype.Int4{Int32: user1.ID, Valid: true},
+		FromWalletID: pgtype.Int4{Int32: wallet1.ID, Valid: true},
+		ProductID:    pgtype.Int4{Int32: product1.ID, Valid: true},
+		Quantity:     pgtype.Int4{Int32: 4, Valid: true},
+		TType:        transactions.TransactionTypesPurchase,
+	})
+	require.NoError(t, err)
+
+	deposit, err := repoTest.TransactionDepositOrWithdraw(transactions.TransactionParams{
+		UserID:     pgtype.Int4{Int32: user1.ID, Valid: true},
+		ToWalletID: pgtype.Int4{Int32: wallet1.ID, Valid: true},
+		Amount:     100,
+		TType:      transactions.TransactionTypesDeposit,
+	})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		desc     string
+		arg      transactions.TransactionParams
+		quantity int32
+		amount   int32
+		err      error
+		isErr    bool
+	}{
+		{
+			desc: "success_partial",
+			arg: transactions.TransactionParams{
+				UserID:           pgtype.Int4{Int32: user1.ID, Valid: true},
+				Quantity:         pgtype.Int4{Int32: 1, Valid: true},
+				RefTransactionID: pgtype.Int4{Int32: purchase.ID, Valid: true},
+			},
+			quantity: 1,
+			amount:   product1.Price,
+			isErr:    false,
+		}, {
+			desc: "failed_more_than_remaining",
+			arg: transactions.TransactionParams{
+				UserID:           pgtype.Int4{Int32: user1.ID, Valid: true},
+				Quantity:         pgtype.Int4{Int32: 4, Valid: true},
+				RefTransactionID: pgtype.Int4{Int32: purchase.ID, Valid: true},
+			},
+			err:   errs.ErrRefundExceedsPurchase,
+			isErr: true,
+		}, {
+			desc: "failed_other_user",
+			arg: transactions.TransactionParams{
+				UserID:           pgtype.Int4{Int32: user2.ID, Valid: true},
+				Quantity:         pgtype.Int4{Int32: 1, Valid: true},
+				RefTransactionID: pgtype.Int4{Int32: purchase.ID, Valid: true},
+			},
+			err:   errs.ErrNoData,
+			isErr: true,
+		}, {
+			desc: "failed_not_purchase",
+			arg: transactions.TransactionParams{
+				UserID:           pgtype.Int4{Int32: user1.ID, Valid: true},
+				Quantity:         pgtype.Int4{Int32: 1, Valid: true},
+				RefTransactionID: pgtype.Int4{Int32: deposit.ID, Valid: true},
+			},
+			err:   errs.ErrNotRefundable,
+			isErr: true,
+		}, {
+			desc: "success_remaining",
+			arg: transactions.TransactionParams{
+				UserID:           pgtype.Int4{Int32: user1.ID, Valid: true},
+				RefTransactionID: pgtype.Int4{Int32: purchase.ID, Valid: true},
+			},
+			quantity: 3,
+			amount:   product1.Price * 3,
+			isErr:    false,
+		}, {
+			desc: "failed_fully_refunded",
+			arg: transactions.TransactionParams{
+				UserID:           pgtype.Int4{Int32: user1.ID, Valid: true},
+				Quantity:         pgtype.Int4{Int32: 1, Valid: true},
+				RefTransactionID: pgtype.Int4{Int32: purchase.ID, Valid: true},
+			},
+			err:   errs.ErrRefundExceedsPurchase,
+			isErr: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			res, err := repoTest.TransactionRefund(tC.arg)
+			if !tC.isErr {
+				require.NoError(t, err)
+				assert.NotZero(t, res.ID)
+				assert.False(t, res.FromWalletID.Valid)
+				assert.Equal(t, wallet1.ID, res.ToWalletID.Int32)
+				assert.Equal(t, product1.ID, res.ProductID.Int32)
+				assert.Equal(t, tC.quantity, res.Quantity.Int32)
+				assert.Equal(t, tC.amount, res.Amount)
+				assert.Equal(t, purchase.ID, res.RefTransactionID.Int32)
+				assert.Equal(t, transactions.TransactionTypesRefund, res.TType)
+				assert.Equal(t, transactions.TransactionStatusCompleted, res.TStatus)
+			} else {
+				require.Error(t, err)
+				assert.ErrorIs(t, err, tC.err)
+			}
+		})
+	}
+
+	resWallet, err := walletRepoTest.GetWalletByUserID(user1.ID)
+	require.NoError(t, err)
+	assert.Equal(t, wallet1.Balance+deposit.Amount, resWallet.Balance)
+
+	resWallet2, err := walletRepoTest.GetWalletByUserID(user2.ID)
+	require.NoError(t, err)
+	assert.Equal(t, wallet2.Balance, resWallet2.Balance)
+
+	resProduct, err := productRepoTest.GetProductByID(ctx, product1.ID)
+	require.NoError(t, err)
+	assert.Equal(t, product1.Availability, resProduct.Availability)
+}
+
+func TestTransactionPurchaseProductConcurrent(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	product, err := productRepoTest.CreateProduct(ctx, products.CreateProductParams{
+		Name:         generator.CreateRandomString(7),
+		Description:  generator.CreateRandomString(50),
+		Price:        20,
+		Availability: 1,
+	})
+	require.NoError(t, err)
+
+	n := 5
+	args := make([]transactions.TransactionParams, n)
+	for i := 0; i < n; i++ {
+		user, wallet, _ := createPreparationTest(t)
+		args[i] = transactions.TransactionParams{
+			UserID:       pgtype.Int4{Int32: user.ID, Valid: true},
+			FromWalletID: pgtype.Int4{Int32: wallet.ID, Valid: true},
+			ProductID:    pgtype.Int4{Int32: product.ID, Valid: true},
+			Quantity:     pgtype.Int4{Int32: 1, Valid: true},
+			TType:        transactions.TransactionTypesPurchase,
+		}
+	}
+
+	var wg sync.WaitGroup
+	results := make(chan *transactions.TransactionHistory, n)
+	for _, arg := range args {
+		wg.Add(1)
+		go func(arg transactions.TransactionParams) {
+			defer wg.Done()
+			res, _ := repoTest.TransactionPurchaseProduct(arg)
+			results <- res
+		}(arg)
+	}
+	wg.Wait()
+	close(results)
+
+	var completed, failed int
+	for res := range results {
+		require.NotNil(t, res)
+		switch res.TStatus {
+		case transactions.TransactionStatusCompleted:
+			completed++
+		case transactions.TransactionStatusFailed:
+			failed++
+		default:
+			t.Errorf("unexpected transaction status %s", res.TStatus)
+		}
+	}
+	assert.Equal(t, 1, completed)
+	assert.Equal(t, n-1, failed)
+
+	resProduct, err := productRepoTest.GetProductByID(ctx, product.ID)
+	require.NoError(t, err)
+	assert.Zero(t, resProduct.Availability)
+}
+
+func TestListTransactionsByUserID(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user1, wallet1, product1 := createPreparationTest(t)
+	user2, wallet2, _ := createPreparationTest(t)
+
+	userID := pgtype.Int4{Int32: user1.ID, Valid: true}
+	_, err = repoTest.TransactionDepositOrWithdraw(transactions.TransactionParams{
+		UserID:     userID,
+		ToWalletID: pgtype.Int4{Int32: wallet1.ID, Valid: true},
+		Amount:     500,
+		TType:      transactions.TransactionTypesDeposit,
+	})
+	require.NoError(t, err)
+	_, err = repoTest.TransactionPurchaseProduct(transactions.TransactionParams{
+		UserID:       userID,
+		FromWalletID: pgtype.Int4{Int32: wallet1.ID, Valid: true},
+		ProductID:    pgtype.Int4{Int32: product1.ID, Valid: true},
+		Quantity:     pgtype.Int4{Int32: 2, Valid: true},
+		TType:        transactions.TransactionTypesPurchase,
+	})
+	require.NoError(t, err)
+	// user2 sends to user1, both of them see it
+	_, err = repoTest.TransactionTransfer(transactions.TransactionParams{
+		UserID:       pgtype.Int4{Int32: user2.ID, Valid: true},
+		FromWalletID: pgtype.Int4{Int32: wallet2.ID, Valid: true},
+		ToWalletID:   pgtype.Int4{Int32: wallet1.ID, Valid: true},
+		Amount:       100,
+		TType:        transactions.TransactionTypesTransfer,
+	})
+	require.NoError(t, err)
+	_, err = repoTest.TransactionDepositOrWithdraw(transactions.TransactionParams{
+		UserID:     pgtype.Int4{Int32: user2.ID, Valid: true},
+		ToWalletID: pgtype.Int4{Int32: wallet2.ID, Valid: true},
+		Amount:     700,
+		TType:      transactions.TransactionTypesDeposit,
+	})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		desc   string
+		arg    transactions.ListTransactionsParams
+		length int
+	}{
+		{
+			desc:   "all_user1",
+			arg:    transactions.ListTransactionsParams{UserID: user1.ID, Limit: 10},
+			length: 3,
+		}, {
+			desc:   "all_user2",
+			arg:    transactions.ListTransactionsParams{UserID: user2.ID, Limit: 10},
+			length: 2,
+		}, {
+			desc: "type_purchase",
+			arg: transactions.ListTransactionsParams{
+				UserID: user1.ID,
+				TType:  transactions.NullTransactionTypes{TransactionTypes: transactions.TransactionTypesPurchase, Valid: true},
+				Limit:  10,
+			},
+			length: 1,
+		}, {
+			desc: "status_failed",
+			arg: transactions.ListTransactionsParams{
+				UserID:  user1.ID,
+				TStatus: transactions.NullTransactionStatus{TransactionStatus: transactions.TransactionStatusFailed, Valid: true},
+				Limit:   10,
+			},
+			length: 0,
+		}, {
+			desc: "product_id",
+			arg: transactions.ListTransactionsParams{
+				UserID:    user1.ID,
+				ProductID: pgtype.Int4{Int32: product1.ID, Valid: true},
+				Limit:     10,
+			},
+			length: 1,
+		}, {
+			desc: "amount_range",
+			arg: transactions.ListTransactionsParams{
+				UserID:    user1.ID,
+				MinAmount: pgtype.Int4{Int32: 100, Valid: true},
+				MaxAmount: pgtype.Int4{Int32: 500, Valid: true},
+				Limit:     10,
+			},
+			length: 2,
+		}, {
+			desc: "created_range_future",
+			arg: transactions.ListTransactionsParams{
+				UserID:      user1.ID,
+				CreatedFrom: pgtype.Timestamp{Time: time.Now().AddDate(0, 0, 1), Valid: true},
+				Limit:       10,
+			},
+			length: 0,
+		}, {
+			desc:   "limit",
+			arg:    transactions.ListTransactionsParams{UserID: user1.ID, Limit: 2},
+			length: 2,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			res, err := repoTest.ListTransactionsByUserID(tC.arg)
+			require.NoError(t, err)
+			assert.Len(t, res, tC.length)
+			for i, history := range res {
+				if i > 0 {
+					assert.Greater(t, res[i-1].ID, history.ID)
+				}
+			}
+		})
+	}
+
+	t.Run("after_id", func(t *testing.T) {
+		firstPage, err := repoTest.ListTransactionsByUserID(transactions.ListTransactionsParams{UserID: user1.ID, Limit: 2})
+		require.NoError(t, err)
+		require.Len(t, firstPage, 2)
+
+		secondPage, err := repoTest.ListTransactionsByUserID(transactions.ListTransactionsParams{
+			UserID:  user1.ID,
+			AfterID: pgtype.Int4{Int32: firstPage[1].ID, Valid: true},
+			Limit:   2,
+		})
+		require.NoError(t, err)
+		require.Len(t, secondPage, 1)
+		assert.Less(t, secondPage[0].ID, firstPage[1].ID)
+	})
+}
+
+func TestEachTransactionByWalletIDAndBalanceBefore(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user, wallet, _ := createPreparationTest(t)
+	userID := pgtype.Int4{Int32: user.ID, Valid: true}
+	walletID := pgtype.Int4{Int32: wallet.ID, Valid: true}
+
+	_, err = repoTest.TransactionDepositOrWithdraw(transactions.TransactionParams{
+		UserID:     userID,
+		ToWalletID: walletID,
+		Amount:     500,
+		TType:      transactions.TransactionTypesDeposit,
+	})
+	require.NoError(t, err)
+	_, err = repoTest.TransactionDepositOrWithdraw(transactions.TransactionParams{
+		UserID:       userID,
+		FromWalletID: walletID,
+		ToWalletID:   walletID,
+		Amount:       -200,
+		TType:        transactions.TransactionTypesWithdrawal,
+	})
+	require.NoError(t, err)
+
+	var res []transactions.TransactionHistory
+	collect := func(history transactions.TransactionHistory) error {
+		res = append(res, history)
+		return nil
+	}
+
+	err = repoTest.EachTransactionByWalletID(transactions.ListWalletTransactionsParams{WalletID: wallet.ID}, collect)
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	assert.Less(t, res[0].ID, res[1].ID)
+
+	res = nil
+	future := pgtype.Timestamp{Time: time.Now().AddDate(0, 0, 1), Valid: true}
+	err = repoTest.EachTransactionByWalletID(transactions.ListWalletTransactionsParams{WalletID: wallet.ID, CreatedFrom: future}, collect)
+	require.NoError(t, err)
+	assert.Empty(t, res)
+
+	// an error from fn stops the scan
+	errStop := errors.New("stop")
+	calls := 0
+	err = repoTest.EachTransactionByWalletID(transactions.ListWalletTransactionsParams{WalletID: wallet.ID}, func(transactions.TransactionHistory) error {
+		calls++
+		return errStop
+	})
+	require.ErrorIs(t, err, errStop)
+	assert.Equal(t, 1, calls)
+
+	current, err := walletRepoTest.GetWalletByID(wallet.ID)
+	require.NoError(t, err)
+
+	balance, err := repoTest.GetWalletBalanceBefore(wallet.ID, pgtype.Timestamp{})
+	require.NoError(t, err)
+	assert.Equal(t, current.Balance-300, balance)
+
+	balance, err = repoTest.GetWalletBalanceBefore(wallet.ID, future)
+	require.NoError(t, err)
+	assert.Equal(t, current.Balance, balance)
+}
+
+func TestTransactionsPostToLedger(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user1, wallet1, product := createPreparationTest(t)
+	_, wallet2, _ := createPreparationTest(t)
+	ledgerRepoTest := ledgerRepo.NewLedgerRepository(pool, ctx)
+
+	userID := pgtype.Int4{Int32: user1.ID, Valid: true}
+	_, err = repoTest.TransactionDepositOrWithdraw(transactions.TransactionParams{
+		UserID: userID,
+		Amount: 500,
+		TType:  transactions.TransactionTypesDeposit,
+	})
+	require.NoError(t, err)
+	_, err = repoTest.TransactionDepositOrWithdraw(transactions.TransactionParams{
+		UserID: userID,
+		Amount: -200,
+		TType:  transactions.TransactionTypesWithdrawal,
+	})
+	require.NoError(t, err)
+	purchase, err := repoTest.TransactionPurchaseProduct(transactions.TransactionParams{
+		UserID:    userID,
+		ProductID: pgtype.Int4{Int32: product.ID, Valid: true},
+		Quantity:  pgtype.Int4{Int32: 3, Valid: true},
+		TType:     transactions.TransactionTypesPurchase,
+	})
+	require.NoError(t, err)
+	_, err = repoTest.TransactionTransfer(transactions.TransactionParams{
+		UserID:       userID,
+		FromWalletID: pgtype.Int4{Int32: wallet1.ID, Valid: true},
+		ToWalletID:   pgtype.Int4{Int32: wallet2.ID, Valid: true},
+		Amount:       150,
+		TType:        transactions.TransactionTypesTransfer,
+	})
+	require.NoError(t, err)
+	_, err = repoTest.TransactionRefund(transactions.TransactionParams{
+		UserID:           userID,
+		Quantity:         pgtype.Int4{Int32: 1, Valid: true},
+		TType:            transactions.TransactionTypesRefund,
+		RefTransactionID: pgtype.Int4{Int32: purchase.ID, Valid: true},
+	})
+	require.NoError(t, err)
+	// a failed withdrawal moves nothing and posts nothing
+	_, err = repoTest.TransactionDepositOrWithdraw(transactions.TransactionParams{
+		UserID: userID,
+		Amount: -100000,
+		TType:  transactions.TransactionTypesWithdrawal,
+	})
+	require.Error(t, err)
+
+	for _, walletID := range []int32{wallet1.ID, wallet2.ID} {
+		wallet, err := walletRepoTest.GetWalletByID(walletID)
+		require.NoError(t, err)
+		ledgerBalance, err := ledgerRepoTest.GetWalletLedgerBalance(walletID)
+		require.NoError(t, err)
+		assert.Equal(t, wallet.Balance, ledgerBalance)
+	}
+
+	drifts, err := ledgerRepoTest.ListWalletDrift()
+	require.NoError(t, err)
+	assert.Empty(t, drifts)
+	unbalanced, err := ledgerRepoTest.ListUnbalancedJournals()
+	require.NoError(t, err)
+	assert.Empty(t, unbalanced)
+}
+
+func TestTransactionsAcrossCurrencies(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user1, wallet1, _ := createPreparationTest(t)
+	user2 := createRandomUser(t)
+	usdWallet, err := walletRepoTest.CreateWallet(wallets.CreateWalletParams{UserID: user2.ID, Currency: "USD"})
+	require.NoError(t, err)
+	eurWallet, err := walletRepoTest.CreateWallet(wallets.CreateWalletParams{UserID: user2.ID, Currency: "EUR"})
+	require.NoError(t, err)
+	usdProduct, err := productRepoTest.CreateProduct(ctx, products.CreateProductParams{
+		Name:         generator.CreateRandomString(7),
+		Price:        20,
+		Availability: 50,
+		Currency:     "USD",
+	})
+	require.NoError(t, err)
+
+	ratesRepoTest := ratesRepo.NewRatesRepository(pool, ctx)
+	_, err = ratesRepoTest.UpsertRate(rates.UpsertRateParams{BaseCurrency: "USD", QuoteCurrency: wallet1.Currency, Rate: 10})
+	require.NoError(t, err)
+
+	userID := pgtype.Int4{Int32: user1.ID, Valid: true}
+
+	t.Run("transfer_failed_no_rate", func(t *testing.T) {
+		_, err := repoTest.TransactionTransfer(transactions.TransactionParams{
+			UserID:       userID,
+			FromWalletID: pgtype.Int4{Int32: wallet1.ID, Valid: true},
+			ToWalletID:   pgtype.Int4{Int32: eurWallet.ID, Valid: true},
+			Amount:       100,
+			TType:        transactions.TransactionTypesTransfer,
+		})
+		require.Error(t, err)
+		assert.ErrorIs(t, err, errs.ErrRateNotFound)
+	})
+
+	t.Run("transfer_success_inverse_rate", func(t *testing.T) {
+		res, err := repoTest.TransactionTransfer(transactions.TransactionParams{
+			UserID:       userID,
+			FromWalletID: pgtype.Int4{Int32: wallet1.ID, Valid: true},
+			ToWalletID:   pgtype.Int4{Int32: usdWallet.ID, Valid: true},
+			Amount:       500,
+			TType:        transactions.TransactionTypesTransfer,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, int32(500), res.Amount)
+		assert.Equal(t, pgtype.Int4{Int32: 50, Valid: true}, res.ConvertedAmount)
+		assert.True(t, res.ExchangeRate.Valid)
+		assert.InDelta(t, 0.1, res.ExchangeRate.Float64, 1e-9)
+
+		wallet, err := walletRepoTest.GetWalletByID(usdWallet.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int32(50), wallet.Balance)
+	})
+
+	t.Run("purchase_success_converted_price", func(t *testing.T) {
+		res, err := repoTest.TransactionPurchaseProduct(transactions.TransactionParams{
+			UserID:    userID,
+			ProductID: pgtype.Int4{Int32: usdProduct.ID, Valid: true},
+			Quantity:  pgtype.Int4{Int32: 2, Valid: true},
+			TType:     transactions.TransactionTypesPurchase,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, int32(400), res.Amount)
+		assert.Equal(t, pgtype.Int4{Int32: 40, Valid: true}, res.ConvertedAmount)
+		assert.InDelta(t, 10, res.ExchangeRate.Float64, 1e-9)
+
+		wallet, err := walletRepoTest.GetWalletByID(wallet1.ID)
+		require.NoError(t, err)
+		assert.Equal(t, wallet1.Balance-500-400, wallet.Balance)
+	})
+
+	// the usd wallet started empty, the converted transfer is all it holds
+	wallet, err := walletRepoTest.GetWalletByID(usdWallet.ID)
+	require.NoError(t, err)
+	completedEffect, err := repoTest.GetWalletCompletedEffect(usdWallet.ID)
+	require.NoError(t, err)
+	assert.Equal(t, wallet.Balance, completedEffect)
+
+	ledgerRepoTest := ledgerRepo.NewLedgerRepository(pool, ctx)
+	drifts, err := ledgerRepoTest.ListWalletDrift()
+	require.NoError(t, err)
+	assert.Empty(t, drifts)
+	unbalanced, err := ledgerRepoTest.ListUnbalancedJournals()
+	require.NoError(t, err)
+	assert.Empty(t, unbalanced)
+}
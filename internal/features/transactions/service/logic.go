@@ -6,10 +6,12 @@ import (
 	"fmt"
 
 	transactions "github.com/dwiw96/GoCommerceAPI/internal/features/transactions"
+	converter "github.com/dwiw96/GoCommerceAPI/pkg/utils/converter"
 	errs "github.com/dwiw96/GoCommerceAPI/pkg/utils/responses"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 type transactionsService struct {
@@ -25,9 +27,25 @@ func NewTransactionsService(ctx context.Context, repo transactions.IRepository)
 }
 
 func handleError(arg error) (code int, err error) {
-	if errors.Is(arg, pgx.ErrNoRows) {
+	if errors.Is(arg, pgx.ErrNoRows) || errors.Is(arg, errs.ErrNoData) {
 		return errs.CodeFailedUser, errs.ErrNoData
 	}
+	if errors.Is(arg, errs.ErrForbidden) {
+		return errs.CodeFailedForbidden, errs.ErrForbidden
+	}
+	for _, userErr := range []error{
+		errs.ErrInsufficientBalance,
+		errs.ErrInsufficientStock,
+		errs.ErrInvalidInput,
+		errs.ErrNotRefundable,
+		errs.ErrRefundExceedsPurchase,
+		errs.ErrRateNotFound,
+		errs.ErrAmountTooSmall,
+	} {
+		if errors.Is(arg, userErr) {
+			return errs.CodeFailedUser, userErr
+		}
+	}
 	var pgErr *pgconn.PgError
 	if errors.As(arg, &pgErr) {
 		if pgErr.ConstraintName == "ck_transactions_balance" {
@@ -96,7 +114,7 @@ func (s *transactionsService) DepositOrWithdraw(arg transactions.TransactionPara
 }
 
 func (s *transactionsService) Transfer(arg transactions.TransactionParams) (res *transactions.TransactionHistory, code int, err error) {
-	if arg.Amount == int32(0) {
+	if arg.Amount <= int32(0) {
 		return nil, errs.CodeFailedUser, errs.ErrLessOrEqualToZero
 	}
 
@@ -112,3 +130,70 @@ func (s *transactionsService) Transfer(arg transactions.TransactionParams) (res
 
 	return
 }
+
+func (s *transactionsService) Refund(arg transactions.TransactionParams) (res *transactions.TransactionHistory, code int, err error) {
+	if !arg.RefTransactionID.Valid || arg.RefTransactionID.Int32 <= 0 {
+		return nil, errs.CodeFailedUser, fmt.Errorf("transaction_id is required")
+	}
+	// quantity 0 refunds everything that is left of the purchase
+	if arg.Quantity.Int32 < int32(0) {
+		return nil, errs.CodeFailedUser, fmt.Errorf("quantity must not be less than 0")
+	}
+
+	arg.FromWalletID.Valid = false
+	arg.ToWalletID.Valid = false
+	arg.ProductID.Valid = false
+
+	code = errs.CodeSuccess
+	res, err = s.repo.TransactionRefund(arg)
+	if err != nil {
+		code, err = handleError(err)
+		return res, code, err
+	}
+
+	return
+}
+
+const (
+	defaultListTransactionsLimit = 10
+	maxListTransactionsLimit     = 100
+)
+
+func (s *transactionsService) ListTransactions(arg transactions.ListTransactionsParams, cursor string) (res []transactions.TransactionHistory, nextCursor string, code int, err error) {
+	if arg.MinAmount.Valid && arg.MaxAmount.Valid && arg.MinAmount.Int32 > arg.MaxAmount.Int32 {
+		return nil, "", errs.CodeFailedUser, fmt.Errorf("min_amount must not be more than max_amount")
+	}
+	if arg.CreatedFrom.Valid && arg.CreatedTo.Valid && arg.CreatedFrom.Time.After(arg.CreatedTo.Time) {
+		return nil, "", errs.CodeFailedUser, fmt.Errorf("from must not be after to")
+	}
+
+	if cursor != "" {
+		afterID, err := converter.DecodeCursor(cursor)
+		if err != nil {
+			return nil, "", errs.CodeFailedUser, err
+		}
+		arg.AfterID = pgtype.Int4{Int32: afterID, Valid: true}
+	}
+
+	if arg.Limit <= 0 {
+		arg.Limit = defaultListTransactionsLimit
+	}
+	if arg.Limit > maxListTransactionsLimit {
+		arg.Limit = maxListTransactionsLimit
+	}
+	limit := arg.Limit
+
+	// one extra row tells whether there is a next page
+	arg.Limit++
+	res, err = s.repo.ListTransactionsByUserID(arg)
+	if err != nil {
+		return nil, "", errs.CodeFailedServer, fmt.Errorf("failed to list transactions, err: %v", err)
+	}
+
+	if len(res) > int(limit) {
+		res = res[:limit]
+		nextCursor = converter.EncodeCursor(res[len(res)-1].ID)
+	}
+
+	return res, nextCursor, errs.CodeSuccess, nil
+}
@@ -428,9 +428,10 @@ func TestTransfer(t *testing.T) {
 	require.NoError(t, err)
 
 	user1, wallet1, _ := createPreparationTest(t)
-	_, wallet2, _ := createPreparationTest(t)
+	user2, wallet2, _ := createPreparationTest(t)
 
 	userID := pgtype.Int4{Int32: user1.ID, Valid: true}
+	user2ID := pgtype.Int4{Int32: user2.ID, Valid: true}
 	wallet1ID := pgtype.Int4{Int32: wallet1.ID, Valid: true}
 	wallet2ID := pgtype.Int4{Int32: wallet2.ID, Valid: true}
 	amount := generator.RandomInt32(100, 1000)
@@ -469,7 +470,7 @@ func TestTransfer(t *testing.T) {
 		}, {
 			desc: "success_failed_insufficient_balance",
 			arg: transactions.TransactionParams{
-				UserID:       userID,
+				UserID:       user2ID,
 				FromWalletID: wallet2ID,
 				ToWalletID:   wallet1ID,
 				Amount:       wallet2.Balance + amount + 1,
@@ -487,6 +488,40 @@ func TestTransfer(t *testing.T) {
 			code:      errs.CodeFailedUser,
 			isSuccess: true,
 			isErr:     true,
+		}, {
+			desc: "error_not_owner",
+			arg: transactions.TransactionParams{
+				UserID:       user2ID,
+				FromWalletID: wallet1ID,
+				ToWalletID:   wallet2ID,
+				Amount:       amount,
+				TType:        transferType,
+			},
+			code:      errs.CodeFailedForbidden,
+			isSuccess: false,
+			isErr:     true,
+		}, {
+			desc: "success_admin_not_owner",
+			arg: transactions.TransactionParams{
+				UserID:       userID,
+				FromWalletID: wallet2ID,
+				ToWalletID:   wallet1ID,
+				Amount:       1,
+				TType:        transferType,
+				AsAdmin:      true,
+			},
+			ans: transactions.TransactionHistory{
+				FromWalletID: wallet2ID,
+				ToWalletID:   wallet1ID,
+				ProductID:    pgtype.Int4{Valid: false},
+				Amount:       1,
+				Quantity:     pgtype.Int4{Valid: false},
+				TType:        transferType,
+				TStatus:      transactions.TransactionStatusCompleted,
+			},
+			code:      errs.CodeSuccess,
+			isSuccess: true,
+			isErr:     false,
 		}, {
 			desc: "error_not_found_from_wallet",
 			arg: transactions.TransactionParams{
@@ -511,6 +546,18 @@ func TestTransfer(t *testing.T) {
 			code:      errs.CodeFailedUser,
 			isSuccess: false,
 			isErr:     true,
+		}, {
+			desc: "error_negative_amount",
+			arg: transactions.TransactionParams{
+				UserID:       userID,
+				FromWalletID: wallet1ID,
+				ToWalletID:   wallet2ID,
+				Amount:       -amount,
+				TType:        transferType,
+			},
+			code:      errs.CodeFailedUser,
+			isSuccess: false,
+			isErr:     true,
 		},
 	}
 	for _, tC := range testCases {
@@ -537,3 +584,157 @@ func TestTransfer(t *testing.T) {
 		})
 	}
 }
+
+func TestRefund(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user1, wallet1, product1 := createPreparationTest(t)
+	userID := pgtype.Int4{Int32: user1.ID, Valid: true}
+
+	purchase, _, err := serviceTest.PurchaseProduct(transactions.TransactionParams{
+		UserID:       userID,
+		FromWalletID: pgtype.Int4{Int32: wallet1.ID, Valid: true},
+		ProductID:    pgtype.Int4{Int32: product1.ID, Valid: true},
+		Quantity:     pgtype.Int4{Int32: 2, Valid: true},
+		TType:        transactions.TransactionTypesPurchase,
+	})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		desc  string
+		arg   transactions.TransactionParams
+		code  int
+		err   error
+		isErr bool
+	}{
+		{
+			desc: "failed_no_transaction_id",
+			arg: transactions.TransactionParams{
+				UserID:   userID,
+				Quantity: pgtype.Int4{Int32: 1, Valid: true},
+			},
+			code:  errs.CodeFailedUser,
+			isErr: true,
+		}, {
+			desc: "failed_negative_quantity",
+			arg: transactions.TransactionParams{
+				UserID:           userID,
+				Quantity:         pgtype.Int4{Int32: -1, Valid: true},
+				RefTransactionID: pgtype.Int4{Int32: purchase.ID, Valid: true},
+			},
+			code:  errs.CodeFailedUser,
+			isErr: true,
+		}, {
+			desc: "failed_wrong_transaction_id",
+			arg: transactions.TransactionParams{
+				UserID:           userID,
+				Quantity:         pgtype.Int4{Int32: 1, Valid: true},
+				RefTransactionID: pgtype.Int4{Int32: purchase.ID + 5, Valid: true},
+			},
+			code:  errs.CodeFailedUser,
+			err:   errs.ErrNoData,
+			isErr: true,
+		}, {
+			desc: "failed_more_than_purchased",
+			arg: transactions.TransactionParams{
+				UserID:           userID,
+				Quantity:         pgtype.Int4{Int32: 3, Valid: true},
+				RefTransactionID: pgtype.Int4{Int32: purchase.ID, Valid: true},
+			},
+			code:  errs.CodeFailedUser,
+			err:   errs.ErrRefundExceedsPurchase,
+			isErr: true,
+		}, {
+			desc: "success",
+			arg: transactions.TransactionParams{
+				UserID:           userID,
+				Quantity:         pgtype.Int4{Int32: 2, Valid: true},
+				RefTransactionID: pgtype.Int4{Int32: purchase.ID, Valid: true},
+			},
+			code:  errs.CodeSuccess,
+			isErr: false,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			res, code, err := serviceTest.Refund(tC.arg)
+			assert.Equal(t, tC.code, code)
+			if !tC.isErr {
+				require.NoError(t, err)
+				assert.Equal(t, purchase.Amount, res.Amount)
+				assert.Equal(t, purchase.ID, res.RefTransactionID.Int32)
+				assert.Equal(t, transactions.TransactionTypesRefund, res.TType)
+			} else {
+				require.Error(t, err)
+				if tC.err != nil {
+					assert.Equal(t, tC.err, err)
+				}
+			}
+		})
+	}
+}
+
+func TestListTransactions(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	user1, wallet1, _ := createPreparationTest(t)
+	for i := 0; i < 5; i++ {
+		_, _, err = serviceTest.DepositOrWithdraw(transactions.TransactionParams{
+			UserID:     pgtype.Int4{Int32: user1.ID, Valid: true},
+			ToWalletID: pgtype.Int4{Int32: wallet1.ID, Valid: true},
+			Amount:     100,
+			TType:      transactions.TransactionTypesDeposit,
+		})
+		require.NoError(t, err)
+	}
+
+	t.Run("cursor_pages", func(t *testing.T) {
+		arg := transactions.ListTransactionsParams{UserID: user1.ID, Limit: 2}
+		var (
+			ids    []int32
+			cursor string
+		)
+		for page := 0; page < 3; page++ {
+			res, nextCursor, code, err := serviceTest.ListTransactions(arg, cursor)
+			require.NoError(t, err)
+			assert.Equal(t, errs.CodeSuccess, code)
+			for _, history := range res {
+				ids = append(ids, history.ID)
+			}
+			cursor = nextCursor
+		}
+		assert.Len(t, ids, 5)
+		assert.Empty(t, cursor)
+	})
+
+	testCases := []struct {
+		desc   string
+		arg    transactions.ListTransactionsParams
+		cursor string
+		code   int
+	}{
+		{
+			desc: "failed_amount_range",
+			arg: transactions.ListTransactionsParams{
+				UserID:    user1.ID,
+				MinAmount: pgtype.Int4{Int32: 10, Valid: true},
+				MaxAmount: pgtype.Int4{Int32: 5, Valid: true},
+			},
+			code: errs.CodeFailedUser,
+		}, {
+			desc:   "failed_invalid_cursor",
+			arg:    transactions.ListTransactionsParams{UserID: user1.ID},
+			cursor: "not a cursor",
+			code:   errs.CodeFailedUser,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			_, _, code, err := serviceTest.ListTransactions(tC.arg, tC.cursor)
+			require.Error(t, err)
+			assert.Equal(t, tC.code, code)
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	transactions "github.com/dwiw96/GoCommerceAPI/internal/features/transactions"
+)
+
+const reconcileBatchSize = 100
+
+// Reconciler settles transaction_histories rows that stayed in pending
+// longer than pendingAge, checking every interval.
+type Reconciler struct {
+	repo       transactions.IRepository
+	interval   time.Duration
+	pendingAge time.Duration
+	logger     *slog.Logger
+}
+
+func NewReconciler(repo transactions.IRepository, interval, pendingAge time.Duration, logger *slog.Logger) *Reconciler {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &Reconciler{
+		repo:       repo,
+		interval:   interval,
+		pendingAge: pendingAge,
+		logger:     logger.With("worker", "transactions_reconciler"),
+	}
+}
+
+// Start runs the reconciler until ctx is done. It blocks, run it in its own
+// goroutine. An interval of 0 turns the reconciler off.
+func (r *Reconciler) Start(ctx context.Context) {
+	if r.interval <= 0 {
+		r.logger.Warn("reconciler disabled, interval must be more than 0")
+		return
+	}
+
+	r.logger.Info("reconciler started", "interval", r.interval.String(), "pending_age", r.pendingAge.String())
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		r.RunOnce()
+
+		select {
+		case <-ctx.Done():
+			r.logger.Info("reconciler stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce reconciles one batch of stale pending transactions and returns the
+// decision made for each of them.
+func (r *Reconciler) RunOnce() []transactions.ReconcileResult {
+	pending, err := r.repo.ListStalePendingTransactions(r.pendingAge, reconcileBatchSize)
+	if err != nil {
+		r.logger.Error("failed to list pending transactions", "error", err)
+		return nil
+	}
+
+	var results []transactions.ReconcileResult
+	for _, t := range pending {
+		res, err := r.repo.ReconcileTransaction(t.ID)
+		if err != nil {
+			r.logger.Error("failed to reconcile transaction", "transaction_id", t.ID, "error", err)
+			continue
+		}
+
+		r.logger.Info("transaction reconciled",
+			"transaction_id", res.Transaction.ID,
+			"transaction_type", res.Transaction.TType,
+			"amount", res.Transaction.Amount,
+			"decision", res.Decision,
+			"reason", res.Reason,
+		)
+		results = append(results, *res)
+	}
+
+	return results
+}
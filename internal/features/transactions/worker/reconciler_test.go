@@ -0,0 +1,229 @@
+package worker
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	auth "github.com/dwiw96/GoCommerceAPI/internal/features/auth"
+	authRepo "github.com/dwiw96/GoCommerceAPI/internal/features/auth/repository"
+	products "github.com/dwiw96/GoCommerceAPI/internal/features/products"
+	productsRepo "github.com/dwiw96/GoCommerceAPI/internal/features/products/repository"
+	transactions "github.com/dwiw96/GoCommerceAPI/internal/features/transactions"
+	transactionsRepo "github.com/dwiw96/GoCommerceAPI/internal/features/transactions/repository"
+	wallets "github.com/dwiw96/GoCommerceAPI/internal/features/wallets"
+	walletsRepo "github.com/dwiw96/GoCommerceAPI/internal/features/wallets/repository"
+	testUtils "github.com/dwiw96/GoCommerceAPI/testutils"
+
+	generator "github.com/dwiw96/GoCommerceAPI/pkg/utils/generator"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	reconcilerTest  *Reconciler
+	repoTest        transactions.IRepository
+	ctx             context.Context
+	pool            *pgxpool.Pool
+	productRepoTest products.IRepository
+	walletRepoTest  wallets.IRepository
+	authRepoTest    auth.IRepository
+)
+
+func TestMain(m *testing.M) {
+	pool = testUtils.GetPool()
+	defer pool.Close()
+	ctx = testUtils.GetContext()
+	defer ctx.Done()
+
+	schemaCleanup := testUtils.SetupDB("test_worker_transactions")
+
+	authRepoTest = authRepo.NewAuthRepository(pool, pool)
+	productRepoTest = productsRepo.NewProductRepository(pool)
+	walletRepoTest = walletsRepo.NewWalletsRepository(pool, ctx)
+	repoTest = transactionsRepo.NewTransactionsRepository(pool, pool, ctx)
+	// pending age 0 so rows written by the test are already stale
+	reconcilerTest = NewReconciler(repoTest, 0, 0, nil)
+
+	exitTest := m.Run()
+
+	schemaCleanup()
+
+	os.Exit(exitTest)
+}
+
+// createFundedWalletTest creates an empty wallet and funds it with a
+// completed deposit, so its balance matches its history.
+func createFundedWalletTest(t *testing.T, balance int32) (*auth.User, *wallets.Wallet) {
+	username := generator.CreateRandomString(generator.RandomInt(3, 13))
+	user, err := authRepoTest.CreateUser(ctx, auth.CreateUserParams{
+		Username:       username,
+		Email:          generator.CreateRandomEmail(username),
+		HashedPassword: generator.CreateRandomString(generator.RandomInt(20, 20)),
+	})
+	require.NoError(t, err)
+
+	wallet, err := walletRepoTest.CreateWallet(wallets.CreateWalletParams{UserID: user.ID, Balance: 0})
+	require.NoError(t, err)
+
+	_, err = repoTest.TransactionDepositOrWithdraw(transactions.TransactionParams{
+		UserID:     pgtype.Int4{Int32: user.ID, Valid: true},
+		ToWalletID: pgtype.Int4{Int32: wallet.ID, Valid: true},
+		Amount:     balance,
+		TType:      transactions.TransactionTypesDeposit,
+	})
+	require.NoError(t, err)
+
+	wallet, err = walletRepoTest.GetWalletByID(wallet.ID)
+	require.NoError(t, err)
+	require.Equal(t, balance, wallet.Balance)
+
+	return user, wallet
+}
+
+func createPendingTest(t *testing.T, arg transactions.CreateTransactionParams) *transactions.TransactionHistory {
+	arg.TStatus = transactions.TransactionStatusPending
+	res, err := repoTest.CreateTransaction(arg)
+	require.NoError(t, err)
+
+	return res
+}
+
+func moveWalletTest(t *testing.T, walletID, amount int32) {
+	_, err := walletRepoTest.UpdateWalletByID(wallets.UpdateWalletParams{WalletID: walletID, Amount: amount})
+	require.NoError(t, err)
+}
+
+func findResult(results []transactions.ReconcileResult, id int32) *transactions.ReconcileResult {
+	for _, res := range results {
+		if res.Transaction.ID == id {
+			return &res
+		}
+	}
+
+	return nil
+}
+
+func TestRunOnce(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	_, wallet1 := createFundedWalletTest(t, 1000)
+	_, wallet2 := createFundedWalletTest(t, 1000)
+	_, wallet3 := createFundedWalletTest(t, 1000)
+	_, wallet4 := createFundedWalletTest(t, 1000)
+
+	product, err := productRepoTest.CreateProduct(ctx, products.CreateProductParams{
+		Name:         generator.CreateRandomString(7),
+		Description:  generator.CreateRandomString(50),
+		Price:        25,
+		Availability: 50,
+	})
+	require.NoError(t, err)
+
+	// the money moved but the status was never updated
+	appliedWithdrawal := createPendingTest(t, transactions.CreateTransactionParams{
+		FromWalletID: pgtype.Int4{Int32: wallet1.ID, Valid: true},
+		Amount:       -100,
+		TType:        transactions.TransactionTypesWithdrawal,
+	})
+	moveWalletTest(t, wallet1.ID, -100)
+
+	// nothing moved
+	notAppliedDeposit := createPendingTest(t, transactions.CreateTransactionParams{
+		ToWalletID: pgtype.Int4{Int32: wallet2.ID, Valid: true},
+		Amount:     300,
+		TType:      transactions.TransactionTypesDeposit,
+	})
+
+	// pending purchases were written with amount 0
+	appliedPurchase := createPendingTest(t, transactions.CreateTransactionParams{
+		FromWalletID: pgtype.Int4{Int32: wallet3.ID, Valid: true},
+		ProductID:    pgtype.Int4{Int32: product.ID, Valid: true},
+		Amount:       0,
+		Quantity:     pgtype.Int4{Int32: 2, Valid: true},
+		TType:        transactions.TransactionTypesPurchase,
+	})
+	moveWalletTest(t, wallet3.ID, -product.Price*2)
+
+	// only one side of a transfer moved
+	halfTransfer := createPendingTest(t, transactions.CreateTransactionParams{
+		FromWalletID: pgtype.Int4{Int32: wallet4.ID, Valid: true},
+		ToWalletID:   pgtype.Int4{Int32: wallet2.ID, Valid: true},
+		Amount:       50,
+		TType:        transactions.TransactionTypesTransfer,
+	})
+	moveWalletTest(t, wallet4.ID, -50)
+
+	results := reconcilerTest.RunOnce()
+
+	testCases := []struct {
+		desc     string
+		id       int32
+		decision transactions.ReconcileDecision
+		status   transactions.TransactionStatus
+		amount   int32
+	}{
+		{
+			desc:     "applied_withdrawal_completed",
+			id:       appliedWithdrawal.ID,
+			decision: transactions.ReconcileDecisionCompleted,
+			status:   transactions.TransactionStatusCompleted,
+			amount:   -100,
+		}, {
+			desc:     "not_applied_deposit_failed",
+			id:       notAppliedDeposit.ID,
+			decision: transactions.ReconcileDecisionFailed,
+			status:   transactions.TransactionStatusFailed,
+			amount:   300,
+		}, {
+			desc:     "applied_purchase_completed",
+			id:       appliedPurchase.ID,
+			decision: transactions.ReconcileDecisionCompleted,
+			status:   transactions.TransactionStatusCompleted,
+			amount:   product.Price * 2,
+		}, {
+			desc:     "half_transfer_skipped",
+			id:       halfTransfer.ID,
+			decision: transactions.ReconcileDecisionSkipped,
+			status:   transactions.TransactionStatusPending,
+			amount:   50,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			res := findResult(results, tC.id)
+			require.NotNil(t, res)
+			assert.Equal(t, tC.decision, res.Decision)
+			assert.Equal(t, tC.status, res.Transaction.TStatus)
+			assert.Equal(t, tC.amount, res.Transaction.Amount)
+			assert.NotEmpty(t, res.Reason)
+		})
+	}
+
+	// settled rows are not picked up again, the skipped one is
+	results = reconcilerTest.RunOnce()
+	require.Len(t, results, 1)
+	assert.Equal(t, halfTransfer.ID, results[0].Transaction.ID)
+	assert.Equal(t, transactions.ReconcileDecisionSkipped, results[0].Decision)
+}
+
+func TestRunOnceIgnoresRecentRows(t *testing.T) {
+	err := testUtils.DeleteSchemaTestData(pool)
+	require.NoError(t, err)
+
+	_, wallet := createFundedWalletTest(t, 1000)
+	pending := createPendingTest(t, transactions.CreateTransactionParams{
+		ToWalletID: pgtype.Int4{Int32: wallet.ID, Valid: true},
+		Amount:     300,
+		TType:      transactions.TransactionTypesDeposit,
+	})
+
+	reconciler := NewReconciler(repoTest, 0, time.Hour, nil)
+	results := reconciler.RunOnce()
+	assert.Nil(t, findResult(results, pending.ID))
+}
@@ -2,38 +2,101 @@ package wallets
 
 import (
 	"time"
+
+	transactions "github.com/dwiw96/GoCommerceAPI/internal/features/transactions"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 type Wallet struct {
 	ID        int32     `json:"id"`
 	UserID    int32     `json:"user_id"`
 	Balance   int32     `json:"balance"`
+	Currency  string    `json:"currency"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// CreateWalletParams creates a wallet in Currency, rates.DefaultCurrency
+// when empty. A user holds at most one wallet per currency.
 type CreateWalletParams struct {
-	UserID  int32
-	Balance int32
+	UserID   int32
+	Balance  int32
+	Currency string
 }
 
+// UpdateWalletParams changes the balance of the user's wallet in Currency,
+// the user's first wallet when empty.
 type UpdateWalletParams struct {
 	Amount   int32
 	UserID   int32
 	WalletID int32
+	Currency string
+}
+
+// GetStatementParams selects the statement of the user's wallet in Currency
+// for [From, To), a bound is open when not Valid.
+type GetStatementParams struct {
+	UserID   int32
+	Currency string
+	From     pgtype.Timestamp
+	To       pgtype.Timestamp
+}
+
+// StatementLine is one transaction with the balance right after it. Effect
+// is 0 unless the transaction is completed.
+type StatementLine struct {
+	transactions.TransactionHistory
+	Effect  int32
+	Balance int32
+}
+
+// StatementTotal sums the completed lines of one transaction type, Amount is
+// their effect on the balance.
+type StatementTotal struct {
+	TType  transactions.TransactionTypes
+	Count  int32
+	Amount int32
+}
+
+// Statement is the head and the tail of a statement, the lines go to the
+// StatementWriter one by one. ClosingBalance and Totals are set once every
+// line is written.
+type Statement struct {
+	Wallet         Wallet
+	From           pgtype.Timestamp
+	To             pgtype.Timestamp
+	OpeningBalance int32
+	ClosingBalance int32
+	Totals         []StatementTotal
+}
+
+// StatementWriter gets a statement while it's read from the database: Begin
+// once, Line for every transaction oldest first, then End. An error stops
+// the statement.
+type StatementWriter interface {
+	Begin(arg *Statement) error
+	Line(arg StatementLine) error
+	End(arg *Statement) error
 }
 
 type IRepository interface {
 	CreateWallet(arg CreateWalletParams) (*Wallet, error)
 	GetWalletByUserID(UserID int32) (*Wallet, error)
+	GetWalletByUserIDAndCurrency(userID int32, currency string) (*Wallet, error)
+	ListWalletsByUserID(userID int32) ([]Wallet, error)
 	UpdateWalletByUserID(arg UpdateWalletParams) (*Wallet, error)
 	GetWalletByID(walletID int32) (*Wallet, error)
 	UpdateWalletByID(arg UpdateWalletParams) (*Wallet, error)
+	GetWalletByUserIDForUpdate(userID int32) (*Wallet, error)
+	GetWalletByIDForUpdate(walletID int32) (*Wallet, error)
 }
 
 type IService interface {
 	CreateWallet(arg CreateWalletParams) (res *Wallet, code int, err error)
-	GetWalletByUserID(UserID int32) (res *Wallet, code int, err error)
+	GetWalletByUserID(UserID int32, currency string) (res *Wallet, code int, err error)
+	ListWallets(userID int32) (res []Wallet, code int, err error)
 	DepositToWallet(arg UpdateWalletParams) (res *Wallet, code int, err error)
 	WithdrawFromWallet(arg UpdateWalletParams) (res *Wallet, code int, err error)
+	WriteStatement(arg GetStatementParams, out StatementWriter) (code int, err error)
 }
@@ -2,6 +2,9 @@ package handler
 
 import (
 	"context"
+	"errors"
+	"io"
+	"log"
 
 	auth "github.com/dwiw96/GoCommerceAPI/internal/features/auth"
 	wallets "github.com/dwiw96/GoCommerceAPI/internal/features/wallets"
@@ -21,14 +24,18 @@ import (
 type walletsHandler struct {
 	router   *gin.Engine
 	service  wallets.IService
+	stepUp   auth.IStepUp
 	validate *validator.Validate
 	trans    ut.Translator
 }
 
-func NewWalletsHandler(router *gin.Engine, service wallets.IService, pool *pgxpool.Pool, client *redis.Client, ctx context.Context) {
+// NewWalletsHandler registers the wallet routes, stepUp asks for a TOTP code
+// before a large withdrawal.
+func NewWalletsHandler(router *gin.Engine, service wallets.IService, stepUp auth.IStepUp, pool *pgxpool.Pool, client *redis.Client, ctx context.Context) {
 	handler := &walletsHandler{
 		router:   router,
 		service:  service,
+		stepUp:   stepUp,
 		validate: validator.New(),
 	}
 
@@ -41,9 +48,11 @@ func NewWalletsHandler(router *gin.Engine, service wallets.IService, pool *pgxpo
 	router.Use(mid.AuthMiddleware(ctx, pool, client))
 
 	router.POST("/api/v1/wallets", handler.createWallet)
-	router.GET("/api/v1/wallets/:user_id", handler.getWallet)
-	router.PUT("/api/v1/wallets/:user_id/deposit", handler.depositToWallet)
-	router.PUT("/api/v1/wallets/:user_id/withdraw", handler.withdrawFromWallet)
+	router.GET("/api/v1/wallets", handler.listWallets)
+	router.GET("/api/v1/wallets/:user_id", mid.OwnerMiddleware("user_id"), handler.getWallet)
+	router.PUT("/api/v1/wallets/:user_id/deposit", mid.OwnerMiddleware("user_id"), handler.depositToWallet)
+	router.PUT("/api/v1/wallets/:user_id/withdraw", mid.OwnerMiddleware("user_id"), handler.withdrawFromWallet)
+	router.GET("/api/v1/wallets/:user_id/statement", mid.OwnerMiddleware("user_id"), handler.getStatement)
 }
 
 func translateError(trans ut.Translator, err error) (errTrans []string) {
@@ -64,9 +73,22 @@ func (h *walletsHandler) createWallet(c *gin.Context) {
 		return
 	}
 
+	// the body is optional, without it the wallet gets the default currency
+	var reqBody createWalletReq
+	if err := c.ShouldBindJSON(&reqBody); err != nil && !errors.Is(err, io.EOF) {
+		responses.ErrorJSON(c, 422, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+	if err := h.validate.Struct(reqBody); err != nil {
+		errTranslated := translateError(h.trans, err)
+		responses.ErrorJSON(c, 422, errTranslated, c.Request.RemoteAddr)
+		return
+	}
+
 	arg := wallets.CreateWalletParams{
-		UserID:  authPayload.UserID,
-		Balance: 0,
+		UserID:   authPayload.UserID,
+		Balance:  0,
+		Currency: reqBody.Currency,
 	}
 	res, code, err := h.service.CreateWallet(arg)
 	if err != nil {
@@ -93,7 +115,18 @@ func (h *walletsHandler) getWallet(c *gin.Context) {
 		return
 	}
 
-	res, code, err := h.service.GetWalletByUserID(urlParam.UserID)
+	var reqQuery walletQuery
+	if err := c.ShouldBindQuery(&reqQuery); err != nil {
+		responses.ErrorJSON(c, 422, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+	if err := h.validate.Struct(reqQuery); err != nil {
+		errTranslated := translateError(h.trans, err)
+		responses.ErrorJSON(c, 422, errTranslated, c.Request.RemoteAddr)
+		return
+	}
+
+	res, code, err := h.service.GetWalletByUserID(urlParam.UserID, reqQuery.Currency)
 	if err != nil {
 		responses.ErrorJSON(c, code, []string{err.Error()}, c.Request.RemoteAddr)
 		return
@@ -105,6 +138,23 @@ func (h *walletsHandler) getWallet(c *gin.Context) {
 	c.IndentedJSON(code, response)
 }
 
+func (h *walletsHandler) listWallets(c *gin.Context) {
+	authPayload, isExists := c.Keys["payloadKey"].(*auth.JwtPayload)
+	if !isExists {
+		responses.ErrorJSON(c, 401, []string{"token is wrong"}, c.Request.RemoteAddr)
+		return
+	}
+
+	res, code, err := h.service.ListWallets(authPayload.UserID)
+	if err != nil {
+		responses.ErrorJSON(c, code, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	response := responses.SuccessWithDataResponse(toListWalletResp(res), code, "list of wallets")
+	c.IndentedJSON(code, response)
+}
+
 func (h *walletsHandler) depositToWallet(c *gin.Context) {
 	var urlParam walletUrlParam
 	if err := c.ShouldBindUri(&urlParam); err != nil {
@@ -121,19 +171,20 @@ func (h *walletsHandler) depositToWallet(c *gin.Context) {
 	var reqBody updateWalletReq
 	err := c.ShouldBindJSON(&reqBody)
 	if err != nil {
-		if err := h.validate.Struct(reqBody); err != nil {
-			errTranslated := translateError(h.trans, err)
-			responses.ErrorJSON(c, 422, errTranslated, c.Request.RemoteAddr)
-			return
-		}
-
 		responses.ErrorJSON(c, 422, []string{err.Error()}, c.Request.RemoteAddr)
 		return
 	}
+	err = h.validate.Struct(&reqBody)
+	if err != nil {
+		errTranslated := translateError(h.trans, err)
+		responses.ErrorJSON(c, 422, errTranslated, c.Request.RemoteAddr)
+		return
+	}
 
 	arg := wallets.UpdateWalletParams{
-		Amount: reqBody.Amount,
-		UserID: urlParam.UserID,
+		Amount:   reqBody.Amount,
+		UserID:   urlParam.UserID,
+		Currency: reqBody.Currency,
 	}
 
 	res, code, err := h.service.DepositToWallet(arg)
@@ -164,19 +215,32 @@ func (h *walletsHandler) withdrawFromWallet(c *gin.Context) {
 	var reqBody updateWalletReq
 	err := c.ShouldBindJSON(&reqBody)
 	if err != nil {
-		if err := h.validate.Struct(reqBody); err != nil {
-			errTranslated := translateError(h.trans, err)
-			responses.ErrorJSON(c, 422, errTranslated, c.Request.RemoteAddr)
-			return
-		}
-
 		responses.ErrorJSON(c, 422, []string{err.Error()}, c.Request.RemoteAddr)
 		return
 	}
+	err = h.validate.Struct(&reqBody)
+	if err != nil {
+		errTranslated := translateError(h.trans, err)
+		responses.ErrorJSON(c, 422, errTranslated, c.Request.RemoteAddr)
+		return
+	}
+
+	authPayload, isExists := c.Keys["payloadKey"].(*auth.JwtPayload)
+	if !isExists {
+		responses.ErrorJSON(c, 401, []string{"token is wrong"}, c.Request.RemoteAddr)
+		return
+	}
+
+	code, err := h.stepUp.CheckStepUp(*authPayload, reqBody.Amount, c.GetHeader(auth.TOTPCodeHeader))
+	if err != nil {
+		responses.ErrorJSON(c, code, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
 
 	arg := wallets.UpdateWalletParams{
-		Amount: reqBody.Amount,
-		UserID: urlParam.UserID,
+		Amount:   reqBody.Amount,
+		UserID:   urlParam.UserID,
+		Currency: reqBody.Currency,
 	}
 
 	res, code, err := h.service.WithdrawFromWallet(arg)
@@ -190,3 +254,46 @@ func (h *walletsHandler) withdrawFromWallet(c *gin.Context) {
 	response := responses.SuccessWithDataResponse(respBody, code, "withdraw from wallet success")
 	c.IndentedJSON(code, response)
 }
+
+func (h *walletsHandler) getStatement(c *gin.Context) {
+	var urlParam walletUrlParam
+	if err := c.ShouldBindUri(&urlParam); err != nil {
+		if err := h.validate.Struct(urlParam); err != nil {
+			errTranslated := translateError(h.trans, err)
+			responses.ErrorJSON(c, 422, errTranslated, c.Request.RemoteAddr)
+			return
+		}
+
+		responses.ErrorJSON(c, 422, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+
+	var reqQuery statementReq
+	err := c.ShouldBindQuery(&reqQuery)
+	if err != nil {
+		responses.ErrorJSON(c, 422, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+	err = h.validate.Struct(&reqQuery)
+	if err != nil {
+		errTranslated := translateError(h.trans, err)
+		responses.ErrorJSON(c, 422, errTranslated, c.Request.RemoteAddr)
+		return
+	}
+
+	var out statementWriter = newStatementJSONWriter(c, "get wallet statement success")
+	if reqQuery.Format == statementFormatCSV {
+		out = newStatementCSVWriter(c)
+	}
+
+	code, err := h.service.WriteStatement(toStatementArg(urlParam.UserID, reqQuery), out)
+	if err != nil {
+		if out.started() {
+			// the status is already sent, a failure here can only be logged
+			log.Printf("failed to write wallet statement, err: %v", err)
+			return
+		}
+		responses.ErrorJSON(c, code, []string{err.Error()}, c.Request.RemoteAddr)
+		return
+	}
+}
@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	transactions "github.com/dwiw96/GoCommerceAPI/internal/features/transactions"
+	wallets "github.com/dwiw96/GoCommerceAPI/internal/features/wallets"
+	responses "github.com/dwiw96/GoCommerceAPI/pkg/utils/responses"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// statementStub writes a statement with the lines in lines, or fails with
+// err after failAfter lines when err is set.
+type statementStub struct {
+	wallets.IService
+	lines     []wallets.StatementLine
+	err       error
+	failAfter int
+}
+
+func (s *statementStub) WriteStatement(arg wallets.GetStatementParams, out wallets.StatementWriter) (int, error) {
+	if s.err != nil && s.failAfter < 0 {
+		return responses.CodeFailedUser, s.err
+	}
+
+	res := &wallets.Statement{Wallet: wallets.Wallet{ID: 7, UserID: arg.UserID, Currency: "IDR"}, OpeningBalance: 100}
+	if err := out.Begin(res); err != nil {
+		return responses.CodeFailedServer, err
+	}
+	for i, line := range s.lines {
+		if s.err != nil && i == s.failAfter {
+			return responses.CodeFailedServer, s.err
+		}
+		if err := out.Line(line); err != nil {
+			return responses.CodeFailedServer, err
+		}
+	}
+
+	res.ClosingBalance = 100
+	for _, line := range s.lines {
+		res.ClosingBalance += line.Effect
+	}
+	res.Totals = []wallets.StatementTotal{{TType: transactions.TransactionTypesDeposit, Count: int32(len(s.lines)), Amount: res.ClosingBalance - 100}}
+	if err := out.End(res); err != nil {
+		return responses.CodeFailedServer, err
+	}
+
+	return responses.CodeSuccess, nil
+}
+
+func newStatementRouter(service wallets.IService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	handler := &walletsHandler{
+		router:   router,
+		service:  service,
+		validate: validator.New(),
+	}
+	router.GET("/api/v1/wallets/:user_id/statement", handler.getStatement)
+
+	return router
+}
+
+func getStatementTest(router *gin.Engine, query string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/wallets/1/statement"+query, nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func statementLinesTest(n int) []wallets.StatementLine {
+	var lines []wallets.StatementLine
+	for i := 1; i <= n; i++ {
+		line := wallets.StatementLine{Effect: 10, Balance: 100 + int32(i)*10}
+		line.ID = int32(i)
+		line.TType = transactions.TransactionTypesDeposit
+		line.TStatus = transactions.TransactionStatusCompleted
+		line.Amount = 10
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+func TestGetStatementJSON(t *testing.T) {
+	testCases := []struct {
+		desc  string
+		lines int
+	}{
+		{desc: "no_lines", lines: 0},
+		{desc: "one_line", lines: 1},
+		{desc: "many_lines", lines: 3},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			router := newStatementRouter(&statementStub{lines: statementLinesTest(tC.lines)})
+			res := getStatementTest(router, "")
+			require.Equal(t, http.StatusOK, res.Code)
+
+			var body struct {
+				Result string `json:"result"`
+				Value  struct {
+					statementHeadResp
+					Lines []statementLineResp `json:"lines"`
+					statementTailResp
+				} `json:"value"`
+			}
+			require.NoError(t, json.Unmarshal(res.Body.Bytes(), &body), res.Body.String())
+			assert.Equal(t, "success", body.Result)
+			assert.Equal(t, int32(7), body.Value.WalletID)
+			assert.Equal(t, int32(100), body.Value.OpeningBalance)
+			assert.Len(t, body.Value.Lines, tC.lines)
+			assert.Equal(t, int32(100+10*tC.lines), body.Value.ClosingBalance)
+			require.Len(t, body.Value.Totals, 1)
+			assert.Equal(t, int32(tC.lines), body.Value.Totals[0].Count)
+		})
+	}
+}
+
+func TestGetStatementCSV(t *testing.T) {
+	router := newStatementRouter(&statementStub{lines: statementLinesTest(2)})
+	res := getStatementTest(router, "?format=csv")
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "text/csv", res.Header().Get("Content-Type"))
+	assert.Contains(t, res.Header().Get("Content-Disposition"), "statement-wallet-7.csv")
+
+	reader := csv.NewReader(strings.NewReader(res.Body.String()))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"opening_balance", "100"}, records[4])
+	assert.Equal(t, statementCSVHeader, records[5])
+	assert.Equal(t, "1", records[6][0])
+	assert.Equal(t, "2", records[7][0])
+	assert.Equal(t, []string{"closing_balance", "120"}, records[8])
+}
+
+func TestGetStatementFailed(t *testing.T) {
+	t.Run("before_begin", func(t *testing.T) {
+		router := newStatementRouter(&statementStub{err: responses.ErrNoData, failAfter: -1})
+		res := getStatementTest(router, "")
+		require.Equal(t, http.StatusBadRequest, res.Code)
+		assert.Contains(t, res.Body.String(), responses.ErrNoData.Error())
+	})
+
+	t.Run("after_begin", func(t *testing.T) {
+		// the status is already sent, the body is cut short
+		router := newStatementRouter(&statementStub{lines: statementLinesTest(3), err: errors.New("connection lost"), failAfter: 1})
+		res := getStatementTest(router, "")
+		require.Equal(t, http.StatusOK, res.Code)
+		assert.False(t, json.Valid(res.Body.Bytes()))
+	})
+}
@@ -1,9 +1,58 @@
 package handler
 
+import (
+	"time"
+
+	wallets "github.com/dwiw96/GoCommerceAPI/internal/features/wallets"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
 type walletUrlParam struct {
 	UserID int32 `uri:"user_id" validate:"required,number"`
 }
 
+type createWalletReq struct {
+	Currency string `json:"currency" validate:"omitempty,iso4217"`
+}
+
+// walletQuery picks one of the user's wallets, the first one when Currency
+// is empty.
+type walletQuery struct {
+	Currency string `form:"currency" validate:"omitempty,iso4217"`
+}
+
 type updateWalletReq struct {
-	Amount int32 `json:"amount" validate:"required,number"`
+	Amount   int32  `json:"amount" validate:"required,gt=0"`
+	Currency string `json:"currency" validate:"omitempty,iso4217"`
+}
+
+const dateLayout = "2006-01-02"
+
+const statementFormatCSV = "csv"
+
+// statementReq is the query string of the statement endpoint, from and to
+// are dates and both are inclusive.
+type statementReq struct {
+	From     string `form:"from" validate:"omitempty,datetime=2006-01-02"`
+	To       string `form:"to" validate:"omitempty,datetime=2006-01-02"`
+	Format   string `form:"format" validate:"omitempty,oneof=csv json"`
+	Currency string `form:"currency" validate:"omitempty,iso4217"`
+}
+
+func toStatementArg(userID int32, input statementReq) wallets.GetStatementParams {
+	res := wallets.GetStatementParams{
+		UserID:   userID,
+		Currency: input.Currency,
+	}
+
+	// the layout is already checked by the validator
+	if from, err := time.Parse(dateLayout, input.From); err == nil {
+		res.From = pgtype.Timestamp{Time: from, Valid: true}
+	}
+	if to, err := time.Parse(dateLayout, input.To); err == nil {
+		res.To = pgtype.Timestamp{Time: to.AddDate(0, 0, 1), Valid: true}
+	}
+
+	return res
 }
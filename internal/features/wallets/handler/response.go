@@ -1,14 +1,24 @@
 package handler
 
 import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
 	"time"
 
+	transactions "github.com/dwiw96/GoCommerceAPI/internal/features/transactions"
 	wallets "github.com/dwiw96/GoCommerceAPI/internal/features/wallets"
+	responses "github.com/dwiw96/GoCommerceAPI/pkg/utils/responses"
+
+	"github.com/gin-gonic/gin"
 )
 
 type walletResp struct {
 	ID        int32     `json:"id"`
 	Balance   int32     `json:"balance"`
+	Currency  string    `json:"currency"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -16,8 +26,261 @@ type walletResp struct {
 func toWalletResp(arg *wallets.Wallet) (res walletResp) {
 	res.ID = arg.ID
 	res.Balance = arg.Balance
+	res.Currency = arg.Currency
 	res.CreatedAt = arg.CreatedAt
 	res.UpdatedAt = arg.UpdatedAt
 
 	return
 }
+
+func toListWalletResp(arg []wallets.Wallet) []walletResp {
+	res := []walletResp{}
+	for i := range arg {
+		res = append(res, toWalletResp(&arg[i]))
+	}
+
+	return res
+}
+
+type statementLineResp struct {
+	ID           int32                          `json:"id"`
+	CreatedAt    time.Time                      `json:"created_at"`
+	TType        transactions.TransactionTypes  `json:"transaction_type"`
+	TStatus      transactions.TransactionStatus `json:"transaction_status"`
+	FromWalletID int32                          `json:"from_wallet_id,omitempty"`
+	ToWalletID   int32                          `json:"to_wallet_id,omitempty"`
+	ProductID    int32                          `json:"product_id,omitempty"`
+	Quantity     int32                          `json:"quantity,omitempty"`
+	Amount       int32                          `json:"amount"`
+	ExchangeRate float64                        `json:"exchange_rate,omitempty"`
+	Effect       int32                          `json:"effect"`
+	Balance      int32                          `json:"balance"`
+}
+
+type statementTotalResp struct {
+	TType  transactions.TransactionTypes `json:"transaction_type"`
+	Count  int32                         `json:"count"`
+	Amount int32                         `json:"amount"`
+}
+
+// statementHeadResp is the part of the statement written before the lines,
+// statementTailResp the part after them.
+type statementHeadResp struct {
+	WalletID       int32      `json:"wallet_id"`
+	Currency       string     `json:"currency"`
+	From           *time.Time `json:"from,omitempty"`
+	To             *time.Time `json:"to,omitempty"`
+	OpeningBalance int32      `json:"opening_balance"`
+}
+
+type statementTailResp struct {
+	ClosingBalance int32                `json:"closing_balance"`
+	Totals         []statementTotalResp `json:"totals"`
+}
+
+func toStatementLineResp(arg wallets.StatementLine) statementLineResp {
+	return statementLineResp{
+		ID:           arg.ID,
+		CreatedAt:    arg.CreatedAt.Time,
+		TType:        arg.TType,
+		TStatus:      arg.TStatus,
+		FromWalletID: arg.FromWalletID.Int32,
+		ToWalletID:   arg.ToWalletID.Int32,
+		ProductID:    arg.ProductID.Int32,
+		Quantity:     arg.Quantity.Int32,
+		Amount:       arg.Amount,
+		ExchangeRate: arg.ExchangeRate.Float64,
+		Effect:       arg.Effect,
+		Balance:      arg.Balance,
+	}
+}
+
+func toStatementHeadResp(arg *wallets.Statement) (res statementHeadResp) {
+	res.WalletID = arg.Wallet.ID
+	res.Currency = arg.Wallet.Currency
+	if arg.From.Valid {
+		res.From = &arg.From.Time
+	}
+	if arg.To.Valid {
+		// the statement ends right before To, the response shows the last day
+		to := arg.To.Time.AddDate(0, 0, -1)
+		res.To = &to
+	}
+	res.OpeningBalance = arg.OpeningBalance
+
+	return
+}
+
+func toStatementTailResp(arg *wallets.Statement) (res statementTailResp) {
+	res.ClosingBalance = arg.ClosingBalance
+	res.Totals = make([]statementTotalResp, 0, len(arg.Totals))
+	for _, total := range arg.Totals {
+		res.Totals = append(res.Totals, statementTotalResp{
+			TType:  total.TType,
+			Count:  total.Count,
+			Amount: total.Amount,
+		})
+	}
+
+	return
+}
+
+// statementWriter writes the statement to the response while it's read,
+// started tells if the status is already sent.
+type statementWriter interface {
+	wallets.StatementWriter
+	started() bool
+}
+
+// statementJSONWriter writes the usual success body with the statement as
+// its value, the lines go out one by one in the "lines" array.
+type statementJSONWriter struct {
+	c     *gin.Context
+	msg   string
+	lines int
+}
+
+func newStatementJSONWriter(c *gin.Context, msg string) *statementJSONWriter {
+	return &statementJSONWriter{c: c, msg: msg, lines: -1}
+}
+
+func (w *statementJSONWriter) started() bool {
+	return w.lines >= 0
+}
+
+func (w *statementJSONWriter) Begin(arg *wallets.Statement) error {
+	envelope := responses.SuccessWithDataResponse(nil, responses.CodeSuccess, w.msg)
+	delete(envelope, "value")
+	envelopeJSON, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+	head, err := json.Marshal(toStatementHeadResp(arg))
+	if err != nil {
+		return err
+	}
+
+	w.c.Header("Content-Type", "application/json; charset=utf-8")
+	w.c.Status(responses.CodeSuccess)
+	w.lines = 0
+
+	// both objects are reopened to carry on with the value and its lines
+	var buf bytes.Buffer
+	buf.Write(envelopeJSON[:len(envelopeJSON)-1])
+	buf.WriteString(`,"value":`)
+	buf.Write(head[:len(head)-1])
+	buf.WriteString(`,"lines":[`)
+	_, err = w.c.Writer.Write(buf.Bytes())
+	return err
+}
+
+func (w *statementJSONWriter) Line(arg wallets.StatementLine) error {
+	line, err := json.Marshal(toStatementLineResp(arg))
+	if err != nil {
+		return err
+	}
+	if w.lines > 0 {
+		line = append([]byte(","), line...)
+	}
+	w.lines++
+
+	_, err = w.c.Writer.Write(line)
+	return err
+}
+
+func (w *statementJSONWriter) End(arg *wallets.Statement) error {
+	tail, err := json.Marshal(toStatementTailResp(arg))
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("],")
+	buf.Write(tail[1:])
+	buf.WriteString("}")
+	_, err = w.c.Writer.Write(buf.Bytes())
+	return err
+}
+
+var statementCSVHeader = []string{
+	"id", "created_at", "transaction_type", "transaction_status", "from_wallet_id",
+	"to_wallet_id", "product_id", "quantity", "amount", "effect", "balance",
+}
+
+// statementCSVWriter writes the opening balance, one row per line, the
+// closing balance and the totals, with an empty row between the sections.
+type statementCSVWriter struct {
+	c      *gin.Context
+	writer *csv.Writer
+}
+
+func newStatementCSVWriter(c *gin.Context) *statementCSVWriter {
+	return &statementCSVWriter{c: c}
+}
+
+func (w *statementCSVWriter) started() bool {
+	return w.writer != nil
+}
+
+func itoa(i int32) string {
+	return strconv.Itoa(int(i))
+}
+
+func (w *statementCSVWriter) Begin(arg *wallets.Statement) error {
+	head := toStatementHeadResp(arg)
+	date := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.Format(dateLayout)
+	}
+
+	w.c.Header("Content-Type", "text/csv")
+	w.c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"statement-wallet-%d.csv\"", head.WalletID))
+	w.c.Status(responses.CodeSuccess)
+	w.writer = csv.NewWriter(w.c.Writer)
+
+	return w.writer.WriteAll([][]string{
+		{"wallet_id", itoa(head.WalletID)},
+		{"currency", head.Currency},
+		{"from", date(head.From)},
+		{"to", date(head.To)},
+		{"opening_balance", itoa(head.OpeningBalance)},
+		{},
+		statementCSVHeader,
+	})
+}
+
+// Line leaves the row in the csv buffer, it goes out once the buffer is full.
+func (w *statementCSVWriter) Line(arg wallets.StatementLine) error {
+	line := toStatementLineResp(arg)
+	return w.writer.Write([]string{
+		itoa(line.ID),
+		line.CreatedAt.Format(time.RFC3339),
+		string(line.TType),
+		string(line.TStatus),
+		itoa(line.FromWalletID),
+		itoa(line.ToWalletID),
+		itoa(line.ProductID),
+		itoa(line.Quantity),
+		itoa(line.Amount),
+		itoa(line.Effect),
+		itoa(line.Balance),
+	})
+}
+
+func (w *statementCSVWriter) End(arg *wallets.Statement) error {
+	tail := toStatementTailResp(arg)
+	records := [][]string{
+		{},
+		{"closing_balance", itoa(tail.ClosingBalance)},
+		{},
+		{"transaction_type", "count", "amount"},
+	}
+	for _, total := range tail.Totals {
+		records = append(records, []string{string(total.TType), itoa(total.Count), itoa(total.Amount)})
+	}
+
+	// WriteAll flushes
+	return w.writer.WriteAll(records)
+}
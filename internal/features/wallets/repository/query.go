@@ -4,6 +4,7 @@ import (
 	"context"
 
 	db "github.com/dwiw96/GoCommerceAPI/internal/db"
+	rates "github.com/dwiw96/GoCommerceAPI/internal/features/rates"
 	wallets "github.com/dwiw96/GoCommerceAPI/internal/features/wallets"
 )
 
@@ -19,30 +20,54 @@ func NewWalletsRepository(db db.DBTX, ctx context.Context) wallets.IRepository {
 	}
 }
 
+// createWallet posts a starting balance to the ledger as an opening journal
+// in the same statement, so the wallet's balance stays derivable from it.
 const createWallet = `-- name: CreateWallet :one
-INSERT INTO wallets(
-    user_id,
-    balance
-) VALUES (
-    $1, $2
-) RETURNING id, user_id, balance, created_at, updated_at
+WITH wallet AS (
+    INSERT INTO wallets(
+        user_id,
+        balance,
+        currency
+    ) VALUES (
+        $1, $2, $3
+    ) RETURNING id, user_id, balance, currency, created_at, updated_at
+), journal AS (
+    INSERT INTO ledger_journals(description)
+    SELECT 'opening balance' FROM wallet WHERE balance > 0
+    RETURNING id
+), entries AS (
+    INSERT INTO ledger_entries(journal_id, account, wallet_id, side, amount)
+    SELECT journal.id, 'opening'::ledger_accounts, NULL, 'debit'::ledger_sides, wallet.balance FROM journal, wallet
+    UNION ALL
+    SELECT journal.id, 'wallet'::ledger_accounts, wallet.id, 'credit'::ledger_sides, wallet.balance FROM journal, wallet
+)
+SELECT id, user_id, balance, currency, created_at, updated_at FROM wallet
 `
 
 func (r *walletsRepository) CreateWallet(arg wallets.CreateWalletParams) (*wallets.Wallet, error) {
-	row := r.db.QueryRow(r.ctx, createWallet, arg.UserID, arg.Balance)
+	if arg.Currency == "" {
+		arg.Currency = rates.DefaultCurrency
+	}
+
+	row := r.db.QueryRow(r.ctx, createWallet, arg.UserID, arg.Balance, arg.Currency)
 	var i wallets.Wallet
 	err := row.Scan(
 		&i.ID,
 		&i.UserID,
 		&i.Balance,
+		&i.Currency,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 	)
 	return &i, err
 }
 
+// getWalletByUserID returns the user's first wallet, the one used when a
+// request doesn't pick a currency.
 const getWalletByUserID = `-- name: GetWalletByUserID :one
-SELECT id, user_id, balance, created_at, updated_at FROM wallets WHERE user_id = $1
+SELECT id, user_id, balance, currency, created_at, updated_at FROM wallets WHERE user_id = $1
+ORDER BY id ASC
+LIMIT 1
 `
 
 func (r *walletsRepository) GetWalletByUserID(userID int32) (*wallets.Wallet, error) {
@@ -52,20 +77,46 @@ func (r *walletsRepository) GetWalletByUserID(userID int32) (*wallets.Wallet, er
 		&i.ID,
 		&i.UserID,
 		&i.Balance,
+		&i.Currency,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 	)
 	return &i, err
 }
 
+// getWalletByUserIDForUpdate locks the user's first wallet until the
+// surrounding db transaction ends.
+const getWalletByUserIDForUpdate = `-- name: GetWalletByUserIDForUpdate :one
+SELECT id, user_id, balance, currency, created_at, updated_at FROM wallets WHERE user_id = $1
+ORDER BY id ASC
+LIMIT 1
+FOR UPDATE
+`
+
+func (r *walletsRepository) GetWalletByUserIDForUpdate(userID int32) (*wallets.Wallet, error) {
+	row := r.db.QueryRow(r.ctx, getWalletByUserIDForUpdate, userID)
+	var i wallets.Wallet
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Balance,
+		&i.Currency,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return &i, err
+}
+
+// updateWalletByUserID changes the user's first wallet. It does not touch the
+// ledger, callers post the change in the same db transaction.
 const updateWalletByUserID = `-- name: UpdateWalletByUserID :one
 UPDATE
     wallets
 SET
     balance = balance + ($1), 
     updated_at = NOW()
-WHERE user_id = $2
-RETURNING id, user_id, balance, created_at, updated_at
+WHERE id = (SELECT id FROM wallets WHERE user_id = $2 ORDER BY id ASC LIMIT 1)
+RETURNING id, user_id, balance, currency, created_at, updated_at
 `
 
 func (r *walletsRepository) UpdateWalletByUserID(arg wallets.UpdateWalletParams) (*wallets.Wallet, error) {
@@ -75,14 +126,65 @@ func (r *walletsRepository) UpdateWalletByUserID(arg wallets.UpdateWalletParams)
 		&i.ID,
 		&i.UserID,
 		&i.Balance,
+		&i.Currency,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 	)
 	return &i, err
 }
 
+const getWalletByUserIDAndCurrency = `-- name: GetWalletByUserIDAndCurrency :one
+SELECT id, user_id, balance, currency, created_at, updated_at FROM wallets WHERE user_id = $1 AND currency = $2
+`
+
+func (r *walletsRepository) GetWalletByUserIDAndCurrency(userID int32, currency string) (*wallets.Wallet, error) {
+	row := r.db.QueryRow(r.ctx, getWalletByUserIDAndCurrency, userID, currency)
+	var i wallets.Wallet
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Balance,
+		&i.Currency,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return &i, err
+}
+
+const listWalletsByUserID = `-- name: ListWalletsByUserID :many
+SELECT id, user_id, balance, currency, created_at, updated_at FROM wallets WHERE user_id = $1
+ORDER BY id ASC
+`
+
+func (r *walletsRepository) ListWalletsByUserID(userID int32) ([]wallets.Wallet, error) {
+	rows, err := r.db.Query(r.ctx, listWalletsByUserID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []wallets.Wallet
+	for rows.Next() {
+		var i wallets.Wallet
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Balance,
+			&i.Currency,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getWalletByID = `-- name: GetWalletByID :one
-SELECT id, user_id, balance, created_at, updated_at FROM wallets WHERE id = $1
+SELECT id, user_id, balance, currency, created_at, updated_at FROM wallets WHERE id = $1
 `
 
 func (r *walletsRepository) GetWalletByID(walletID int32) (*wallets.Wallet, error) {
@@ -92,12 +194,36 @@ func (r *walletsRepository) GetWalletByID(walletID int32) (*wallets.Wallet, erro
 		&i.ID,
 		&i.UserID,
 		&i.Balance,
+		&i.Currency,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return &i, err
+}
+
+// getWalletByIDForUpdate locks the wallet row until the surrounding db
+// transaction ends.
+const getWalletByIDForUpdate = `-- name: GetWalletByIDForUpdate :one
+SELECT id, user_id, balance, currency, created_at, updated_at FROM wallets WHERE id = $1
+FOR UPDATE
+`
+
+func (r *walletsRepository) GetWalletByIDForUpdate(walletID int32) (*wallets.Wallet, error) {
+	row := r.db.QueryRow(r.ctx, getWalletByIDForUpdate, walletID)
+	var i wallets.Wallet
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Balance,
+		&i.Currency,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 	)
 	return &i, err
 }
 
+// updateWalletByID does not touch the ledger, callers post the change in the same
+// db transaction.
 const updateWalletByID = `-- name: UpdateWalletByID :one
 UPDATE
     wallets
@@ -105,7 +231,7 @@ SET
     balance = balance + ($1), 
     updated_at = NOW()
 WHERE id = $2
-RETURNING id, user_id, balance, created_at, updated_at
+RETURNING id, user_id, balance, currency, created_at, updated_at
 `
 
 func (r *walletsRepository) UpdateWalletByID(arg wallets.UpdateWalletParams) (*wallets.Wallet, error) {
@@ -115,6 +241,7 @@ func (r *walletsRepository) UpdateWalletByID(arg wallets.UpdateWalletParams) (*w
 		&i.ID,
 		&i.UserID,
 		&i.Balance,
+		&i.Currency,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 	)
@@ -105,6 +105,22 @@ func TestCreateWallet(t *testing.T) {
 				Balance: int32(generator.RandomInt(0, 50)),
 			},
 			err: true,
+		}, {
+			desc: "success_other_currency",
+			args: wallets.CreateWalletParams{
+				UserID:   user.ID,
+				Balance:  int32(generator.RandomInt(0, 50)),
+				Currency: "USD",
+			},
+			err: false,
+		}, {
+			desc: "failed_invalid_currency",
+			args: wallets.CreateWalletParams{
+				UserID:   user2.ID,
+				Balance:  int32(generator.RandomInt(0, 50)),
+				Currency: "US",
+			},
+			err: true,
 		}, {
 			desc: "failed_without_user_id",
 			args: wallets.CreateWalletParams{
@@ -145,6 +161,32 @@ func TestCreateWallet(t *testing.T) {
 	}
 }
 
+func TestGetWalletByUserIDAndCurrency(t *testing.T) {
+	walletArg, wallet := createWalletTest(t)
+	usdWallet, err := repoTest.CreateWallet(wallets.CreateWalletParams{UserID: walletArg.UserID, Currency: "USD"})
+	require.NoError(t, err)
+	assert.Equal(t, "USD", usdWallet.Currency)
+
+	// without a currency the first wallet is used
+	res, err := repoTest.GetWalletByUserID(walletArg.UserID)
+	require.NoError(t, err)
+	assert.Equal(t, wallet.ID, res.ID)
+	assert.Equal(t, "IDR", res.Currency)
+
+	res, err = repoTest.GetWalletByUserIDAndCurrency(walletArg.UserID, "USD")
+	require.NoError(t, err)
+	assert.Equal(t, usdWallet.ID, res.ID)
+
+	_, err = repoTest.GetWalletByUserIDAndCurrency(walletArg.UserID, "EUR")
+	require.Error(t, err)
+
+	list, err := repoTest.ListWalletsByUserID(walletArg.UserID)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, wallet.ID, list[0].ID)
+	assert.Equal(t, usdWallet.ID, list[1].ID)
+}
+
 func TestGetWalletByUserID(t *testing.T) {
 	walletArg, wallet := createWalletTest(t)
 	testCases := []struct {
@@ -5,29 +5,37 @@ import (
 	"errors"
 	"fmt"
 
+	transactions "github.com/dwiw96/GoCommerceAPI/internal/features/transactions"
 	wallets "github.com/dwiw96/GoCommerceAPI/internal/features/wallets"
 	errs "github.com/dwiw96/GoCommerceAPI/pkg/utils/responses"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 type walletsService struct {
-	ctx  context.Context
-	repo wallets.IRepository
+	ctx              context.Context
+	repo             wallets.IRepository
+	transactionsRepo transactions.IRepository
 }
 
-func NewWalletsService(ctx context.Context, repo wallets.IRepository) wallets.IService {
+func NewWalletsService(ctx context.Context, repo wallets.IRepository, transactionsRepo transactions.IRepository) wallets.IService {
 	return &walletsService{
-		ctx:  ctx,
-		repo: repo,
+		ctx:              ctx,
+		repo:             repo,
+		transactionsRepo: transactionsRepo,
 	}
 }
 
 func handleError(err error) (code int, errRes error) {
-	if err == pgx.ErrNoRows {
+	if errors.Is(err, pgx.ErrNoRows) || errors.Is(err, errs.ErrNoData) {
 		return errs.CodeFailedUser, errs.ErrNoData
 	}
+	if errors.Is(err, errs.ErrInsufficientBalance) {
+		return errs.CodeFailedUser, errs.ErrBalanceLessThanZero
+	}
+	errRes = fmt.Errorf("database error occurred")
 	var pgErr *pgconn.PgError
 	if errors.As(err, &pgErr) {
 		if pgErr.ConstraintName == "ck_wallets_balance" {
@@ -42,8 +50,6 @@ func handleError(err error) (code int, errRes error) {
 			return errs.CodeFailedUser, errs.ErrNotNull
 		case "23503": // Foreign Key violation
 			return errs.CodeFailedUser, errs.ErrViolation
-		default:
-			errRes = fmt.Errorf("database error occurred")
 		}
 	}
 
@@ -60,8 +66,8 @@ func (s *walletsService) CreateWallet(arg wallets.CreateWalletParams) (res *wall
 	return res, errs.CodeSuccessCreate, err
 }
 
-func (s *walletsService) GetWalletByUserID(userID int32) (res *wallets.Wallet, code int, err error) {
-	res, err = s.repo.GetWalletByUserID(userID)
+func (s *walletsService) GetWalletByUserID(userID int32, currency string) (res *wallets.Wallet, code int, err error) {
+	res, err = s.getWallet(userID, currency)
 	if err != nil {
 		code, err = handleError(err)
 		return nil, code, err
@@ -69,27 +75,75 @@ func (s *walletsService) GetWalletByUserID(userID int32) (res *wallets.Wallet, c
 	return res, errs.CodeSuccess, nil
 }
 
-func (s *walletsService) DepositToWallet(arg wallets.UpdateWalletParams) (res *wallets.Wallet, code int, err error) {
-	if arg.Amount <= 0 {
-		return nil, errs.CodeFailedUser, errs.ErrInvalidInput
+// getWallet returns the user's wallet in currency, or the user's first
+// wallet when currency is empty.
+func (s *walletsService) getWallet(userID int32, currency string) (*wallets.Wallet, error) {
+	if currency == "" {
+		return s.repo.GetWalletByUserID(userID)
 	}
 
-	res, err = s.repo.UpdateWalletByUserID(arg)
+	return s.repo.GetWalletByUserIDAndCurrency(userID, currency)
+}
+
+func (s *walletsService) ListWallets(userID int32) (res []wallets.Wallet, code int, err error) {
+	res, err = s.repo.ListWalletsByUserID(userID)
 	if err != nil {
 		code, err = handleError(err)
 		return nil, code, err
 	}
+	if len(res) == 0 {
+		return nil, errs.CodeFailedUser, errs.ErrNoData
+	}
 
 	return res, errs.CodeSuccess, nil
 }
 
+func (s *walletsService) DepositToWallet(arg wallets.UpdateWalletParams) (res *wallets.Wallet, code int, err error) {
+	if arg.Amount <= 0 {
+		return nil, errs.CodeFailedUser, errs.ErrInvalidInput
+	}
+
+	return s.updateBalance(arg, transactions.TransactionTypesDeposit)
+}
+
 func (s *walletsService) WithdrawFromWallet(arg wallets.UpdateWalletParams) (res *wallets.Wallet, code int, err error) {
 	arg.Amount *= -1
 	if arg.Amount >= 0 {
 		return nil, errs.CodeFailedUser, errs.ErrInvalidInput
 	}
 
-	res, err = s.repo.UpdateWalletByUserID(arg)
+	return s.updateBalance(arg, transactions.TransactionTypesWithdrawal)
+}
+
+// updateBalance records the change as a deposit or withdrawal transaction,
+// so it lands in transaction_histories and the ledger like the ones made
+// through /api/v1/transactions.
+func (s *walletsService) updateBalance(arg wallets.UpdateWalletParams, tType transactions.TransactionTypes) (res *wallets.Wallet, code int, err error) {
+	wallet, err := s.getWallet(arg.UserID, arg.Currency)
+	if err != nil {
+		code, err = handleError(err)
+		return nil, code, err
+	}
+
+	walletID := pgtype.Int4{Int32: wallet.ID, Valid: true}
+	transactionArg := transactions.TransactionParams{
+		UserID: pgtype.Int4{Int32: arg.UserID, Valid: true},
+		Amount: arg.Amount,
+		TType:  tType,
+	}
+	if tType == transactions.TransactionTypesWithdrawal {
+		transactionArg.FromWalletID = walletID
+	} else {
+		transactionArg.ToWalletID = walletID
+	}
+
+	_, err = s.transactionsRepo.TransactionDepositOrWithdraw(transactionArg)
+	if err != nil {
+		code, err = handleError(err)
+		return nil, code, err
+	}
+
+	res, err = s.repo.GetWalletByID(wallet.ID)
 	if err != nil {
 		code, err = handleError(err)
 		return nil, code, err
@@ -97,3 +151,97 @@ func (s *walletsService) WithdrawFromWallet(arg wallets.UpdateWalletParams) (res
 
 	return res, errs.CodeSuccess, nil
 }
+
+// statementTypes is the order of the totals in a statement.
+var statementTypes = []transactions.TransactionTypes{
+	transactions.TransactionTypesDeposit,
+	transactions.TransactionTypesWithdrawal,
+	transactions.TransactionTypesPurchase,
+	transactions.TransactionTypesTransfer,
+	transactions.TransactionTypesRefund,
+}
+
+// WriteStatement streams the statement to out. Begin is only called once the
+// transactions are being read, an error before it is returned with its code
+// and nothing is written.
+func (s *walletsService) WriteStatement(arg wallets.GetStatementParams, out wallets.StatementWriter) (code int, err error) {
+	if arg.From.Valid && arg.To.Valid && !arg.From.Time.Before(arg.To.Time) {
+		return errs.CodeFailedUser, errs.ErrInvalidInput
+	}
+
+	wallet, err := s.getWallet(arg.UserID, arg.Currency)
+	if err != nil {
+		return handleError(err)
+	}
+
+	// the opening balance is read before the lines, a transaction landing in
+	// between then shows up as a line and in the closing balance
+	opening, err := s.transactionsRepo.GetWalletBalanceBefore(wallet.ID, arg.From)
+	if err != nil {
+		return errs.CodeFailedServer, fmt.Errorf("failed to get opening balance, err: %v", err)
+	}
+
+	totals := make(map[transactions.TransactionTypes]*wallets.StatementTotal, len(statementTypes))
+	for _, tType := range statementTypes {
+		totals[tType] = &wallets.StatementTotal{TType: tType}
+	}
+
+	res := &wallets.Statement{
+		Wallet:         *wallet,
+		From:           arg.From,
+		To:             arg.To,
+		OpeningBalance: opening,
+	}
+
+	begun := false
+	begin := func() error {
+		if begun {
+			return nil
+		}
+		begun = true
+		return out.Begin(res)
+	}
+
+	listArg := transactions.ListWalletTransactionsParams{
+		WalletID:    wallet.ID,
+		CreatedFrom: arg.From,
+		CreatedTo:   arg.To,
+	}
+	balance := opening
+	err = s.transactionsRepo.EachTransactionByWalletID(listArg, func(history transactions.TransactionHistory) error {
+		if err := begin(); err != nil {
+			return err
+		}
+
+		line := wallets.StatementLine{TransactionHistory: history}
+		if history.TStatus == transactions.TransactionStatusCompleted {
+			line.Effect = transactions.WalletEffect(history, wallet.ID)
+			balance += line.Effect
+
+			if total, ok := totals[history.TType]; ok {
+				total.Count++
+				total.Amount += line.Effect
+			}
+		}
+		line.Balance = balance
+		return out.Line(line)
+	})
+	if err == nil {
+		// a range without transactions still has a head
+		err = begin()
+	}
+	if err != nil {
+		return errs.CodeFailedServer, fmt.Errorf("failed to write wallet statement, err: %v", err)
+	}
+
+	res.ClosingBalance = balance
+	for _, tType := range statementTypes {
+		res.Totals = append(res.Totals, *totals[tType])
+	}
+
+	if err := out.End(res); err != nil {
+		return errs.CodeFailedServer, fmt.Errorf("failed to write wallet statement, err: %v", err)
+	}
+
+	return errs.CodeSuccess, nil
+}
@@ -2,28 +2,34 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"testing"
+	"time"
 
 	auth "github.com/dwiw96/GoCommerceAPI/internal/features/auth"
 	authRepo "github.com/dwiw96/GoCommerceAPI/internal/features/auth/repository"
+	transactions "github.com/dwiw96/GoCommerceAPI/internal/features/transactions"
+	transactionsRepo "github.com/dwiw96/GoCommerceAPI/internal/features/transactions/repository"
 	wallets "github.com/dwiw96/GoCommerceAPI/internal/features/wallets"
 	walletsRepo "github.com/dwiw96/GoCommerceAPI/internal/features/wallets/repository"
 	generator "github.com/dwiw96/GoCommerceAPI/pkg/utils/generator"
 	errs "github.com/dwiw96/GoCommerceAPI/pkg/utils/responses"
 	testUtils "github.com/dwiw96/GoCommerceAPI/testutils"
 
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 var (
-	serviceTest  wallets.IService
-	ctx          context.Context
-	pool         *pgxpool.Pool
-	authRepoTest auth.IRepository
+	serviceTest          wallets.IService
+	ctx                  context.Context
+	pool                 *pgxpool.Pool
+	authRepoTest         auth.IRepository
+	transactionsRepoTest transactions.IRepository
 )
 
 func TestMain(m *testing.M) {
@@ -36,7 +42,8 @@ func TestMain(m *testing.M) {
 
 	repo := walletsRepo.NewWalletsRepository(pool, ctx)
 	authRepoTest = authRepo.NewAuthRepository(pool, pool)
-	serviceTest = NewWalletsService(ctx, repo)
+	transactionsRepoTest = transactionsRepo.NewTransactionsRepository(pool, pool, ctx)
+	serviceTest = NewWalletsService(ctx, repo, transactionsRepoTest)
 
 	exitTest := m.Run()
 
@@ -116,6 +123,26 @@ func TestCreateWallet(t *testing.T) {
 			code:  errs.CodeFailedDuplicated,
 			err:   errs.ErrDuplicate,
 			isErr: true,
+		}, {
+			desc: "success_other_currency",
+			args: wallets.CreateWalletParams{
+				UserID:   user.ID,
+				Balance:  int32(generator.RandomInt(0, 50)),
+				Currency: "USD",
+			},
+			code:  errs.CodeSuccessCreate,
+			err:   nil,
+			isErr: false,
+		}, {
+			desc: "failed_invalid_currency",
+			args: wallets.CreateWalletParams{
+				UserID:   user2.ID,
+				Balance:  int32(generator.RandomInt(0, 50)),
+				Currency: "usd",
+			},
+			code:  errs.CodeFailedUser,
+			err:   errs.ErrCheckConstraint,
+			isErr: true,
 		}, {
 			desc: "failed_without_user_id",
 			args: wallets.CreateWalletParams{
@@ -155,6 +182,11 @@ func TestCreateWallet(t *testing.T) {
 				assert.NotZero(t, res.ID)
 				assert.Equal(t, tC.args.UserID, res.UserID)
 				assert.Equal(t, tC.args.Balance, res.Balance)
+				if tC.args.Currency != "" {
+					assert.Equal(t, tC.args.Currency, res.Currency)
+				} else {
+					assert.Equal(t, "IDR", res.Currency)
+				}
 				assert.False(t, res.CreatedAt.IsZero())
 				assert.False(t, res.UpdatedAt.IsZero())
 			} else {
@@ -166,27 +198,40 @@ func TestCreateWallet(t *testing.T) {
 
 func TestGetWalletByUserID(t *testing.T) {
 	walletArg, wallet := createWalletTest(t)
+	usdWallet, _, err := serviceTest.CreateWallet(wallets.CreateWalletParams{UserID: walletArg.UserID, Currency: "USD"})
+	require.NoError(t, err)
+
 	testCases := []struct {
-		desc   string
-		userID int32
-		ans    wallets.Wallet
-		code   int
-		err    error
-		isErr  bool
+		desc     string
+		userID   int32
+		currency string
+		ans      wallets.Wallet
+		code     int
+		err      error
+		isErr    bool
 	}{
 		{
 			desc:   "success",
 			userID: walletArg.UserID,
-			ans: wallets.Wallet{
-				ID:        wallet.ID,
-				UserID:    wallet.UserID,
-				Balance:   wallet.Balance,
-				CreatedAt: wallet.CreatedAt,
-				UpdatedAt: wallet.UpdatedAt,
-			},
-			code:  errs.CodeSuccess,
-			err:   nil,
-			isErr: false,
+			ans:    *wallet,
+			code:   errs.CodeSuccess,
+			err:    nil,
+			isErr:  false,
+		}, {
+			desc:     "success_by_currency",
+			userID:   walletArg.UserID,
+			currency: "USD",
+			ans:      *usdWallet,
+			code:     errs.CodeSuccess,
+			err:      nil,
+			isErr:    false,
+		}, {
+			desc:     "failed_not_found_currency",
+			userID:   walletArg.UserID,
+			currency: "EUR",
+			code:     errs.CodeFailedUser,
+			err:      errs.ErrNoData,
+			isErr:    true,
 		}, {
 			desc:   "failed_not_found_user_id",
 			userID: walletArg.UserID + 5,
@@ -202,16 +247,17 @@ func TestGetWalletByUserID(t *testing.T) {
 	}
 	for _, tC := range testCases {
 		t.Run(tC.desc, func(t *testing.T) {
-			res, code, err := serviceTest.GetWalletByUserID(tC.userID)
+			res, code, err := serviceTest.GetWalletByUserID(tC.userID, tC.currency)
 			assert.Equal(t, tC.code, code)
 			assert.Equal(t, tC.err, err)
 			if !tC.isErr {
 				require.NoError(t, err)
-				assert.Equal(t, wallet.ID, res.ID)
-				assert.Equal(t, wallet.UserID, res.UserID)
-				assert.Equal(t, wallet.Balance, res.Balance)
-				assert.Equal(t, wallet.CreatedAt, res.CreatedAt)
-				assert.Equal(t, wallet.UpdatedAt, res.UpdatedAt)
+				assert.Equal(t, tC.ans.ID, res.ID)
+				assert.Equal(t, tC.ans.UserID, res.UserID)
+				assert.Equal(t, tC.ans.Balance, res.Balance)
+				assert.Equal(t, tC.ans.Currency, res.Currency)
+				assert.Equal(t, tC.ans.CreatedAt, res.CreatedAt)
+				assert.Equal(t, tC.ans.UpdatedAt, res.UpdatedAt)
 			} else {
 				require.Error(t, err)
 			}
@@ -219,6 +265,25 @@ func TestGetWalletByUserID(t *testing.T) {
 	}
 }
 
+func TestListWallets(t *testing.T) {
+	walletArg, wallet := createWalletTest(t)
+	usdWallet, _, err := serviceTest.CreateWallet(wallets.CreateWalletParams{UserID: walletArg.UserID, Currency: "USD"})
+	require.NoError(t, err)
+
+	res, code, err := serviceTest.ListWallets(walletArg.UserID)
+	require.NoError(t, err)
+	assert.Equal(t, errs.CodeSuccess, code)
+	require.Len(t, res, 2)
+	assert.Equal(t, wallet.ID, res[0].ID)
+	assert.Equal(t, usdWallet.ID, res[1].ID)
+	assert.Equal(t, "USD", res[1].Currency)
+
+	_, code, err = serviceTest.ListWallets(walletArg.UserID + 5)
+	require.Error(t, err)
+	assert.Equal(t, errs.CodeFailedUser, code)
+	assert.Equal(t, errs.ErrNoData, err)
+}
+
 func TestDepositToWallet(t *testing.T) {
 	walletArg, wallet := createWalletTest(t)
 	deposit := int32(generator.RandomInt(500, 5000))
@@ -401,3 +466,130 @@ func TestWithdrawFromWallet(t *testing.T) {
 		})
 	}
 }
+
+// statementRecorder keeps what WriteStatement writes, errLine is returned
+// from Line when set.
+type statementRecorder struct {
+	begun   bool
+	res     *wallets.Statement
+	lines   []wallets.StatementLine
+	errLine error
+}
+
+func (r *statementRecorder) Begin(arg *wallets.Statement) error {
+	r.begun = true
+	return nil
+}
+
+func (r *statementRecorder) Line(arg wallets.StatementLine) error {
+	if r.errLine != nil {
+		return r.errLine
+	}
+	r.lines = append(r.lines, arg)
+	return nil
+}
+
+func (r *statementRecorder) End(arg *wallets.Statement) error {
+	r.res = arg
+	return nil
+}
+
+func TestWriteStatement(t *testing.T) {
+	_, wallet := createWalletTest(t)
+	userID := pgtype.Int4{Int32: wallet.UserID, Valid: true}
+	walletID := pgtype.Int4{Int32: wallet.ID, Valid: true}
+
+	_, err := transactionsRepoTest.TransactionDepositOrWithdraw(transactions.TransactionParams{
+		UserID:     userID,
+		ToWalletID: walletID,
+		Amount:     500,
+		TType:      transactions.TransactionTypesDeposit,
+	})
+	require.NoError(t, err)
+	_, err = transactionsRepoTest.TransactionDepositOrWithdraw(transactions.TransactionParams{
+		UserID:       userID,
+		FromWalletID: walletID,
+		ToWalletID:   walletID,
+		Amount:       -200,
+		TType:        transactions.TransactionTypesWithdrawal,
+	})
+	require.NoError(t, err)
+
+	t.Run("success", func(t *testing.T) {
+		out := &statementRecorder{}
+		code, err := serviceTest.WriteStatement(wallets.GetStatementParams{UserID: wallet.UserID}, out)
+		require.NoError(t, err)
+		assert.Equal(t, errs.CodeSuccess, code)
+		require.True(t, out.begun)
+		require.NotNil(t, out.res)
+		assert.Equal(t, wallet.Balance, out.res.OpeningBalance)
+		assert.Equal(t, wallet.Balance+300, out.res.ClosingBalance)
+		require.Len(t, out.lines, 2)
+		assert.Equal(t, int32(500), out.lines[0].Effect)
+		assert.Equal(t, wallet.Balance+500, out.lines[0].Balance)
+		assert.Equal(t, int32(-200), out.lines[1].Effect)
+		assert.Equal(t, wallet.Balance+300, out.lines[1].Balance)
+
+		for _, total := range out.res.Totals {
+			switch total.TType {
+			case transactions.TransactionTypesDeposit:
+				assert.Equal(t, int32(1), total.Count)
+				assert.Equal(t, int32(500), total.Amount)
+			case transactions.TransactionTypesWithdrawal:
+				assert.Equal(t, int32(1), total.Count)
+				assert.Equal(t, int32(-200), total.Amount)
+			default:
+				assert.Zero(t, total.Count)
+			}
+		}
+	})
+
+	t.Run("success_future_range", func(t *testing.T) {
+		arg := wallets.GetStatementParams{
+			UserID: wallet.UserID,
+			From:   pgtype.Timestamp{Time: time.Now().AddDate(0, 0, 1), Valid: true},
+		}
+		out := &statementRecorder{}
+		code, err := serviceTest.WriteStatement(arg, out)
+		require.NoError(t, err)
+		assert.Equal(t, errs.CodeSuccess, code)
+		assert.True(t, out.begun)
+		assert.Empty(t, out.lines)
+		require.NotNil(t, out.res)
+		assert.Equal(t, wallet.Balance+300, out.res.OpeningBalance)
+		assert.Equal(t, out.res.OpeningBalance, out.res.ClosingBalance)
+	})
+
+	t.Run("failed_writer", func(t *testing.T) {
+		out := &statementRecorder{errLine: errors.New("connection closed")}
+		code, err := serviceTest.WriteStatement(wallets.GetStatementParams{UserID: wallet.UserID}, out)
+		require.Error(t, err)
+		assert.Equal(t, errs.CodeFailedServer, code)
+		assert.True(t, out.begun)
+		assert.Nil(t, out.res)
+	})
+
+	t.Run("failed_range", func(t *testing.T) {
+		now := time.Now()
+		arg := wallets.GetStatementParams{
+			UserID: wallet.UserID,
+			From:   pgtype.Timestamp{Time: now, Valid: true},
+			To:     pgtype.Timestamp{Time: now.AddDate(0, 0, -1), Valid: true},
+		}
+		out := &statementRecorder{}
+		code, err := serviceTest.WriteStatement(arg, out)
+		require.Error(t, err)
+		assert.Equal(t, errs.CodeFailedUser, code)
+		assert.Equal(t, errs.ErrInvalidInput, err)
+		assert.False(t, out.begun)
+	})
+
+	t.Run("failed_no_wallet", func(t *testing.T) {
+		out := &statementRecorder{}
+		code, err := serviceTest.WriteStatement(wallets.GetStatementParams{UserID: wallet.UserID + 100}, out)
+		require.Error(t, err)
+		assert.Equal(t, errs.CodeFailedUser, code)
+		assert.Equal(t, errs.ErrNoData, err)
+		assert.False(t, out.begun)
+	})
+}
@@ -0,0 +1,4 @@
+BEGIN;
+DROP TABLE IF EXISTS cart_items;
+DROP TABLE IF EXISTS carts;
+COMMIT;
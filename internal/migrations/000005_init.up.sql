@@ -0,0 +1,31 @@
+BEGIN;
+CREATE TABLE carts(
+    id INT GENERATED ALWAYS AS IDENTITY
+        CONSTRAINT pk_carts_id PRIMARY KEY,
+    user_id INT NOT NULL
+        CONSTRAINT uq_carts_user_id UNIQUE,
+        CONSTRAINT fk_carts_user_id FOREIGN KEY (user_id)
+            REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE cart_items(
+    id INT GENERATED ALWAYS AS IDENTITY
+        CONSTRAINT pk_cart_items_id PRIMARY KEY,
+    cart_id INT NOT NULL,
+        CONSTRAINT fk_cart_items_cart_id FOREIGN KEY (cart_id)
+            REFERENCES carts(id) ON DELETE CASCADE,
+    product_id INT NOT NULL,
+        CONSTRAINT fk_cart_items_product_id FOREIGN KEY (product_id)
+            REFERENCES products(id) ON DELETE CASCADE,
+    quantity INT NOT NULL
+        CONSTRAINT ck_cart_items_quantity CHECK (quantity > 0),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    CONSTRAINT uq_cart_items_cart_id_product_id UNIQUE (cart_id, product_id)
+);
+
+CREATE INDEX ix_cart_items_cart_id ON cart_items(cart_id);
+CREATE INDEX ix_cart_items_product_id ON cart_items(product_id);
+COMMIT;
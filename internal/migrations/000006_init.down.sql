@@ -0,0 +1,7 @@
+BEGIN;
+DROP INDEX IF EXISTS ix_transaction_histories_order_id;
+ALTER TABLE transaction_histories DROP COLUMN IF EXISTS order_id;
+DROP TABLE IF EXISTS order_items;
+DROP TABLE IF EXISTS orders;
+DROP TYPE IF EXISTS order_status;
+COMMIT;
@@ -0,0 +1,47 @@
+BEGIN;
+CREATE TYPE order_status AS ENUM ('created', 'paid', 'shipped', 'delivered', 'cancelled', 'refunded');
+
+CREATE TABLE orders(
+    id INT GENERATED ALWAYS AS IDENTITY
+        CONSTRAINT pk_orders_id PRIMARY KEY,
+    user_id INT NOT NULL,
+        CONSTRAINT fk_orders_user_id FOREIGN KEY (user_id)
+            REFERENCES users(id),
+    status order_status NOT NULL DEFAULT 'created',
+    total_amount INT NOT NULL DEFAULT 0
+        CONSTRAINT ck_orders_total_amount CHECK (total_amount >= 0),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX ix_orders_user_id ON orders(user_id);
+CREATE INDEX ix_orders_status ON orders(status);
+CREATE INDEX ix_orders_created_at ON orders(created_at);
+
+CREATE TABLE order_items(
+    id INT GENERATED ALWAYS AS IDENTITY
+        CONSTRAINT pk_order_items_id PRIMARY KEY,
+    order_id INT NOT NULL,
+        CONSTRAINT fk_order_items_order_id FOREIGN KEY (order_id)
+            REFERENCES orders(id) ON DELETE CASCADE,
+    product_id INT NOT NULL,
+        CONSTRAINT fk_order_items_product_id FOREIGN KEY (product_id)
+            REFERENCES products(id),
+    quantity INT NOT NULL
+        CONSTRAINT ck_order_items_quantity CHECK (quantity > 0),
+    price INT NOT NULL
+        CONSTRAINT ck_order_items_price CHECK (price >= 0),
+    amount INT NOT NULL
+        CONSTRAINT ck_order_items_amount CHECK (amount >= 0),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX ix_order_items_order_id ON order_items(order_id);
+CREATE INDEX ix_order_items_product_id ON order_items(product_id);
+
+ALTER TABLE transaction_histories
+    ADD COLUMN order_id INT NULL
+        CONSTRAINT fk_transaction_histories_order_id REFERENCES orders(id);
+
+CREATE INDEX ix_transaction_histories_order_id ON transaction_histories(order_id);
+COMMIT;
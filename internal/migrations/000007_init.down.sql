@@ -0,0 +1,14 @@
+BEGIN;
+DROP INDEX IF EXISTS ix_transaction_histories_ref_transaction_id;
+ALTER TABLE transaction_histories DROP COLUMN IF EXISTS ref_transaction_id;
+
+DELETE FROM transaction_histories WHERE t_type = 'refund';
+
+DROP INDEX IF EXISTS ix_transaction_histories_t_type;
+ALTER TYPE transaction_types RENAME TO transaction_types_old;
+CREATE TYPE transaction_types AS ENUM ('purchase', 'deposit', 'withdrawal', 'transfer');
+ALTER TABLE transaction_histories
+    ALTER COLUMN t_type TYPE transaction_types USING t_type::text::transaction_types;
+DROP TYPE transaction_types_old;
+CREATE INDEX ix_transaction_histories_t_type ON transaction_histories(t_type);
+COMMIT;
@@ -0,0 +1,9 @@
+ALTER TYPE transaction_types ADD VALUE IF NOT EXISTS 'refund';
+
+BEGIN;
+ALTER TABLE transaction_histories
+    ADD COLUMN ref_transaction_id INT NULL
+        CONSTRAINT fk_transaction_histories_ref_transaction_id REFERENCES transaction_histories(id);
+
+CREATE INDEX ix_transaction_histories_ref_transaction_id ON transaction_histories(ref_transaction_id);
+COMMIT;
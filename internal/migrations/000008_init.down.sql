@@ -0,0 +1,6 @@
+BEGIN;
+DROP TABLE IF EXISTS ledger_entries;
+DROP TABLE IF EXISTS ledger_journals;
+DROP TYPE IF EXISTS ledger_sides;
+DROP TYPE IF EXISTS ledger_accounts;
+COMMIT;
@@ -0,0 +1,54 @@
+BEGIN;
+CREATE TYPE ledger_accounts AS ENUM ('wallet', 'external', 'sales', 'opening');
+CREATE TYPE ledger_sides AS ENUM ('debit', 'credit');
+
+CREATE TABLE ledger_journals(
+    id INT GENERATED ALWAYS AS IDENTITY
+        CONSTRAINT pk_ledger_journals_id PRIMARY KEY,
+    transaction_id INT NULL,
+        CONSTRAINT fk_ledger_journals_transaction_id FOREIGN KEY (transaction_id)
+            REFERENCES transaction_histories(id),
+    description VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- a transaction is posted once
+CREATE UNIQUE INDEX ux_ledger_journals_transaction_id ON ledger_journals(transaction_id);
+
+CREATE TABLE ledger_entries(
+    id INT GENERATED ALWAYS AS IDENTITY
+        CONSTRAINT pk_ledger_entries_id PRIMARY KEY,
+    journal_id INT NOT NULL,
+        CONSTRAINT fk_ledger_entries_journal_id FOREIGN KEY (journal_id)
+            REFERENCES ledger_journals(id),
+    account ledger_accounts NOT NULL,
+    wallet_id INT NULL,
+        CONSTRAINT fk_ledger_entries_wallet_id FOREIGN KEY (wallet_id)
+            REFERENCES wallets(id),
+    side ledger_sides NOT NULL,
+    amount INT NOT NULL
+        CONSTRAINT ck_ledger_entries_amount CHECK (amount > 0),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    CONSTRAINT ck_ledger_entries_wallet_id CHECK ((account = 'wallet') = (wallet_id IS NOT NULL))
+);
+
+CREATE INDEX ix_ledger_entries_journal_id ON ledger_entries(journal_id);
+CREATE INDEX ix_ledger_entries_wallet_id ON ledger_entries(wallet_id);
+
+-- wallets that exist before the ledger open with their current balance,
+-- their older transaction_histories rows are not posted
+DO $$
+DECLARE
+    w RECORD;
+    new_journal_id INT;
+BEGIN
+    FOR w IN SELECT id, balance FROM wallets WHERE balance > 0 ORDER BY id LOOP
+        INSERT INTO ledger_journals(description) VALUES ('opening balance')
+        RETURNING id INTO new_journal_id;
+
+        INSERT INTO ledger_entries(journal_id, account, wallet_id, side, amount) VALUES
+            (new_journal_id, 'opening', NULL, 'debit', w.balance),
+            (new_journal_id, 'wallet', w.id, 'credit', w.balance);
+    END LOOP;
+END $$;
+COMMIT;
@@ -0,0 +1,17 @@
+BEGIN;
+ALTER TABLE transaction_histories
+    DROP COLUMN IF EXISTS converted_amount,
+    DROP COLUMN IF EXISTS exchange_rate;
+
+DROP TABLE IF EXISTS exchange_rates;
+
+ALTER TABLE products DROP COLUMN IF EXISTS currency;
+
+-- fails while a user still holds more than one wallet
+DROP INDEX IF EXISTS ix_wallets_user_id;
+ALTER TABLE wallets DROP CONSTRAINT IF EXISTS uq_wallets_user_id_currency;
+ALTER TABLE wallets ADD CONSTRAINT uq_wallets_user_id UNIQUE (user_id);
+ALTER TABLE wallets DROP COLUMN IF EXISTS currency;
+
+-- postgres can't drop an enum value, 'exchange' stays in ledger_accounts
+COMMIT;
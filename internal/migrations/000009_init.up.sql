@@ -0,0 +1,37 @@
+ALTER TYPE ledger_accounts ADD VALUE IF NOT EXISTS 'exchange';
+
+BEGIN;
+ALTER TABLE wallets
+    ADD COLUMN currency VARCHAR(3) NOT NULL DEFAULT 'IDR'
+        CONSTRAINT ck_wallets_currency CHECK (currency ~ '^[A-Z]{3}$');
+
+-- a user holds one wallet per currency
+ALTER TABLE wallets DROP CONSTRAINT IF EXISTS uq_wallets_user_id;
+ALTER TABLE wallets ADD CONSTRAINT uq_wallets_user_id_currency UNIQUE (user_id, currency);
+
+CREATE INDEX ix_wallets_user_id ON wallets(user_id);
+
+ALTER TABLE products
+    ADD COLUMN currency VARCHAR(3) NOT NULL DEFAULT 'IDR'
+        CONSTRAINT ck_products_currency CHECK (currency ~ '^[A-Z]{3}$');
+
+-- one base_currency is worth rate quote_currency
+CREATE TABLE exchange_rates(
+    id INT GENERATED ALWAYS AS IDENTITY
+        CONSTRAINT pk_exchange_rates_id PRIMARY KEY,
+    base_currency VARCHAR(3) NOT NULL
+        CONSTRAINT ck_exchange_rates_base_currency CHECK (base_currency ~ '^[A-Z]{3}$'),
+    quote_currency VARCHAR(3) NOT NULL
+        CONSTRAINT ck_exchange_rates_quote_currency CHECK (quote_currency ~ '^[A-Z]{3}$'),
+    rate NUMERIC(20, 10) NOT NULL
+        CONSTRAINT ck_exchange_rates_rate CHECK (rate > 0),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    CONSTRAINT uq_exchange_rates_base_currency_quote_currency UNIQUE (base_currency, quote_currency),
+    CONSTRAINT ck_exchange_rates_pair CHECK (base_currency <> quote_currency)
+);
+
+ALTER TABLE transaction_histories
+    ADD COLUMN exchange_rate NUMERIC(20, 10) NULL,
+    ADD COLUMN converted_amount INT NULL;
+COMMIT;
@@ -0,0 +1,5 @@
+BEGIN;
+ALTER TABLE users DROP COLUMN IF EXISTS role;
+
+DROP TYPE IF EXISTS user_roles;
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+CREATE TYPE user_roles AS ENUM ('customer', 'staff', 'admin');
+
+ALTER TABLE users
+    ADD COLUMN role user_roles NOT NULL DEFAULT 'customer';
+COMMIT;
@@ -0,0 +1,17 @@
+BEGIN;
+-- only the sha256 of a reset token is kept, the token itself is mailed
+CREATE TABLE password_reset_tokens(
+    id INT GENERATED ALWAYS AS IDENTITY
+        CONSTRAINT pk_password_reset_tokens_id PRIMARY KEY,
+    user_id INT NOT NULL,
+        CONSTRAINT fk_password_reset_tokens_user_id FOREIGN KEY (user_id)
+            REFERENCES users(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) NOT NULL
+        CONSTRAINT uq_password_reset_tokens_token_hash UNIQUE,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX ix_password_reset_tokens_user_id ON password_reset_tokens(user_id);
+COMMIT;
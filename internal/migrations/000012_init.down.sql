@@ -0,0 +1,7 @@
+BEGIN;
+DROP TABLE IF EXISTS user_addresses;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS phone,
+    DROP COLUMN IF EXISTS full_name;
+COMMIT;
@@ -0,0 +1,28 @@
+BEGIN;
+ALTER TABLE users
+    ADD COLUMN full_name VARCHAR(255) NULL,
+    ADD COLUMN phone VARCHAR(32) NULL;
+
+CREATE TABLE user_addresses(
+    id INT GENERATED ALWAYS AS IDENTITY
+        CONSTRAINT pk_user_addresses_id PRIMARY KEY,
+    user_id INT NOT NULL,
+        CONSTRAINT fk_user_addresses_user_id FOREIGN KEY (user_id)
+            REFERENCES users(id) ON DELETE CASCADE,
+    label VARCHAR(50) NOT NULL DEFAULT '',
+    recipient VARCHAR(255) NOT NULL,
+    phone VARCHAR(32) NOT NULL DEFAULT '',
+    street VARCHAR(255) NOT NULL,
+    city VARCHAR(100) NOT NULL,
+    province VARCHAR(100) NOT NULL DEFAULT '',
+    postal_code VARCHAR(20) NOT NULL DEFAULT '',
+    country VARCHAR(100) NOT NULL,
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX ix_user_addresses_user_id ON user_addresses(user_id);
+-- a user has one default address at most
+CREATE UNIQUE INDEX uq_user_addresses_default ON user_addresses(user_id) WHERE is_default;
+COMMIT;
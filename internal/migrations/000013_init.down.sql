@@ -0,0 +1,17 @@
+BEGIN;
+DROP INDEX IF EXISTS ix_refresh_token_whitelist_user_id;
+CREATE INDEX ix_refresh_token_whitelist_user_id ON refresh_token_whitelist(id);
+
+-- only the last session of each user is kept
+DELETE FROM refresh_token_whitelist r
+USING refresh_token_whitelist newer
+WHERE newer.user_id = r.user_id
+AND newer.id > r.id;
+
+ALTER TABLE refresh_token_whitelist
+    DROP COLUMN IF EXISTS last_used_at,
+    DROP COLUMN IF EXISTS ip_address,
+    DROP COLUMN IF EXISTS user_agent,
+    DROP COLUMN IF EXISTS device_name,
+    ADD CONSTRAINT uq_refresh_token_whitelist_user_id UNIQUE (user_id);
+COMMIT;
@@ -0,0 +1,13 @@
+BEGIN;
+-- a user can be logged in on many devices, each with its own refresh token
+ALTER TABLE refresh_token_whitelist
+    DROP CONSTRAINT uq_refresh_token_whitelist_user_id,
+    ADD COLUMN device_name VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN user_agent TEXT NOT NULL DEFAULT '',
+    ADD COLUMN ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    ADD COLUMN last_used_at TIMESTAMP NOT NULL DEFAULT NOW();
+
+-- the index named after user_id was on id
+DROP INDEX IF EXISTS ix_refresh_token_whitelist_user_id;
+CREATE INDEX ix_refresh_token_whitelist_user_id ON refresh_token_whitelist(user_id);
+COMMIT;
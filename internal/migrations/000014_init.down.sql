@@ -0,0 +1,4 @@
+BEGIN;
+DROP TABLE IF EXISTS auth_audit_logs;
+DROP TABLE IF EXISTS refresh_token_rotations;
+COMMIT;
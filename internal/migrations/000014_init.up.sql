@@ -0,0 +1,33 @@
+BEGIN;
+-- a session is a token family, every rotation keeps the token it replaced so
+-- a replayed old token can be told apart from a wrong one
+CREATE TABLE refresh_token_rotations(
+    id INT GENERATED ALWAYS AS IDENTITY
+        CONSTRAINT pk_refresh_token_rotations_id PRIMARY KEY,
+    session_id INT NOT NULL,
+        CONSTRAINT fk_refresh_token_rotations_session_id FOREIGN KEY (session_id)
+            REFERENCES refresh_token_whitelist(id) ON DELETE CASCADE,
+    user_id INT NOT NULL,
+        CONSTRAINT fk_refresh_token_rotations_user_id FOREIGN KEY (user_id)
+            REFERENCES users(id) ON DELETE CASCADE,
+    refresh_token UUID NOT NULL,
+    parent_token UUID NOT NULL
+        CONSTRAINT uq_refresh_token_rotations_parent_token UNIQUE,
+    rotated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX ix_refresh_token_rotations_session_id ON refresh_token_rotations(session_id);
+
+-- user_id has no foreign key, the log is kept after the user is deleted
+CREATE TABLE auth_audit_logs(
+    id INT GENERATED ALWAYS AS IDENTITY
+        CONSTRAINT pk_auth_audit_logs_id PRIMARY KEY,
+    user_id INT NOT NULL,
+    session_id INT NULL,
+    event VARCHAR(64) NOT NULL,
+    detail TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX ix_auth_audit_logs_user_id ON auth_audit_logs(user_id);
+COMMIT;
@@ -0,0 +1,16 @@
+BEGIN;
+CREATE TABLE sec_m (
+  private_key bytea DEFAULT NULL
+);
+
+-- only the key that signs now is kept
+INSERT INTO sec_m(private_key)
+SELECT private_key
+FROM jwt_signing_keys
+WHERE activates_at <= NOW()
+AND (retires_at IS NULL OR retires_at > NOW())
+ORDER BY activates_at DESC, id DESC
+LIMIT 1;
+
+DROP TABLE IF EXISTS jwt_signing_keys;
+COMMIT;
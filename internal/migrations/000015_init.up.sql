@@ -0,0 +1,23 @@
+BEGIN;
+-- a token names the key it was signed with in its kid header, a key signs
+-- from activates_at and is trusted until retires_at
+CREATE TABLE jwt_signing_keys(
+    id INT GENERATED ALWAYS AS IDENTITY
+        CONSTRAINT pk_jwt_signing_keys_id PRIMARY KEY,
+    kid VARCHAR(64) NOT NULL
+        CONSTRAINT uq_jwt_signing_keys_kid UNIQUE,
+    private_key BYTEA NOT NULL,
+    activates_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    retires_at TIMESTAMP NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- the key that signed every token so far stays the signing key
+INSERT INTO jwt_signing_keys(kid, private_key, activates_at)
+SELECT md5(private_key), private_key, NOW()
+FROM sec_m
+WHERE private_key IS NOT NULL
+LIMIT 1;
+
+DROP TABLE sec_m;
+COMMIT;
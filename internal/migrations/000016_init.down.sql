@@ -0,0 +1,13 @@
+BEGIN;
+-- an encrypted key can't be read without the encrypted column, they have to
+-- be decrypted before going down
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM jwt_signing_keys WHERE encrypted) THEN
+        RAISE EXCEPTION 'jwt_signing_keys has encrypted keys, run make encrypt-keys args=-decrypt first';
+    END IF;
+END $$;
+
+ALTER TABLE jwt_signing_keys
+    DROP COLUMN IF EXISTS encrypted;
+COMMIT;
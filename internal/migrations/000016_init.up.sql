@@ -0,0 +1,6 @@
+BEGIN;
+-- private_key is encrypted with the key encryption key when encrypted is
+-- true, the keys from before stay plain until make encrypt-keys runs
+ALTER TABLE jwt_signing_keys
+    ADD COLUMN encrypted BOOLEAN NOT NULL DEFAULT FALSE;
+COMMIT;
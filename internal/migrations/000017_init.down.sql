@@ -0,0 +1,19 @@
+BEGIN;
+-- the code before only reads RS256 keys, the others have to be retired by
+-- rotating to an RS256 key before going down
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM jwt_signing_keys
+        WHERE algorithm <> 'RS256'
+        AND (retires_at IS NULL OR retires_at > NOW())
+    ) THEN
+        RAISE EXCEPTION 'jwt_signing_keys has keys that are not RS256, run make rotate-key args=-alg=RS256 and wait until they retire';
+    END IF;
+END $$;
+
+DELETE FROM jwt_signing_keys WHERE algorithm <> 'RS256';
+
+ALTER TABLE jwt_signing_keys
+    DROP COLUMN IF EXISTS algorithm;
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+-- the keys from before are RS256, RS256 keys are stored as PKCS#1 and the
+-- other algorithms as PKCS#8
+ALTER TABLE jwt_signing_keys
+    ADD COLUMN algorithm VARCHAR(16) NOT NULL DEFAULT 'RS256';
+COMMIT;
@@ -0,0 +1,27 @@
+BEGIN;
+-- a user has TOTP once confirmed_at is set, last_used_step is the period of
+-- the last code taken so the same code can't be used twice
+CREATE TABLE user_totp(
+    user_id INT NOT NULL
+        CONSTRAINT pk_user_totp_user_id PRIMARY KEY,
+        CONSTRAINT fk_user_totp_user_id FOREIGN KEY (user_id)
+            REFERENCES users(id) ON DELETE CASCADE,
+    secret VARCHAR(64) NOT NULL,
+    confirmed_at TIMESTAMP NULL,
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- recovery codes are single use, only their sha256 is kept
+CREATE TABLE mfa_recovery_codes(
+    id INT GENERATED ALWAYS AS IDENTITY
+        CONSTRAINT pk_mfa_recovery_codes_id PRIMARY KEY,
+    user_id INT NOT NULL,
+        CONSTRAINT fk_mfa_recovery_codes_user_id FOREIGN KEY (user_id)
+            REFERENCES users(id) ON DELETE CASCADE,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at TIMESTAMP NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    CONSTRAINT uq_mfa_recovery_codes_user_id_code_hash UNIQUE (user_id, code_hash)
+);
+COMMIT;
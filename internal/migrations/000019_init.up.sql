@@ -0,0 +1,21 @@
+BEGIN;
+-- an api key is only shown when it's created, key_hash is its sha256 and
+-- prefix the start of it to tell the keys apart
+CREATE TABLE api_keys(
+    id INT GENERATED ALWAYS AS IDENTITY
+        CONSTRAINT pk_api_keys_id PRIMARY KEY,
+    user_id INT NOT NULL,
+        CONSTRAINT fk_api_keys_user_id FOREIGN KEY (user_id)
+            REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    prefix VARCHAR(16) NOT NULL,
+    key_hash VARCHAR(64) NOT NULL,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    expires_at TIMESTAMP NULL,
+    last_used_at TIMESTAMP NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    CONSTRAINT uq_api_keys_key_hash UNIQUE (key_hash)
+);
+
+CREATE INDEX ix_api_keys_user_id ON api_keys(user_id);
+COMMIT;
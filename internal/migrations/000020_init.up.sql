@@ -0,0 +1,18 @@
+BEGIN;
+-- an identity is a user's account at an OpenID Connect provider, subject is
+-- the provider's id of it and email what the provider said when it was linked
+CREATE TABLE identities(
+    id INT GENERATED ALWAYS AS IDENTITY
+        CONSTRAINT pk_identities_id PRIMARY KEY,
+    user_id INT NOT NULL,
+        CONSTRAINT fk_identities_user_id FOREIGN KEY (user_id)
+            REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(64) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    CONSTRAINT uq_identities_provider_subject UNIQUE (provider, subject)
+);
+
+CREATE INDEX ix_identities_user_id ON identities(user_id);
+COMMIT;
@@ -0,0 +1,4 @@
+BEGIN;
+ALTER TABLE refresh_token_whitelist
+    DROP COLUMN IF EXISTS remember_me;
+COMMIT;
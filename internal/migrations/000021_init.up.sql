@@ -0,0 +1,6 @@
+BEGIN;
+-- a remember me session gets the longer refresh lifetime every time it's
+-- refreshed, created_at bounds every session by SESSION_MAX_LIFETIME
+ALTER TABLE refresh_token_whitelist
+    ADD COLUMN remember_me BOOLEAN NOT NULL DEFAULT FALSE;
+COMMIT;
@@ -0,0 +1,14 @@
+BEGIN;
+-- an encrypted secret can't be read without the encrypted column, they have
+-- to be decrypted before going down
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM user_totp WHERE encrypted) THEN
+        RAISE EXCEPTION 'user_totp has encrypted secrets, run make encrypt-keys args=-decrypt first';
+    END IF;
+END $$;
+
+ALTER TABLE user_totp
+    DROP COLUMN IF EXISTS encrypted,
+    ALTER COLUMN secret TYPE VARCHAR(64) USING convert_from(secret, 'UTF8');
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+-- secret is encrypted with the key encryption key when encrypted is true,
+-- the secrets from before stay plain until make encrypt-keys runs
+ALTER TABLE user_totp
+    ALTER COLUMN secret TYPE BYTEA USING convert_to(secret, 'UTF8'),
+    ADD COLUMN encrypted BOOLEAN NOT NULL DEFAULT FALSE;
+COMMIT;
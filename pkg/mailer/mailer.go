@@ -0,0 +1,72 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Message is one plain text email.
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender sends emails. An implementation must be safe to use from more than
+// one request at a time.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+type fileSender struct {
+	dir string
+}
+
+// NewFileSender returns a Sender for local development that never sends
+// anything: every message is written as an .eml file in dir, or to the log
+// when dir is empty.
+func NewFileSender(dir string) Sender {
+	return &fileSender{
+		dir: dir,
+	}
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+func (s *fileSender) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	var content strings.Builder
+	fmt.Fprintf(&content, "From: %s\r\n", msg.From)
+	fmt.Fprintf(&content, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&content, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&content, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	content.WriteString("\r\n")
+	content.WriteString(msg.Body)
+
+	if s.dir == "" {
+		log.Printf("mail to %s:\n%s", msg.To, content.String())
+		return nil
+	}
+
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create mail dir, err: %v", err)
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", now.Format("20060102T150405.000000000"), unsafeFileChars.ReplaceAllString(msg.To, "_"))
+	if err := os.WriteFile(filepath.Join(s.dir, name), []byte(content.String()), 0o644); err != nil {
+		return fmt.Errorf("failed to write mail, err: %v", err)
+	}
+
+	return nil
+}
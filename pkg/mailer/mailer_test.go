@@ -0,0 +1,50 @@
+package mailer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileSender(t *testing.T) {
+	msg := Message{
+		From:    "no-reply@gocommerce.com",
+		To:      "user/1@mail.com",
+		Subject: "Verify your email",
+		Body:    "open the link",
+	}
+
+	t.Run("success_file", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "outbox")
+		err := NewFileSender(dir).Send(context.Background(), msg)
+		require.NoError(t, err)
+
+		files, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		require.Len(t, files, 1)
+		assert.Contains(t, files[0].Name(), "user_1_mail.com")
+
+		content, err := os.ReadFile(filepath.Join(dir, files[0].Name()))
+		require.NoError(t, err)
+		assert.Contains(t, string(content), "To: user/1@mail.com\r\n")
+		assert.Contains(t, string(content), "Subject: Verify your email\r\n")
+		assert.Contains(t, string(content), "\r\n\r\nopen the link")
+	})
+
+	t.Run("success_log", func(t *testing.T) {
+		err := NewFileSender("").Send(context.Background(), msg)
+		require.NoError(t, err)
+	})
+
+	t.Run("failed_canceled_context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := NewFileSender(t.TempDir()).Send(ctx, msg)
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	auth "github.com/dwiw96/GoCommerceAPI/internal/features/auth"
+	authRepository "github.com/dwiw96/GoCommerceAPI/internal/features/auth/repository"
+	response "github.com/dwiw96/GoCommerceAPI/pkg/utils/responses"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// apiKeyScope is the scope a request needs from an API key, ok is false for
+// the routes a key can't call.
+func apiKeyScope(method, path string) (scope string, ok bool) {
+	rest, found := strings.CutPrefix(path, "/api/v1/")
+	if !found {
+		return "", false
+	}
+	resource, _, _ := strings.Cut(rest, "/")
+
+	access := "write"
+	if method == http.MethodGet || method == http.MethodHead {
+		access = "read"
+	}
+	scope = resource + ":" + access
+
+	return scope, auth.ValidAPIKeyScope(scope)
+}
+
+// APIKeyPayload authenticates a request made with an API key instead of an
+// access token. The payload is the key's user as it is now, with no token
+// or session, and the key must have the scope of the route.
+func APIKeyPayload(ctx context.Context, pool *pgxpool.Pool, key, method, path string) (payload *auth.JwtPayload, code int, err error) {
+	repo := authRepository.NewAuthRepository(pool, pool)
+
+	apiKey, err := repo.GetAPIKeyByHash(ctx, auth.HashAPIKey(key))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, response.CodeFailedUnauthorized, response.ErrInvalidAPIKey
+		}
+		log.Println(err)
+		return nil, response.CodeFailedServer, err
+	}
+
+	scope, ok := apiKeyScope(method, path)
+	if !ok {
+		return nil, response.CodeFailedForbidden, response.ErrAPIKeyNotAllowed
+	}
+	if !apiKey.HasScope(scope) {
+		return nil, response.CodeFailedForbidden, response.ErrAPIKeyScope
+	}
+
+	user, err := repo.GetUserByID(ctx, apiKey.UserID)
+	if err != nil {
+		log.Println(err)
+		return nil, response.CodeFailedServer, err
+	}
+
+	// the request goes on when last used can't be saved
+	if err := repo.TouchAPIKey(ctx, apiKey.ID); err != nil {
+		log.Println(err)
+	}
+
+	payload = &auth.JwtPayload{
+		UserID:     user.ID,
+		Name:       user.Username,
+		Email:      user.Email,
+		Role:       user.Role,
+		IsVerified: user.IsVerified,
+	}
+
+	return payload, response.CodeSuccess, nil
+}
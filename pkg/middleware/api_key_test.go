@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"net/http"
+	"testing"
+
+	auth "github.com/dwiw96/GoCommerceAPI/internal/features/auth"
+	authRepository "github.com/dwiw96/GoCommerceAPI/internal/features/auth/repository"
+	generator "github.com/dwiw96/GoCommerceAPI/pkg/utils/generator"
+	response "github.com/dwiw96/GoCommerceAPI/pkg/utils/responses"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeyScope(t *testing.T) {
+	testCases := []struct {
+		desc   string
+		method string
+		path   string
+		scope  string
+		ok     bool
+	}{
+		{
+			desc:   "read",
+			method: http.MethodGet,
+			path:   "/api/v1/wallets/3/statement",
+			scope:  "wallets:read",
+			ok:     true,
+		}, {
+			desc:   "write",
+			method: http.MethodPost,
+			path:   "/api/v1/transactions",
+			scope:  "transactions:write",
+			ok:     true,
+		}, {
+			desc:   "admin",
+			method: http.MethodPut,
+			path:   "/api/v1/admin/rates",
+			scope:  "admin:write",
+			ok:     true,
+		}, {
+			desc:   "failed_auth_route",
+			method: http.MethodPost,
+			path:   "/api/v1/auth/api_keys",
+			ok:     false,
+		}, {
+			desc:   "failed_users_route",
+			method: http.MethodPatch,
+			path:   "/api/v1/users/me",
+			ok:     false,
+		}, {
+			desc:   "failed_outside_api",
+			method: http.MethodGet,
+			path:   "/.well-known/jwks.json",
+			ok:     false,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			scope, ok := apiKeyScope(tC.method, tC.path)
+			assert.Equal(t, tC.ok, ok)
+			if tC.ok {
+				assert.Equal(t, tC.scope, scope)
+			}
+		})
+	}
+}
+
+func TestAPIKeyPayload(t *testing.T) {
+	repo := authRepository.NewAuthRepository(pool, pool)
+
+	username := generator.CreateRandomString(7)
+	user, err := repo.CreateUser(ctx, auth.CreateUserParams{
+		Username:       username,
+		Email:          generator.CreateRandomEmail(username),
+		HashedPassword: generator.CreateRandomString(20),
+		Role:           auth.RoleCustomer,
+	})
+	require.NoError(t, err)
+
+	key := auth.APIKeyPrefix + generator.CreateRandomString(32)
+	_, err = repo.CreateAPIKey(ctx, auth.CreateAPIKeyParams{
+		UserID:  user.ID,
+		Name:    "test",
+		Prefix:  key[:12],
+		KeyHash: auth.HashAPIKey(key),
+		Scopes:  []string{"wallets:read"},
+	})
+	require.NoError(t, err)
+
+	payload, code, err := APIKeyPayload(ctx, pool, key, http.MethodGet, "/api/v1/wallets")
+	require.NoError(t, err)
+	assert.Equal(t, response.CodeSuccess, code)
+	assert.Equal(t, user.ID, payload.UserID)
+	assert.Equal(t, user.Email, payload.Email)
+	assert.Equal(t, user.Username, payload.Name)
+	assert.Equal(t, auth.RoleCustomer, payload.Role)
+
+	t.Run("failed_scope", func(t *testing.T) {
+		_, code, err := APIKeyPayload(ctx, pool, key, http.MethodPut, "/api/v1/wallets/1/withdraw")
+		assert.Equal(t, response.CodeFailedForbidden, code)
+		assert.Equal(t, response.ErrAPIKeyScope, err)
+	})
+
+	t.Run("failed_auth_route", func(t *testing.T) {
+		_, code, err := APIKeyPayload(ctx, pool, key, http.MethodGet, "/api/v1/auth/api_keys")
+		assert.Equal(t, response.CodeFailedForbidden, code)
+		assert.Equal(t, response.ErrAPIKeyNotAllowed, err)
+	})
+
+	t.Run("failed_wrong_key", func(t *testing.T) {
+		_, code, err := APIKeyPayload(ctx, pool, key+"x", http.MethodGet, "/api/v1/wallets")
+		assert.Equal(t, response.CodeFailedUnauthorized, code)
+		assert.Equal(t, response.ErrInvalidAPIKey, err)
+	})
+}
@@ -2,8 +2,6 @@ package middleware
 
 import (
 	"context"
-	"crypto/rsa"
-	"crypto/x509"
 	"errors"
 	"fmt"
 	"log"
@@ -13,11 +11,13 @@ import (
 	"time"
 
 	auth "github.com/dwiw96/GoCommerceAPI/internal/features/auth"
+	authRepository "github.com/dwiw96/GoCommerceAPI/internal/features/auth/repository"
 	response "github.com/dwiw96/GoCommerceAPI/pkg/utils/responses"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/redis/go-redis/v9"
 )
@@ -26,22 +26,62 @@ type ContextKey string
 
 var PayloadKey ContextKey = "payload"
 
+// publicPaths are the routes called without an access token.
+var publicPaths = map[string]bool{
+	"/api/v1/auth/signup":        true,
+	"/api/v1/auth/login":         true,
+	"/api/v1/auth/login/mfa":     true,
+	"/api/v1/auth/refresh_token": true,
+	"/api/v1/auth/verify":        true,
+
+	"/api/v1/auth/password/forgot": true,
+	"/api/v1/auth/password/reset":  true,
+
+	"/.well-known/jwks.json": true,
+}
+
+// publicPrefixes are public routes with a path param, the log in with a
+// provider and its callback.
+var publicPrefixes = []string{"/api/v1/auth/oidc/"}
+
+func isPublicPath(path string) bool {
+	if publicPaths[path] {
+		return true
+	}
+	for _, prefix := range publicPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
 func AuthMiddleware(ctx context.Context, pool *pgxpool.Pool, client *redis.Client) gin.HandlerFunc {
 	return (func(c *gin.Context) {
-		if c.Request.RequestURI == "/api/v1/auth/signup" {
+		// the path leaves out the query string, /api/v1/auth/verify carries
+		// its token there
+		if isPublicPath(c.Request.URL.Path) {
 			c.Next()
 			return
 		}
-		if c.Request.RequestURI == "/api/v1/auth/login" {
-			c.Next()
-			return
-		}
-		if c.Request.RequestURI == "/api/v1/auth/refresh_token" {
+
+		// an api key stands in for the access token
+		if apiKey := c.GetHeader(auth.APIKeyHeader); apiKey != "" {
+			payload, code, err := APIKeyPayload(ctx, pool, apiKey, c.Request.Method, c.Request.URL.Path)
+			if err != nil {
+				response.ErrorJSON(c, code, []string{err.Error()}, c.Request.RemoteAddr)
+				c.Abort()
+				return
+			}
+
+			c.Set("payloadKey", payload)
+
 			c.Next()
 			return
 		}
 
-		key, err := LoadKey(ctx, pool)
+		keys, err := LoadKeys(ctx, pool)
 		if err != nil {
 			log.Println(err)
 			response.ErrorJSON(c, 500, []string{err.Error()}, c.Request.RemoteAddr)
@@ -57,7 +97,7 @@ func AuthMiddleware(ctx context.Context, pool *pgxpool.Pool, client *redis.Clien
 			return
 		}
 
-		isVerified, err := VerifyToken(authHeader, key)
+		isVerified, err := VerifyToken(authHeader, keys)
 		if err != nil {
 			response.ErrorJSON(c, 401, []string{err.Error()}, c.Request.RemoteAddr)
 			c.Abort()
@@ -69,7 +109,7 @@ func AuthMiddleware(ctx context.Context, pool *pgxpool.Pool, client *redis.Clien
 			return
 		}
 
-		payload, err := ReadToken(authHeader, key)
+		payload, err := ReadToken(authHeader, keys)
 		if err != nil {
 			response.ErrorJSON(c, 401, []string{err.Error()}, c.Request.RemoteAddr)
 			c.Abort()
@@ -83,12 +123,30 @@ func AuthMiddleware(ctx context.Context, pool *pgxpool.Pool, client *redis.Clien
 			return
 		}
 
-		err = PayloadVerification(ctx, pool, payload.Email, payload.Name)
+		err = CheckBlockedUser(client, ctx, payload.UserID, payload.Iat)
+		if err != nil {
+			response.ErrorJSON(c, 401, []string{err.Error()}, c.Request.RemoteAddr)
+			c.Abort()
+			return
+		}
+
+		err = CheckBlockedSession(client, ctx, payload.SessionID)
+		if err != nil {
+			response.ErrorJSON(c, 401, []string{err.Error()}, c.Request.RemoteAddr)
+			c.Abort()
+			return
+		}
+
+		user, err := PayloadVerification(ctx, pool, payload.Email, payload.Name)
 		if err != nil {
 			response.ErrorJSON(c, 401, []string{err.Error()}, c.Request.RemoteAddr)
 			c.Abort()
 			return
 		}
+		// the role in the token can be stale after a grant or a revoke, the
+		// one in the database is what counts
+		payload.Role = user.Role
+		payload.IsVerified = user.IsVerified
 
 		c.Set("payloadKey", payload)
 
@@ -106,46 +164,67 @@ func GetTokenHeader(r *http.Request) (token string, err error) {
 	return tokenString, nil
 }
 
-func CreateToken(reqData auth.User, minute int, key *rsa.PrivateKey) (token string, err error) {
+// CreateToken returns an access token for the user signed with key, the kid
+// header names the key. sessionID is the session the token belongs to, 0 when
+// there is none, and the token expires after ttl.
+func CreateToken(reqData auth.User, sessionID int32, ttl time.Duration, key *auth.SigningKey) (token string, err error) {
 	nowTime := time.Now().UTC()
-	expTime := nowTime.Add(time.Minute * time.Duration(minute))
+	expTime := nowTime.Add(ttl)
 
 	id, err := uuid.NewRandom()
 	if err != nil {
 		return "", fmt.Errorf("failed to generate uuid, err: %v", err)
 	}
 
-	t := jwt.NewWithClaims(jwt.SigningMethodRS256,
+	token, err = key.Signer.Sign(
 		auth.JwtPayload{
-			ID:     id,
-			UserID: reqData.ID,
-			Name:   reqData.Username,
-			Email:  reqData.Email,
-			Iat:    nowTime.Unix(),
-			Exp:    expTime.Unix(),
-		})
-
-	token, err = t.SignedString(key)
+			ID:      id,
+			UserID:  reqData.ID,
+			Name:    reqData.Username,
+			Email:   reqData.Email,
+			Role:    reqData.Role,
+			Address: reqData.Address,
+			Iat:     nowTime.Unix(),
+			Exp:     expTime.Unix(),
+
+			SessionID: sessionID,
+		}, key.Kid)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token, err: %v", err)
+	}
 
 	token = "Bearer " + token
 
 	return
 }
 
-func VerifyToken(authHeader string, key *rsa.PrivateKey) (bool, error) {
+// KeyFunc returns the public key a token is verified with, picked out of keys
+// by the token's kid header. The token's alg header has to be the algorithm
+// of that key, a token can't pick how its key is used.
+func KeyFunc(keys *auth.KeySet) jwt.Keyfunc {
+	return func(jwtToken *jwt.Token) (interface{}, error) {
+		kid, _ := jwtToken.Header["kid"].(string)
+		key, ok := keys.Find(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key: %s", kid)
+		}
+
+		if jwtToken.Method.Alg() != key.Signer.Method().Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", jwtToken.Header["alg"])
+		}
+
+		return key.Signer.PublicKey(), nil
+	}
+}
+
+func VerifyToken(authHeader string, keys *auth.KeySet) (bool, error) {
 	userToken := strings.Split(authHeader, " ")
 
 	if len(userToken) != 2 {
 		return false, fmt.Errorf("authorization header format is wrong, ether doesn't has bearer or token")
 	}
 
-	jwtToken, err := jwt.Parse(userToken[1], func(jwtToken *jwt.Token) (interface{}, error) {
-		if _, ok := jwtToken.Method.(*jwt.SigningMethodRSA); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", jwtToken.Header["alg"])
-		}
-
-		return &key.PublicKey, nil
-	})
+	jwtToken, err := jwt.Parse(userToken[1], KeyFunc(keys))
 
 	if err != nil {
 		return false, fmt.Errorf("failed to parse token when verifying, err: %v", err)
@@ -160,17 +239,11 @@ func VerifyToken(authHeader string, key *rsa.PrivateKey) (bool, error) {
 	return true, nil
 }
 
-func ReadToken(authHeader string, key *rsa.PrivateKey) (*auth.JwtPayload, error) {
+func ReadToken(authHeader string, keys *auth.KeySet) (*auth.JwtPayload, error) {
 	var payload auth.JwtPayload
 	userToken := strings.Split(authHeader, " ")
 
-	jwtToken, err := jwt.ParseWithClaims(userToken[1], &payload, func(jwtToken *jwt.Token) (interface{}, error) {
-		if _, ok := jwtToken.Method.(*jwt.SigningMethodRSA); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", jwtToken.Header["alg"])
-		}
-
-		return &key.PublicKey, nil
-	})
+	jwtToken, err := jwt.ParseWithClaims(userToken[1], &payload, KeyFunc(keys))
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse token, msg: %v", err)
@@ -183,53 +256,39 @@ func ReadToken(authHeader string, key *rsa.PrivateKey) (*auth.JwtPayload, error)
 	return &payload, err
 }
 
+// keyCacheTTL is how long the keys are kept before they are read again, a
+// rotated key has to be added at least this long before it activates.
+const keyCacheTTL = time.Minute
+
 type KeyCache struct {
-	key        *rsa.PrivateKey
+	keys       *auth.KeySet
 	expiration time.Time
 	mutex      sync.Mutex
 }
 
 var keyCache = &KeyCache{
-	key:        nil,
+	keys:       nil,
 	expiration: time.Now(),
 }
 
-func LoadKey(ctx context.Context, conn *pgxpool.Pool) (key *rsa.PrivateKey, err error) {
-	if keyCache.key != nil && time.Now().Before(keyCache.expiration) {
-		return keyCache.key, nil
+func LoadKeys(ctx context.Context, conn *pgxpool.Pool) (keys *auth.KeySet, err error) {
+	keyCache.mutex.Lock()
+	defer keyCache.mutex.Unlock()
+
+	if keyCache.keys != nil && time.Now().Before(keyCache.expiration) {
+		return keyCache.keys, nil
 	}
 
-	query := "select private_key from sec_m"
-	var keyBytes []byte
-	rows, err := conn.Query(ctx, query)
+	keys, err = authRepository.NewAuthRepository(conn, conn).LoadKeys(ctx)
 	if err != nil {
 		log.Println(err)
 		return nil, err
 	}
-	defer rows.Close()
 
-	if rows.Next() {
-		err = rows.Scan(&keyBytes)
-		if err != nil {
-			log.Println(err)
-			return nil, err
-		}
-
-		privateKey, err := x509.ParsePKCS1PrivateKey(keyBytes)
-		if err != nil {
-			log.Println(err)
-			return nil, err
-		}
-
-		keyCache.mutex.Lock()
-		defer keyCache.mutex.Unlock()
-		keyCache.key = key
-		keyCache.expiration = time.Now().Add(time.Hour)
-
-		return privateKey, nil
-	}
+	keyCache.keys = keys
+	keyCache.expiration = time.Now().Add(keyCacheTTL)
 
-	return nil, errors.New("no private key found in database")
+	return keys, nil
 }
 
 func CheckBlockedToken(redis *redis.Client, ctx context.Context, tokenID uuid.UUID) error {
@@ -244,18 +303,56 @@ func CheckBlockedToken(redis *redis.Client, ctx context.Context, tokenID uuid.UU
 	return nil
 }
 
-func PayloadVerification(ctx context.Context, pool *pgxpool.Pool, email, username string) error {
-	query := "SELECT COUNT(*) FROM users WHERE email = $1 AND username = $2;"
+// CheckBlockedUser rejects a token issued before the user's tokens were
+// blocked, which happens when the password is reset or changed. iat and the
+// block are both in seconds, a token issued in the same second as the block
+// is kept so the log in right after a password change works.
+func CheckBlockedUser(client *redis.Client, ctx context.Context, userID int32, iat int64) error {
+	blockedAt, err := client.Get(ctx, fmt.Sprint("block user ", userID)).Int64()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil
+		}
+		return err
+	}
+	if iat < blockedAt {
+		return errors.New("token is blacklist")
+	}
+
+	return nil
+}
+
+// CheckBlockedSession rejects a token of a session that was revoked. Tokens
+// without a session aren't checked.
+func CheckBlockedSession(client *redis.Client, ctx context.Context, sessionID int32) error {
+	if sessionID == 0 {
+		return nil
+	}
 
-	var isOk int64
-	err := pool.QueryRow(ctx, query, email, username).Scan(&isOk)
+	check, err := client.Exists(ctx, fmt.Sprint("block session ", sessionID)).Result()
 	if err != nil {
-		return fmt.Errorf("failed to verify token payload")
+		return err
 	}
+	if check != 0 {
+		return errors.New("session is revoked")
+	}
+
+	return nil
+}
+
+// PayloadVerification checks that the user in the token still exists and
+// returns the user's current role and verification.
+func PayloadVerification(ctx context.Context, pool *pgxpool.Pool, email, username string) (*auth.User, error) {
+	query := "SELECT id, role, is_verified FROM users WHERE email = $1 AND username = $2;"
 
-	if isOk == 0 {
-		return fmt.Errorf("token payload is wrong, email and username doesn't match")
+	var user auth.User
+	err := pool.QueryRow(ctx, query, email, username).Scan(&user.ID, &user.Role, &user.IsVerified)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("token payload is wrong, email and username doesn't match")
+		}
+		return nil, fmt.Errorf("failed to verify token payload")
 	}
 
-	return err
+	return &user, nil
 }
@@ -2,9 +2,10 @@ package middleware
 
 import (
 	"context"
-	"crypto/rsa"
+	"fmt"
 	"net/http"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -13,7 +14,11 @@ import (
 	pg "github.com/dwiw96/GoCommerceAPI/pkg/driver/postgresql"
 	rd "github.com/dwiw96/GoCommerceAPI/pkg/driver/redis"
 	generator "github.com/dwiw96/GoCommerceAPI/pkg/utils/generator"
+	signer "github.com/dwiw96/GoCommerceAPI/pkg/utils/signer"
+	testUtils "github.com/dwiw96/GoCommerceAPI/testutils"
 
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
@@ -46,6 +51,7 @@ func TestMain(m *testing.M) {
 	}
 
 	pool = pg.ConnectToPg(envConfig)
+	testUtils.SetKeyEncryptionKey()
 
 	client = rd.ConnectToRedis(envConfig)
 
@@ -56,10 +62,10 @@ func TestMain(m *testing.M) {
 	os.Exit(m.Run())
 }
 
-func createTokenAndKey(t *testing.T) (string, auth.User, *rsa.PrivateKey) {
-	key, err := LoadKey(ctx, pool)
+func createTokenAndKey(t *testing.T) (string, auth.User, *auth.KeySet) {
+	keys, err := LoadKeys(ctx, pool)
 	require.NoError(t, err)
-	require.NotNil(t, key)
+	require.NotNil(t, keys)
 
 	firstname := generator.CreateRandomString(5)
 	payload := auth.User{
@@ -67,11 +73,11 @@ func createTokenAndKey(t *testing.T) (string, auth.User, *rsa.PrivateKey) {
 		Email:    generator.CreateRandomEmail(firstname),
 	}
 
-	token, err := CreateToken(payload, 5, key)
+	token, err := CreateToken(payload, 0, 5*time.Minute, keys.Signing)
 	require.NoError(t, err)
 	require.NotEmpty(t, token)
 
-	return token, payload, key
+	return token, payload, keys
 }
 
 func TestCreateToken(t *testing.T) {
@@ -79,48 +85,154 @@ func TestCreateToken(t *testing.T) {
 }
 
 func TestVerifyToken(t *testing.T) {
-	token, _, key := createTokenAndKey(t)
+	token, _, keys := createTokenAndKey(t)
 
 	t.Run("success", func(t *testing.T) {
-		res, err := VerifyToken(token, key)
+		res, err := VerifyToken(token, keys)
 		require.NoError(t, err)
 		require.True(t, res)
 	})
 
 	t.Run("failed", func(t *testing.T) {
-		res, err := VerifyToken(token+"b", key)
+		res, err := VerifyToken(token+"b", keys)
 		require.Error(t, err)
 		require.False(t, res)
 	})
 }
 
 func TestReadToken(t *testing.T) {
-	token, payloadInput, key := createTokenAndKey(t)
+	token, payloadInput, keys := createTokenAndKey(t)
 
 	t.Run("success", func(t *testing.T) {
-		payload, err := ReadToken(token, key)
+		payload, err := ReadToken(token, keys)
 		require.NoError(t, err)
 		assert.Equal(t, payloadInput.Username, payload.Name)
 		assert.Equal(t, payloadInput.Email, payload.Email)
 	})
 
 	t.Run("failed", func(t *testing.T) {
-		payload, err := ReadToken(token+"b", key)
+		payload, err := ReadToken(token+"b", keys)
 		require.Error(t, err)
 		assert.Nil(t, payload)
 	})
 }
 
-func TestLoadKey(t *testing.T) {
-	res, err := LoadKey(ctx, pool)
+func TestLoadKeys(t *testing.T) {
+	res, err := LoadKeys(ctx, pool)
 	require.NoError(t, err)
-	require.NotNil(t, res)
+	require.NotNil(t, res.Signing)
+}
+
+func createSigningKeyTest(t *testing.T, id int32, kid string, alg signer.Algorithm, activatesAt time.Time) auth.SigningKey {
+	keySigner, err := signer.Generate(alg)
+	require.NoError(t, err)
+
+	return auth.SigningKey{ID: id, Kid: kid, Signer: keySigner, ActivatesAt: activatesAt}
+}
+
+func TestVerifyTokenByKid(t *testing.T) {
+	now := time.Now()
+	oldKey := createSigningKeyTest(t, 1, "old", signer.RS256, now.Add(-time.Hour))
+	newKey := createSigningKeyTest(t, 2, "new", signer.RS256, now.Add(-time.Minute))
+
+	keys, err := auth.NewKeySet([]auth.SigningKey{oldKey, newKey}, now)
+	require.NoError(t, err)
+	require.Equal(t, "new", keys.Signing.Kid)
+
+	user := auth.User{Username: generator.CreateRandomString(5), Email: generator.CreateRandomEmail(generator.CreateRandomString(5))}
+
+	// a token signed before the rotation is still valid
+	oldToken, err := CreateToken(user, 0, 5*time.Minute, &oldKey)
+	require.NoError(t, err)
+	payload, err := ReadToken(oldToken, keys)
+	require.NoError(t, err)
+	assert.Equal(t, user.Email, payload.Email)
+
+	newToken, err := CreateToken(user, 0, 5*time.Minute, keys.Signing)
+	require.NoError(t, err)
+	isVerified, err := VerifyToken(newToken, keys)
+	require.NoError(t, err)
+	assert.True(t, isVerified)
+
+	t.Run("legacy_token_without_kid", func(t *testing.T) {
+		token, err := newKey.Signer.Sign(auth.JwtPayload{Email: user.Email, Exp: now.Add(time.Minute).Unix()}, "")
+		require.NoError(t, err)
+
+		payload, err := ReadToken("Bearer "+token, keys)
+		require.NoError(t, err)
+		assert.Equal(t, user.Email, payload.Email)
+	})
+
+	t.Run("failed_retired_key", func(t *testing.T) {
+		oldKey.RetiresAt = pgtype.Timestamp{Time: now.Add(-time.Second), Valid: true}
+		keys, err := auth.NewKeySet([]auth.SigningKey{oldKey, newKey}, now)
+		require.NoError(t, err)
+
+		_, err = ReadToken(oldToken, keys)
+		require.Error(t, err)
+		isVerified, err := VerifyToken(oldToken, keys)
+		require.Error(t, err)
+		assert.False(t, isVerified)
+	})
+}
+
+func TestVerifyTokenAcrossAlgorithms(t *testing.T) {
+	now := time.Now()
+	rsaKey := createSigningKeyTest(t, 1, "rsa", signer.RS256, now.Add(-time.Hour))
+	ecdsaKey := createSigningKeyTest(t, 2, "ecdsa", signer.ES256, now.Add(-30*time.Minute))
+	ed25519Key := createSigningKeyTest(t, 3, "ed25519", signer.EdDSA, now.Add(-time.Minute))
+
+	// moving from RS256 to EdDSA keeps the RS256 tokens valid until the key
+	// is retired
+	keys, err := auth.NewKeySet([]auth.SigningKey{rsaKey, ecdsaKey, ed25519Key}, now)
+	require.NoError(t, err)
+	require.Equal(t, "ed25519", keys.Signing.Kid)
+
+	user := auth.User{Username: generator.CreateRandomString(5), Email: generator.CreateRandomEmail(generator.CreateRandomString(5))}
+
+	for _, key := range []auth.SigningKey{rsaKey, ecdsaKey, ed25519Key} {
+		t.Run(string(key.Signer.Algorithm()), func(t *testing.T) {
+			token, err := CreateToken(user, 0, 5*time.Minute, &key)
+			require.NoError(t, err)
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(strings.TrimPrefix(token, "Bearer "), &auth.JwtPayload{})
+			require.NoError(t, err)
+			assert.Equal(t, string(key.Signer.Algorithm()), parsed.Header["alg"])
+			assert.Equal(t, key.Kid, parsed.Header["kid"])
+
+			isVerified, err := VerifyToken(token, keys)
+			require.NoError(t, err)
+			assert.True(t, isVerified)
+			payload, err := ReadToken(token, keys)
+			require.NoError(t, err)
+			assert.Equal(t, user.Email, payload.Email)
+		})
+	}
+
+	t.Run("failed_alg_of_other_key", func(t *testing.T) {
+		// a token signed by the ES256 key but naming the EdDSA key
+		token, err := ecdsaKey.Signer.Sign(auth.JwtPayload{Email: user.Email, Exp: now.Add(time.Minute).Unix()}, "ed25519")
+		require.NoError(t, err)
+
+		_, err = ReadToken("Bearer "+token, keys)
+		require.Error(t, err)
+	})
+
+	t.Run("failed_hmac_with_public_key", func(t *testing.T) {
+		jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.JwtPayload{Email: user.Email, Exp: now.Add(time.Minute).Unix()})
+		jwtToken.Header["kid"] = "rsa"
+		token, err := jwtToken.SignedString([]byte(rsaKey.Signer.JWK(rsaKey.Kid).N))
+		require.NoError(t, err)
+
+		_, err = ReadToken("Bearer "+token, keys)
+		require.Error(t, err)
+	})
 }
 
 func TestCheckBlockedToken(t *testing.T) {
-	token, _, key := createTokenAndKey(t)
+	token, _, keys := createTokenAndKey(t)
 
-	payload, err := ReadToken(token, key)
+	payload, err := ReadToken(token, keys)
 	require.NoError(t, err)
 
 	t.Run("valid", func(t *testing.T) {
@@ -140,6 +252,55 @@ func TestCheckBlockedToken(t *testing.T) {
 	})
 }
 
+func TestCheckBlockedUser(t *testing.T) {
+	userID := int32(generator.RandomInt(1000, 100000))
+	err := client.Del(ctx, fmt.Sprint("block user ", userID)).Err()
+	require.NoError(t, err)
+
+	now := time.Now().UTC().Unix()
+
+	t.Run("valid", func(t *testing.T) {
+		err = CheckBlockedUser(client, ctx, userID, now)
+		require.NoError(t, err)
+	})
+
+	t.Run("blacklist", func(t *testing.T) {
+		err = client.Set(ctx, fmt.Sprint("block user ", userID), now, time.Minute).Err()
+		require.NoError(t, err)
+
+		err = CheckBlockedUser(client, ctx, userID, now-10)
+		require.Error(t, err)
+		err = CheckBlockedUser(client, ctx, userID, now-1)
+		require.Error(t, err)
+	})
+
+	t.Run("issued_after_block", func(t *testing.T) {
+		err = CheckBlockedUser(client, ctx, userID, now)
+		require.NoError(t, err)
+		err = CheckBlockedUser(client, ctx, userID, now+1)
+		require.NoError(t, err)
+	})
+}
+
+func TestCheckBlockedSession(t *testing.T) {
+	sessionID := int32(generator.RandomInt(1000, 100000))
+	err := client.Del(ctx, fmt.Sprint("block session ", sessionID)).Err()
+	require.NoError(t, err)
+
+	err = CheckBlockedSession(client, ctx, sessionID)
+	require.NoError(t, err)
+
+	err = client.Set(ctx, fmt.Sprint("block session ", sessionID), 1, time.Minute).Err()
+	require.NoError(t, err)
+
+	err = CheckBlockedSession(client, ctx, sessionID)
+	require.Error(t, err)
+
+	// the token from sign up has no session
+	err = CheckBlockedSession(client, ctx, 0)
+	require.NoError(t, err)
+}
+
 func TestGetHeaderToken(t *testing.T) {
 	r, err := http.NewRequest(http.MethodPost, "http://localhost:8080/", nil)
 	require.NoError(t, err)
@@ -177,6 +338,12 @@ func TestPayloadVerification(t *testing.T) {
 	require.NoError(t, err)
 	assert.NotZero(t, user.ID)
 
-	err = PayloadVerification(ctx, pool, user.Email, user.Username)
+	res, err := PayloadVerification(ctx, pool, user.Email, user.Username)
 	require.NoError(t, err)
+	assert.Equal(t, user.ID, res.ID)
+	assert.Equal(t, auth.RoleCustomer, res.Role)
+	assert.False(t, res.IsVerified)
+
+	_, err = PayloadVerification(ctx, pool, "a"+user.Email, user.Username)
+	require.Error(t, err)
 }
@@ -0,0 +1,217 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	auth "github.com/dwiw96/GoCommerceAPI/internal/features/auth"
+	response "github.com/dwiw96/GoCommerceAPI/pkg/utils/responses"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotencyReplayedHeader = "Idempotent-Replayed"
+
+	idempotencyKeyMaxLength = 255
+	// idempotencyLockTTL bounds how long a key stays reserved when the server
+	// dies before the response is stored.
+	idempotencyLockTTL = 1 * time.Minute
+	idempotencyTTL     = 24 * time.Hour
+)
+
+// idempotencyRecord is what is stored in redis for one Idempotency-Key.
+// Status stays 0 while the first request is still being handled.
+type idempotencyRecord struct {
+	Fingerprint string `json:"fingerprint"`
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type"`
+	Body        []byte `json:"body"`
+}
+
+type idempotencyWriter struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (w *idempotencyWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *idempotencyWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// IdempotencyMiddleware makes a route safe to retry. The first request with an
+// Idempotency-Key header runs normally and its response is stored, a retry
+// with the same key and body gets the stored response back, and a retry with
+// the same key but a different body is rejected with 409. Server errors and
+// 401, 403 and 429 aren't stored, a retry of those runs again. Requests
+// without the header are not touched. It must run after AuthMiddleware, keys are
+// scoped to the user in the token.
+func IdempotencyMiddleware(ctx context.Context, client *redis.Client) gin.HandlerFunc {
+	return (func(c *gin.Context) {
+		idempotencyKey := c.GetHeader(IdempotencyKeyHeader)
+		if idempotencyKey == "" {
+			c.Next()
+			return
+		}
+		if len(idempotencyKey) > idempotencyKeyMaxLength {
+			response.ErrorJSON(c, 422, []string{fmt.Sprintf("%s must be at most %d characters", IdempotencyKeyHeader, idempotencyKeyMaxLength)}, c.Request.RemoteAddr)
+			c.Abort()
+			return
+		}
+
+		payload, isExists := c.Keys["payloadKey"].(*auth.JwtPayload)
+		if !isExists {
+			response.ErrorJSON(c, 401, []string{"token is wrong"}, c.Request.RemoteAddr)
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			response.ErrorJSON(c, 422, []string{err.Error()}, c.Request.RemoteAddr)
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		redisKey := fmt.Sprintf("idempotency %d %s", payload.UserID, idempotencyKey)
+		fingerprint := requestFingerprint(c.Request.Method, c.Request.URL.Path, body)
+
+		reserved, err := reserveIdempotencyKey(ctx, client, redisKey, fingerprint)
+		if err != nil {
+			log.Println(err)
+			response.ErrorJSON(c, 500, []string{err.Error()}, c.Request.RemoteAddr)
+			c.Abort()
+			return
+		}
+
+		if !reserved {
+			record, err := getIdempotencyRecord(ctx, client, redisKey)
+			if err != nil {
+				log.Println(err)
+				response.ErrorJSON(c, 500, []string{err.Error()}, c.Request.RemoteAddr)
+				c.Abort()
+				return
+			}
+
+			if record.Fingerprint != fingerprint {
+				response.ErrorJSON(c, response.CodeFailedDuplicated, []string{response.ErrIdempotencyKeyReused.Error()}, c.Request.RemoteAddr)
+				c.Abort()
+				return
+			}
+			if record.Status == 0 {
+				response.ErrorJSON(c, response.CodeFailedDuplicated, []string{response.ErrIdempotencyInProgress.Error()}, c.Request.RemoteAddr)
+				c.Abort()
+				return
+			}
+
+			c.Header(IdempotencyReplayedHeader, "true")
+			c.Data(record.Status, record.ContentType, record.Body)
+			c.Abort()
+			return
+		}
+
+		writer := &idempotencyWriter{ResponseWriter: c.Writer, body: &bytes.Buffer{}}
+		c.Writer = writer
+
+		c.Next()
+
+		// the key is released when the request wasn't done and may succeed
+		// on a retry, e.g. with the TOTP code a step up asked for
+		if isRetryableStatus(writer.Status()) {
+			if err := client.Del(ctx, redisKey).Err(); err != nil {
+				log.Printf("failed to release idempotency key, err: %v", err)
+			}
+			return
+		}
+
+		record := idempotencyRecord{
+			Fingerprint: fingerprint,
+			Status:      writer.Status(),
+			ContentType: writer.Header().Get("Content-Type"),
+			Body:        writer.body.Bytes(),
+		}
+		if err := setIdempotencyRecord(ctx, client, redisKey, record, idempotencyTTL); err != nil {
+			log.Printf("failed to store idempotency response, err: %v", err)
+		}
+	})
+}
+
+// isRetryableStatus tells if a response says nothing about the request itself.
+// A server error may not happen again, and 401, 403 and 429 are about the
+// caller's credentials or rate, not about what it asked for.
+func isRetryableStatus(status int) bool {
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests:
+		return true
+	}
+
+	return status >= 500
+}
+
+func requestFingerprint(method, path string, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(method))
+	hash.Write([]byte(" "))
+	hash.Write([]byte(path))
+	hash.Write([]byte(" "))
+	hash.Write(body)
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func reserveIdempotencyKey(ctx context.Context, client *redis.Client, redisKey, fingerprint string) (bool, error) {
+	value, err := json.Marshal(idempotencyRecord{Fingerprint: fingerprint})
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal idempotency record, err: %v", err)
+	}
+
+	reserved, err := client.SetNX(ctx, redisKey, value, idempotencyLockTTL).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to reserve idempotency key, err: %v", err)
+	}
+
+	return reserved, nil
+}
+
+func getIdempotencyRecord(ctx context.Context, client *redis.Client, redisKey string) (*idempotencyRecord, error) {
+	value, err := client.Get(ctx, redisKey).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, fmt.Errorf("idempotency key expired, retry the request")
+		}
+		return nil, fmt.Errorf("failed to get idempotency record, err: %v", err)
+	}
+
+	var record idempotencyRecord
+	if err := json.Unmarshal(value, &record); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal idempotency record, err: %v", err)
+	}
+
+	return &record, nil
+}
+
+func setIdempotencyRecord(ctx context.Context, client *redis.Client, redisKey string, record idempotencyRecord, ttl time.Duration) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal idempotency record, err: %v", err)
+	}
+
+	return client.Set(ctx, redisKey, value, ttl).Err()
+}
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	auth "github.com/dwiw96/GoCommerceAPI/internal/features/auth"
+	generator "github.com/dwiw96/GoCommerceAPI/pkg/utils/generator"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupIdempotencyRouter(status int) (*gin.Engine, *int) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	calls := 0
+	userID := generator.RandomInt32(1, 1000000)
+	router.Use(func(c *gin.Context) {
+		c.Set("payloadKey", &auth.JwtPayload{UserID: userID})
+		c.Next()
+	})
+	router.POST("/test", IdempotencyMiddleware(ctx, client), func(c *gin.Context) {
+		calls++
+		c.JSON(status, gin.H{"calls": calls})
+	})
+
+	return router, &calls
+}
+
+func doIdempotentRequest(router *gin.Engine, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/test", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	t.Run("replay_same_request", func(t *testing.T) {
+		router, calls := setupIdempotencyRouter(http.StatusOK)
+		key := generator.CreateRandomString(20)
+
+		first := doIdempotentRequest(router, key, `{"amount":10}`)
+		require.Equal(t, http.StatusOK, first.Code)
+
+		second := doIdempotentRequest(router, key, `{"amount":10}`)
+		require.Equal(t, http.StatusOK, second.Code)
+		assert.Equal(t, first.Body.String(), second.Body.String())
+		assert.Equal(t, "true", second.Header().Get(IdempotencyReplayedHeader))
+		assert.Equal(t, 1, *calls)
+	})
+
+	t.Run("conflict_different_body", func(t *testing.T) {
+		router, calls := setupIdempotencyRouter(http.StatusOK)
+		key := generator.CreateRandomString(20)
+
+		first := doIdempotentRequest(router, key, `{"amount":10}`)
+		require.Equal(t, http.StatusOK, first.Code)
+
+		second := doIdempotentRequest(router, key, `{"amount":20}`)
+		assert.Equal(t, http.StatusConflict, second.Code)
+		assert.Equal(t, 1, *calls)
+	})
+
+	t.Run("release_on_server_error", func(t *testing.T) {
+		router, calls := setupIdempotencyRouter(http.StatusInternalServerError)
+		key := generator.CreateRandomString(20)
+
+		doIdempotentRequest(router, key, `{"amount":10}`)
+		doIdempotentRequest(router, key, `{"amount":10}`)
+		assert.Equal(t, 2, *calls)
+	})
+
+	t.Run("release_on_forbidden", func(t *testing.T) {
+		router, calls := setupIdempotencyRouter(http.StatusForbidden)
+		key := generator.CreateRandomString(20)
+
+		doIdempotentRequest(router, key, `{"amount":10}`)
+		second := doIdempotentRequest(router, key, `{"amount":10}`)
+		assert.Empty(t, second.Header().Get(IdempotencyReplayedHeader))
+		assert.Equal(t, 2, *calls)
+	})
+
+	t.Run("no_header", func(t *testing.T) {
+		router, calls := setupIdempotencyRouter(http.StatusOK)
+
+		doIdempotentRequest(router, "", `{"amount":10}`)
+		doIdempotentRequest(router, "", `{"amount":10}`)
+		assert.Equal(t, 2, *calls)
+	})
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"fmt"
+	"strconv"
+
+	auth "github.com/dwiw96/GoCommerceAPI/internal/features/auth"
+	response "github.com/dwiw96/GoCommerceAPI/pkg/utils/responses"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OwnerMiddleware only lets through the user whose id is in the path param
+// param, and the admins. Everyone else gets 403. It must run after
+// AuthMiddleware.
+func OwnerMiddleware(param string) gin.HandlerFunc {
+	return (func(c *gin.Context) {
+		payload, isExists := c.Keys["payloadKey"].(*auth.JwtPayload)
+		if !isExists {
+			response.ErrorJSON(c, 401, []string{"token is wrong"}, c.Request.RemoteAddr)
+			c.Abort()
+			return
+		}
+
+		userID, err := strconv.ParseInt(c.Param(param), 10, 32)
+		if err != nil {
+			response.ErrorJSON(c, 422, []string{fmt.Sprintf("%s must be a number", param)}, c.Request.RemoteAddr)
+			c.Abort()
+			return
+		}
+
+		if int32(userID) != payload.UserID && payload.Role != auth.RoleAdmin {
+			response.ErrorJSON(c, response.CodeFailedForbidden, []string{response.ErrForbidden.Error()}, c.Request.RemoteAddr)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	})
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	auth "github.com/dwiw96/GoCommerceAPI/internal/features/auth"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOwnerMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	testCases := []struct {
+		desc    string
+		payload *auth.JwtPayload
+		path    string
+		code    int
+	}{
+		{
+			desc:    "success_owner",
+			payload: &auth.JwtPayload{UserID: 7, Role: auth.RoleCustomer},
+			path:    "/wallets/7",
+			code:    http.StatusOK,
+		}, {
+			desc:    "success_admin",
+			payload: &auth.JwtPayload{UserID: 1, Role: auth.RoleAdmin},
+			path:    "/wallets/7",
+			code:    http.StatusOK,
+		}, {
+			desc:    "failed_other_user",
+			payload: &auth.JwtPayload{UserID: 8, Role: auth.RoleCustomer},
+			path:    "/wallets/7",
+			code:    http.StatusForbidden,
+		}, {
+			desc:    "failed_staff",
+			payload: &auth.JwtPayload{UserID: 8, Role: auth.RoleStaff},
+			path:    "/wallets/7",
+			code:    http.StatusForbidden,
+		}, {
+			desc:    "failed_not_number",
+			payload: &auth.JwtPayload{UserID: 7, Role: auth.RoleCustomer},
+			path:    "/wallets/abc",
+			code:    http.StatusUnprocessableEntity,
+		}, {
+			desc: "failed_no_payload",
+			path: "/wallets/7",
+			code: http.StatusUnauthorized,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			router := gin.New()
+			router.Use(func(c *gin.Context) {
+				if tC.payload != nil {
+					c.Set("payloadKey", tC.payload)
+				}
+				c.Next()
+			})
+			router.GET("/wallets/:user_id", OwnerMiddleware("user_id"), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tC.path, nil))
+			assert.Equal(t, tC.code, rec.Code)
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	auth "github.com/dwiw96/GoCommerceAPI/internal/features/auth"
+	response "github.com/dwiw96/GoCommerceAPI/pkg/utils/responses"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RoleMiddleware only lets through the users that hold one of roles, everyone
+// else gets 403. It must run after AuthMiddleware.
+func RoleMiddleware(roles ...auth.Role) gin.HandlerFunc {
+	allowed := make(map[auth.Role]bool, len(roles))
+	for _, role := range roles {
+		allowed[role] = true
+	}
+
+	return (func(c *gin.Context) {
+		payload, isExists := c.Keys["payloadKey"].(*auth.JwtPayload)
+		if !isExists {
+			response.ErrorJSON(c, 401, []string{"token is wrong"}, c.Request.RemoteAddr)
+			c.Abort()
+			return
+		}
+
+		if !allowed[payload.Role] {
+			response.ErrorJSON(c, response.CodeFailedForbidden, []string{response.ErrForbidden.Error()}, c.Request.RemoteAddr)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	})
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	auth "github.com/dwiw96/GoCommerceAPI/internal/features/auth"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoleMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	testCases := []struct {
+		desc    string
+		payload *auth.JwtPayload
+		code    int
+	}{
+		{
+			desc:    "success_admin",
+			payload: &auth.JwtPayload{Role: auth.RoleAdmin},
+			code:    http.StatusOK,
+		}, {
+			desc:    "success_staff",
+			payload: &auth.JwtPayload{Role: auth.RoleStaff},
+			code:    http.StatusOK,
+		}, {
+			desc:    "failed_customer",
+			payload: &auth.JwtPayload{Role: auth.RoleCustomer},
+			code:    http.StatusForbidden,
+		}, {
+			desc:    "failed_no_role",
+			payload: &auth.JwtPayload{},
+			code:    http.StatusForbidden,
+		}, {
+			desc: "failed_no_payload",
+			code: http.StatusUnauthorized,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			router := gin.New()
+			router.Use(func(c *gin.Context) {
+				if tC.payload != nil {
+					c.Set("payloadKey", tC.payload)
+				}
+				c.Next()
+			})
+			router.GET("/test", RoleMiddleware(auth.RoleStaff, auth.RoleAdmin), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/test", nil))
+			assert.Equal(t, tC.code, rec.Code)
+		})
+	}
+}
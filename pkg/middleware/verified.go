@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	auth "github.com/dwiw96/GoCommerceAPI/internal/features/auth"
+	response "github.com/dwiw96/GoCommerceAPI/pkg/utils/responses"
+
+	"github.com/gin-gonic/gin"
+)
+
+// VerifiedMiddleware rejects the users who haven't verified their email with
+// 403 when required is true, and lets everyone through otherwise. It must run
+// after AuthMiddleware.
+func VerifiedMiddleware(required bool) gin.HandlerFunc {
+	return (func(c *gin.Context) {
+		if !CheckVerified(c, required) {
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	})
+}
+
+// CheckVerified is the check of VerifiedMiddleware for a handler that only
+// needs it for some of its requests. It writes the error response and returns
+// false when the user is turned away.
+func CheckVerified(c *gin.Context, required bool) bool {
+	if !required {
+		return true
+	}
+
+	payload, isExists := c.Keys["payloadKey"].(*auth.JwtPayload)
+	if !isExists {
+		response.ErrorJSON(c, 401, []string{"token is wrong"}, c.Request.RemoteAddr)
+		return false
+	}
+
+	if !payload.IsVerified {
+		response.ErrorJSON(c, response.CodeFailedForbidden, []string{response.ErrEmailNotVerified.Error()}, c.Request.RemoteAddr)
+		return false
+	}
+
+	return true
+}
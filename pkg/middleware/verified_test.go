@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	auth "github.com/dwiw96/GoCommerceAPI/internal/features/auth"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifiedMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	testCases := []struct {
+		desc     string
+		required bool
+		payload  *auth.JwtPayload
+		code     int
+	}{
+		{
+			desc:     "success_verified",
+			required: true,
+			payload:  &auth.JwtPayload{IsVerified: true},
+			code:     http.StatusOK,
+		}, {
+			desc:     "success_not_required",
+			required: false,
+			payload:  &auth.JwtPayload{IsVerified: false},
+			code:     http.StatusOK,
+		}, {
+			desc:     "failed_not_verified",
+			required: true,
+			payload:  &auth.JwtPayload{IsVerified: false},
+			code:     http.StatusForbidden,
+		}, {
+			desc:     "failed_no_payload",
+			required: true,
+			code:     http.StatusUnauthorized,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			router := gin.New()
+			router.Use(func(c *gin.Context) {
+				if tC.payload != nil {
+					c.Set("payloadKey", tC.payload)
+				}
+				c.Next()
+			})
+			router.GET("/test", VerifiedMiddleware(tC.required), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/test", nil))
+			assert.Equal(t, tC.code, rec.Code)
+		})
+	}
+}
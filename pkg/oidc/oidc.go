@@ -0,0 +1,341 @@
+// Package oidc logs users in with an OpenID Connect provider using the
+// authorization code flow with PKCE. The provider's endpoints are read from
+// its discovery document and its keys from its JWKS, both are fetched the
+// first time they are needed.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	signer "github.com/dwiw96/GoCommerceAPI/pkg/utils/signer"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// jwksRefreshInterval is how often an unknown kid may fetch the JWKS
+	// again, a provider that rotated its keys is picked up without letting
+	// bad tokens hammer it.
+	jwksRefreshInterval = time.Minute
+	maxResponseSize     = 1 << 20
+	defaultTimeout      = 10 * time.Second
+)
+
+var ErrInvalidIDToken = errors.New("invalid id token")
+
+// Config is one provider the API trusts. RedirectURL is the callback route
+// of the provider, it has to be registered with the provider as is.
+type Config struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	// Scopes are asked for besides openid, email and profile when empty.
+	Scopes []string
+}
+
+// Discovery is the part of the provider's discovery document the flow uses.
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Claims are the claims of an id token the API reads.
+type Claims struct {
+	jwt.RegisteredClaims
+	Nonce             string `json:"nonce"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+}
+
+// Client talks to one provider, it is safe to use from more than one request
+// at a time.
+type Client struct {
+	conf       Config
+	httpClient *http.Client
+
+	mu            sync.Mutex
+	discovery     *Discovery
+	keys          map[string]crypto.PublicKey
+	keysFetchedAt time.Time
+}
+
+// NewClient returns the client of the provider in conf, requests time out
+// after 10 seconds when httpClient is nil.
+func NewClient(conf Config, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: defaultTimeout}
+	}
+	if len(conf.Scopes) == 0 {
+		conf.Scopes = []string{"openid", "email", "profile"}
+	}
+
+	return &Client{
+		conf:       conf,
+		httpClient: httpClient,
+	}
+}
+
+// Discover returns the provider's discovery document, it's only fetched
+// again when fetching it failed.
+func (c *Client) Discover(ctx context.Context) (*Discovery, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.discover(ctx)
+}
+
+func (c *Client) discover(ctx context.Context) (*Discovery, error) {
+	if c.discovery != nil {
+		return c.discovery, nil
+	}
+
+	var discovery Discovery
+	wellKnown := strings.TrimSuffix(c.conf.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := c.getJSON(ctx, wellKnown, &discovery); err != nil {
+		return nil, fmt.Errorf("failed to get discovery document, err: %w", err)
+	}
+	// the issuer has to be the one configured, or another provider's tokens
+	// could be passed off as this one's
+	if discovery.Issuer != c.conf.Issuer {
+		return nil, fmt.Errorf("discovery document issuer %q isn't %q", discovery.Issuer, c.conf.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery document of %s misses an endpoint", c.conf.Issuer)
+	}
+
+	c.discovery = &discovery
+	return c.discovery, nil
+}
+
+// AuthCodeURL is where the user is sent to log in with the provider. state
+// and nonce are random values kept until the callback, challenge is the
+// S256Challenge of the code verifier.
+func (c *Client) AuthCodeURL(ctx context.Context, state, nonce, challenge string) (string, error) {
+	discovery, err := c.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := url.Parse(discovery.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse authorization endpoint, err: %w", err)
+	}
+
+	query := authURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", c.conf.ClientID)
+	query.Set("redirect_uri", c.conf.RedirectURL)
+	query.Set("scope", strings.Join(c.conf.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", challenge)
+	query.Set("code_challenge_method", "S256")
+	authURL.RawQuery = query.Encode()
+
+	return authURL.String(), nil
+}
+
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Exchange trades the code from the callback for the id token, verifier is
+// the code verifier the challenge was made from.
+func (c *Client) Exchange(ctx context.Context, code, verifier string) (idToken string, err error) {
+	discovery, err := c.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", c.conf.RedirectURL)
+	form.Set("client_id", c.conf.ClientID)
+	form.Set("client_secret", c.conf.ClientSecret)
+	form.Set("code_verifier", verifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create token request, err: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to exchange code, err: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var token tokenResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to decode token response, status: %d, err: %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to exchange code, status: %d, error: %s %s", resp.StatusCode, token.Error, token.ErrorDescription)
+	}
+	if token.IDToken == "" {
+		return "", fmt.Errorf("token response has no id token")
+	}
+
+	return token.IDToken, nil
+}
+
+// VerifyIDToken checks the signature, issuer, audience, expiry and nonce of
+// the id token and returns its claims.
+func (c *Client) VerifyIDToken(ctx context.Context, idToken, nonce string) (*Claims, error) {
+	discovery, err := c.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	keyFunc := func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return c.key(ctx, kid)
+	}
+
+	var claims Claims
+	_, err = jwt.ParseWithClaims(idToken, &claims, keyFunc,
+		jwt.WithValidMethods(signer.Algorithms),
+		jwt.WithIssuer(discovery.Issuer),
+		jwt.WithAudience(c.conf.ClientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w, err: %w", ErrInvalidIDToken, err)
+	}
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 || nonce == "" {
+		return nil, fmt.Errorf("%w, nonce doesn't match", ErrInvalidIDToken)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w, no subject", ErrInvalidIDToken)
+	}
+
+	return &claims, nil
+}
+
+// key returns the provider's key kid. A token without a kid is only taken
+// when the provider has one key.
+func (c *Client) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if key, ok := c.lookupKey(kid); ok {
+		return key, nil
+	}
+	if time.Since(c.keysFetchedAt) < jwksRefreshInterval {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	if err := c.fetchKeys(ctx); err != nil {
+		return nil, err
+	}
+	if key, ok := c.lookupKey(kid); ok {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("unknown key %q", kid)
+}
+
+func (c *Client) lookupKey(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(c.keys) == 1 {
+		for _, key := range c.keys {
+			return key, true
+		}
+	}
+	key, ok := c.keys[kid]
+
+	return key, ok
+}
+
+func (c *Client) fetchKeys(ctx context.Context) error {
+	discovery, err := c.discover(ctx)
+	if err != nil {
+		return err
+	}
+
+	var jwks struct {
+		Keys []signer.JWK `json:"keys"`
+	}
+	c.keysFetchedAt = time.Now()
+	if err := c.getJSON(ctx, discovery.JWKSURI, &jwks); err != nil {
+		return fmt.Errorf("failed to get jwks, err: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		// a key the API can't read can't have signed a token it accepts
+		key, err := jwk.PublicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	c.keys = keys
+
+	return nil
+}
+
+func (c *Client) getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %d", url, resp.StatusCode)
+	}
+
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(v)
+}
+
+// RandomString is a random url safe string for the state, the nonce and the
+// code verifier.
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random string, err: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// S256Challenge is the PKCE code challenge of verifier.
+func S256Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
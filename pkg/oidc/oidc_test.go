@@ -0,0 +1,197 @@
+package oidc_test
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	oidc "github.com/dwiw96/GoCommerceAPI/pkg/oidc"
+	oidctest "github.com/dwiw96/GoCommerceAPI/pkg/oidc/oidctest"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const redirectURL = "http://localhost:8080/api/v1/auth/oidc/stub/callback"
+
+func startLogin(t *testing.T, client *oidc.Client) (authURL, state, nonce, verifier string) {
+	var err error
+	state, err = oidc.RandomString()
+	require.NoError(t, err)
+	nonce, err = oidc.RandomString()
+	require.NoError(t, err)
+	verifier, err = oidc.RandomString()
+	require.NoError(t, err)
+
+	authURL, err = client.AuthCodeURL(context.Background(), state, nonce, oidc.S256Challenge(verifier))
+	require.NoError(t, err)
+
+	return authURL, state, nonce, verifier
+}
+
+func TestLogin(t *testing.T) {
+	provider, err := oidctest.NewProvider("client", "secret")
+	require.NoError(t, err)
+	defer provider.Close()
+
+	ctx := context.Background()
+	client := oidc.NewClient(provider.Config("stub", redirectURL), nil)
+	identity := oidctest.Identity{Subject: "1234", Email: "user@example.com", EmailVerified: true, Name: "User"}
+
+	t.Run("success", func(t *testing.T) {
+		authURL, state, nonce, verifier := startLogin(t, client)
+		parsed, err := url.Parse(authURL)
+		require.NoError(t, err)
+		assert.Equal(t, "S256", parsed.Query().Get("code_challenge_method"))
+		assert.Equal(t, redirectURL, parsed.Query().Get("redirect_uri"))
+		assert.Equal(t, "openid email profile", parsed.Query().Get("scope"))
+
+		code, gotState, err := provider.Authorize(authURL, identity)
+		require.NoError(t, err)
+		assert.Equal(t, state, gotState)
+
+		idToken, err := client.Exchange(ctx, code, verifier)
+		require.NoError(t, err)
+
+		claims, err := client.VerifyIDToken(ctx, idToken, nonce)
+		require.NoError(t, err)
+		assert.Equal(t, identity.Subject, claims.Subject)
+		assert.Equal(t, identity.Email, claims.Email)
+		assert.True(t, claims.EmailVerified)
+		assert.Equal(t, identity.Name, claims.Name)
+
+		// a code is only good once
+		_, err = client.Exchange(ctx, code, verifier)
+		require.Error(t, err)
+	})
+
+	t.Run("failed_wrong_verifier", func(t *testing.T) {
+		authURL, _, _, _ := startLogin(t, client)
+		code, _, err := provider.Authorize(authURL, identity)
+		require.NoError(t, err)
+
+		other, err := oidc.RandomString()
+		require.NoError(t, err)
+		_, err = client.Exchange(ctx, code, other)
+		require.Error(t, err)
+	})
+
+	t.Run("failed_wrong_nonce", func(t *testing.T) {
+		authURL, _, _, verifier := startLogin(t, client)
+		code, _, err := provider.Authorize(authURL, identity)
+		require.NoError(t, err)
+		idToken, err := client.Exchange(ctx, code, verifier)
+		require.NoError(t, err)
+
+		_, err = client.VerifyIDToken(ctx, idToken, "other nonce")
+		require.ErrorIs(t, err, oidc.ErrInvalidIDToken)
+		_, err = client.VerifyIDToken(ctx, idToken, "")
+		require.ErrorIs(t, err, oidc.ErrInvalidIDToken)
+	})
+
+	t.Run("failed_wrong_client_secret", func(t *testing.T) {
+		conf := provider.Config("stub", redirectURL)
+		conf.ClientSecret = "wrong"
+		other := oidc.NewClient(conf, nil)
+
+		authURL, _, _, verifier := startLogin(t, other)
+		code, _, err := provider.Authorize(authURL, identity)
+		require.NoError(t, err)
+		_, err = other.Exchange(ctx, code, verifier)
+		require.Error(t, err)
+	})
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	provider, err := oidctest.NewProvider("client", "secret")
+	require.NoError(t, err)
+	defer provider.Close()
+
+	ctx := context.Background()
+	client := oidc.NewClient(provider.Config("stub", redirectURL), nil)
+
+	claims := func() oidc.Claims {
+		return oidc.Claims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    provider.Issuer(),
+				Subject:   "1234",
+				Audience:  jwt.ClaimStrings{"client"},
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			},
+			Nonce: "nonce",
+		}
+	}
+
+	testCases := []struct {
+		desc   string
+		modify func(c *oidc.Claims)
+		isErr  bool
+	}{
+		{
+			desc:   "success",
+			modify: func(c *oidc.Claims) {},
+			isErr:  false,
+		}, {
+			desc:   "failed_other_issuer",
+			modify: func(c *oidc.Claims) { c.Issuer = "http://other.example.com" },
+			isErr:  true,
+		}, {
+			desc:   "failed_other_audience",
+			modify: func(c *oidc.Claims) { c.Audience = jwt.ClaimStrings{"other"} },
+			isErr:  true,
+		}, {
+			desc:   "failed_expired",
+			modify: func(c *oidc.Claims) { c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute)) },
+			isErr:  true,
+		}, {
+			desc:   "failed_no_expiry",
+			modify: func(c *oidc.Claims) { c.ExpiresAt = nil },
+			isErr:  true,
+		}, {
+			desc:   "failed_no_subject",
+			modify: func(c *oidc.Claims) { c.Subject = "" },
+			isErr:  true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			c := claims()
+			tC.modify(&c)
+			idToken, err := provider.SignIDToken(c)
+			require.NoError(t, err)
+
+			res, err := client.VerifyIDToken(ctx, idToken, "nonce")
+			if !tC.isErr {
+				require.NoError(t, err)
+				assert.Equal(t, "1234", res.Subject)
+			} else {
+				require.ErrorIs(t, err, oidc.ErrInvalidIDToken)
+			}
+		})
+	}
+
+	t.Run("failed_other_key", func(t *testing.T) {
+		other, err := oidctest.NewProvider("client", "secret")
+		require.NoError(t, err)
+		defer other.Close()
+
+		c := claims()
+		idToken, err := other.SignIDToken(c)
+		require.NoError(t, err)
+		_, err = client.VerifyIDToken(ctx, idToken, "nonce")
+		require.ErrorIs(t, err, oidc.ErrInvalidIDToken)
+	})
+}
+
+func TestDiscoverIssuerMismatch(t *testing.T) {
+	provider, err := oidctest.NewProvider("client", "secret")
+	require.NoError(t, err)
+	defer provider.Close()
+
+	conf := provider.Config("stub", redirectURL)
+	conf.Issuer += "/"
+	_, err = oidc.NewClient(conf, nil).Discover(context.Background())
+	require.Error(t, err)
+}
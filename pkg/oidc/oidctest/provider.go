@@ -0,0 +1,241 @@
+// Package oidctest is an OpenID Connect provider for tests. It serves a
+// discovery document, a JWKS, an authorization endpoint that logs in whoever
+// is set with Authorize, and a token endpoint that checks the PKCE verifier.
+package oidctest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	oidc "github.com/dwiw96/GoCommerceAPI/pkg/oidc"
+	signer "github.com/dwiw96/GoCommerceAPI/pkg/utils/signer"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const keyID = "oidctest"
+
+// Identity is the user who logs in at the provider.
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+type authRequest struct {
+	identity    Identity
+	clientID    string
+	redirectURI string
+	nonce       string
+	challenge   string
+}
+
+type Provider struct {
+	ClientID     string
+	ClientSecret string
+
+	server *httptest.Server
+	signer signer.Signer
+
+	mu       sync.Mutex
+	identity Identity
+	codes    map[string]authRequest
+}
+
+// NewProvider starts a provider with one client, Close stops it.
+func NewProvider(clientID, clientSecret string) (*Provider, error) {
+	s, err := signer.Generate(signer.ES256)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Provider{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		signer:       s,
+		codes:        map[string]authRequest{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("GET /jwks", p.jwks)
+	mux.HandleFunc("GET /authorize", p.authorize)
+	mux.HandleFunc("POST /token", p.token)
+	p.server = httptest.NewServer(mux)
+
+	return p, nil
+}
+
+func (p *Provider) Issuer() string { return p.server.URL }
+
+func (p *Provider) Close() { p.server.Close() }
+
+// Config is the oidc.Config of a client of the provider called name.
+func (p *Provider) Config(name, redirectURL string) oidc.Config {
+	return oidc.Config{
+		Name:         name,
+		Issuer:       p.Issuer(),
+		ClientID:     p.ClientID,
+		ClientSecret: p.ClientSecret,
+		RedirectURL:  redirectURL,
+	}
+}
+
+// Authorize logs identity in at authURL, the url the client sent the user
+// to, and returns the code and state the provider redirects back with.
+func (p *Provider) Authorize(authURL string, identity Identity) (code, state string, err error) {
+	p.mu.Lock()
+	p.identity = identity
+	p.mu.Unlock()
+
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusFound {
+		return "", "", fmt.Errorf("authorize returned %d", resp.StatusCode)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return "", "", err
+	}
+	if errCode := location.Query().Get("error"); errCode != "" {
+		return "", "", fmt.Errorf("authorize failed: %s", errCode)
+	}
+
+	return location.Query().Get("code"), location.Query().Get("state"), nil
+}
+
+// SignIDToken signs claims with the provider's key, for tokens the token
+// endpoint wouldn't hand out.
+func (p *Provider) SignIDToken(claims jwt.Claims) (string, error) {
+	return p.signer.Sign(claims, keyID)
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, oidc.Discovery{
+		Issuer:                p.Issuer(),
+		AuthorizationEndpoint: p.Issuer() + "/authorize",
+		TokenEndpoint:         p.Issuer() + "/token",
+		JWKSURI:               p.Issuer() + "/jwks",
+	})
+}
+
+func (p *Provider) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string][]signer.JWK{"keys": {p.signer.JWK(keyID)}})
+}
+
+func (p *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || query.Get("redirect_uri") == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	params := url.Values{}
+	params.Set("state", query.Get("state"))
+	switch {
+	case query.Get("client_id") != p.ClientID:
+		params.Set("error", "unauthorized_client")
+	case query.Get("response_type") != "code":
+		params.Set("error", "unsupported_response_type")
+	case query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "":
+		params.Set("error", "invalid_request")
+	default:
+		code, err := oidc.RandomString()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		p.mu.Lock()
+		p.codes[code] = authRequest{
+			identity:    p.identity,
+			clientID:    query.Get("client_id"),
+			redirectURI: query.Get("redirect_uri"),
+			nonce:       query.Get("nonce"),
+			challenge:   query.Get("code_challenge"),
+		}
+		p.mu.Unlock()
+		params.Set("code", code)
+	}
+
+	redirectURI.RawQuery = params.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	if r.PostForm.Get("client_id") != p.ClientID || r.PostForm.Get("client_secret") != p.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+
+	// a code is good for one try
+	p.mu.Lock()
+	req, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mu.Unlock()
+	if !ok || req.clientID != p.ClientID || req.redirectURI != r.PostForm.Get("redirect_uri") ||
+		oidc.S256Challenge(r.PostForm.Get("code_verifier")) != req.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	idToken, err := p.SignIDToken(oidc.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    p.Issuer(),
+			Subject:   req.identity.Subject,
+			Audience:  jwt.ClaimStrings{p.ClientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(5 * time.Minute)),
+		},
+		Nonce:         req.nonce,
+		Email:         req.identity.Email,
+		EmailVerified: req.identity.EmailVerified,
+		Name:          req.identity.Name,
+	})
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	accessToken, err := oidc.RandomString()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -1,9 +1,11 @@
 package converter
 
 import (
+	"encoding/base64"
 	"fmt"
 	"log"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -41,3 +43,27 @@ func ConvertStrToInt32(s string) (int32, error) {
 func ConvertInt32ToString(n int32) string {
 	return strconv.Itoa(int(n))
 }
+
+// EncodeCursor turns the id of the last row of a page into an opaque cursor.
+func EncodeCursor(id int32) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("id:%d", id)))
+}
+
+func DecodeCursor(cursor string) (int32, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, fmt.Errorf("cursor is invalid")
+	}
+
+	idStr, found := strings.CutPrefix(string(decoded), "id:")
+	if !found {
+		return 0, fmt.Errorf("cursor is invalid")
+	}
+
+	id, err := strconv.ParseInt(idStr, 10, 32)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("cursor is invalid")
+	}
+
+	return int32(id), nil
+}
@@ -103,3 +103,36 @@ func TestConvertStrToInt32(t *testing.T) {
 		})
 	}
 }
+
+func TestEncodeDecodeCursor(t *testing.T) {
+	for _, id := range []int32{1, 57, 2147483647} {
+		res, err := DecodeCursor(EncodeCursor(id))
+		require.NoError(t, err)
+		assert.Equal(t, id, res)
+	}
+
+	testCases := []struct {
+		desc  string
+		input string
+	}{
+		{
+			desc:  "not_base64",
+			input: "!!!",
+		}, {
+			desc:  "wrong_prefix",
+			input: "MTIz",
+		}, {
+			desc:  "not_number",
+			input: "aWQ6YWI",
+		}, {
+			desc:  "zero_id",
+			input: "aWQ6MA",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			_, err := DecodeCursor(tC.input)
+			require.Error(t, err)
+		})
+	}
+}
@@ -2,65 +2,174 @@ package password
 
 import (
 	"context"
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/rand"
-	"crypto/rsa"
-	"crypto/x509"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 
+	signer "github.com/dwiw96/GoCommerceAPI/pkg/utils/signer"
+
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func JwtInit(conn *pgxpool.Pool, ctx context.Context) {
-	var err error
-	privateKey, err := loadKey(conn, ctx) // temporary-should make as method
-	if privateKey == nil {
-		jwtSetPrivKey(conn, ctx)
+// keyCipher encrypts the signing keys in the database, it's set once at start
+// up by SetKeyEncryptionKey.
+var keyCipher cipher.AEAD
+
+// SetKeyEncryptionKey sets the 32 bytes AES-256 key the signing keys are
+// encrypted with. It has to be called before a key is added or read.
+func SetKeyEncryptionKey(kek []byte) error {
+	if len(kek) != 32 {
+		return fmt.Errorf("key encryption key must be 32 bytes, got %d", len(kek))
+	}
+
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return fmt.Errorf("failed to create key cipher, err: %v", err)
+	}
+	keyCipher, err = cipher.NewGCM(block)
+	if err != nil {
+		return fmt.Errorf("failed to create key cipher, err: %v", err)
+	}
+
+	return nil
+}
+
+// EncryptPrivateKey seals the stored form of a key with AES-GCM, the nonce
+// goes in front. The kid is authenticated with it, so an encrypted key can't
+// be copied to the row of another kid.
+func EncryptPrivateKey(der []byte, kid string) ([]byte, error) {
+	if keyCipher == nil {
+		return nil, errors.New("key encryption key is not set")
+	}
+
+	nonce := make([]byte, keyCipher.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce, err: %v", err)
+	}
+
+	return keyCipher.Seal(nonce, nonce, der, []byte(kid)), nil
+}
+
+// DecryptPrivateKey opens a key sealed by EncryptPrivateKey for kid.
+func DecryptPrivateKey(data []byte, kid string) ([]byte, error) {
+	if keyCipher == nil {
+		return nil, errors.New("key encryption key is not set")
+	}
+	if len(data) < keyCipher.NonceSize() {
+		return nil, errors.New("encrypted key is too short")
+	}
+
+	nonce, sealed := data[:keyCipher.NonceSize()], data[keyCipher.NonceSize():]
+	plain, err := keyCipher.Open(nil, nonce, sealed, []byte(kid))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt key, err: %v", err)
 	}
+
+	return plain, nil
+}
+
+// JwtInit adds a signing key of alg when there is no active one, later keys
+// are added by rotating.
+func JwtInit(conn *pgxpool.Pool, ctx context.Context, alg signer.Algorithm) {
+	isExists, err := activeKeyExists(conn, ctx)
 	if err != nil {
 		log.Println(err)
+		return
+	}
+	if !isExists {
+		jwtSetPrivKey(conn, ctx, alg)
+		return
 	}
 
 	log.Println("private key already created")
+
+	var activeAlg signer.Algorithm
+	err = conn.QueryRow(ctx, `SELECT algorithm FROM jwt_signing_keys
+		WHERE activates_at <= NOW()
+		AND (retires_at IS NULL OR retires_at > NOW())
+		ORDER BY activates_at DESC, id DESC
+		LIMIT 1`).Scan(&activeAlg)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if activeAlg != alg {
+		log.Printf("tokens are signed with %s instead of %s, run make rotate-key to switch", activeAlg, alg)
+	}
+
+	var plaintext int
+	err = conn.QueryRow(ctx, "SELECT COUNT(*) FROM jwt_signing_keys WHERE NOT encrypted").Scan(&plaintext)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if plaintext > 0 {
+		log.Printf("%d signing keys are stored unencrypted, run make encrypt-keys", plaintext)
+	}
 }
 
-func loadKey(conn *pgxpool.Pool, ctx context.Context) (key *rsa.PrivateKey, err error) {
-	q := "select private_key from sec_m"
-	var keyBytes []byte
-	rows := conn.QueryRow(ctx, q)
-	rows.Scan(&keyBytes)
-	if keyBytes == nil {
-		return nil, err
+func activeKeyExists(conn *pgxpool.Pool, ctx context.Context) (isExists bool, err error) {
+	q := `SELECT EXISTS(
+		SELECT 1 FROM jwt_signing_keys
+		WHERE activates_at <= NOW()
+		AND (retires_at IS NULL OR retires_at > NOW())
+	)`
+	err = conn.QueryRow(ctx, q).Scan(&isExists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check signing key, err: %v", err)
 	}
 
-	return x509.ParsePKCS1PrivateKey(keyBytes)
+	return isExists, nil
 }
 
-func jwtSetPrivKey(conn *pgxpool.Pool, ctx context.Context) {
+func jwtSetPrivKey(conn *pgxpool.Pool, ctx context.Context, alg signer.Algorithm) {
 	log.Println("Set private key for jwt")
-	privateKeyTest := generatePrivateKey()
-	err := insertKeyToDatabase(privateKeyTest, conn, ctx)
+	kid, privateKeyTest, err := GenerateSigningKey(alg)
+	if err != nil {
+		log.Println("--- [error](JwtSetPrivKey) Failed to generate private key, msg:", err)
+		return
+	}
+	err = insertKeyToDatabase(kid, privateKeyTest, conn, ctx)
 	if err != nil {
 		log.Println("--- [error](JwtSetPrivKey) Failed to insert private key to database, msg:", err)
 	}
 }
 
-func generatePrivateKey() *rsa.PrivateKey {
+// GenerateSigningKey returns a new key of alg for signing tokens and the kid
+// tokens signed with it carry.
+func GenerateSigningKey(alg signer.Algorithm) (kid string, privKey signer.Signer, err error) {
 	log.Println("<- generate private key")
-	privKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	privKey, err = signer.Generate(alg)
 	if err != nil {
-		log.Println("--- [error](GeneratePrivateKey) :", err)
+		return "", nil, fmt.Errorf("failed to generate private key, err: %v", err)
+	}
+
+	id := make([]byte, 16)
+	if _, err = rand.Read(id); err != nil {
+		return "", nil, fmt.Errorf("failed to generate kid, err: %v", err)
 	}
 	log.Println("-> generate private key is done")
-	return privKey
+
+	return hex.EncodeToString(id), privKey, nil
 }
 
-func insertKeyToDatabase(privateKey *rsa.PrivateKey, conn *pgxpool.Pool, ctx context.Context) (err error) {
-	query := "INSERT INTO sec_m(private_key) VALUES($1);"
+func insertKeyToDatabase(kid string, privateKey signer.Signer, conn *pgxpool.Pool, ctx context.Context) (err error) {
+	query := "INSERT INTO jwt_signing_keys(kid, algorithm, private_key, encrypted) VALUES($1, $2, $3, TRUE);"
 
-	newKeyInbyte := x509.MarshalPKCS1PrivateKey(privateKey)
+	der, err := privateKey.MarshalPrivateKey()
+	if err != nil {
+		return err
+	}
+	newKeyInbyte, err := EncryptPrivateKey(der, kid)
+	if err != nil {
+		return err
+	}
 
-	res, err := conn.Exec(ctx, query, newKeyInbyte)
+	res, err := conn.Exec(ctx, query, kid, privateKey.Algorithm(), newKeyInbyte)
 	if err != nil {
 		log.Println(err.Error())
 		return err
@@ -0,0 +1,66 @@
+package password
+
+import (
+	"crypto/rand"
+	"testing"
+
+	signer "github.com/dwiw96/GoCommerceAPI/pkg/utils/signer"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptPrivateKey(t *testing.T) {
+	err := SetKeyEncryptionKey([]byte("short"))
+	require.Error(t, err)
+
+	kek := make([]byte, 32)
+	_, err = rand.Read(kek)
+	require.NoError(t, err)
+	err = SetKeyEncryptionKey(kek)
+	require.NoError(t, err)
+
+	kid, key, err := GenerateSigningKey(signer.EdDSA)
+	require.NoError(t, err)
+	assert.Len(t, kid, 32)
+	assert.Equal(t, signer.EdDSA, key.Algorithm())
+
+	der, err := key.MarshalPrivateKey()
+	require.NoError(t, err)
+	encrypted, err := EncryptPrivateKey(der, kid)
+	require.NoError(t, err)
+	assert.NotContains(t, string(encrypted), string(der))
+
+	t.Run("success", func(t *testing.T) {
+		res, err := DecryptPrivateKey(encrypted, kid)
+		require.NoError(t, err)
+		assert.Equal(t, der, res)
+	})
+
+	t.Run("failed_other_kid", func(t *testing.T) {
+		_, err := DecryptPrivateKey(encrypted, "other")
+		require.Error(t, err)
+	})
+
+	t.Run("failed_other_kek", func(t *testing.T) {
+		otherKek := make([]byte, 32)
+		_, err := rand.Read(otherKek)
+		require.NoError(t, err)
+		err = SetKeyEncryptionKey(otherKek)
+		require.NoError(t, err)
+		defer SetKeyEncryptionKey(kek)
+
+		_, err = DecryptPrivateKey(encrypted, kid)
+		require.Error(t, err)
+	})
+
+	t.Run("failed_not_set", func(t *testing.T) {
+		keyCipher = nil
+		defer SetKeyEncryptionKey(kek)
+
+		_, err = EncryptPrivateKey(der, kid)
+		require.Error(t, err)
+		_, err = DecryptPrivateKey(encrypted, kid)
+		require.Error(t, err)
+	})
+}
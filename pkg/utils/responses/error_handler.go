@@ -11,7 +11,10 @@ var (
 	CodeFailedUser         = 400 // 400, Bad Request
 	CodeFailedValidation   = 422 // 422, Unprocessably Entity
 	CodeFailedUnauthorized = 401 // 401, Unauthorized
+	CodeFailedForbidden    = 403 // 403, Forbidden
 	CodeFailedDuplicated   = 409 // 409, Conflict
+
+	CodeFailedTooManyRequests = 429 // 429, Too Many Requests
 )
 
 var (
@@ -26,4 +29,52 @@ var (
 	ErrInsufficientBalance = errors.New("balance is insufficient")       // balance is insufficient
 	ErrInsufficientStock   = errors.New("product stock is insufficient") // product stock is insufficient
 	ErrBalanceLessThanZero = errors.New("balance minimum is 0")          // balance minimum is 0
+	ErrEmptyCart           = errors.New("cart is empty")                 // cart is empty
+
+	ErrInvalidStatusTransition = errors.New("order status transition is not allowed") // order status transition is not allowed
+
+	ErrNotRefundable         = errors.New("transaction can't be refunded")              // transaction can't be refunded
+	ErrRefundExceedsPurchase = errors.New("refund quantity exceeds purchased quantity") // refund quantity exceeds purchased quantity
+
+	ErrIdempotencyKeyReused  = errors.New("idempotency key is already used for a different request") // idempotency key is already used for a different request
+	ErrIdempotencyInProgress = errors.New("request with this idempotency key is still in progress")  // request with this idempotency key is still in progress
+
+	ErrUnbalancedJournal = errors.New("ledger debits and credits are not equal") // ledger debits and credits are not equal
+
+	ErrForbidden      = errors.New("access is not allowed")          // access is not allowed
+	ErrRateNotFound   = errors.New("exchange rate is not found")     // exchange rate is not found
+	ErrAmountTooSmall = errors.New("amount is too small to convert") // amount is too small to convert
+
+	ErrCartCurrencyRequired = errors.New("cart has products in several currencies, pick the wallet currency") // cart has products in several currencies, pick the wallet currency
+
+	ErrEmailNotVerified         = errors.New("email is not verified")                    // email is not verified
+	ErrAlreadyVerified          = errors.New("email is already verified")                // email is already verified
+	ErrInvalidVerificationToken = errors.New("verification token is invalid or expired") // verification token is invalid or expired
+	ErrTooManyRequests          = errors.New("too many requests, try again later")       // too many requests, try again later
+	ErrInvalidResetToken        = errors.New("reset token is invalid or expired")        // reset token is invalid or expired
+
+	ErrRefreshTokenReused = errors.New("refresh token was already used, the session is revoked") // refresh token was already used, the session is revoked
+
+	ErrInvalidCredentials   = errors.New("email or password is wrong")                       // email or password is wrong
+	ErrTooManyLoginAttempts = errors.New("too many failed log in attempts, try again later") // too many failed log in attempts, try again later
+
+	ErrTOTPRequired       = errors.New("a totp code is required for this amount") // a totp code is required for this amount
+	ErrInvalidTOTPCode    = errors.New("totp code is wrong")                      // totp code is wrong
+	ErrTOTPAlreadyEnabled = errors.New("totp is already enabled")                 // totp is already enabled
+	ErrTOTPNotEnrolled    = errors.New("totp is not enrolled")                    // totp is not enrolled
+	ErrInvalidMFAToken    = errors.New("mfa token is not valid")                  // mfa token is not valid
+
+	ErrInvalidAPIKey       = errors.New("api key is invalid or expired")                     // api key is invalid or expired
+	ErrAPIKeyScope         = errors.New("api key doesn't have the scope for this request")   // api key doesn't have the scope for this request
+	ErrAPIKeyNotAllowed    = errors.New("api keys can't be used on this route")              // api keys can't be used on this route
+	ErrInvalidAPIKeyScope  = errors.New("scope must be <resource>:read or <resource>:write") // scope must be <resource>:read or <resource>:write
+	ErrInvalidAPIKeyExpiry = errors.New("expires_at must be in the future")                  // expires_at must be in the future
+
+	ErrUnknownOIDCProvider  = errors.New("unknown login provider")                                                              // unknown login provider
+	ErrInvalidOIDCState     = errors.New("login request is invalid or expired, start again")                                    // login request is invalid or expired, start again
+	ErrOIDCLogin            = errors.New("failed to log in with the provider")                                                  // failed to log in with the provider
+	ErrOIDCEmailNotVerified = errors.New("the provider hasn't verified the email")                                              // the provider hasn't verified the email
+	ErrOIDCEmailInUse       = errors.New("email belongs to an unverified account, verify it before logging in with a provider") // email belongs to an unverified account, verify it before logging in with a provider
+
+	ErrSessionExpired = errors.New("session expired, log in again") // session expired, log in again
 )
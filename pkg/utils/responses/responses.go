@@ -79,6 +79,20 @@ func SuccessWithDataResponsePagination(data interface{}, currentPage, totalPage
 	}
 }
 
+func SuccessWithDataResponseCursor(data interface{}, nextCursor string, msg string) map[string]interface{} {
+	return map[string]interface{}{
+		"error_message": "",
+		"result":        "success",
+		"value":         data,
+		"pagination": map[string]interface{}{
+			"next_cursor": nextCursor,
+			"has_more":    nextCursor != "",
+		},
+		"description": msg,
+		"execute_at":  time.Now().UTC().Add(time.Hour * 9).Format("2006/01/02 15:04:05.000"),
+	}
+}
+
 func SuccessResponse(msg string) map[string]interface{} {
 	return map[string]interface{}{
 		"error_message": "",
@@ -0,0 +1,291 @@
+// Package signer signs and verifies tokens with the algorithms the API
+// supports. Every algorithm has its own Signer, tokens name the algorithm in
+// the alg header so keys of different algorithms can be trusted at once while
+// moving from one to another.
+package signer
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type Algorithm string
+
+const (
+	RS256 Algorithm = "RS256"
+	ES256 Algorithm = "ES256"
+	EdDSA Algorithm = "EdDSA"
+)
+
+// Algorithms are the algorithms tokens may be signed with.
+var Algorithms = []string{string(RS256), string(ES256), string(EdDSA)}
+
+// ParseAlgorithm returns the algorithm named s.
+func ParseAlgorithm(s string) (Algorithm, error) {
+	switch alg := Algorithm(s); alg {
+	case RS256, ES256, EdDSA:
+		return alg, nil
+	}
+
+	return "", fmt.Errorf("unknown signing algorithm: %s", s)
+}
+
+// JWK is the public half of a key as RFC 7517 puts it, only the fields of its
+// key type are set.
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// PublicKey decodes the key, it is how keys published by another issuer are
+// read back.
+func (k JWK) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if len(n) == 0 || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid RSA key %s", k.Kid)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, fmt.Errorf("invalid EC key %s", k.Kid)
+		}
+		return key, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid OKP key %s", k.Kid)
+		}
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
+
+// Verifier checks the tokens signed with one key.
+type Verifier interface {
+	Algorithm() Algorithm
+	Method() jwt.SigningMethod
+	// PublicKey is the key in the form jwt verifies with.
+	PublicKey() crypto.PublicKey
+	JWK(kid string) JWK
+}
+
+// Signer signs tokens with one key.
+type Signer interface {
+	Verifier
+	// Sign returns the signed token, kid goes in its header when it's set.
+	Sign(claims jwt.Claims, kid string) (string, error)
+	// MarshalPrivateKey is the private key as it's stored, PKCS#1 for RSA
+	// like the keys from before other algorithms and PKCS#8 for the others.
+	MarshalPrivateKey() ([]byte, error)
+}
+
+// Generate returns a signer with a new key.
+func Generate(alg Algorithm) (Signer, error) {
+	switch alg {
+	case RS256:
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate rsa key, err: %v", err)
+		}
+		return &rsaSigner{key: key}, nil
+	case ES256:
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate ecdsa key, err: %v", err)
+		}
+		return &ecdsaSigner{key: key}, nil
+	case EdDSA:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate ed25519 key, err: %v", err)
+		}
+		return &ed25519Signer{key: key}, nil
+	}
+
+	return nil, fmt.Errorf("unknown signing algorithm: %s", alg)
+}
+
+// Parse returns the signer of a key stored by MarshalPrivateKey.
+func Parse(alg Algorithm, der []byte) (Signer, error) {
+	if alg == RS256 {
+		key, err := x509.ParsePKCS1PrivateKey(der)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse rsa key, err: %v", err)
+		}
+		return &rsaSigner{key: key}, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s key, err: %v", alg, err)
+	}
+
+	switch key := parsed.(type) {
+	case *ecdsa.PrivateKey:
+		if alg == ES256 && key.Curve == elliptic.P256() {
+			return &ecdsaSigner{key: key}, nil
+		}
+	case ed25519.PrivateKey:
+		if alg == EdDSA {
+			return &ed25519Signer{key: key}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("key is not a %s key", alg)
+}
+
+func sign(s Signer, key crypto.PrivateKey, claims jwt.Claims, kid string) (string, error) {
+	t := jwt.NewWithClaims(s.Method(), claims)
+	if kid != "" {
+		t.Header["kid"] = kid
+	}
+
+	return t.SignedString(key)
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decode(s string) ([]byte, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode key, err: %w", err)
+	}
+
+	return b, nil
+}
+
+type rsaSigner struct {
+	key *rsa.PrivateKey
+}
+
+func (s *rsaSigner) Algorithm() Algorithm        { return RS256 }
+func (s *rsaSigner) Method() jwt.SigningMethod   { return jwt.SigningMethodRS256 }
+func (s *rsaSigner) PublicKey() crypto.PublicKey { return &s.key.PublicKey }
+
+func (s *rsaSigner) JWK(kid string) JWK {
+	return JWK{
+		Kty: "RSA",
+		Use: "sig",
+		Alg: string(RS256),
+		Kid: kid,
+		N:   encode(s.key.N.Bytes()),
+		E:   encode(big.NewInt(int64(s.key.E)).Bytes()),
+	}
+}
+
+func (s *rsaSigner) Sign(claims jwt.Claims, kid string) (string, error) {
+	return sign(s, s.key, claims, kid)
+}
+
+func (s *rsaSigner) MarshalPrivateKey() ([]byte, error) {
+	return x509.MarshalPKCS1PrivateKey(s.key), nil
+}
+
+type ecdsaSigner struct {
+	key *ecdsa.PrivateKey
+}
+
+func (s *ecdsaSigner) Algorithm() Algorithm        { return ES256 }
+func (s *ecdsaSigner) Method() jwt.SigningMethod   { return jwt.SigningMethodES256 }
+func (s *ecdsaSigner) PublicKey() crypto.PublicKey { return &s.key.PublicKey }
+
+func (s *ecdsaSigner) JWK(kid string) JWK {
+	// the coordinates are padded to the size of the curve, RFC 7518 6.2.1.2
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+
+	return JWK{
+		Kty: "EC",
+		Use: "sig",
+		Alg: string(ES256),
+		Kid: kid,
+		Crv: "P-256",
+		X:   encode(s.key.X.FillBytes(x)),
+		Y:   encode(s.key.Y.FillBytes(y)),
+	}
+}
+
+func (s *ecdsaSigner) Sign(claims jwt.Claims, kid string) (string, error) {
+	return sign(s, s.key, claims, kid)
+}
+
+func (s *ecdsaSigner) MarshalPrivateKey() ([]byte, error) {
+	return x509.MarshalPKCS8PrivateKey(s.key)
+}
+
+type ed25519Signer struct {
+	key ed25519.PrivateKey
+}
+
+func (s *ed25519Signer) Algorithm() Algorithm      { return EdDSA }
+func (s *ed25519Signer) Method() jwt.SigningMethod { return jwt.SigningMethodEdDSA }
+func (s *ed25519Signer) PublicKey() crypto.PublicKey {
+	return s.key.Public()
+}
+
+func (s *ed25519Signer) JWK(kid string) JWK {
+	return JWK{
+		Kty: "OKP",
+		Use: "sig",
+		Alg: string(EdDSA),
+		Kid: kid,
+		Crv: "Ed25519",
+		X:   encode(s.key.Public().(ed25519.PublicKey)),
+	}
+}
+
+func (s *ed25519Signer) Sign(claims jwt.Claims, kid string) (string, error) {
+	return sign(s, s.key, claims, kid)
+}
+
+func (s *ed25519Signer) MarshalPrivateKey() ([]byte, error) {
+	return x509.MarshalPKCS8PrivateKey(s.key)
+}
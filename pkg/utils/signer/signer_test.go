@@ -0,0 +1,112 @@
+package signer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAlgorithm(t *testing.T) {
+	for _, name := range Algorithms {
+		alg, err := ParseAlgorithm(name)
+		require.NoError(t, err)
+		assert.Equal(t, Algorithm(name), alg)
+	}
+
+	_, err := ParseAlgorithm("HS256")
+	require.Error(t, err)
+	_, err = ParseAlgorithm("")
+	require.Error(t, err)
+}
+
+func TestSigner(t *testing.T) {
+	testCases := []struct {
+		alg Algorithm
+		kty string
+		crv string
+	}{
+		{alg: RS256, kty: "RSA"},
+		{alg: ES256, kty: "EC", crv: "P-256"},
+		{alg: EdDSA, kty: "OKP", crv: "Ed25519"},
+	}
+	for _, tC := range testCases {
+		t.Run(string(tC.alg), func(t *testing.T) {
+			s, err := Generate(tC.alg)
+			require.NoError(t, err)
+			assert.Equal(t, tC.alg, s.Algorithm())
+			assert.Equal(t, string(tC.alg), s.Method().Alg())
+
+			claims := jwt.RegisteredClaims{Subject: "1", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))}
+			token, err := s.Sign(claims, "kid")
+			require.NoError(t, err)
+
+			keyFunc := func(*jwt.Token) (interface{}, error) { return s.PublicKey(), nil }
+			parsed, err := jwt.Parse(token, keyFunc, jwt.WithValidMethods([]string{string(tC.alg)}))
+			require.NoError(t, err)
+			assert.Equal(t, "kid", parsed.Header["kid"])
+
+			// the stored key signs tokens the first one verifies
+			der, err := s.MarshalPrivateKey()
+			require.NoError(t, err)
+			parsedSigner, err := Parse(tC.alg, der)
+			require.NoError(t, err)
+			token, err = parsedSigner.Sign(claims, "")
+			require.NoError(t, err)
+			parsed, err = jwt.Parse(token, keyFunc)
+			require.NoError(t, err)
+			assert.NotContains(t, parsed.Header, "kid")
+
+			jwk := s.JWK("kid")
+			assert.Equal(t, tC.kty, jwk.Kty)
+			assert.Equal(t, tC.crv, jwk.Crv)
+			assert.Equal(t, string(tC.alg), jwk.Alg)
+			assert.Equal(t, "sig", jwk.Use)
+			assert.Equal(t, "kid", jwk.Kid)
+			if tC.kty == "RSA" {
+				assert.NotEmpty(t, jwk.N)
+				assert.Equal(t, "AQAB", jwk.E)
+			} else {
+				// 32 bytes base64url encoded
+				assert.Len(t, jwk.X, 43)
+			}
+			if tC.kty == "EC" {
+				assert.Len(t, jwk.Y, 43)
+			}
+
+			pub, err := jwk.PublicKey()
+			require.NoError(t, err)
+			assert.Equal(t, s.PublicKey(), pub)
+		})
+	}
+
+	t.Run("failed_other_algorithm", func(t *testing.T) {
+		s, err := Generate(ES256)
+		require.NoError(t, err)
+		der, err := s.MarshalPrivateKey()
+		require.NoError(t, err)
+
+		_, err = Parse(EdDSA, der)
+		require.Error(t, err)
+		_, err = Parse(RS256, der)
+		require.Error(t, err)
+	})
+
+	t.Run("failed_invalid_jwk", func(t *testing.T) {
+		_, err := JWK{Kty: "oct"}.PublicKey()
+		require.Error(t, err)
+		_, err = JWK{Kty: "EC", Crv: "P-384"}.PublicKey()
+		require.Error(t, err)
+		_, err = JWK{Kty: "EC", Crv: "P-256", X: "AQ", Y: "AQ"}.PublicKey()
+		require.Error(t, err)
+		_, err = JWK{Kty: "OKP", Crv: "Ed25519", X: "AQ"}.PublicKey()
+		require.Error(t, err)
+	})
+
+	t.Run("failed_unknown_algorithm", func(t *testing.T) {
+		_, err := Generate("HS256")
+		require.Error(t, err)
+	})
+}
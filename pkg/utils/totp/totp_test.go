@@ -0,0 +1,92 @@
+package totp
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// the SHA1 vectors of RFC 6238 appendix B, cut to 6 digits
+func TestCode(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	testCases := []struct {
+		unix int64
+		code string
+	}{
+		{unix: 59, code: "287082"},
+		{unix: 1111111109, code: "081804"},
+		{unix: 1111111111, code: "050471"},
+		{unix: 1234567890, code: "005924"},
+		{unix: 2000000000, code: "279037"},
+		{unix: 20000000000, code: "353130"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.code, func(t *testing.T) {
+			code, err := Code(secret, Step(time.Unix(tC.unix, 0)))
+			require.NoError(t, err)
+			assert.Equal(t, tC.code, code)
+		})
+	}
+
+	_, err := Code("not base32!", 1)
+	require.Error(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+	assert.Len(t, secret, 32)
+
+	now := time.Now()
+	code, err := Code(secret, Step(now))
+	require.NoError(t, err)
+
+	step, ok := Validate(secret, code, now)
+	assert.True(t, ok)
+	assert.Equal(t, Step(now), step)
+
+	// a code from the period before is still taken
+	previous, err := Code(secret, Step(now)-1)
+	require.NoError(t, err)
+	step, ok = Validate(secret, previous, now)
+	assert.True(t, ok)
+	assert.Equal(t, Step(now)-1, step)
+
+	t.Run("failed_expired", func(t *testing.T) {
+		_, ok := Validate(secret, code, now.Add(3*Period))
+		assert.False(t, ok)
+	})
+
+	t.Run("failed_other_secret", func(t *testing.T) {
+		other, err := GenerateSecret()
+		require.NoError(t, err)
+		_, ok := Validate(other, code, now)
+		assert.False(t, ok)
+	})
+
+	t.Run("failed_length", func(t *testing.T) {
+		_, ok := Validate(secret, code+"0", now)
+		assert.False(t, ok)
+		_, ok = Validate(secret, "", now)
+		assert.False(t, ok)
+	})
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("GoCommerceAPI", "john@mail.com", "JBSWY3DPEHPK3PXP")
+
+	parsed, err := url.Parse(uri)
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", parsed.Scheme)
+	assert.Equal(t, "totp", parsed.Host)
+	assert.Equal(t, "/GoCommerceAPI:john@mail.com", parsed.Path)
+	assert.Equal(t, "JBSWY3DPEHPK3PXP", parsed.Query().Get("secret"))
+	assert.Equal(t, "GoCommerceAPI", parsed.Query().Get("issuer"))
+	assert.Equal(t, "6", parsed.Query().Get("digits"))
+	assert.Equal(t, "30", parsed.Query().Get("period"))
+}
@@ -7,10 +7,16 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func SetupRouter() *gin.Engine {
+// SetupRouter returns the router, the client ip is only read from
+// X-Forwarded-For when the request comes from one of trustedProxies. With none
+// it's the ip the request came from, so a client can't pick its own ip.
+func SetupRouter(trustedProxies []string) *gin.Engine {
 	log.Println("<- SetupRouter()")
 
 	router := gin.Default()
+	if err := router.SetTrustedProxies(trustedProxies); err != nil {
+		log.Fatal("set trusted proxies, err:", err)
+	}
 
 	log.Println("-> SetupRouter()")
 	return router
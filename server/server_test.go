@@ -1,12 +1,48 @@
 package api
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 func TestSetupRouter(t *testing.T) {
-	router := SetupRouter()
+	router := SetupRouter(nil)
 	require.NotNil(t, router)
 }
+
+// TestSetupRouterClientIP checks the ip the log in throttle counts, a client
+// sending X-Forwarded-For must not get a new ip with every request.
+func TestSetupRouterClientIP(t *testing.T) {
+	clientIP := func(router *gin.Engine, remoteAddr, forwardedFor string) string {
+		router.GET("/ip", func(c *gin.Context) {
+			c.String(http.StatusOK, c.ClientIP())
+		})
+		req := httptest.NewRequest(http.MethodGet, "/ip", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+
+	t.Run("spoofed_header_ignored", func(t *testing.T) {
+		for _, spoofed := range []string{"1.2.3.4", "5.6.7.8"} {
+			assert.Equal(t, "203.0.113.7", clientIP(SetupRouter(nil), "203.0.113.7:4000", spoofed))
+		}
+	})
+
+	t.Run("trusted_proxy", func(t *testing.T) {
+		router := SetupRouter([]string{"10.0.0.0/8"})
+		assert.Equal(t, "1.2.3.4", clientIP(router, "10.1.2.3:4000", "1.2.3.4"))
+	})
+
+	t.Run("untrusted_proxy", func(t *testing.T) {
+		router := SetupRouter([]string{"10.0.0.0/8"})
+		assert.Equal(t, "203.0.113.7", clientIP(router, "203.0.113.7:4000", "1.2.3.4"))
+	})
+}
@@ -12,6 +12,7 @@ import (
 
 	cfg "github.com/dwiw96/GoCommerceAPI/config"
 	pg "github.com/dwiw96/GoCommerceAPI/pkg/driver/postgresql"
+	password "github.com/dwiw96/GoCommerceAPI/pkg/utils/password"
 
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/pgx/v5"
@@ -32,6 +33,7 @@ func GetPool() *pgxpool.Pool {
 		os.Setenv("DB_HOST", "localhost")
 		os.Setenv("DB_PORT", "5432")
 		os.Setenv("DB_NAME", "commerce_main_db")
+		setTestKeyEncryptionKey()
 
 		env := &cfg.EnvConfig{
 			DB_USERNAME: os.Getenv("DB_USERNAME"),
@@ -47,6 +49,28 @@ func GetPool() *pgxpool.Pool {
 	return pool
 }
 
+// testKeyEncryptionKey is only for the test database, .env ships without a
+// key so every deployment has to generate its own.
+const testKeyEncryptionKey = "dGVzdC1vbmx5LWtleS1lbmNyeXB0aW9uLWtleS0zMmI="
+
+// setTestKeyEncryptionKey puts the test key in the env when none is set, the
+// env config can't be read without one.
+func setTestKeyEncryptionKey() {
+	if os.Getenv("JWT_KEY_ENCRYPTION_KEY") == "" && os.Getenv("JWT_KEY_ENCRYPTION_KEY_FILE") == "" {
+		os.Setenv("JWT_KEY_ENCRYPTION_KEY", testKeyEncryptionKey)
+	}
+}
+
+// SetKeyEncryptionKey sets the key encryption key from the env, the signing
+// keys can't be added or read without it.
+func SetKeyEncryptionKey() {
+	setTestKeyEncryptionKey()
+	err := password.SetKeyEncryptionKey(cfg.GetEnvConfig().JWT_KEY_ENCRYPTION_KEY)
+	if err != nil {
+		log.Fatal("set key encryption key, err:", err)
+	}
+}
+
 func ClosePool() {
 	if pool != nil {
 		pool.Close()
@@ -83,6 +107,7 @@ func SetupDB(schemaName string) func() {
 		log.Fatalf("error while switching to schema. err: %v", err)
 	}
 
+	setTestKeyEncryptionKey()
 	env := cfg.GetEnvConfig()
 	_, b, _, _ := runtime.Caller(0)
 	basePath := filepath.Dir(b)
@@ -126,7 +151,22 @@ func DeleteSchemaTestData(pool *pgxpool.Pool) error {
 		wallets,
 		users,
 		transaction_histories,
-		products
+		products,
+		carts,
+		cart_items,
+		orders,
+		order_items,
+		ledger_journals,
+		ledger_entries,
+		exchange_rates,
+		password_reset_tokens,
+		user_addresses,
+		refresh_token_rotations,
+		auth_audit_logs,
+		user_totp,
+		mfa_recovery_codes,
+		api_keys,
+		identities
 	RESTART IDENTITY CASCADE;
 	`
 	_, err = tx.Exec(ctx, query)